@@ -0,0 +1,202 @@
+package changelog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
+	"github.com/holydocs/messageflow/pkg/docs"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+type Command struct {
+	cmd *cobra.Command
+}
+
+// NewCommand creates a new changelog command
+func NewCommand() *Command {
+	c := &Command{}
+
+	c.cmd = &cobra.Command{
+		Use:   "changelog",
+		Short: "Print changes between stored documentation metadata and AsyncAPI files",
+		Long: `Compare the schema stored in messageflow.json by a previous gen-docs run with the schema
+of the current AsyncAPI files and print the changelog without generating documentation.
+With --base-ref, messageflow.json is read from the git ref instead of the working tree, e.g. to compare
+a feature branch against the documentation committed on main. When it doesn't exist on the ref,
+all of the schema is reported as added.
+
+Example:
+  messageflow changelog --asyncapi-files asyncapi1.yaml,asyncapi2.yaml --metadata-dir ./docs --fail-on-breaking
+  messageflow changelog --asyncapi-files asyncapi1.yaml,asyncapi2.yaml --metadata-dir ./docs --base-ref main`,
+		RunE: c.run,
+	}
+
+	c.cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+	c.cmd.Flags().String("metadata-dir", ".", "Directory containing messageflow.json of a previous gen-docs run")
+	c.cmd.Flags().String("base-ref", "", "Git ref, e.g. main, to read messageflow.json of metadata-dir from instead of the working tree")
+	c.cmd.Flags().String("format", "markdown", "Output format (markdown, json)")
+	cmdutil.AddIgnoreFileFlag(c.cmd)
+	c.cmd.Flags().String("diff-format", "cmp", "Format of message diffs (cmp, unified)")
+	c.cmd.Flags().Bool("fail-on-breaking", false, "Exit with an error if breaking changes are detected")
+
+	// Mark required flags
+	err := c.cmd.MarkFlagRequired("asyncapi-files")
+	if err != nil {
+		log.Fatalf("error marking asyncapi-files flag as required: %v", err)
+	}
+
+	return c
+}
+
+// GetCommand returns the cobra command
+func (c *Command) GetCommand() *cobra.Command {
+	return c.cmd
+}
+
+// run executes the changelog command
+func (c *Command) run(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	metadataDir, err := cmd.Flags().GetString("metadata-dir")
+	if err != nil {
+		return fmt.Errorf("error getting metadata-dir flag: %w", err)
+	}
+
+	baseRef, err := cmd.Flags().GetString("base-ref")
+	if err != nil {
+		return fmt.Errorf("error getting base-ref flag: %w", err)
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("error getting format flag: %w", err)
+	}
+
+	failOnBreaking, err := cmd.Flags().GetBool("fail-on-breaking")
+	if err != nil {
+		return fmt.Errorf("error getting fail-on-breaking flag: %w", err)
+	}
+
+	diffFormat, err := cmd.Flags().GetString("diff-format")
+	if err != nil {
+		return fmt.Errorf("error getting diff-format flag: %w", err)
+	}
+
+	ignorePatterns, err := cmdutil.IgnorePatterns(cmd)
+	if err != nil {
+		return err
+	}
+
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	if df := messageflow.DiffFormat(diffFormat); df != messageflow.DiffFormatCmp && df != messageflow.DiffFormatUnified {
+		return fmt.Errorf("unknown diff format: %s", diffFormat)
+	}
+
+	ctx := context.Background()
+
+	var metadata *docs.Metadata
+	if baseRef != "" {
+		metadata, err = docs.ReadMetadataAtRef(ctx, baseRef, metadataDir)
+		if err != nil {
+			return fmt.Errorf("error reading messageflow data at %s: %w", baseRef, err)
+		}
+
+		// A baseline missing on the ref is empty, so all of the schema is reported as added.
+		if metadata == nil {
+			metadata = &docs.Metadata{}
+		}
+	} else {
+		metadata, err = docs.ReadMetadata(metadataDir)
+		if err != nil {
+			return fmt.Errorf("error reading existing messageflow data: %w", err)
+		}
+
+		if metadata == nil {
+			return fmt.Errorf("messageflow.json not found in %s", metadataDir)
+		}
+	}
+
+	s, err := schema.Load(ctx, strings.Split(asyncAPIFilesPath, ","))
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	changelog := messageflow.CompareSchemas(metadata.Schema, s,
+		messageflow.WithDiffFormat(messageflow.DiffFormat(diffFormat)),
+		messageflow.WithIgnorePatterns(ignorePatterns...),
+	)
+
+	switch format {
+	case "json":
+		err = writeJSON(os.Stdout, changelog)
+	default:
+		err = writeMarkdown(os.Stdout, changelog)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing changelog: %w", err)
+	}
+
+	if breaking := changelog.BreakingChanges(); failOnBreaking && len(breaking) > 0 {
+		return fmt.Errorf("%d breaking change(s) detected", len(breaking))
+	}
+
+	return nil
+}
+
+// writeJSON writes the changelog as indented JSON.
+func writeJSON(w io.Writer, changelog messageflow.Changelog) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(changelog)
+}
+
+// writeMarkdown writes the changelog in the format used by the generated documentation.
+func writeMarkdown(w io.Writer, changelog messageflow.Changelog) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Changelog\n\n### %s\n\n", changelog.Date.Format("2006-01-02"))
+
+	if len(changelog.Changes) == 0 {
+		b.WriteString("- No changes detected\n")
+	}
+
+	for _, change := range changelog.Changes {
+		fmt.Fprintf(&b, "- **%s** %s: %s", change.Type, change.Category, change.Details)
+		if change.Severity() == messageflow.ChangeSeverityBreaking {
+			b.WriteString(" (breaking)")
+		}
+		b.WriteString("\n")
+
+		if change.Note != "" {
+			fmt.Fprintf(&b, "  > **Migration note:** %s\n", change.Note)
+		}
+
+		if change.Diff != "" {
+			language := "json"
+			if change.DiffFormat == messageflow.DiffFormatUnified {
+				language = "diff"
+			}
+
+			fmt.Fprintf(&b, "```%s\n%s\n```\n", language, change.Diff)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
@@ -2,19 +2,27 @@ package docs
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/holydocs/messageflow/internal/docs"
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
+	"github.com/holydocs/messageflow/pkg/docs"
+	"github.com/holydocs/messageflow/pkg/messageflow"
 	"github.com/holydocs/messageflow/pkg/schema"
-	"github.com/holydocs/messageflow/pkg/schema/target/d2"
+	"github.com/holydocs/messageflow/pkg/schema/target"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
+// exitCodeChanges is the exit code of gen-docs with --exit-on-change when changes were detected.
+const exitCodeChanges = 2
+
 type Command struct {
 	cmd *cobra.Command
 }
@@ -32,10 +40,44 @@ Example:
 		RunE: c.run,
 	}
 
+	c.cmd.AddCommand(newIndexCommand())
+
 	c.cmd.Flags().String("dir", "", "Path to dir to scan asyncapi files automatically")
 	c.cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
 	c.cmd.Flags().String("output", ".", "Output directory for generated documentation")
+	c.cmd.Flags().String("readme-name", "README.md", "File name of the generated README in the output directory")
+	c.cmd.Flags().String("diagrams-dir", "diagrams", "Subdirectory of the output directory the diagrams are written to, e.g. assets/diagrams")
 	c.cmd.Flags().String("title", "Message Flow", "Title of the documentation")
+	c.cmd.Flags().Bool("strict", false, "Fail on schema validation issues")
+	c.cmd.Flags().Bool("check-channel-payloads", false, "Report messages with different payloads in services sharing a channel as merge conflicts")
+	cmdutil.AddNameMapFlag(c.cmd)
+	cmdutil.AddValidateExamplesFlag(c.cmd)
+	c.cmd.Flags().String("env", "", "Document only channels available on the server of the environment, e.g. staging (channels without servers are available on all)")
+	c.cmd.Flags().String("target", "d2", fmt.Sprintf("Target rendering the diagrams (%s)", strings.Join(target.Names(), ", ")))
+	c.cmd.Flags().String("template-dir", "", "Directory with custom D2 templates overriding the embedded ones")
+	c.cmd.Flags().String("output-format", "markdown", "Documentation format (markdown, html generates index.html and pdf generates docs.pdf in addition to README.md)")
+	c.cmd.Flags().Bool("pdf", false, "Generate docs.pdf in addition to README.md, shorthand for --output-format pdf")
+	c.cmd.MarkFlagsMutuallyExclusive("pdf", "output-format")
+	c.cmd.Flags().Bool("force", false, "Render all diagrams instead of only those affected by schema changes")
+	c.cmd.Flags().Int("changelog-limit", 0, "Number of most recent changelogs kept in README, older ones are archived into CHANGELOG.md (0 keeps all)")
+	c.cmd.Flags().String("changelog-order", "desc", "Order of changelogs in README (desc lists the most recent first, asc chronologically)")
+	c.cmd.Flags().Int("concurrency", 0, "Maximum number of diagrams rendered concurrently (0 uses the number of CPUs)")
+	c.cmd.Flags().Bool("legend", false, "Add a legend explaining connection labels and line styles to the context diagram")
+	c.cmd.Flags().String("payload-style", "text", "Style of message payloads in channel diagrams (text shows JSON, tree shows nested tables)")
+	c.cmd.Flags().Bool("minify-svg", false, "Optimize generated SVG diagrams for size")
+	c.cmd.Flags().Bool("raw-payloads", false, "Keep message payloads as JSON schemas instead of flattened types")
+	c.cmd.Flags().Bool("payload-constraints", false, "Keep constraints of flattened payload fields, e.g. required fields and length limits")
+	cmdutil.AddIgnoreFileFlag(c.cmd)
+	c.cmd.Flags().String("diff-format", "cmp", "Format of message diffs in the changelog (cmp, unified)")
+	c.cmd.Flags().Bool("dry-run", false, "Report detected changes and files that would be written or deleted without touching them")
+	c.cmd.Flags().String("summary-file", "", "Path to write the run summary to as JSON")
+	c.cmd.Flags().StringArray("exclude-channel-pattern", nil, "Leave channels matching the glob out of the context and service diagrams, e.g. '*.dlq' (* matches any characters, repeatable)")
+	c.cmd.Flags().String("service-links", "", "URL template linking service nodes of the context diagram, {anchor} is replaced by the README anchor and {service} by the escaped service name, e.g. '../README.md#{anchor}'")
+	c.cmd.Flags().Bool("env-diagrams", false, "Render a context diagram per environment (server) into diagrams/ when channel availability differs across them")
+	c.cmd.Flags().Bool("inline-diagrams", false, "Embed diagrams into README.md and HTML as base64 data URIs instead of linking diagrams/ (not displayed by all markdown renderers)")
+	c.cmd.Flags().Bool("split-by-domain", false, "Write a README per service domain (x-domain) into domains/<domain>/ in addition to README.md")
+	c.cmd.Flags().Bool("quiet", false, "Print only errors, leaving out progress, warnings, detected changes and the summary")
+	c.cmd.Flags().Bool("exit-on-change", false, fmt.Sprintf("Exit with code %d when changes were detected, e.g. to commit regenerated docs in CI only then", exitCodeChanges))
 
 	return c
 }
@@ -51,6 +93,173 @@ func (c *Command) run(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("error getting title flag: %w", err)
 	}
 
+	strict, err := cmd.Flags().GetBool("strict")
+	if err != nil {
+		return fmt.Errorf("error getting strict flag: %w", err)
+	}
+
+	checkChannelPayloads, err := cmd.Flags().GetBool("check-channel-payloads")
+	if err != nil {
+		return fmt.Errorf("error getting check-channel-payloads flag: %w", err)
+	}
+
+	targetType, err := cmd.Flags().GetString("target")
+	if err != nil {
+		return fmt.Errorf("error getting target flag: %w", err)
+	}
+
+	templateDir, err := cmd.Flags().GetString("template-dir")
+	if err != nil {
+		return fmt.Errorf("error getting template-dir flag: %w", err)
+	}
+
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return fmt.Errorf("error getting force flag: %w", err)
+	}
+
+	outputFormat, err := cmd.Flags().GetString("output-format")
+	if err != nil {
+		return fmt.Errorf("error getting output-format flag: %w", err)
+	}
+
+	pdf, err := cmd.Flags().GetBool("pdf")
+	if err != nil {
+		return fmt.Errorf("error getting pdf flag: %w", err)
+	}
+
+	if pdf {
+		outputFormat = string(docs.OutputFormatPDF)
+	}
+
+	changelogLimit, err := cmd.Flags().GetInt("changelog-limit")
+	if err != nil {
+		return fmt.Errorf("error getting changelog-limit flag: %w", err)
+	}
+
+	changelogOrder, err := cmd.Flags().GetString("changelog-order")
+	if err != nil {
+		return fmt.Errorf("error getting changelog-order flag: %w", err)
+	}
+
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return fmt.Errorf("error getting concurrency flag: %w", err)
+	}
+
+	minifySVG, err := cmd.Flags().GetBool("minify-svg")
+	if err != nil {
+		return fmt.Errorf("error getting minify-svg flag: %w", err)
+	}
+
+	legend, err := cmd.Flags().GetBool("legend")
+	if err != nil {
+		return fmt.Errorf("error getting legend flag: %w", err)
+	}
+
+	payloadStyle, err := cmd.Flags().GetString("payload-style")
+	if err != nil {
+		return fmt.Errorf("error getting payload-style flag: %w", err)
+	}
+
+	rawPayloads, err := cmd.Flags().GetBool("raw-payloads")
+	if err != nil {
+		return fmt.Errorf("error getting raw-payloads flag: %w", err)
+	}
+
+	payloadConstraints, err := cmd.Flags().GetBool("payload-constraints")
+	if err != nil {
+		return fmt.Errorf("error getting payload-constraints flag: %w", err)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("error getting dry-run flag: %w", err)
+	}
+
+	diffFormat, err := cmd.Flags().GetString("diff-format")
+	if err != nil {
+		return fmt.Errorf("error getting diff-format flag: %w", err)
+	}
+
+	summaryFile, err := cmd.Flags().GetString("summary-file")
+	if err != nil {
+		return fmt.Errorf("error getting summary-file flag: %w", err)
+	}
+
+	exitOnChange, err := cmd.Flags().GetBool("exit-on-change")
+	if err != nil {
+		return fmt.Errorf("error getting exit-on-change flag: %w", err)
+	}
+
+	excludeChannelPatterns, err := cmd.Flags().GetStringArray("exclude-channel-pattern")
+	if err != nil {
+		return fmt.Errorf("error getting exclude-channel-pattern flag: %w", err)
+	}
+
+	splitByDomain, err := cmd.Flags().GetBool("split-by-domain")
+	if err != nil {
+		return fmt.Errorf("error getting split-by-domain flag: %w", err)
+	}
+
+	quiet, err := cmd.Flags().GetBool("quiet")
+	if err != nil {
+		return fmt.Errorf("error getting quiet flag: %w", err)
+	}
+
+	// Informational output goes to stderr, keeping stdout for the dry run report.
+	var info io.Writer = os.Stderr
+	if quiet {
+		info = io.Discard
+	}
+
+	envDiagrams, err := cmd.Flags().GetBool("env-diagrams")
+	if err != nil {
+		return fmt.Errorf("error getting env-diagrams flag: %w", err)
+	}
+
+	inlineDiagrams, err := cmd.Flags().GetBool("inline-diagrams")
+	if err != nil {
+		return fmt.Errorf("error getting inline-diagrams flag: %w", err)
+	}
+
+	serviceLinks, err := cmd.Flags().GetString("service-links")
+	if err != nil {
+		return fmt.Errorf("error getting service-links flag: %w", err)
+	}
+
+	readmeName, err := cmd.Flags().GetString("readme-name")
+	if err != nil {
+		return fmt.Errorf("error getting readme-name flag: %w", err)
+	}
+
+	diagramsDir, err := cmd.Flags().GetString("diagrams-dir")
+	if err != nil {
+		return fmt.Errorf("error getting diagrams-dir flag: %w", err)
+	}
+
+	ignorePatterns, err := cmdutil.IgnorePatterns(cmd)
+	if err != nil {
+		return err
+	}
+
+	nameMap, err := cmdutil.NameMap(cmd)
+	if err != nil {
+		return err
+	}
+
+	var exampleMismatches []string
+
+	validateExamples, err := cmdutil.ValidateExamplesOpt(cmd, &exampleMismatches)
+	if err != nil {
+		return err
+	}
+
+	env, err := cmd.Flags().GetString("env")
+	if err != nil {
+		return fmt.Errorf("error getting env flag: %w", err)
+	}
+
 	asyncAPIFilesPaths, err := getAsyncAPIFilesPaths(cmd)
 	if err != nil {
 		return fmt.Errorf("error getting asyncapi files paths: %w", err)
@@ -61,42 +270,167 @@ func (c *Command) run(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("error getting output flag: %w", err)
 	}
 
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("error creating output directory %s: %w", outputDir, err)
+	if !dryRun {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("error creating output directory %s: %w", outputDir, err)
+		}
 	}
 
 	ctx := context.Background()
 
-	s, err := schema.Load(ctx, asyncAPIFilesPaths)
+	s, conflicts, err := schema.LoadWithConflicts(
+		ctx,
+		asyncAPIFilesPaths,
+		schema.WithStrict(strict),
+		schema.WithRawPayloads(rawPayloads),
+		schema.WithPayloadConstraints(payloadConstraints),
+		schema.WithChannelConsistency(checkChannelPayloads),
+		schema.WithNameMap(nameMap),
+		schema.WithEnvironment(env),
+		schema.WithLogger(slog.Default()),
+		validateExamples,
+	)
 	if err != nil {
 		return fmt.Errorf("error loading schema from files: %w", err)
 	}
 
-	d2Target, err := d2.NewTarget()
+	cmdutil.ReportMergeConflicts(info, conflicts)
+	cmdutil.ReportExampleMismatches(info, exampleMismatches)
+
+	if err := cmdutil.ReportValidationIssues(info, messageflow.ValidateSchema(s), strict); err != nil {
+		return err
+	}
+
+	diagramTarget, err := target.New(targetType, target.Config{
+		TemplateDir:  templateDir,
+		MinifySVG:    minifySVG,
+		Legend:       legend,
+		PayloadStyle: payloadStyle,
+		Logger:       slog.Default(),
+	})
 	if err != nil {
-		return fmt.Errorf("error creating D2 target: %w", err)
+		return fmt.Errorf("error picking target: %w", err)
+	}
+
+	if caps := diagramTarget.Capabilities(); !caps.Format || !caps.Render {
+		return fmt.Errorf("target %s doesn't support rendering diagrams", targetType)
+	}
+
+	opts := []docs.Opt{
+		docs.WithForce(force),
+		docs.WithOutputFormat(docs.OutputFormat(outputFormat)),
+		docs.WithChangelogLimit(changelogLimit),
+		docs.WithChangelogOrder(docs.ChangelogOrder(changelogOrder)),
+		docs.WithConcurrency(concurrency),
+		docs.WithDiffFormat(messageflow.DiffFormat(diffFormat)),
+		docs.WithIgnorePatterns(ignorePatterns...),
+		docs.WithSplitByDomain(splitByDomain),
+		docs.WithInlineDiagrams(inlineDiagrams),
+		docs.WithEnvironmentDiagrams(envDiagrams),
+		docs.WithReadmeName(readmeName),
+		docs.WithDiagramsDir(diagramsDir),
+		docs.WithExcludeChannelPatterns(excludeChannelPatterns...),
+		docs.WithRenderSettings(fmt.Sprintf("target=%s template-dir=%s minify-svg=%t legend=%t payload-style=%s",
+			targetType, templateDir, minifySVG, legend, payloadStyle)),
+		docs.WithLogger(slog.Default()),
+	}
+
+	if !quiet {
+		opts = append(opts, docs.WithProgress(newProgressReporter(os.Stderr).report))
+	}
+
+	if serviceLinks != "" {
+		opts = append(opts, docs.WithServiceLinks(serviceLinkTemplate(serviceLinks)))
 	}
 
-	newChangelog, err := docs.Generate(ctx, s, d2Target, title, outputDir)
+	plan, err := docs.NewPlan(ctx, s, diagramTarget, title, outputDir, opts...)
 	if err != nil {
 		return fmt.Errorf("error generating documentation: %w", err)
 	}
 
-	fmt.Printf("Documentation generated successfully in: %s\n", outputDir)
+	if dryRun {
+		reportPlan(plan)
+	} else {
+		if err := plan.Apply(); err != nil {
+			return fmt.Errorf("error generating documentation: %w", err)
+		}
+
+		fmt.Fprintf(info, "Documentation generated successfully in: %s\n", outputDir)
+	}
 
-	if newChangelog != nil && len(newChangelog.Changes) > 0 {
-		fmt.Printf("\nNew Changes Detected:\n")
+	newChangelog := plan.Artifacts.Changelog
+	changesDetected := newChangelog != nil && len(newChangelog.Changes) > 0
+	if changesDetected {
+		fmt.Fprintf(info, "\nNew Changes Detected:\n")
 		for _, change := range newChangelog.Changes {
-			fmt.Printf("• %s %s: %s\n", change.Type, change.Category, change.Details)
+			fmt.Fprintf(info, "• %s %s: %s\n", change.Type, change.Category, change.Details)
 			if change.Diff != "" {
-				fmt.Println(change.Diff)
+				fmt.Fprintln(info, change.Diff)
 			}
 		}
 	}
 
+	reportSummary(info, plan.Artifacts.Summary)
+
+	if summaryFile != "" {
+		if err := writeSummary(summaryFile, plan.Artifacts.Summary); err != nil {
+			return err
+		}
+	}
+
+	// Detected changes aren't a failure, so only the exit code is returned.
+	if exitOnChange && changesDetected {
+		return &cmdutil.ExitError{Code: exitCodeChanges}
+	}
+
+	return nil
+}
+
+// reportSummary prints a one line summary of the run.
+func reportSummary(w io.Writer, summary docs.Summary) {
+	fmt.Fprintf(w, "\nSummary: %d services, %d channels, %d diagrams rendered (%d up to date) in %s, %d changes detected\n",
+		summary.Services, summary.Channels, summary.DiagramsRendered, summary.DiagramsReused,
+		summary.RenderTime.Round(time.Millisecond), summary.Changes)
+}
+
+// writeSummary writes the run summary as JSON.
+func writeSummary(path string, summary docs.Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling summary: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing summary to %s: %w", path, err)
+	}
+
 	return nil
 }
 
+// reportPlan prints files a dry run would write and delete.
+func reportPlan(plan *docs.Plan) {
+	fmt.Printf("Dry run, no files were changed.\n")
+
+	fmt.Printf("\nFiles To Write:\n")
+	for _, name := range plan.Write {
+		fmt.Printf("• %s\n", name)
+	}
+
+	if len(plan.Delete) > 0 {
+		fmt.Printf("\nFiles To Delete:\n")
+		for _, name := range plan.Delete {
+			fmt.Printf("• %s\n", name)
+		}
+	}
+}
+
+// serviceLinkTemplate builds service links replacing {anchor} and {service} placeholders of the template.
+func serviceLinkTemplate(template string) docs.ServiceLinkFunc {
+	return func(service, anchor string) string {
+		return strings.NewReplacer("{anchor}", anchor, "{service}", url.PathEscape(service)).Replace(template)
+	}
+}
+
 func getAsyncAPIFilesPaths(cmd *cobra.Command) ([]string, error) {
 	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
 	if err != nil {
@@ -120,50 +454,18 @@ func getAsyncAPIFilesPaths(cmd *cobra.Command) ([]string, error) {
 }
 
 func asyncAPIFilesFromDir(dir string) ([]string, error) {
-	fmt.Println("Scanning directory for AsyncAPI files:", dir)
-
-	var asyncAPIFiles []string
-
-	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if d.IsDir() {
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext != ".yml" && ext != ".yaml" {
-			return nil
-		}
-
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("error reading file %s: %w", path, err)
-		}
-
-		var yamlDoc map[string]interface{}
-		if err := yaml.Unmarshal(content, &yamlDoc); err != nil {
-			return fmt.Errorf("error unmarshalling yaml file %s: %w", path, err)
-		}
-
-		if _, hasAsyncAPI := yamlDoc["asyncapi"]; hasAsyncAPI {
-			asyncAPIFiles = append(asyncAPIFiles, path)
-		}
-
-		return nil
-	})
+	slog.Info("scanning directory for AsyncAPI files", slog.String("dir", dir))
 
+	asyncAPIFiles, err := schema.FindAsyncAPIFiles(dir)
 	if err != nil {
-		return nil, fmt.Errorf("error walking directory %s: %w", dir, err)
+		return nil, err
 	}
 
-	if len(asyncAPIFiles) == 0 {
-		return nil, fmt.Errorf("no AsyncAPI specification files found in directory %s", dir)
+	for _, file := range asyncAPIFiles {
+		slog.Debug("matched AsyncAPI file", slog.String("path", file))
 	}
 
-	fmt.Println("Found AsyncAPI files:", asyncAPIFiles)
+	slog.Info("found AsyncAPI files", slog.Int("count", len(asyncAPIFiles)))
 
 	return asyncAPIFiles, nil
 }
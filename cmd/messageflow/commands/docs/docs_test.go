@@ -0,0 +1,40 @@
+package docs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
+	_ "github.com/holydocs/messageflow/pkg/schema/target/d2"
+)
+
+func TestRunExitOnChange(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "analytics.yaml")
+	output := t.TempDir()
+
+	run := func(specFile string) error {
+		data, err := os.ReadFile(filepath.Join("../../../../pkg/schema/source/asyncapi/testdata", specFile))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(spec, data, 0o600))
+
+		cmd := NewCommand().GetCommand()
+		cmd.SetArgs([]string{"--asyncapi-files", spec, "--output", output, "--exit-on-change", "--quiet"})
+
+		return cmd.Execute()
+	}
+
+	require.NoError(t, run("analytics.yaml"), "initial docs have no changes to exit with")
+
+	err := run("analytics_ver2.yaml")
+
+	var exitErr *cmdutil.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, exitCodeChanges, exitErr.Code)
+	require.NoError(t, exitErr.Err)
+
+	require.NoError(t, run("analytics_ver2.yaml"), "unchanged docs must exit with code 0")
+}
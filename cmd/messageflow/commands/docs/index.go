@@ -0,0 +1,93 @@
+package docs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/docs"
+	"github.com/holydocs/messageflow/pkg/schema/target"
+	"github.com/spf13/cobra"
+)
+
+// newIndexCommand creates the gen-docs index command generating a portal of several documentation outputs.
+func newIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Generate a portal README linking documentation generated by gen-docs",
+		Long: `Scan a directory for documentation generated by gen-docs, e.g. checked out from several
+repositories, and generate a portal README linking each of them with a context diagram of all
+their services merged.
+
+Example:
+  messageflow gen-docs index --dir ./repos --output ./portal --title "Company Message Flow"`,
+		RunE: runIndex,
+	}
+
+	cmd.Flags().String("dir", "", "Directory scanned for messageflow.json of gen-docs outputs, including subdirectories")
+	cmd.Flags().String("output", ".", "Output directory of the portal")
+	cmd.Flags().String("title", "Message Flow", "Title of the portal")
+	cmd.Flags().String("target", "d2", fmt.Sprintf("Target rendering the diagrams (%s)", strings.Join(target.Names(), ", ")))
+	cmd.Flags().String("template-dir", "", "Directory with custom D2 templates overriding the embedded ones")
+
+	if err := cmd.MarkFlagRequired("dir"); err != nil {
+		log.Fatalf("error marking dir flag as required: %v", err)
+	}
+
+	return cmd
+}
+
+// runIndex executes the gen-docs index command.
+func runIndex(cmd *cobra.Command, _ []string) error {
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return fmt.Errorf("error getting dir flag: %w", err)
+	}
+
+	outputDir, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("error getting output flag: %w", err)
+	}
+
+	title, err := cmd.Flags().GetString("title")
+	if err != nil {
+		return fmt.Errorf("error getting title flag: %w", err)
+	}
+
+	targetType, err := cmd.Flags().GetString("target")
+	if err != nil {
+		return fmt.Errorf("error getting target flag: %w", err)
+	}
+
+	templateDir, err := cmd.Flags().GetString("template-dir")
+	if err != nil {
+		return fmt.Errorf("error getting template-dir flag: %w", err)
+	}
+
+	diagramTarget, err := target.New(targetType, target.Config{
+		TemplateDir: templateDir,
+		Logger:      slog.Default(),
+	})
+	if err != nil {
+		return fmt.Errorf("error picking target: %w", err)
+	}
+
+	if caps := diagramTarget.Capabilities(); !caps.Format || !caps.Render {
+		return fmt.Errorf("target %s doesn't support rendering diagrams", targetType)
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory %s: %w", outputDir, err)
+	}
+
+	if err := docs.GeneratePortal(context.Background(), diagramTarget, title, dir, outputDir); err != nil {
+		return fmt.Errorf("error generating portal: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Portal generated successfully in: %s\n", outputDir)
+
+	return nil
+}
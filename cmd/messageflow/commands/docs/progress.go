@@ -0,0 +1,67 @@
+package docs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// progressBarWidth is the number of characters of the progress bar drawn on terminals.
+	progressBarWidth = 30
+	// progressInterval is the minimum time between progress lines printed when not on a terminal.
+	progressInterval = 5 * time.Second
+)
+
+// progressReporter prints progress of rendering diagrams, redrawing a progress bar on terminals
+// and printing a line every progressInterval otherwise, e.g. in CI logs. It's safe for concurrent use.
+type progressReporter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	terminal bool
+	done     int
+	printed  time.Time
+}
+
+// newProgressReporter creates a reporter writing to the file, drawing a progress bar if it's a terminal.
+func newProgressReporter(f *os.File) *progressReporter {
+	info, err := f.Stat()
+
+	return &progressReporter{
+		w:        f,
+		terminal: err == nil && info.Mode()&os.ModeCharDevice != 0,
+	}
+}
+
+// report prints the progress, see docs.ProgressFunc. Reports arriving out of order are skipped.
+func (p *progressReporter) report(done, total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if done <= p.done || total <= 0 {
+		return
+	}
+	p.done = done
+
+	if p.terminal {
+		filled := progressBarWidth * done / total
+		fmt.Fprintf(p.w, "\rRendering diagrams [%s%s] %d/%d",
+			strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), done, total)
+
+		if done == total {
+			fmt.Fprintln(p.w)
+		}
+
+		return
+	}
+
+	if done < total && time.Since(p.printed) < progressInterval {
+		return
+	}
+	p.printed = time.Now()
+
+	fmt.Fprintf(p.w, "Rendered %d/%d diagrams\n", done, total)
+}
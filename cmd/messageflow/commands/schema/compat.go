@@ -0,0 +1,172 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// newCompatCommand creates the gen-schema check-compat command checking backward compatibility of schemas.
+func newCompatCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check-compat",
+		Short: "Check that a schema is backward compatible with a base schema",
+		Long: `Compare the head schema against the base schema and report changes breaking services
+relying on the base one, e.g. as a CI check of pull requests. Both schemas are loaded from
+AsyncAPI files or schema JSON files such as messageflow.json of gen-docs.
+
+Incompatibilities are reported as consumer-breaking (e.g. a field of a sent message was removed,
+or a channel other services receive from is no longer sent to) or producer-breaking (e.g. a message
+variant other services send is no longer received). The command fails when any are found.
+With --base-ref, base files are read from the git ref instead of the working tree, e.g. to check
+a feature branch against main. Base files missing on the ref are skipped.
+
+Example:
+  messageflow gen-schema check-compat --base docs/messageflow.json --head asyncapi1.yaml,asyncapi2.yaml
+  messageflow gen-schema check-compat --base old.json --head current.json --format json
+  messageflow gen-schema check-compat --base docs/messageflow.json --base-ref main --head asyncapi1.yaml`,
+		RunE: runCompat,
+	}
+
+	cmd.Flags().String("base", "", "Schema files of the base separated by comma, e.g. messageflow.json of gen-docs")
+	cmd.Flags().String("base-ref", "", "Git ref, e.g. main, to read the base files from instead of the working tree")
+	cmd.Flags().String("head", "", "Schema files of the head separated by comma, e.g. current AsyncAPI files")
+	cmd.Flags().String("format", "markdown", "Output format (markdown, json)")
+	cmd.Flags().Bool("payload-constraints", false, "Keep constraints of flattened payload fields of AsyncAPI files, reporting fields no longer or newly required")
+
+	// Mark required flags
+	for _, name := range []string{"base", "head"} {
+		if err := cmd.MarkFlagRequired(name); err != nil {
+			log.Fatalf("error marking %s flag as required: %v", name, err)
+		}
+	}
+
+	return cmd
+}
+
+// runCompat executes the gen-schema check-compat command.
+func runCompat(cmd *cobra.Command, _ []string) error {
+	basePath, err := cmd.Flags().GetString("base")
+	if err != nil {
+		return fmt.Errorf("error getting base flag: %w", err)
+	}
+
+	baseRef, err := cmd.Flags().GetString("base-ref")
+	if err != nil {
+		return fmt.Errorf("error getting base-ref flag: %w", err)
+	}
+
+	headPath, err := cmd.Flags().GetString("head")
+	if err != nil {
+		return fmt.Errorf("error getting head flag: %w", err)
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return fmt.Errorf("error getting format flag: %w", err)
+	}
+
+	payloadConstraints, err := cmd.Flags().GetBool("payload-constraints")
+	if err != nil {
+		return fmt.Errorf("error getting payload-constraints flag: %w", err)
+	}
+
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
+	ctx := context.Background()
+
+	var base messageflow.Schema
+	if baseRef != "" {
+		base, err = schema.LoadAtRef(ctx, baseRef, strings.Split(basePath, ","),
+			schema.WithPayloadConstraints(payloadConstraints))
+	} else {
+		base, err = schema.Load(ctx, strings.Split(basePath, ","), schema.WithPayloadConstraints(payloadConstraints))
+	}
+	if err != nil {
+		return fmt.Errorf("error loading base schema: %w", err)
+	}
+
+	head, err := schema.Load(ctx, strings.Split(headPath, ","), schema.WithPayloadConstraints(payloadConstraints))
+	if err != nil {
+		return fmt.Errorf("error loading head schema: %w", err)
+	}
+
+	report := messageflow.CheckCompatibility(base, head)
+
+	switch format {
+	case "json":
+		err = writeCompatJSON(os.Stdout, report)
+	default:
+		err = writeCompatMarkdown(os.Stdout, report)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing compatibility report: %w", err)
+	}
+
+	if !report.Compatible {
+		return fmt.Errorf("%d incompatible change(s) detected", len(report.Incompatibilities))
+	}
+
+	return nil
+}
+
+// writeCompatJSON writes the report as indented JSON.
+func writeCompatJSON(w io.Writer, report messageflow.CompatibilityReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
+
+// writeCompatMarkdown writes the report grouped by the broken side, suitable for pull request comments.
+func writeCompatMarkdown(w io.Writer, report messageflow.CompatibilityReport) error {
+	var b strings.Builder
+
+	b.WriteString("## Compatibility\n\n")
+
+	if report.Compatible {
+		b.WriteString("- No incompatible changes detected\n")
+	}
+
+	for _, section := range []struct {
+		title  string
+		impact messageflow.CompatibilityImpact
+	}{
+		{title: "Consumer-breaking", impact: messageflow.CompatibilityImpactConsumer},
+		{title: "Producer-breaking", impact: messageflow.CompatibilityImpactProducer},
+		{title: "Consumer- and producer-breaking", impact: messageflow.CompatibilityImpactBoth},
+	} {
+		var lines []string
+
+		for _, incompatibility := range report.Incompatibilities {
+			if incompatibility.Impact != section.impact {
+				continue
+			}
+
+			line := fmt.Sprintf("- **%s** %s", incompatibility.Category, incompatibility.Details)
+			if incompatibility.Category == messageflow.ChangeCategoryMessage {
+				line += fmt.Sprintf(" (service '%s', channel '%s')", incompatibility.Service, incompatibility.Channel)
+			}
+
+			lines = append(lines, line)
+		}
+
+		if len(lines) > 0 {
+			fmt.Fprintf(&b, "### %s\n\n%s\n\n", section.title, strings.Join(lines, "\n"))
+		}
+	}
+
+	_, err := io.WriteString(w, strings.TrimRight(b.String(), "\n")+"\n")
+
+	return err
+}
@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// newCyclesCommand creates the gen-schema cycles command printing cycles of services sending messages to each other.
+func newCyclesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cycles",
+		Short: "Print cycles of services sending messages to each other",
+		Long: `Print cycles of services sending messages to each other (A -> B -> C -> A),
+which may cause deadlocks or add latency to request/reply flows.
+
+Example:
+  messageflow gen-schema cycles --asyncapi-files asyncapi1.yaml,asyncapi2.yaml`,
+		RunE: runCycles,
+	}
+
+	cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+	cmd.Flags().Bool("two-node", false, "Include pairs of services sending to each other")
+
+	if err := cmd.MarkFlagRequired("asyncapi-files"); err != nil {
+		log.Fatalf("error marking asyncapi-files flag as required: %v", err)
+	}
+
+	return cmd
+}
+
+// runCycles executes the gen-schema cycles command.
+func runCycles(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	twoNode, err := cmd.Flags().GetBool("two-node")
+	if err != nil {
+		return fmt.Errorf("error getting two-node flag: %w", err)
+	}
+
+	s, err := schema.Load(context.Background(), strings.Split(asyncAPIFilesPath, ","))
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	writeCycles(os.Stdout, messageflow.DetectCycles(s, messageflow.WithTwoNodeCycles(twoNode)))
+
+	return nil
+}
+
+// writeCycles writes each cycle on its own line, closed by its first service.
+func writeCycles(w io.Writer, cycles [][]string) {
+	if len(cycles) == 0 {
+		fmt.Fprintln(w, "No cycles found")
+		return
+	}
+
+	for _, cycle := range cycles {
+		fmt.Fprintln(w, strings.Join(cycle, " -> ")+" -> "+cycle[0])
+	}
+}
@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// newHotspotsCommand creates the gen-schema hotspots command ranking services and channels by their connections.
+func newHotspotsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hotspots",
+		Short: "Rank services by fan-in and fan-out and channels by the services operating on them",
+		Long: `Rank services by their degree, the number of services they send messages to (fan-out) and
+receive messages from (fan-in), and channels by the number of services operating on them, to find
+communication hotspots worth decomposing. With --threshold, services and channels reaching it are
+flagged as potential bottlenecks.
+
+Example:
+  messageflow gen-schema hotspots --asyncapi-files asyncapi1.yaml,asyncapi2.yaml --threshold 5`,
+		RunE: runHotspots,
+	}
+
+	cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+	cmd.Flags().Int("threshold", 0, "Flag services with a degree and channels with a number of services of at least this (0 flags none)")
+
+	if err := cmd.MarkFlagRequired("asyncapi-files"); err != nil {
+		log.Fatalf("error marking asyncapi-files flag as required: %v", err)
+	}
+
+	return cmd
+}
+
+// runHotspots executes the gen-schema hotspots command.
+func runHotspots(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	threshold, err := cmd.Flags().GetInt("threshold")
+	if err != nil {
+		return fmt.Errorf("error getting threshold flag: %w", err)
+	}
+
+	if threshold < 0 {
+		return fmt.Errorf("threshold must not be negative, got %d", threshold)
+	}
+
+	s, err := schema.Load(context.Background(), strings.Split(asyncAPIFilesPath, ","))
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	report := messageflow.Hotspots(s, messageflow.WithHotspotThreshold(threshold))
+	if err := writeHotspots(os.Stdout, report, threshold > 0); err != nil {
+		return fmt.Errorf("error writing hotspots: %w", err)
+	}
+
+	return nil
+}
+
+// writeHotspots writes ranked services and channels as tables, with a column of flagged hotspots if flagged is set.
+func writeHotspots(w io.Writer, report messageflow.HotspotReport, flagged bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	hotspot := func(hotspot bool) string {
+		switch {
+		case !flagged:
+			return ""
+		case hotspot:
+			return "\tyes"
+		default:
+			return "\t"
+		}
+	}
+
+	fmt.Fprintf(tw, "RANK\tSERVICE\tFAN-IN\tFAN-OUT\tDEGREE%s\n", hotspotHeader(flagged))
+	for i, s := range report.Services {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d%s\n", i+1, s.Name, s.FanIn, s.FanOut, s.Degree, hotspot(s.Hotspot))
+	}
+
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "RANK\tCHANNEL\tSERVICES%s\n", hotspotHeader(flagged))
+	for i, c := range report.Channels {
+		fmt.Fprintf(tw, "%d\t%s\t%d%s\n", i+1, c.Name, c.Services, hotspot(c.Hotspot))
+	}
+
+	return tw.Flush()
+}
+
+// hotspotHeader returns the hotspot column header if hotspots are flagged.
+func hotspotHeader(flagged bool) string {
+	if flagged {
+		return "\tHOTSPOT"
+	}
+
+	return ""
+}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
 	"github.com/holydocs/messageflow/pkg/messageflow"
 	"github.com/holydocs/messageflow/pkg/schema"
-	"github.com/holydocs/messageflow/pkg/schema/target/d2"
+	"github.com/holydocs/messageflow/pkg/schema/target"
 	"github.com/spf13/cobra"
 )
 
+// stdoutPath is the output file value that makes gen-schema write to stdout.
+const stdoutPath = "-"
+
 type Command struct {
 	cmd *cobra.Command
 }
@@ -32,14 +40,47 @@ Example:
 		RunE: c.run,
 	}
 
-	c.cmd.Flags().String("target", "d2", "Target type (d2)")
-	c.cmd.Flags().String("format-to-file", "", "Output file for the formatted schema")
-	c.cmd.Flags().String("render-to-file", "", "Output file for the rendered diagram")
+	c.cmd.AddCommand(newStatsCommand())
+	c.cmd.AddCommand(newCyclesCommand())
+	c.cmd.AddCommand(newValidateCommand())
+	c.cmd.AddCommand(newCompatCommand())
+	c.cmd.AddCommand(newHotspotsCommand())
+
+	c.cmd.Flags().String("target", "d2", fmt.Sprintf("Target type (%s)", strings.Join(target.Names(), ", ")))
+	c.cmd.Flags().String("format-to-file", "", "Output file for the formatted schema (- for stdout)")
+	c.cmd.Flags().String("render-to-file", "", "Output file for the rendered diagram (- for stdout)")
 	c.cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
-	c.cmd.Flags().String("channel", "", "Channel")
-	c.cmd.Flags().String("service", "", "Service")
-	c.cmd.Flags().String("format-mode", "service_channels", "Format mode")
+	c.cmd.Flags().String("channel", "", "Channel, matched case-insensitively by a part of its name if unambiguous")
+	c.cmd.Flags().String("service", "", "Service, matched case-insensitively by a part of its name if unambiguous")
+	c.cmd.Flags().String("format-mode", "service_channels",
+		"Format modes separated by comma, or all (multiple modes are written to files suffixed with the mode)")
 	c.cmd.Flags().Bool("omit-payloads", false, "Omit payloads")
+	c.cmd.Flags().Int("depth", 1, "Number of hops from the service to include in service_services and service_overview modes")
+	c.cmd.Flags().Bool("preserve-order", false, "Keep operations in the order they are defined in AsyncAPI files")
+	c.cmd.Flags().Bool("exclude-deprecated", false, "Leave deprecated operations out of the diagram")
+	c.cmd.Flags().StringArray("exclude-channel-pattern", nil, "Leave operations on channels matching the glob out of the diagram, e.g. '*.dlq' (* matches any characters, repeatable)")
+	c.cmd.Flags().Int("channel-prefix-depth", 0, "List channels on context_services connections grouped by dot-delimited prefixes of this depth (0 omits channels)")
+	c.cmd.Flags().Bool("highlight-cycles", false, "Highlight context_services connections forming cycles of services")
+	c.cmd.Flags().String("highlight-field", "", "Highlight context_services connections and channel_services channels carrying messages with the payload field, e.g. user.id")
+	c.cmd.Flags().Bool("self-loops", false, "Show context_services services sending to channels they also receive from as loops on the service")
+	c.cmd.Flags().String("edge-metadata", "", "Operation extension shown under context_services connection labels, e.g. x-throughput")
+	c.cmd.Flags().String("baseline", "", "Schema files separated by comma, e.g. messageflow.json of gen-docs, to highlight changes against in context_services mode")
+	c.cmd.Flags().Bool("strict", false, "Fail on schema validation issues")
+	c.cmd.Flags().Bool("quiet", false, "Print only errors, leaving out warnings and confirmations of written files")
+	c.cmd.Flags().Bool("check-channel-payloads", false, "Report messages with different payloads in services sharing a channel as merge conflicts")
+	cmdutil.AddNameMapFlag(c.cmd)
+	cmdutil.AddValidateExamplesFlag(c.cmd)
+	c.cmd.Flags().String("env", "", "Keep only channels available on the server of the environment, e.g. staging (channels without servers are available on all)")
+	c.cmd.Flags().String("direction", "down", "Layout direction of the diagram (down, right, up, left)")
+	c.cmd.Flags().Float64("png-scale", 1, "Scale factor for PNG rendering (used when --render-to-file ends with .png)")
+	c.cmd.Flags().Duration("render-timeout", 0, "Maximum time to spend rendering the diagram (0 means no limit)")
+	c.cmd.Flags().Int("max-context-services", 0, "Refuse to format context diagrams with more services (0 means no limit)")
+	c.cmd.Flags().String("template-dir", "", "Directory with custom D2 templates overriding the embedded ones")
+	c.cmd.Flags().Int("padding", 5, "Padding around the rendered diagram in pixels")
+	c.cmd.Flags().Bool("legend", false, "Add a legend explaining connection labels and line styles to context_services diagrams")
+	c.cmd.Flags().String("payload-style", "text", "Style of message payloads in channel_services diagrams (text shows JSON, tree shows nested tables)")
+	c.cmd.Flags().String("title", "", "Title of the document of context_services mode (asyncapi target)")
+	c.cmd.Flags().Int("font-size", 0, "Font size of diagram labels between 8 and 100 (0 keeps the D2 defaults of 16 for shapes and 14 for connections)")
 
 	// Mark required flags
 	err := c.cmd.MarkFlagRequired("asyncapi-files")
@@ -97,12 +138,176 @@ func (c *Command) run(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("error getting omit-payloads flag: %w", err)
 	}
 
+	depth, err := cmd.Flags().GetInt("depth")
+	if err != nil {
+		return fmt.Errorf("error getting depth flag: %w", err)
+	}
+
+	preserveOrder, err := cmd.Flags().GetBool("preserve-order")
+	if err != nil {
+		return fmt.Errorf("error getting preserve-order flag: %w", err)
+	}
+
+	excludeDeprecated, err := cmd.Flags().GetBool("exclude-deprecated")
+	if err != nil {
+		return fmt.Errorf("error getting exclude-deprecated flag: %w", err)
+	}
+
+	excludeChannelPatterns, err := cmd.Flags().GetStringArray("exclude-channel-pattern")
+	if err != nil {
+		return fmt.Errorf("error getting exclude-channel-pattern flag: %w", err)
+	}
+
+	channelPrefixDepth, err := cmd.Flags().GetInt("channel-prefix-depth")
+	if err != nil {
+		return fmt.Errorf("error getting channel-prefix-depth flag: %w", err)
+	}
+
+	highlightCycles, err := cmd.Flags().GetBool("highlight-cycles")
+	if err != nil {
+		return fmt.Errorf("error getting highlight-cycles flag: %w", err)
+	}
+
+	highlightField, err := cmd.Flags().GetString("highlight-field")
+	if err != nil {
+		return fmt.Errorf("error getting highlight-field flag: %w", err)
+	}
+
+	selfLoops, err := cmd.Flags().GetBool("self-loops")
+	if err != nil {
+		return fmt.Errorf("error getting self-loops flag: %w", err)
+	}
+
+	edgeMetadata, err := cmd.Flags().GetString("edge-metadata")
+	if err != nil {
+		return fmt.Errorf("error getting edge-metadata flag: %w", err)
+	}
+
+	baselinePath, err := cmd.Flags().GetString("baseline")
+	if err != nil {
+		return fmt.Errorf("error getting baseline flag: %w", err)
+	}
+
+	nameMap, err := cmdutil.NameMap(cmd)
+	if err != nil {
+		return err
+	}
+
+	var exampleMismatches []string
+
+	validateExamples, err := cmdutil.ValidateExamplesOpt(cmd, &exampleMismatches)
+	if err != nil {
+		return err
+	}
+
+	env, err := cmd.Flags().GetString("env")
+	if err != nil {
+		return fmt.Errorf("error getting env flag: %w", err)
+	}
+
+	pngScale, err := cmd.Flags().GetFloat64("png-scale")
+	if err != nil {
+		return fmt.Errorf("error getting png-scale flag: %w", err)
+	}
+
+	strict, err := cmd.Flags().GetBool("strict")
+	if err != nil {
+		return fmt.Errorf("error getting strict flag: %w", err)
+	}
+
+	quiet, err := cmd.Flags().GetBool("quiet")
+	if err != nil {
+		return fmt.Errorf("error getting quiet flag: %w", err)
+	}
+
+	var info io.Writer = os.Stderr
+	if quiet {
+		info = io.Discard
+	}
+
+	checkChannelPayloads, err := cmd.Flags().GetBool("check-channel-payloads")
+	if err != nil {
+		return fmt.Errorf("error getting check-channel-payloads flag: %w", err)
+	}
+
+	direction, err := cmd.Flags().GetString("direction")
+	if err != nil {
+		return fmt.Errorf("error getting direction flag: %w", err)
+	}
+
+	renderTimeout, err := cmd.Flags().GetDuration("render-timeout")
+	if err != nil {
+		return fmt.Errorf("error getting render-timeout flag: %w", err)
+	}
+
+	maxContextServices, err := cmd.Flags().GetInt("max-context-services")
+	if err != nil {
+		return fmt.Errorf("error getting max-context-services flag: %w", err)
+	}
+
+	templateDir, err := cmd.Flags().GetString("template-dir")
+	if err != nil {
+		return fmt.Errorf("error getting template-dir flag: %w", err)
+	}
+
+	padding, err := cmd.Flags().GetInt("padding")
+	if err != nil {
+		return fmt.Errorf("error getting padding flag: %w", err)
+	}
+
+	fontSize, err := cmd.Flags().GetInt("font-size")
+	if err != nil {
+		return fmt.Errorf("error getting font-size flag: %w", err)
+	}
+
+	legend, err := cmd.Flags().GetBool("legend")
+	if err != nil {
+		return fmt.Errorf("error getting legend flag: %w", err)
+	}
+
+	payloadStyle, err := cmd.Flags().GetString("payload-style")
+	if err != nil {
+		return fmt.Errorf("error getting payload-style flag: %w", err)
+	}
+
+	title, err := cmd.Flags().GetString("title")
+	if err != nil {
+		return fmt.Errorf("error getting title flag: %w", err)
+	}
+
 	// Validate that at least one output is specified
 	if formatToFile == "" && renderToFile == "" {
 		return errors.New("either --format-to-file or --render-to-file must be specified")
 	}
 
-	target, err := pickTarget(targetType)
+	if formatToFile == stdoutPath && renderToFile == stdoutPath {
+		return errors.New("--format-to-file and --render-to-file can't both write to stdout")
+	}
+
+	modes, err := parseFormatModes(formatMode)
+	if err != nil {
+		return err
+	}
+
+	if len(modes) > 1 && (formatToFile == stdoutPath || renderToFile == stdoutPath) {
+		return errors.New("multiple format modes can't be written to stdout")
+	}
+
+	cfg := target.Config{
+		PNGScale:           pngScale,
+		Direction:          direction,
+		RenderTimeout:      renderTimeout,
+		MaxContextServices: maxContextServices,
+		TemplateDir:        templateDir,
+		Padding:            &padding,
+		FontSize:           fontSize,
+		Legend:             legend,
+		PayloadStyle:       payloadStyle,
+		Title:              title,
+		Logger:             slog.Default(),
+	}
+
+	target, err := pickTarget(targetType, renderToFile, cfg)
 	if err != nil {
 		return fmt.Errorf("error picking target: %w", err)
 	}
@@ -121,53 +326,234 @@ func (c *Command) run(cmd *cobra.Command, _ []string) error {
 
 	filePaths := strings.Split(asyncAPIFilesPath, ",")
 
-	s, err := schema.Load(ctx, filePaths)
+	s, conflicts, err := schema.LoadWithConflicts(
+		ctx,
+		filePaths,
+		schema.WithStrict(strict),
+		schema.WithChannelConsistency(checkChannelPayloads),
+		schema.WithNameMap(nameMap),
+		schema.WithEnvironment(env),
+		schema.WithSourceOrder(preserveOrder),
+		schema.WithLogger(slog.Default()),
+		validateExamples,
+	)
 	if err != nil {
 		return fmt.Errorf("error loading schema from files: %w", err)
 	}
 
-	formatOpts := messageflow.FormatOptions{
-		Mode:         messageflow.FormatMode(formatMode),
-		Service:      service,
-		Channel:      channel,
-		OmitPayloads: omitPayloads,
+	cmdutil.ReportMergeConflicts(info, conflicts)
+	cmdutil.ReportExampleMismatches(info, exampleMismatches)
+
+	if err := cmdutil.ReportValidationIssues(info, messageflow.ValidateSchema(s), strict); err != nil {
+		return err
+	}
+
+	if service != "" {
+		if service, err = s.MatchService(service); err != nil {
+			return err
+		}
+	}
+
+	if channel != "" {
+		if channel, err = s.MatchChannel(channel); err != nil {
+			return err
+		}
+	}
+
+	var baseline *messageflow.Schema
+	if baselinePath != "" {
+		b, err := schema.Load(
+			ctx,
+			strings.Split(baselinePath, ","),
+			schema.WithNameMap(nameMap),
+			schema.WithLogger(slog.Default()),
+		)
+		if err != nil {
+			return fmt.Errorf("error loading baseline schema: %w", err)
+		}
+
+		baseline = &b
+	}
+
+	modes = applicableModes(info, modes, s, service, channel)
+	if len(modes) == 0 {
+		return errors.New("no format mode can be applied, specify --service or --channel")
+	}
+
+	for _, mode := range modes {
+		formatOpts := messageflow.FormatOptions{
+			Mode:                   mode,
+			Service:                service,
+			Channel:                channel,
+			OmitPayloads:           omitPayloads,
+			PreserveOrder:          preserveOrder,
+			Depth:                  depth,
+			ExcludeDeprecated:      excludeDeprecated,
+			ExcludeChannelPatterns: excludeChannelPatterns,
+			ChannelPrefixDepth:     channelPrefixDepth,
+			HighlightCycles:        highlightCycles,
+			HighlightField:         highlightField,
+			EdgeMetadata:           edgeMetadata,
+			Baseline:               baseline,
+			SelfLoops:              selfLoops,
+		}
+
+		if len(modes) > 1 {
+			err = generate(ctx, info, target, s, formatOpts, modePath(formatToFile, mode), modePath(renderToFile, mode))
+		} else {
+			err = generate(ctx, info, target, s, formatOpts, formatToFile, renderToFile)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// generate formats the schema and renders the diagram, writing them to the non-empty output paths.
+func generate(
+	ctx context.Context,
+	info io.Writer,
+	target messageflow.Target,
+	s messageflow.Schema,
+	formatOpts messageflow.FormatOptions,
+	formatToFile, renderToFile string,
+) error {
 	fs, err := target.FormatSchema(ctx, s, formatOpts)
 	if err != nil {
-		return fmt.Errorf("error formatting schema: %w", err)
+		return fmt.Errorf("error formatting %s schema: %w", formatOpts.Mode, err)
 	}
 
 	if formatToFile != "" {
-		err = os.WriteFile(formatToFile, fs.Data, 0600)
+		err = writeOutput(info, formatToFile, fs.Data, "Formatted schema")
 		if err != nil {
-			return fmt.Errorf("error writing to file %s: %w", formatToFile, err)
+			return err
 		}
-		fmt.Printf("Formatted schema written to: %s\n", formatToFile)
 	}
 
 	if renderToFile != "" {
 		diagram, err := target.RenderSchema(ctx, fs)
 		if err != nil {
-			return fmt.Errorf("error rendering schema: %w", err)
+			return fmt.Errorf("error rendering %s schema: %w", formatOpts.Mode, err)
 		}
 
-		err = os.WriteFile(renderToFile, diagram, 0600)
+		err = writeOutput(info, renderToFile, diagram, "Rendered diagram")
 		if err != nil {
-			return fmt.Errorf("error writing to file %s: %w", renderToFile, err)
+			return err
 		}
-		fmt.Printf("Rendered diagram written to: %s\n", renderToFile)
 	}
 
 	return nil
 }
 
-// pickTarget selects the appropriate target based on the target type
-func pickTarget(targetType string) (messageflow.Target, error) {
-	switch targetType {
-	case "d2":
-		return d2.NewTarget()
-	default:
-		return nil, fmt.Errorf("unknown target: %s", targetType)
+// allFormatModes is the value of --format-mode selecting every mode.
+const allFormatModes = "all"
+
+// parseFormatModes parses a comma separated list of format modes.
+func parseFormatModes(value string) ([]messageflow.FormatMode, error) {
+	known := []messageflow.FormatMode{
+		messageflow.FormatModeContextServices,
+		messageflow.FormatModeServiceChannels,
+		messageflow.FormatModeServiceServices,
+		messageflow.FormatModeChannelServices,
+		messageflow.FormatModeServiceOverview,
+		messageflow.FormatModeSequence,
+	}
+
+	if strings.TrimSpace(value) == allFormatModes {
+		return known, nil
 	}
+
+	var modes []messageflow.FormatMode
+
+	for _, v := range strings.Split(value, ",") {
+		mode := messageflow.FormatMode(strings.TrimSpace(v))
+		if !slices.Contains(known, mode) {
+			return nil, messageflow.NewUnsupportedFormatModeError(mode, known)
+		}
+
+		if !slices.Contains(modes, mode) {
+			modes = append(modes, mode)
+		}
+	}
+
+	return modes, nil
+}
+
+// applicableModes drops modes requiring a service or channel which isn't specified, printing warnings to w.
+// Service modes fall back to the only service of single service schemas.
+func applicableModes(
+	w io.Writer,
+	modes []messageflow.FormatMode,
+	s messageflow.Schema,
+	service, channel string,
+) []messageflow.FormatMode {
+	var applicable []messageflow.FormatMode
+
+	for _, mode := range modes {
+		switch mode {
+		case messageflow.FormatModeServiceChannels, messageflow.FormatModeServiceServices,
+			messageflow.FormatModeServiceOverview:
+			if service == "" && len(s.Services) != 1 {
+				fmt.Fprintf(w, "Skipping %s format mode: --service is not specified\n", mode)
+				continue
+			}
+		case messageflow.FormatModeChannelServices:
+			if channel == "" {
+				fmt.Fprintf(w, "Skipping %s format mode: --channel is not specified\n", mode)
+				continue
+			}
+		case messageflow.FormatModeSequence:
+			if service == "" && channel == "" {
+				fmt.Fprintf(w, "Skipping %s format mode: neither --service nor --channel is specified\n", mode)
+				continue
+			}
+		}
+
+		applicable = append(applicable, mode)
+	}
+
+	return applicable
+}
+
+// modePath suffixes the file name with the format mode, e.g. schema.svg becomes schema_context_services.svg.
+func modePath(path string, mode messageflow.FormatMode) string {
+	if path == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "_" + string(mode) + ext
+}
+
+// writeOutput writes data to the given file, or to stdout when path is "-".
+// The confirmation line is printed to w, stderr or discarded, so it doesn't mix with data piped from stdout.
+func writeOutput(w io.Writer, path string, data []byte, what string) error {
+	if path == stdoutPath {
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("error writing to stdout: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing to file %s: %w", path, err)
+	}
+
+	fmt.Fprintf(w, "%s written to: %s\n", what, path)
+
+	return nil
+}
+
+// pickTarget creates the registered target of the type.
+// The render output format is inferred from the extension of the render file.
+func pickTarget(targetType, renderToFile string, cfg target.Config) (messageflow.Target, error) {
+	if strings.EqualFold(filepath.Ext(renderToFile), ".png") {
+		cfg.OutputFormat = "png"
+	}
+
+	return target.New(targetType, cfg)
 }
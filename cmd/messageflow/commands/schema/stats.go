@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// newStatsCommand creates the gen-schema stats command printing message payload complexity metrics.
+func newStatsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Print message payload complexity metrics",
+		Long: `Print number of fields, nesting depth and array-root payloads per service and per channel
+to spot over-large messages.
+
+Example:
+  messageflow gen-schema stats --asyncapi-files asyncapi1.yaml,asyncapi2.yaml`,
+		RunE: runStats,
+	}
+
+	cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+
+	if err := cmd.MarkFlagRequired("asyncapi-files"); err != nil {
+		log.Fatalf("error marking asyncapi-files flag as required: %v", err)
+	}
+
+	return cmd
+}
+
+// runStats executes the gen-schema stats command.
+func runStats(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	s, err := schema.Load(context.Background(), strings.Split(asyncAPIFilesPath, ","))
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	if err := writeStats(os.Stdout, messageflow.SchemaStats(s)); err != nil {
+		return fmt.Errorf("error writing stats: %w", err)
+	}
+
+	return nil
+}
+
+// writeStats writes services and channels stats as tables.
+func writeStats(w io.Writer, stats messageflow.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SERVICE\tCHANNELS\tMESSAGES\tFIELDS\tMAX DEPTH")
+	for _, s := range stats.Services {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", s.Service, s.Channels, s.Messages, s.Fields, s.MaxDepth)
+	}
+
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "CHANNEL\tMESSAGES\tFIELDS\tDEPTH\tARRAY ROOT")
+	for _, c := range stats.Channels {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%t\n", c.Channel, len(c.Messages), c.Fields, c.Depth, c.ArrayRoot)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,169 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// newValidateCommand creates the gen-schema validate command validating AsyncAPI files without generating anything.
+func newValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate AsyncAPI files without generating anything",
+		Long: `Validate that AsyncAPI files produce a coherent schema, e.g. as a pre-commit or CI check.
+
+Errors are malformed operations and messages, warnings are integration gaps such as channels
+without senders or receivers and operations defined differently across files, as well as
+message examples not matching payload schemas with --validate-examples.
+The command fails on errors, pass --strict to fail on warnings too.
+
+Example:
+  messageflow gen-schema validate --asyncapi-files asyncapi1.yaml,asyncapi2.yaml
+  messageflow gen-schema validate --dir ./specs --strict`,
+		RunE: runValidate,
+	}
+
+	cmd.Flags().String("dir", "", "Path to dir to scan asyncapi files automatically")
+	cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+	cmd.Flags().Bool("strict", false, "Fail on warnings too")
+	cmd.Flags().Bool("check-channel-payloads", false, "Report messages with different payloads in services sharing a channel as merge conflicts")
+	cmdutil.AddNameMapFlag(cmd)
+	cmdutil.AddValidateExamplesFlag(cmd)
+
+	return cmd
+}
+
+// runValidate executes the gen-schema validate command.
+func runValidate(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return fmt.Errorf("error getting dir flag: %w", err)
+	}
+
+	strict, err := cmd.Flags().GetBool("strict")
+	if err != nil {
+		return fmt.Errorf("error getting strict flag: %w", err)
+	}
+
+	checkChannelPayloads, err := cmd.Flags().GetBool("check-channel-payloads")
+	if err != nil {
+		return fmt.Errorf("error getting check-channel-payloads flag: %w", err)
+	}
+
+	nameMap, err := cmdutil.NameMap(cmd)
+	if err != nil {
+		return err
+	}
+
+	var exampleMismatches []string
+
+	validateExamples, err := cmdutil.ValidateExamplesOpt(cmd, &exampleMismatches)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+
+	switch {
+	case asyncAPIFilesPath != "":
+		paths = strings.Split(asyncAPIFilesPath, ",")
+	case dir != "":
+		paths, err = schema.FindAsyncAPIFiles(dir)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("provide either asyncapi-files or dir")
+	}
+
+	s, conflicts, err := schema.LoadWithConflicts(
+		context.Background(),
+		paths,
+		schema.WithChannelConsistency(checkChannelPayloads),
+		schema.WithNameMap(nameMap),
+		validateExamples,
+	)
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	errs := schemaErrors(s.Validate())
+
+	var warnings []string
+	for _, conflict := range conflicts {
+		warnings = append(warnings, conflict.Details)
+	}
+	for _, issue := range messageflow.ValidateSchema(s) {
+		warnings = append(warnings, issue.String())
+	}
+	warnings = append(warnings, exampleMismatches...)
+
+	writeValidationReport(os.Stdout, errs, warnings)
+
+	switch {
+	case len(errs) > 0:
+		return fmt.Errorf("schema validation failed with %d error(s)", len(errs))
+	case strict && len(warnings) > 0:
+		return fmt.Errorf("schema validation failed with %d warning(s)", len(warnings))
+	}
+
+	return nil
+}
+
+// schemaErrors splits the error returned by messageflow.Schema.Validate into single violations.
+func schemaErrors(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return []string{err.Error()}
+	}
+
+	errs := make([]string, 0, len(joined.Unwrap()))
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, e.Error())
+	}
+
+	return errs
+}
+
+// writeValidationReport writes errors and warnings grouped under their severity.
+func writeValidationReport(w io.Writer, errs, warnings []string) {
+	if len(errs) == 0 && len(warnings) == 0 {
+		fmt.Fprintln(w, "Schema is valid")
+		return
+	}
+
+	for _, group := range []struct {
+		title  string
+		issues []string
+	}{
+		{title: "Errors", issues: errs},
+		{title: "Warnings", issues: warnings},
+	} {
+		if len(group.issues) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s:\n", group.title)
+		for _, issue := range group.issues {
+			fmt.Fprintf(w, "• %s\n", issue)
+		}
+	}
+}
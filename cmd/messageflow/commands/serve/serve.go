@@ -0,0 +1,132 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/holydocs/messageflow/pkg/schema/target"
+	"github.com/holydocs/messageflow/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+type Command struct {
+	cmd *cobra.Command
+}
+
+// NewCommand creates a new serve command
+func NewCommand() *Command {
+	c := &Command{}
+
+	c.cmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve diagrams over HTTP, rendering them on request",
+		Long: `Load the schema once and serve diagrams rendered on request:
+  /context.svg, /service/{name}.svg, /channel/{name}.svg and /schema.json
+
+Example:
+  messageflow serve --asyncapi-files asyncapi1.yaml,asyncapi2.yaml --addr :8080`,
+		RunE: c.run,
+	}
+
+	c.cmd.Flags().String("asyncapi-files", "", "Paths to asyncapi files separated by comma")
+	c.cmd.Flags().String("addr", ":8080", "Address to listen on")
+	c.cmd.Flags().String("template-dir", "", "Directory with custom D2 templates overriding the embedded ones")
+	c.cmd.Flags().Int("render-cache", 64, "Number of rendered diagrams kept in memory to serve unchanged diagrams without rendering (0 disables caching)")
+
+	// Mark required flags
+	err := c.cmd.MarkFlagRequired("asyncapi-files")
+	if err != nil {
+		log.Fatalf("error marking asyncapi-files flag as required: %v", err)
+	}
+
+	return c
+}
+
+// GetCommand returns the cobra command
+func (c *Command) GetCommand() *cobra.Command {
+	return c.cmd
+}
+
+// run executes the serve command
+func (c *Command) run(cmd *cobra.Command, _ []string) error {
+	asyncAPIFilesPath, err := cmd.Flags().GetString("asyncapi-files")
+	if err != nil {
+		return fmt.Errorf("error getting asyncapi-files flag: %w", err)
+	}
+
+	addr, err := cmd.Flags().GetString("addr")
+	if err != nil {
+		return fmt.Errorf("error getting addr flag: %w", err)
+	}
+
+	templateDir, err := cmd.Flags().GetString("template-dir")
+	if err != nil {
+		return fmt.Errorf("error getting template-dir flag: %w", err)
+	}
+
+	renderCache, err := cmd.Flags().GetInt("render-cache")
+	if err != nil {
+		return fmt.Errorf("error getting render-cache flag: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := schema.Load(ctx, strings.Split(asyncAPIFilesPath, ","))
+	if err != nil {
+		return fmt.Errorf("error loading schema from files: %w", err)
+	}
+
+	d2Target, err := target.New("d2", target.Config{
+		TemplateDir: templateDir,
+		Logger:      slog.Default(),
+		RenderCache: renderCache,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating D2 target: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           server.NewHandler(s, d2Target),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+
+	fmt.Printf("Serving diagrams on %s\n", addr)
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("error serving: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error serving: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package cmdutil
+
+import "fmt"
+
+// ExitError is returned by commands to exit with the code, e.g. for outcomes which aren't failures,
+// such as changes detected by gen-docs with --exit-on-change. Err is printed when set.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Error implements the error interface for ExitError.
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,77 @@
+package cmdutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/holydocs/messageflow/pkg/schema"
+	"github.com/holydocs/messageflow/pkg/schema/source/asyncapi"
+	"github.com/spf13/cobra"
+)
+
+// AddNameMapFlag adds the name-map flag read by NameMap to the command.
+func AddNameMapFlag(cmd *cobra.Command) {
+	cmd.Flags().String("name-map", "", "YAML or JSON file mapping asyncapi file paths or service titles to canonical service names")
+}
+
+// NameMap loads the name map of the name-map flag, see schema.WithNameMap. It returns nil when the flag isn't set.
+func NameMap(cmd *cobra.Command) (map[string]string, error) {
+	nameMapPath, err := cmd.Flags().GetString("name-map")
+	if err != nil {
+		return nil, fmt.Errorf("error getting name-map flag: %w", err)
+	}
+
+	if nameMapPath == "" {
+		return nil, nil
+	}
+
+	return schema.LoadNameMap(nameMapPath)
+}
+
+// AddIgnoreFileFlag adds the ignore-file flag read by IgnorePatterns to the command.
+func AddIgnoreFileFlag(cmd *cobra.Command) {
+	cmd.Flags().String("ignore-file", ".messageflowignore", "File of service:channel:field glob patterns of changes to leave out of the changelog, one per line")
+}
+
+// IgnorePatterns loads patterns of the ignore-file flag, see schema.LoadIgnoreFile.
+// The default ignore file is optional, a missing one results in no patterns.
+func IgnorePatterns(cmd *cobra.Command) ([]string, error) {
+	ignoreFile, err := cmd.Flags().GetString("ignore-file")
+	if err != nil {
+		return nil, fmt.Errorf("error getting ignore-file flag: %w", err)
+	}
+
+	if ignoreFile == "" {
+		return nil, nil
+	}
+
+	patterns, err := schema.LoadIgnoreFile(ignoreFile)
+	if errors.Is(err, os.ErrNotExist) && !cmd.Flags().Changed("ignore-file") {
+		return nil, nil
+	}
+
+	return patterns, err
+}
+
+// AddValidateExamplesFlag adds the validate-examples flag read by ValidateExamplesOpt to the command.
+func AddValidateExamplesFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("validate-examples", false, "Report message examples of asyncapi files not matching payload schemas of the messages")
+}
+
+// ValidateExamplesOpt returns a LoadOpt collecting message examples not matching payload schemas into mismatches
+// when the validate-examples flag is set, see schema.WithValidateExamples.
+func ValidateExamplesOpt(cmd *cobra.Command, mismatches *[]string) (schema.LoadOpt, error) {
+	validate, err := cmd.Flags().GetBool("validate-examples")
+	if err != nil {
+		return nil, fmt.Errorf("error getting validate-examples flag: %w", err)
+	}
+
+	if !validate {
+		return schema.WithValidateExamples(nil), nil
+	}
+
+	return schema.WithValidateExamples(func(path string, mismatch asyncapi.ExampleMismatch) {
+		*mismatches = append(*mismatches, fmt.Sprintf("%s: %s", path, mismatch))
+	}), nil
+}
@@ -0,0 +1,57 @@
+// Package cmdutil holds flags and reports shared by messageflow commands.
+package cmdutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// ReportMergeConflicts prints operations defined differently across files as warnings.
+func ReportMergeConflicts(w io.Writer, conflicts []messageflow.MergeConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Schema Merge Conflicts:\n")
+	for _, conflict := range conflicts {
+		fmt.Fprintf(w, "• %s\n", conflict.Details)
+	}
+}
+
+// ReportValidationIssues prints schema validation issues as warnings.
+// In strict mode any issue results in an error, the issues are then printed to stderr regardless of w.
+func ReportValidationIssues(w io.Writer, issues []messageflow.ValidationIssue, strict bool) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	if strict {
+		w = os.Stderr
+	}
+
+	fmt.Fprintf(w, "Schema Validation Warnings:\n")
+	for _, issue := range issues {
+		fmt.Fprintf(w, "• %s\n", issue)
+	}
+
+	if strict {
+		return fmt.Errorf("schema validation failed with %d issue(s)", len(issues))
+	}
+
+	return nil
+}
+
+// ReportExampleMismatches prints message examples not matching payload schemas as warnings.
+func ReportExampleMismatches(w io.Writer, mismatches []string) {
+	if len(mismatches) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Message Example Mismatches:\n")
+	for _, mismatch := range mismatches {
+		fmt.Fprintf(w, "• %s\n", mismatch)
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 
+	"github.com/holydocs/messageflow/cmd/messageflow/commands/changelog"
 	"github.com/holydocs/messageflow/cmd/messageflow/commands/docs"
 	"github.com/holydocs/messageflow/cmd/messageflow/commands/schema"
+	"github.com/holydocs/messageflow/cmd/messageflow/commands/serve"
+	"github.com/holydocs/messageflow/cmd/messageflow/internal/cmdutil"
+	_ "github.com/holydocs/messageflow/pkg/schema/target/asyncapi"
+	_ "github.com/holydocs/messageflow/pkg/schema/target/d2"
 	"github.com/spf13/cobra"
 )
 
@@ -14,13 +22,64 @@ func main() {
 		Use:   "messageflow",
 		Short: "MessageFlow - AsyncAPI schema processing tool",
 		Long:  `MessageFlow is a tool for generating schemas/docs from AsyncAPI schemas.`,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			// Flags are valid once commands run, so their failures, e.g. of check-compat
+			// after printing its report, don't print the usage.
+			cmd.SilenceUsage = true
+
+			return setupLogger(cmd)
+		},
+		// Errors are printed by main, so exit codes of commands don't print errors.
+		SilenceErrors: true,
 	}
 
+	rootCmd.PersistentFlags().String("log-level", "warn", "Log level: debug, info, warn or error")
+
 	rootCmd.AddCommand(schema.NewCommand().GetCommand())
 	rootCmd.AddCommand(docs.NewCommand().GetCommand())
+	rootCmd.AddCommand(changelog.NewCommand().GetCommand())
+	rootCmd.AddCommand(serve.NewCommand().GetCommand())
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitCode(os.Stderr, err))
+	}
+}
+
+// exitCode prints the error of a command to w, returning the exit code of the process,
+// the code of cmdutil.ExitError errors, which are printed only when they wrap an error, and 1 otherwise.
+func exitCode(w io.Writer, err error) int {
+	var exitErr *cmdutil.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintf(w, "Error: %v\n", err)
+		return 1
 	}
+
+	if exitErr.Err != nil {
+		fmt.Fprintf(w, "Error: %v\n", exitErr.Err)
+	}
+
+	return exitErr.Code
+}
+
+// setupLogger installs the default logger writing to stderr at the level of the log-level flag,
+// error by default for commands run with --quiet.
+func setupLogger(cmd *cobra.Command) error {
+	levelName, err := cmd.Flags().GetString("log-level")
+	if err != nil {
+		return fmt.Errorf("error getting log-level flag: %w", err)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("invalid log level '%s', must be one of debug, info, warn, error", levelName)
+	}
+
+	if quiet := cmd.Flags().Lookup("quiet"); quiet != nil && quiet.Value.String() == "true" &&
+		!cmd.Flags().Changed("log-level") {
+		level = slog.LevelError
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	return nil
 }
@@ -0,0 +1,1876 @@
+// Package docs generates markdown documentation with diagrams and changelog from message flow schemas.
+package docs
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/holydocs/messageflow/pkg/internal/gitref"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"golang.org/x/sync/errgroup"
+)
+
+//go:embed templates/readme.tmpl templates/changelog.tmpl templates/index.html.tmpl
+var templateFS embed.FS
+
+// OutputFormat represents the format of the generated documentation.
+type OutputFormat string
+
+const (
+	// OutputFormatMarkdown generates README.md.
+	OutputFormatMarkdown OutputFormat = "markdown"
+	// OutputFormatHTML generates index.html in addition to README.md.
+	OutputFormatHTML OutputFormat = "html"
+	// OutputFormatPDF generates docs.pdf in addition to README.md, for distributing documentation offline.
+	OutputFormatPDF OutputFormat = "pdf"
+)
+
+// ChangelogOrder is the order changelogs are listed in by date.
+type ChangelogOrder string
+
+const (
+	// ChangelogOrderDesc lists the most recent changelog first.
+	ChangelogOrderDesc ChangelogOrder = "desc"
+	// ChangelogOrderAsc lists changelogs chronologically, the most recent one last.
+	ChangelogOrderAsc ChangelogOrder = "asc"
+)
+
+// MetadataVersion is the version of the messageflow.json format written by this version of messageflow,
+// files of older versions are migrated when read, see ReadMetadata.
+const MetadataVersion = 2
+
+// Metadata represents the state persisted between documentation runs (messageflow.json).
+type Metadata struct {
+	// SchemaVersion is the version of the file format, files written before versioning have none and are version 1.
+	SchemaVersion int                     `json:"schemaVersion"`
+	Schema        messageflow.Schema      `json:"schema"`
+	Changelogs    []messageflow.Changelog `json:"changelogs"`
+	// RenderFingerprint identifies the options the diagrams were rendered with, diagrams rendered
+	// with other options aren't reused. See WithRenderSettings.
+	RenderFingerprint string `json:"renderFingerprint,omitempty"`
+}
+
+// Artifacts holds generated documentation in memory.
+type Artifacts struct {
+	// README is the generated markdown documentation.
+	README string
+	// Diagrams maps diagram filenames (relative to the diagrams directory) to rendered diagrams.
+	Diagrams map[string][]byte
+	// Metadata is the state to persist for the next run.
+	Metadata Metadata
+	// Changelog contains changes detected against the existing metadata, nil if there are none.
+	Changelog *messageflow.Changelog
+	// HTML is the generated HTML documentation, empty unless OutputFormatHTML is used.
+	HTML string
+	// PDF is the generated PDF documentation, empty unless OutputFormatPDF is used.
+	PDF []byte
+	// ChangelogArchive is the generated markdown archive of changelogs left out of the README,
+	// empty unless WithChangelogLimit cuts any.
+	ChangelogArchive string
+	// Domains maps paths of domain READMEs relative to the output directory to their content,
+	// empty unless WithSplitByDomain is used.
+	Domains map[string]string
+	// Index lists the generated artifacts.
+	Index Index
+	// Summary describes the run.
+	Summary Summary
+}
+
+// Summary describes a documentation run, e.g. to track generation performance as schemas grow.
+type Summary struct {
+	Services int `json:"services"`
+	Channels int `json:"channels"`
+	// DiagramsRendered counts diagrams rendered in this run, DiagramsReused up to date ones left as they are.
+	DiagramsRendered int `json:"diagramsRendered"`
+	DiagramsReused   int `json:"diagramsReused"`
+	// RenderTime is the wall time spent rendering diagrams, serialized in milliseconds.
+	RenderTime time.Duration `json:"-"`
+	// Changes counts changes detected against the existing metadata.
+	Changes int `json:"changes"`
+}
+
+// MarshalJSON serializes the summary with the render time in milliseconds.
+func (s Summary) MarshalJSON() ([]byte, error) {
+	type summary Summary
+
+	return json.Marshal(struct {
+		summary
+		RenderTimeMS int64 `json:"renderTimeMs"`
+	}{
+		summary:      summary(s),
+		RenderTimeMS: s.RenderTime.Milliseconds(),
+	})
+}
+
+// Index lists generated artifacts so tools can discover them without parsing the README (index.json).
+// Paths are relative to the output directory, anchors point to README headings.
+type Index struct {
+	Title     string         `json:"title"`
+	README    string         `json:"readme"`
+	HTML      string         `json:"html,omitempty"`
+	PDF       string         `json:"pdf,omitempty"`
+	Changelog string         `json:"changelog,omitempty"`
+	Metadata  string         `json:"metadata"`
+	Context   string         `json:"context"`
+	Services  []IndexElement `json:"services"`
+	Channels  []IndexElement `json:"channels"`
+	// Domains lists READMEs of service domains, empty unless WithSplitByDomain is used.
+	Domains []IndexDomain `json:"domains,omitempty"`
+	// ContextDiff is the context diagram highlighting changes since the previous run, empty without changes.
+	ContextDiff string `json:"contextDiff,omitempty"`
+	// Environments lists context diagrams of environments, empty unless WithEnvironmentDiagrams is used
+	// and channel availability differs across them.
+	Environments []IndexEnvironment `json:"environments,omitempty"`
+}
+
+// IndexElement describes a service or channel section of the documentation.
+type IndexElement struct {
+	Name    string `json:"name"`
+	Anchor  string `json:"anchor"`
+	Diagram string `json:"diagram"`
+}
+
+// IndexEnvironment describes the context diagram of an environment.
+type IndexEnvironment struct {
+	Name    string `json:"name"`
+	Context string `json:"context"`
+}
+
+// IndexDomain describes the README of a service domain.
+type IndexDomain struct {
+	Name   string `json:"name"`
+	README string `json:"readme"`
+}
+
+// Opt configures documentation generation.
+type Opt func(*options)
+
+type options struct {
+	force               bool
+	existingDiagrams    map[string]bool
+	outputFormat        OutputFormat
+	changelogLimit      int
+	changelogOrder      ChangelogOrder
+	concurrency         int
+	diffFormat          messageflow.DiffFormat
+	ignorePatterns      []string
+	splitByDomain       bool
+	inlineDiagrams      bool
+	environmentDiagrams bool
+	excludeChannels     []string
+	serviceLink         ServiceLinkFunc
+	renderSettings      string
+	readme              string
+	diagramsDir         string
+	progress            ProgressFunc
+	logger              *slog.Logger
+}
+
+// WithLogger sets the logger reporting rendered and reused diagrams at debug level, slog.Default by default.
+func WithLogger(logger *slog.Logger) Opt {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithConcurrency limits the number of diagrams rendered concurrently, GOMAXPROCS by default.
+// Negative values remove the limit.
+func WithConcurrency(concurrency int) Opt {
+	return func(o *options) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithChangelogLimit limits the README to the given number of most recent changelogs,
+// older ones are archived into CHANGELOG.md. Zero keeps all changelogs in the README.
+// The metadata retains the full history either way.
+func WithChangelogLimit(limit int) Opt {
+	return func(o *options) {
+		o.changelogLimit = limit
+	}
+}
+
+// WithChangelogOrder sets the order changelogs are listed in, ChangelogOrderDesc by default.
+// WithChangelogLimit keeps the most recent changelogs in the README regardless of the order.
+func WithChangelogOrder(order ChangelogOrder) Opt {
+	return func(o *options) {
+		o.changelogOrder = order
+	}
+}
+
+// WithDiffFormat sets the format of message diffs in the changelog, messageflow.DiffFormatCmp by default.
+func WithDiffFormat(format messageflow.DiffFormat) Opt {
+	return func(o *options) {
+		o.diffFormat = format
+	}
+}
+
+// WithIgnorePatterns leaves changes matching the service:channel:field patterns out of the changelog,
+// see messageflow.WithIgnorePatterns.
+func WithIgnorePatterns(patterns ...string) Opt {
+	return func(o *options) {
+		o.ignorePatterns = append(o.ignorePatterns, patterns...)
+	}
+}
+
+// WithOutputFormat sets the format of the generated documentation, OutputFormatMarkdown by default.
+func WithOutputFormat(format OutputFormat) Opt {
+	return func(o *options) {
+		o.outputFormat = format
+	}
+}
+
+// WithSplitByDomain enables writing a README per service domain (Service.Group) in addition to the README,
+// e.g. domains/orders/README.md, listing services of the domain and channels they operate on.
+func WithSplitByDomain(split bool) Opt {
+	return func(o *options) {
+		o.splitByDomain = split
+	}
+}
+
+// WithInlineDiagrams embeds diagrams into the README, HTML and domain pages as base64 data URIs instead of
+// linking files of the diagrams directory, so the pages are self-contained. All diagrams are rendered again
+// as the pages need their content. Markdown renderers don't always display data URIs, e.g. GitHub doesn't.
+func WithInlineDiagrams(inline bool) Opt {
+	return func(o *options) {
+		o.inlineDiagrams = inline
+	}
+}
+
+// WithEnvironmentDiagrams enables rendering a context diagram per environment, the servers channels are available
+// on, when channel availability differs across them. The diagrams are listed in a selector under the context diagram,
+// see messageflow.Schema.ForEnvironment.
+func WithEnvironmentDiagrams(environments bool) Opt {
+	return func(o *options) {
+		o.environmentDiagrams = environments
+	}
+}
+
+// WithExcludeChannelPatterns leaves channels matching any of the patterns, e.g. *.dlq, out of the context
+// and service diagrams, see messageflow.FormatOptions.ExcludeChannelPatterns. Channel sections are kept.
+func WithExcludeChannelPatterns(patterns ...string) Opt {
+	return func(o *options) {
+		o.excludeChannels = append(o.excludeChannels, patterns...)
+	}
+}
+
+// WithReadmeName sets the file name of the README in the output directory, README.md by default,
+// e.g. messageflow.md to slot into an existing docs layout. Domain pages keep their README.md names.
+func WithReadmeName(name string) Opt {
+	return func(o *options) {
+		o.readme = name
+	}
+}
+
+// WithDiagramsDir sets the slash-separated directory of diagrams relative to the output directory,
+// diagrams by default, e.g. assets/messageflow. The directory may be shared with other files, only
+// files named like generated diagrams are removed from it as stale.
+func WithDiagramsDir(dir string) Opt {
+	return func(o *options) {
+		o.diagramsDir = dir
+	}
+}
+
+// ServiceLinkFunc returns the URL the node of the service links to in the context diagram,
+// given the anchor of its README section, e.g. "../README.md#" + anchor. Empty URLs aren't linked.
+type ServiceLinkFunc func(service, anchor string) string
+
+// WithServiceLinks links service nodes of the context diagrams to URLs built by link,
+// so rendered SVGs opened directly or embedded as objects are navigable.
+func WithServiceLinks(link ServiceLinkFunc) Opt {
+	return func(o *options) {
+		o.serviceLink = link
+	}
+}
+
+// ProgressFunc reports diagrams done, rendered or reused, out of the total of the run.
+// It's called concurrently from rendering goroutines as each diagram completes.
+type ProgressFunc func(done, total int)
+
+// WithProgress sets the function reporting progress of rendering diagrams, e.g. to show a progress bar.
+func WithProgress(progress ProgressFunc) Opt {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// WithForce disables incremental regeneration, all diagrams are rendered from scratch.
+func WithForce(force bool) Opt {
+	return func(o *options) {
+		o.force = force
+	}
+}
+
+// WithRenderSettings describes settings of the target affecting rendered diagrams, e.g. the payload style,
+// so that existing diagrams rendered with other settings aren't reused. Contents of template directories
+// aren't compared, pass WithForce after changing templates.
+func WithRenderSettings(settings string) Opt {
+	return func(o *options) {
+		o.renderSettings = settings
+	}
+}
+
+// WithExistingDiagrams sets diagram filenames left by a previous run.
+// Existing diagrams of services and channels unaffected since the existing metadata are not rendered again.
+func WithExistingDiagrams(names ...string) Opt {
+	return func(o *options) {
+		for _, name := range names {
+			o.existingDiagrams[name] = true
+		}
+	}
+}
+
+// Generate generates documentation into outputDir, comparing the schema against
+// messageflow.json from a previous run to maintain the changelog.
+// Only diagrams affected by schema changes are rendered again unless WithForce is used.
+func Generate(
+	ctx context.Context,
+	schema messageflow.Schema,
+	target messageflow.Target,
+	title, outputDir string,
+	opts ...Opt,
+) (*messageflow.Changelog, error) {
+	plan, err := NewPlan(ctx, schema, target, title, outputDir, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.Apply(); err != nil {
+		return nil, err
+	}
+
+	return plan.Artifacts.Changelog, nil
+}
+
+// Plan describes changes Generate makes to an output directory, it's created by NewPlan
+// and carried out by Apply. Paths are relative to the output directory.
+type Plan struct {
+	// Artifacts is the generated documentation to write.
+	Artifacts *Artifacts
+	// Write lists files written, including messageflow.json.
+	Write []string
+	// Delete lists files removed, such as diagrams of removed services and channels.
+	Delete []string
+
+	outputDir   string
+	readme      string
+	diagramsDir string
+	force       bool
+}
+
+// NewPlan generates documentation in memory and determines files it would write into and delete
+// from outputDir, without touching the filesystem.
+func NewPlan(
+	ctx context.Context,
+	schema messageflow.Schema,
+	target messageflow.Target,
+	title, outputDir string,
+	opts ...Opt,
+) (*Plan, error) {
+	existingMetadata, err := ReadMetadata(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing messageflow data: %w", err)
+	}
+
+	o := newOptions(opts)
+	if err := o.validateLayout(); err != nil {
+		return nil, err
+	}
+
+	existingDiagrams, err := readDiagramNames(filepath.Join(outputDir, filepath.FromSlash(o.diagramsDir)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing diagrams: %w", err)
+	}
+
+	opts = append([]Opt{WithExistingDiagrams(existingDiagrams...)}, opts...)
+
+	artifacts, err := Build(ctx, schema, target, title, existingMetadata, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Artifacts:   artifacts,
+		Write:       []string{"messageflow.json", o.readme},
+		outputDir:   outputDir,
+		readme:      o.readme,
+		diagramsDir: o.diagramsDir,
+		force:       o.force,
+	}
+
+	if artifacts.HTML != "" {
+		plan.Write = append(plan.Write, "index.html")
+	}
+
+	if artifacts.PDF != nil {
+		plan.Write = append(plan.Write, pdfFile)
+	}
+
+	if artifacts.ChangelogArchive != "" {
+		plan.Write = append(plan.Write, changelogArchive)
+	} else if _, err := os.Stat(filepath.Join(outputDir, changelogArchive)); err == nil {
+		plan.Delete = append(plan.Delete, changelogArchive)
+	}
+
+	domainPages := make([]string, 0, len(artifacts.Domains))
+	for name := range artifacts.Domains {
+		domainPages = append(domainPages, name)
+	}
+	sort.Strings(domainPages)
+
+	plan.Write = append(plan.Write, domainPages...)
+
+	existingDomainPages, err := readDomainPages(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading existing domain READMEs: %w", err)
+	}
+
+	plan.Delete = append(plan.Delete, staleDomainPages(existingDomainPages, artifacts.Domains)...)
+
+	plan.Write = append(plan.Write, "index.json")
+
+	diagrams := make([]string, 0, len(artifacts.Diagrams))
+	for name := range artifacts.Diagrams {
+		diagrams = append(diagrams, name)
+	}
+	sort.Strings(diagrams)
+
+	for _, name := range diagrams {
+		plan.Write = append(plan.Write, path.Join(o.diagramsDir, name))
+	}
+
+	removed := staleDiagrams(existingDiagrams, artifacts.Index)
+	if plan.force {
+		removed = existingDiagrams
+	}
+
+	for _, name := range removed {
+		if _, ok := artifacts.Diagrams[name]; !ok {
+			plan.Delete = append(plan.Delete, path.Join(o.diagramsDir, name))
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply writes the planned documentation into the output directory.
+func (p *Plan) Apply() error {
+	return writeArtifacts(p.Artifacts, p.outputDir, p.readme, p.diagramsDir, p.force)
+}
+
+// Build generates documentation in memory without touching the filesystem.
+// existingMetadata is the state of a previous run used to detect changes, nil on the first run.
+// Diagrams reused from a previous run (see WithExistingDiagrams) are not included in Artifacts.Diagrams.
+func Build(
+	ctx context.Context,
+	schema messageflow.Schema,
+	target messageflow.Target,
+	title string,
+	existingMetadata *Metadata,
+	opts ...Opt,
+) (*Artifacts, error) {
+	o := newOptions(opts)
+
+	if o.outputFormat != OutputFormatMarkdown && o.outputFormat != OutputFormatHTML && o.outputFormat != OutputFormatPDF {
+		return nil, fmt.Errorf("unsupported output format: %s", o.outputFormat)
+	}
+
+	if o.changelogLimit < 0 {
+		return nil, fmt.Errorf("invalid changelog limit: %d", o.changelogLimit)
+	}
+
+	if o.changelogOrder != ChangelogOrderDesc && o.changelogOrder != ChangelogOrderAsc {
+		return nil, fmt.Errorf("unsupported changelog order: %s", o.changelogOrder)
+	}
+
+	if o.diffFormat != messageflow.DiffFormatCmp && o.diffFormat != messageflow.DiffFormatUnified {
+		return nil, fmt.Errorf("unsupported diff format: %s", o.diffFormat)
+	}
+
+	if err := o.validateLayout(); err != nil {
+		return nil, err
+	}
+
+	metadata, newChangelog := processMetadata(schema, existingMetadata,
+		messageflow.WithDiffFormat(o.diffFormat), messageflow.WithIgnorePatterns(o.ignorePatterns...))
+
+	anchors := newAnchors(schema, title)
+
+	metadata.RenderFingerprint = o.renderFingerprint()
+
+	// The PDF and inlined diagrams embed all diagrams, so none are reused, nor are diagrams rendered
+	// with other options.
+	reuse := func(string) bool { return false }
+	if !o.force && existingMetadata != nil && o.outputFormat != OutputFormatPDF && !o.inlineDiagrams &&
+		existingMetadata.RenderFingerprint == metadata.RenderFingerprint {
+		reuse = reusableDiagrams(existingMetadata.Schema, schema, title, o.existingDiagrams)
+	}
+
+	start := time.Now()
+
+	// Changes are highlighted against the schema of the previous run.
+	var baseline *messageflow.Schema
+	if newChangelog != nil {
+		baseline = &existingMetadata.Schema
+	}
+
+	var serviceLinks map[string]string
+	if o.serviceLink != nil {
+		serviceLinks = make(map[string]string, len(anchors.services))
+		for service, anchor := range anchors.services {
+			if link := o.serviceLink(service, anchor); link != "" {
+				serviceLinks[service] = link
+			}
+		}
+	}
+
+	var environments []string
+	if o.environmentDiagrams {
+		environments = diagramEnvironments(schema)
+	}
+
+	diagrams, reused, err := generateDiagrams(
+		ctx, schema, target, anchors, serviceLinks, reuse, baseline, environments,
+		o.excludeChannels, o.concurrency, o.progress, o.logger,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error generating diagrams: %w", err)
+	}
+
+	summary := Summary{
+		Services:         len(schema.Services),
+		Channels:         len(schema.ChannelNames()),
+		DiagramsRendered: len(diagrams),
+		DiagramsReused:   reused,
+		RenderTime:       time.Since(start),
+	}
+	if newChangelog != nil {
+		summary.Changes = len(newChangelog.Changes)
+	}
+
+	index := newIndex(schema, title, anchors, o.readme, o.diagramsDir)
+	if baseline != nil {
+		index.ContextDiff = path.Join(o.diagramsDir, contextDiffDiagram)
+	}
+
+	for _, env := range environments {
+		index.Environments = append(index.Environments, IndexEnvironment{
+			Name:    env,
+			Context: path.Join(o.diagramsDir, environmentDiagram(env)),
+		})
+	}
+
+	changelogs, archived := splitChangelogs(metadata.Changelogs, o.changelogLimit)
+
+	var archive string
+	if len(archived) > 0 {
+		archive, err = createChangelogArchive(title, archived, o.changelogOrder)
+		if err != nil {
+			return nil, fmt.Errorf("error creating changelog archive: %w", err)
+		}
+
+		index.Changelog = changelogArchive
+	}
+
+	readmePage := page{
+		title:        title,
+		schema:       schema,
+		channelInfo:  extractChannelInfo(schema),
+		changelogs:   changelogs,
+		order:        o.changelogOrder,
+		archive:      index.Changelog,
+		anchors:      anchors,
+		diagrams:     anchors,
+		diagramsDir:  o.diagramsDir,
+		environments: environments,
+	}
+
+	if o.inlineDiagrams {
+		readmePage.inline = diagrams
+	}
+
+	var domains map[string]string
+	if o.splitByDomain {
+		domains, readmePage.domains, err = createDomainPages(
+			schema, title, readmePage.channelInfo, anchors, readmePage.inline, o.readme, o.diagramsDir,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating domain pages: %w", err)
+		}
+
+		for _, link := range readmePage.domains {
+			index.Domains = append(index.Domains, IndexDomain{Name: link.Name, README: link.Path})
+		}
+	}
+
+	readme, err := createContent(OutputFormatMarkdown, readmePage)
+	if err != nil {
+		return nil, fmt.Errorf("error creating README content: %w", err)
+	}
+
+	var html string
+	if o.outputFormat == OutputFormatHTML {
+		html, err = createContent(OutputFormatHTML, readmePage)
+		if err != nil {
+			return nil, fmt.Errorf("error creating HTML content: %w", err)
+		}
+
+		index.HTML = "index.html"
+	}
+
+	var pdf []byte
+	if o.outputFormat == OutputFormatPDF {
+		pdf, err = createPDF(schema, title, anchors, environments, diagrams)
+		if err != nil {
+			return nil, fmt.Errorf("error creating PDF: %w", err)
+		}
+
+		index.PDF = pdfFile
+	}
+
+	return &Artifacts{
+		README:           readme,
+		HTML:             html,
+		PDF:              pdf,
+		Diagrams:         diagrams,
+		Metadata:         metadata,
+		Changelog:        newChangelog,
+		Index:            index,
+		ChangelogArchive: archive,
+		Domains:          domains,
+		Summary:          summary,
+	}, nil
+}
+
+// splitChangelogs sorts changelogs from the most recent one and splits them into
+// the first limit changelogs and the older rest. Zero limit keeps all changelogs.
+func splitChangelogs(changelogs []messageflow.Changelog, limit int) ([]messageflow.Changelog, []messageflow.Changelog) {
+	sorted := sortChangelogs(changelogs, ChangelogOrderDesc)
+	if limit == 0 || len(sorted) <= limit {
+		return sorted, nil
+	}
+
+	return sorted[:limit], sorted[limit:]
+}
+
+// createChangelogArchive renders changelogs left out of the README into CHANGELOG.md.
+func createChangelogArchive(title string, changelogs []messageflow.Changelog, order ChangelogOrder) (string, error) {
+	tmpl, err := template.New("changelog.tmpl").
+		Funcs(template.FuncMap{"SortChangelogs": func(changelogs []messageflow.Changelog) []messageflow.Changelog {
+			return sortChangelogs(changelogs, order)
+		}}).
+		ParseFS(templateFS, "templates/changelog.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("error parsing changelog template: %w", err)
+	}
+
+	data := struct {
+		Title      string
+		Changelogs []messageflow.Changelog
+	}{
+		Title:      title,
+		Changelogs: changelogs,
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error executing changelog template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func newIndex(schema messageflow.Schema, title string, anchors *anchors, readme, diagramsDir string) Index {
+	index := Index{
+		Title:    title,
+		README:   readme,
+		Metadata: "messageflow.json",
+		Context:  path.Join(diagramsDir, contextDiagram),
+		Services: []IndexElement{},
+		Channels: []IndexElement{},
+	}
+
+	for _, service := range schema.ServiceNames() {
+		index.Services = append(index.Services, IndexElement{
+			Name:    service,
+			Anchor:  anchors.services[service],
+			Diagram: path.Join(diagramsDir, serviceDiagram(anchors.services[service])),
+		})
+	}
+
+	for _, channel := range schema.ChannelNames() {
+		index.Channels = append(index.Channels, IndexElement{
+			Name:    channel,
+			Anchor:  anchors.channels[channel],
+			Diagram: path.Join(diagramsDir, channelDiagram(anchors.channels[channel])),
+		})
+	}
+
+	return index
+}
+
+func newOptions(opts []Opt) options {
+	o := options{
+		existingDiagrams: make(map[string]bool),
+		outputFormat:     OutputFormatMarkdown,
+		changelogOrder:   ChangelogOrderDesc,
+		diffFormat:       messageflow.DiffFormatCmp,
+		readme:           "README.md",
+		diagramsDir:      "diagrams",
+		logger:           slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.concurrency == 0 {
+		o.concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	return o
+}
+
+// validateLayout checks the README is a file name and diagrams are in a subdirectory of the output directory,
+// as stale diagrams are removed from it.
+func (o options) validateLayout() error {
+	if o.readme == "" || o.readme == "." || o.readme == ".." || strings.ContainsAny(o.readme, `/\`) {
+		return fmt.Errorf("invalid README name '%s', must be a file name", o.readme)
+	}
+
+	if slices.Contains([]string{"messageflow.json", "index.json", "index.html", pdfFile, changelogArchive}, o.readme) {
+		return fmt.Errorf("invalid README name '%s', it clashes with another generated file", o.readme)
+	}
+
+	if dir := path.Clean(o.diagramsDir); o.diagramsDir == "" || dir == "." || path.IsAbs(dir) ||
+		dir == ".." || strings.HasPrefix(dir, "../") || strings.Contains(o.diagramsDir, `\`) {
+		return fmt.Errorf("invalid diagrams directory '%s', must be a slash-separated subdirectory of the output directory",
+			o.diagramsDir)
+	}
+
+	return nil
+}
+
+// renderFingerprint returns a hash of the options affecting service and channel diagrams, the render settings
+// of the target and excluded channels. Service links only affect context diagrams, which are never reused.
+func (o options) renderFingerprint() string {
+	data, _ := json.Marshal(struct {
+		Settings        string   `json:"settings"`
+		ExcludeChannels []string `json:"excludeChannels"`
+	}{o.renderSettings, o.excludeChannels})
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// reusableDiagrams returns a function reporting whether an existing diagram is still up to date.
+// A service diagram is outdated when the service or any service sharing a channel with it changed,
+// a channel diagram when any service operating on the channel changed. The context diagram is always outdated.
+func reusableDiagrams(
+	oldSchema, newSchema messageflow.Schema,
+	title string,
+	existing map[string]bool,
+) func(string) bool {
+	var (
+		changed    = changedServices(oldSchema, newSchema)
+		oldAnchors = newAnchors(oldSchema, title)
+		curAnchors = newAnchors(newSchema, title)
+		// channelServices maps channels to services operating on them in either schema.
+		channelServices = make(map[string]map[string]bool)
+		reusable        = make(map[string]bool)
+	)
+
+	for _, schema := range []messageflow.Schema{oldSchema, newSchema} {
+		for _, service := range schema.Services {
+			for _, op := range service.Operation {
+				for _, channel := range []*messageflow.Channel{&op.Channel, op.Reply} {
+					if channel == nil {
+						continue
+					}
+
+					if channelServices[channel.Name] == nil {
+						channelServices[channel.Name] = make(map[string]bool)
+					}
+					channelServices[channel.Name][service.Name] = true
+				}
+			}
+		}
+	}
+
+	outdatedServices := make(map[string]bool)
+	for channel, services := range channelServices {
+		affected := false
+		for service := range services {
+			if changed[service] {
+				affected = true
+				break
+			}
+		}
+
+		if !affected {
+			name := channelDiagram(curAnchors.channels[channel])
+			if oldAnchors.channels[channel] == curAnchors.channels[channel] && existing[name] {
+				reusable[name] = true
+			}
+			continue
+		}
+
+		for service := range services {
+			outdatedServices[service] = true
+		}
+	}
+
+	for service, anchor := range curAnchors.services {
+		if changed[service] || outdatedServices[service] || oldAnchors.services[service] != anchor {
+			continue
+		}
+
+		if name := serviceDiagram(anchor); existing[name] {
+			reusable[name] = true
+		}
+	}
+
+	return func(name string) bool {
+		return reusable[name]
+	}
+}
+
+// changedServices returns names of services added, removed or modified between schemas.
+func changedServices(oldSchema, newSchema messageflow.Schema) map[string]bool {
+	encode := func(schema messageflow.Schema) map[string]string {
+		services := make(map[string]string, len(schema.Services))
+		for _, service := range schema.Services {
+			// Services are compared by their JSON form as stored in messageflow.json.
+			data, _ := json.Marshal(service)
+			services[service.Name] = string(data)
+		}
+
+		return services
+	}
+
+	oldServices := encode(oldSchema)
+	newServices := encode(newSchema)
+
+	changed := make(map[string]bool)
+	for name, data := range newServices {
+		if oldServices[name] != data {
+			changed[name] = true
+		}
+	}
+
+	for name := range oldServices {
+		if _, ok := newServices[name]; !ok {
+			changed[name] = true
+		}
+	}
+
+	return changed
+}
+
+// readDiagramNames returns filenames of generated diagrams in the diagrams directory, other files are left out.
+func readDiagramNames(diagramsDir string) ([]string, error) {
+	entries, err := os.ReadDir(diagramsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isDiagramName(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// isDiagramName reports whether the file name is one of a generated diagram.
+func isDiagramName(name string) bool {
+	if path.Ext(name) != ".svg" {
+		return false
+	}
+
+	if name == contextDiagram || name == contextDiffDiagram {
+		return true
+	}
+
+	for _, prefix := range []string{"context-env-", "service_", "channel_"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contextDiagram is the file name of the context diagram.
+const contextDiagram = "context.svg"
+
+// contextDiffDiagram is the file name of the context diagram highlighting changes since the previous run.
+const contextDiffDiagram = "context-diff.svg"
+
+// environmentDiagram returns the file name of the context diagram of the environment.
+func environmentDiagram(env string) string {
+	return "context-env-" + sanitizeAnchor(env) + ".svg"
+}
+
+// diagramEnvironments returns environments of the schema getting their own context diagrams, none unless
+// a channel is available on some of the environments only, as diagrams of all of them would be the same.
+func diagramEnvironments(schema messageflow.Schema) []string {
+	environments := schema.Environments()
+
+	for _, service := range schema.Services {
+		for _, op := range service.Operation {
+			for _, channel := range []*messageflow.Channel{&op.Channel, op.Reply} {
+				if channel == nil {
+					continue
+				}
+
+				// Channels available on all servers of services declaring none are available on all environments.
+				if servers := service.ChannelServers(*channel); len(servers) > 0 && len(servers) < len(environments) {
+					return environments
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// changelogArchive is the file name of changelogs archived by WithChangelogLimit.
+const changelogArchive = "CHANGELOG.md"
+
+// serviceDiagram returns the file name of the diagram of the service with the given anchor.
+func serviceDiagram(anchor string) string {
+	return fmt.Sprintf("service_%s.svg", anchor)
+}
+
+// channelDiagram returns the file name of the diagram of the channel with the given anchor.
+func channelDiagram(anchor string) string {
+	return fmt.Sprintf("channel_%s.svg", anchor)
+}
+
+func processMetadata(
+	schema messageflow.Schema,
+	existingMetadata *Metadata,
+	opts ...messageflow.CompareOpt,
+) (Metadata, *messageflow.Changelog) {
+	var (
+		newChangelog       *messageflow.Changelog
+		existingChangelogs []messageflow.Changelog
+	)
+
+	if existingMetadata != nil {
+		changelog := messageflow.CompareSchemas(existingMetadata.Schema, schema, opts...)
+		if len(changelog.Changes) > 0 {
+			newChangelog = &changelog
+		}
+		existingChangelogs = existingMetadata.Changelogs
+	}
+
+	metadata := Metadata{
+		SchemaVersion: MetadataVersion,
+		Schema:        schema,
+		Changelogs:    existingChangelogs,
+	}
+
+	if newChangelog != nil {
+		metadata.Changelogs = append(metadata.Changelogs, *newChangelog)
+	}
+
+	return metadata, newChangelog
+}
+
+func writeArtifacts(artifacts *Artifacts, outputDir, readme, diagramsDir string, force bool) error {
+	if err := writeMetadata(outputDir, artifacts.Metadata); err != nil {
+		return fmt.Errorf("error writing messageflow data: %w", err)
+	}
+
+	diagramsDir = filepath.Join(outputDir, filepath.FromSlash(diagramsDir))
+	if err := removeStaleDiagrams(diagramsDir, artifacts.Index, force); err != nil {
+		return fmt.Errorf("error removing stale diagrams: %w", err)
+	}
+
+	if err := os.MkdirAll(diagramsDir, 0755); err != nil {
+		return fmt.Errorf("error creating diagrams directory: %w", err)
+	}
+
+	for name, diagram := range artifacts.Diagrams {
+		if err := os.WriteFile(filepath.Join(diagramsDir, name), diagram, 0644); err != nil {
+			return fmt.Errorf("error writing diagram %s: %w", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, readme), []byte(artifacts.README), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", readme, err)
+	}
+
+	if artifacts.HTML != "" {
+		if err := os.WriteFile(filepath.Join(outputDir, "index.html"), []byte(artifacts.HTML), 0644); err != nil {
+			return fmt.Errorf("error writing index.html: %w", err)
+		}
+	}
+
+	if artifacts.PDF != nil {
+		if err := os.WriteFile(filepath.Join(outputDir, pdfFile), artifacts.PDF, 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", pdfFile, err)
+		}
+	}
+
+	if err := writeDomainPages(outputDir, artifacts.Domains); err != nil {
+		return err
+	}
+
+	archivePath := filepath.Join(outputDir, changelogArchive)
+	if artifacts.ChangelogArchive != "" {
+		if err := os.WriteFile(archivePath, []byte(artifacts.ChangelogArchive), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", changelogArchive, err)
+		}
+	} else if err := os.Remove(archivePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing stale %s: %w", changelogArchive, err)
+	}
+
+	indexData, err := json.MarshalIndent(artifacts.Index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling index: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, "index.json"), indexData, 0644); err != nil {
+		return fmt.Errorf("error writing index.json: %w", err)
+	}
+
+	return nil
+}
+
+// removeStaleDiagrams removes diagrams not listed in the index, e.g. of removed services and channels,
+// or all generated diagrams when forced. Other files of the directory are kept.
+func removeStaleDiagrams(diagramsDir string, index Index, force bool) error {
+	names, err := readDiagramNames(diagramsDir)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		names = staleDiagrams(names, index)
+	}
+
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(diagramsDir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// staleDiagrams returns diagram filenames not listed in the index.
+func staleDiagrams(names []string, index Index) []string {
+	current := map[string]bool{path.Base(index.Context): true}
+	if index.ContextDiff != "" {
+		current[path.Base(index.ContextDiff)] = true
+	}
+	for _, env := range index.Environments {
+		current[path.Base(env.Context)] = true
+	}
+	for _, elements := range [][]IndexElement{index.Services, index.Channels} {
+		for _, element := range elements {
+			current[path.Base(element.Diagram)] = true
+		}
+	}
+
+	var stale []string
+	for _, name := range names {
+		if !current[name] {
+			stale = append(stale, name)
+		}
+	}
+
+	return stale
+}
+
+func generateDiagrams(
+	ctx context.Context,
+	schema messageflow.Schema,
+	target messageflow.Target,
+	anchors *anchors,
+	serviceLinks map[string]string,
+	reuse func(name string) bool,
+	baseline *messageflow.Schema,
+	environments []string,
+	excludeChannels []string,
+	concurrency int,
+	progress ProgressFunc,
+	logger *slog.Logger,
+) (map[string][]byte, int, error) {
+	var (
+		mu       sync.Mutex
+		diagrams = make(map[string][]byte)
+		reused   int
+		done     atomic.Int64
+		channels = schema.ChannelNames()
+		total    = 1 + len(schema.Services) + len(channels) + len(environments)
+	)
+
+	if baseline != nil {
+		total++
+	}
+
+	completed := func() {
+		n := done.Add(1)
+		if progress != nil {
+			progress(int(n), total)
+		}
+	}
+
+	renderSchema := func(name string, s messageflow.Schema, formatOpts messageflow.FormatOptions) func() error {
+		return func() error {
+			if reuse(name) {
+				logger.DebugContext(ctx, "skipped up to date diagram", slog.String("diagram", name))
+
+				mu.Lock()
+				reused++
+				mu.Unlock()
+
+				completed()
+
+				return nil
+			}
+
+			start := time.Now()
+
+			diagram, err := renderDiagram(ctx, s, target, formatOpts)
+			if err != nil {
+				return fmt.Errorf("error generating diagram %s: %w", name, err)
+			}
+
+			logger.DebugContext(ctx, "generated diagram",
+				slog.String("diagram", name), slog.Duration("duration", time.Since(start)))
+
+			mu.Lock()
+			diagrams[name] = diagram
+			mu.Unlock()
+
+			completed()
+
+			return nil
+		}
+	}
+
+	render := func(name string, formatOpts messageflow.FormatOptions) func() error {
+		return renderSchema(name, schema, formatOpts)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	g.Go(render(contextDiagram, messageflow.FormatOptions{
+		Mode:                   messageflow.FormatModeContextServices,
+		ExcludeChannelPatterns: excludeChannels,
+		ServiceLinks:           serviceLinks,
+	}))
+
+	if baseline != nil {
+		g.Go(render(contextDiffDiagram, messageflow.FormatOptions{
+			Mode:                   messageflow.FormatModeContextServices,
+			Baseline:               baseline,
+			ExcludeChannelPatterns: excludeChannels,
+			ServiceLinks:           serviceLinks,
+		}))
+	}
+
+	for _, env := range environments {
+		g.Go(renderSchema(environmentDiagram(env), schema.ForEnvironment(env), messageflow.FormatOptions{
+			Mode:                   messageflow.FormatModeContextServices,
+			ExcludeChannelPatterns: excludeChannels,
+			ServiceLinks:           serviceLinks,
+		}))
+	}
+
+	for _, service := range schema.Services {
+		g.Go(render(serviceDiagram(anchors.services[service.Name]), messageflow.FormatOptions{
+			Mode:                   messageflow.FormatModeServiceServices,
+			Service:                service.Name,
+			ExcludeChannelPatterns: excludeChannels,
+		}))
+	}
+
+	for _, channel := range channels {
+		g.Go(render(channelDiagram(anchors.channels[channel]), messageflow.FormatOptions{
+			Mode:         messageflow.FormatModeChannelServices,
+			Channel:      channel,
+			OmitPayloads: true,
+		}))
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, 0, err
+	}
+
+	return diagrams, reused, nil
+}
+
+func renderDiagram(
+	ctx context.Context,
+	schema messageflow.Schema,
+	target messageflow.Target,
+	formatOpts messageflow.FormatOptions,
+) ([]byte, error) {
+	formattedSchema, err := target.FormatSchema(ctx, schema, formatOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error formatting %s schema: %w", formatOpts.Mode, err)
+	}
+
+	diagram, err := target.RenderSchema(ctx, formattedSchema)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering %s diagram: %w", formatOpts.Mode, err)
+	}
+
+	return diagram, nil
+}
+
+// sortChangelogs returns a copy of changelogs sorted by date in the given order, with changes sorted by type,
+// category and name.
+func sortChangelogs(changelogs []messageflow.Changelog, order ChangelogOrder) []messageflow.Changelog {
+	sorted := make([]messageflow.Changelog, len(changelogs))
+	copy(sorted, changelogs)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if order == ChangelogOrderAsc {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+
+		return sorted[i].Date.After(sorted[j].Date)
+	})
+
+	for i := range sorted {
+		sort.Slice(sorted[i].Changes, func(a, b int) bool {
+			if sorted[i].Changes[a].Type != sorted[i].Changes[b].Type {
+				return string(sorted[i].Changes[a].Type) < string(sorted[i].Changes[b].Type)
+			}
+
+			if sorted[i].Changes[a].Category != sorted[i].Changes[b].Category {
+				return sorted[i].Changes[a].Category < sorted[i].Changes[b].Category
+			}
+
+			return sorted[i].Changes[a].Name < sorted[i].Changes[b].Name
+		})
+	}
+
+	return sorted
+}
+
+// page holds the content of a documentation page. Domain pages list a subset of services,
+// while describing channel messages and linking diagrams of the whole schema.
+type page struct {
+	title       string
+	schema      messageflow.Schema
+	channelInfo map[string]ChannelInfo
+	changelogs  []messageflow.Changelog
+	order       ChangelogOrder
+	archive     string
+	// anchors are anchors of the page headings, diagrams anchors naming diagram files in diagramsDir.
+	anchors     *anchors
+	diagrams    *anchors
+	diagramsDir string
+	// inline holds diagrams by name embedded as data URIs instead of linking diagramsDir, nil to link them.
+	inline map[string][]byte
+	// parent links domain pages to the README, domains links the README to domain pages.
+	parent  *pageLink
+	domains []pageLink
+	// boundaries maps channels shared with other domains to their names.
+	boundaries map[string]string
+	// environments lists environments with context diagrams of their own, see diagramEnvironments.
+	environments []string
+}
+
+// pageLink is a link to a documentation page, Path is relative to the linking page.
+type pageLink struct {
+	Name string
+	Path string
+}
+
+// diagramURL returns the link to the named diagram, or its data URI when diagrams are inlined.
+// It's typed as a URL, as HTML templates would otherwise replace data URIs as unsafe.
+func (p page) diagramURL(name string) htmltemplate.URL {
+	if p.inline == nil {
+		return htmltemplate.URL(path.Join(p.diagramsDir, name))
+	}
+
+	return htmltemplate.URL("data:" + mime.TypeByExtension(path.Ext(name)) + ";base64," + base64.StdEncoding.EncodeToString(p.inline[name]))
+}
+
+// createContent renders the page in the given format.
+func createContent(format OutputFormat, p page) (string, error) {
+	funcs := map[string]any{
+		"ServiceAnchor": func(name string) string {
+			return p.anchors.services[name]
+		},
+		"ChannelAnchor": func(name string) string {
+			return p.anchors.channels[name]
+		},
+		"ContextDiagram": func() htmltemplate.URL {
+			return p.diagramURL(contextDiagram)
+		},
+		"EnvironmentDiagram": func(env string) htmltemplate.URL {
+			return p.diagramURL(environmentDiagram(env))
+		},
+		"ServiceDiagram": func(name string) htmltemplate.URL {
+			return p.diagramURL(serviceDiagram(p.diagrams.services[name]))
+		},
+		"ChannelDiagram": func(name string) htmltemplate.URL {
+			return p.diagramURL(channelDiagram(p.diagrams.channels[name]))
+		},
+		"SortChangelogs": func(changelogs []messageflow.Changelog) []messageflow.Changelog {
+			return sortChangelogs(changelogs, p.order)
+		},
+		"PayloadFields":   payloadFields,
+		"EscapeTableCell": escapeTableCell,
+	}
+
+	var tmpl interface {
+		Execute(w io.Writer, data any) error
+	}
+
+	switch format {
+	case OutputFormatMarkdown:
+		t, err := template.New("readme.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/readme.tmpl", "templates/changelog.tmpl")
+		if err != nil {
+			return "", fmt.Errorf("error parsing README template: %w", err)
+		}
+		tmpl = t
+	case OutputFormatHTML:
+		t, err := htmltemplate.New("index.html.tmpl").Funcs(funcs).ParseFS(templateFS, "templates/index.html.tmpl")
+		if err != nil {
+			return "", fmt.Errorf("error parsing HTML template: %w", err)
+		}
+		tmpl = t
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	schema := p.schema
+
+	sort.Slice(schema.Services, func(i, j int) bool {
+		return schema.Services[i].Name < schema.Services[j].Name
+	})
+
+	data := struct {
+		Title            string
+		Parent           *pageLink
+		Services         []messageflow.Service
+		Channels         []string
+		ChannelInfo      map[string]ChannelInfo
+		Boundaries       map[string]string
+		Summaries        map[string]OperationSummary
+		Domains          []pageLink
+		Environments     []string
+		Changelogs       []messageflow.Changelog
+		ChangelogArchive string
+	}{
+		Title:            p.title,
+		Parent:           p.parent,
+		Services:         schema.Services,
+		Channels:         schema.ChannelNames(),
+		ChannelInfo:      p.channelInfo,
+		Boundaries:       p.boundaries,
+		Summaries:        make(map[string]OperationSummary, len(schema.Services)),
+		Domains:          p.domains,
+		Environments:     p.environments,
+		Changelogs:       p.changelogs,
+		ChangelogArchive: p.archive,
+	}
+
+	for _, service := range schema.Services {
+		data.Summaries[service.Name] = summarizeOperations(service)
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error executing %s template: %w", format, err)
+	}
+
+	return buf.String(), nil
+}
+
+// OperationSummary counts operations of a service by direction, hinting whether the service
+// is mostly a producer, a consumer or an orchestrator.
+type OperationSummary struct {
+	Send         int
+	Receive      int
+	RequestReply int
+}
+
+// summarizeOperations counts operations of the service, operations with a reply are counted
+// as request-reply regardless of their action.
+func summarizeOperations(service messageflow.Service) OperationSummary {
+	var summary OperationSummary
+
+	for _, op := range service.Operation {
+		switch {
+		case op.Reply != nil:
+			summary.RequestReply++
+		case op.Action == messageflow.ActionSend:
+			summary.Send++
+		case op.Action == messageflow.ActionReceive:
+			summary.Receive++
+		}
+	}
+
+	return summary
+}
+
+// ChannelInfo represents information about a channel including its messages and payloads
+type ChannelInfo struct {
+	Messages []ChannelMessage
+	// Directional is set when messages sent to the channel conflict with those received from it,
+	// so messages are labeled with their directions, see isDirectional.
+	Directional bool
+	// Security lists unique security requirements of operations on the channel.
+	Security []messageflow.SecurityRequirement
+	// Servers lists servers the channel is available on sorted by name, empty when the specification declares none.
+	Servers []string
+}
+
+// ChannelMessage represents a message in a channel with its payload and direction
+type ChannelMessage struct {
+	Name         string
+	Payload      string
+	Headers      string
+	Examples     []string
+	ContentType  string
+	SchemaFormat string // set when Payload is a raw non JSON schema
+	Direction    string // "send", "receive", "send, receive" for messages carried both ways, "request" or "reply"
+	Service      string
+	// SchemaRef is the payload type shared by reference, see messageflow.Message.SchemaRef.
+	SchemaRef string
+	// SharedWith lists other channels with messages of the same SchemaRef, sorted by name.
+	SharedWith []string
+}
+
+func extractChannelInfo(schema messageflow.Schema) map[string]ChannelInfo {
+	channelInfo := make(map[string]ChannelInfo)
+
+	channelOperations := make(map[string][]struct {
+		service   string
+		operation messageflow.Operation
+	})
+
+	for _, service := range schema.Services {
+		for _, operation := range service.Operation {
+			channelName := operation.Channel.Name
+			channelOperations[channelName] = append(channelOperations[channelName], struct {
+				service   string
+				operation messageflow.Operation
+			}{
+				service:   service.Name,
+				operation: operation,
+			})
+		}
+	}
+
+	// Collect all message variants of each channel, operations of different services may list different ones
+	for channelName, operations := range channelOperations {
+		info := ChannelInfo{
+			Messages: []ChannelMessage{},
+		}
+
+		for _, op := range operations {
+			for _, server := range op.operation.Channel.Servers {
+				if !slices.Contains(info.Servers, server) {
+					info.Servers = append(info.Servers, server)
+				}
+			}
+
+			for _, requirement := range op.operation.Security {
+				if !slices.ContainsFunc(info.Security, func(r messageflow.SecurityRequirement) bool {
+					return r.String() == requirement.String()
+				}) {
+					info.Security = append(info.Security, requirement)
+				}
+			}
+		}
+
+		sort.Strings(info.Servers)
+
+		// Sent and received messages are deduplicated by their content, so messages carried both ways are listed
+		// once while those differing between directions, e.g. in payload, are listed for each direction.
+		seen := make(map[string]int)
+		add := func(messages []messageflow.Message, direction, service string) {
+			for _, msg := range messages {
+				key := direction + ":" + msg.Name
+				if direction == "send" || direction == "receive" {
+					key = strings.Join([]string{
+						msg.Name, msg.Payload, msg.Headers, msg.ContentType, msg.SchemaFormat,
+					}, "\x00")
+				}
+
+				if i, ok := seen[key]; ok {
+					if info.Messages[i].Direction != direction {
+						info.Messages[i].Direction = directionBoth
+					}
+					continue
+				}
+				seen[key] = len(info.Messages)
+
+				info.Messages = append(info.Messages, ChannelMessage{
+					Name:         msg.Name,
+					Payload:      msg.Payload,
+					Headers:      msg.Headers,
+					Examples:     msg.Examples,
+					ContentType:  msg.ContentType,
+					SchemaFormat: msg.SchemaFormat,
+					Direction:    direction,
+					Service:      service,
+					SchemaRef:    msg.SchemaRef,
+				})
+			}
+		}
+
+		// Check if this is a req/reply pattern
+		hasReply := false
+		for _, op := range operations {
+			if op.operation.Reply != nil {
+				hasReply = true
+				break
+			}
+		}
+
+		if hasReply {
+			// For req/reply pattern: include all request messages followed by all reply messages
+			for _, op := range operations {
+				if op.operation.Reply != nil {
+					add(op.operation.Channel.Messages, "request", op.service)
+				}
+			}
+			for _, op := range operations {
+				if op.operation.Reply != nil {
+					add(op.operation.Reply.Messages, "reply", op.service)
+				}
+			}
+		} else {
+			// For send/receive pattern: include messages of receive operations first, then send operations
+			for _, action := range []messageflow.Action{messageflow.ActionReceive, messageflow.ActionSend} {
+				for _, op := range operations {
+					if op.operation.Action == action {
+						add(op.operation.Channel.Messages, string(action), op.service)
+					}
+				}
+			}
+
+			info.Directional = isDirectional(info.Messages)
+		}
+
+		channelInfo[channelName] = info
+	}
+
+	linkSharedTypes(channelInfo)
+
+	return channelInfo
+}
+
+// directionBoth is the direction of messages both sent to and received from a channel.
+const directionBoth = "send, receive"
+
+// isDirectional reports whether some messages are only sent to the channel and others only received from it,
+// e.g. when senders and receivers disagree on the payload. Receivers handling a subset of the sent messages
+// don't make a channel directional.
+func isDirectional(messages []ChannelMessage) bool {
+	var sendOnly, receiveOnly bool
+
+	for _, msg := range messages {
+		switch msg.Direction {
+		case string(messageflow.ActionSend):
+			sendOnly = true
+		case string(messageflow.ActionReceive):
+			receiveOnly = true
+		}
+	}
+
+	return sendOnly && receiveOnly
+}
+
+// linkSharedTypes fills ChannelMessage.SharedWith with other channels carrying messages of the same payload type.
+func linkSharedTypes(channelInfo map[string]ChannelInfo) {
+	channels := make(map[string][]string)
+
+	for channelName, info := range channelInfo {
+		for _, msg := range info.Messages {
+			if msg.SchemaRef != "" && !slices.Contains(channels[msg.SchemaRef], channelName) {
+				channels[msg.SchemaRef] = append(channels[msg.SchemaRef], channelName)
+			}
+		}
+	}
+
+	for channelName, info := range channelInfo {
+		for i, msg := range info.Messages {
+			if msg.SchemaRef == "" {
+				continue
+			}
+
+			for _, other := range channels[msg.SchemaRef] {
+				if other != channelName {
+					info.Messages[i].SharedWith = append(info.Messages[i].SharedWith, other)
+				}
+			}
+
+			sort.Strings(info.Messages[i].SharedWith)
+		}
+	}
+}
+
+// anchors holds unique README anchors of services and channels. The same anchors are used
+// for diagram filenames, so links resolve.
+type anchors struct {
+	services map[string]string
+	channels map[string]string
+}
+
+// newAnchors generates anchors for all README headings in the order they appear in the document,
+// so duplicates get the same -1, -2 suffixes GitHub assigns.
+func newAnchors(schema messageflow.Schema, title string) *anchors {
+	var (
+		s = newSlugger()
+		a = &anchors{
+			services: make(map[string]string),
+			channels: make(map[string]string),
+		}
+		channelInfo = extractChannelInfo(schema)
+	)
+
+	s.slug(title)
+	s.slug("Table of Contents")
+	s.slug("Context")
+	s.slug("Services")
+
+	for _, service := range schema.ServiceNames() {
+		a.services[service] = s.slug(service)
+	}
+
+	s.slug("Channels")
+
+	for _, channel := range schema.ChannelNames() {
+		a.channels[channel] = s.slug(channel)
+
+		if len(channelInfo[channel].Messages) > 0 {
+			s.slug("Messages")
+		}
+	}
+
+	return a
+}
+
+// slugger generates unique GitHub compatible anchors, tracking occurrences across a generation run.
+type slugger struct {
+	occurrences map[string]int
+}
+
+func newSlugger() *slugger {
+	return &slugger{
+		occurrences: make(map[string]int),
+	}
+}
+
+// slug returns a GitHub compatible anchor for the name, adding a -1, -2 suffix on collision.
+func (s *slugger) slug(name string) string {
+	original := sanitizeAnchor(name)
+	anchor := original
+
+	for {
+		if _, exists := s.occurrences[anchor]; !exists {
+			break
+		}
+
+		s.occurrences[original]++
+		anchor = fmt.Sprintf("%s-%d", original, s.occurrences[original])
+	}
+
+	s.occurrences[anchor] = 0
+
+	return anchor
+}
+
+// sanitizeAnchor converts a heading into an anchor following GitHub's algorithm:
+// lowercase, drop everything except letters, numbers, underscores, hyphens and spaces,
+// then replace spaces with hyphens.
+func sanitizeAnchor(name string) string {
+	anchor := strings.ToLower(strings.TrimSpace(name))
+
+	var result strings.Builder
+
+	for _, r := range anchor {
+		switch {
+		case r == ' ':
+			result.WriteRune('-')
+		case unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || unicode.Is(unicode.Pc, r) || r == '-':
+			result.WriteRune(r)
+		}
+	}
+
+	return result.String()
+}
+
+// ReadMetadata reads messageflow.json persisted by a previous run from outputDir.
+// Files of older versions are migrated to MetadataVersion, newer versions are rejected.
+// Returns nil without error when the file doesn't exist.
+func ReadMetadata(outputDir string) (*Metadata, error) {
+	dataPath := filepath.Join(outputDir, "messageflow.json")
+
+	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	fileData, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading messageflow data file: %w", err)
+	}
+
+	return parseMetadata(fileData)
+}
+
+// ReadMetadataAtRef works like ReadMetadata, reading messageflow.json as of the git ref, e.g. main,
+// in the repository of the working directory. It returns nil when the file doesn't exist on the ref.
+func ReadMetadataAtRef(ctx context.Context, ref, outputDir string) (*Metadata, error) {
+	fileData, ok, err := gitref.ReadFile(ctx, ".", ref, filepath.Join(outputDir, "messageflow.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	return parseMetadata(fileData)
+}
+
+func parseMetadata(fileData []byte) (*Metadata, error) {
+	fileData, err := migrateMetadata(fileData)
+	if err != nil {
+		return nil, err
+	}
+
+	var messageFlowData Metadata
+	if err := json.Unmarshal(fileData, &messageFlowData); err != nil {
+		return nil, fmt.Errorf("error unmarshaling messageflow data: %w", err)
+	}
+
+	return &messageFlowData, nil
+}
+
+// metadataMigrations upgrade decoded messageflow.json by one version, the migration at index i
+// upgrades version i+1.
+var metadataMigrations = []func(data map[string]any){
+	migrateChannelMessage,
+}
+
+// migrateMetadata upgrades messageflow.json data of older versions to MetadataVersion.
+func migrateMetadata(fileData []byte) ([]byte, error) {
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(fileData, &header); err != nil {
+		return nil, fmt.Errorf("error unmarshaling messageflow data: %w", err)
+	}
+
+	version := max(header.SchemaVersion, 1)
+
+	switch {
+	case version > MetadataVersion:
+		return nil, fmt.Errorf(
+			"messageflow data version %d is newer than the supported version %d, upgrade messageflow",
+			version, MetadataVersion,
+		)
+	case version == MetadataVersion:
+		return fileData, nil
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(fileData, &data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling messageflow data: %w", err)
+	}
+
+	for _, migrate := range metadataMigrations[version-1:] {
+		migrate(data)
+	}
+
+	data["schemaVersion"] = MetadataVersion
+
+	fileData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling migrated messageflow data: %w", err)
+	}
+
+	return fileData, nil
+}
+
+// migrateChannelMessage converts the single message of channels in version 1 into a list of messages.
+func migrateChannelMessage(data map[string]any) {
+	schema, _ := data["schema"].(map[string]any)
+	services, _ := schema["services"].([]any)
+
+	for _, service := range services {
+		service, _ := service.(map[string]any)
+		operations, _ := service["operations"].([]any)
+
+		for _, op := range operations {
+			op, _ := op.(map[string]any)
+
+			for _, key := range []string{"channel", "reply"} {
+				channel, ok := op[key].(map[string]any)
+				if !ok {
+					continue
+				}
+
+				message, ok := channel["message"]
+				if !ok {
+					continue
+				}
+
+				if _, ok := channel["messages"]; !ok && message != nil {
+					channel["messages"] = []any{message}
+				}
+
+				delete(channel, "message")
+			}
+		}
+	}
+}
+
+func writeMetadata(outputDir string, data Metadata) error {
+	dataPath := filepath.Join(outputDir, "messageflow.json")
+
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling messageflow data: %w", err)
+	}
+
+	if err := os.WriteFile(dataPath, jsonData, 0644); err != nil {
+		return fmt.Errorf("error writing messageflow data file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,1410 @@
+package docs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holydocs/messageflow/pkg/internal/testutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/target/d2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(payload string) messageflow.Schema {
+		return messageflow.Schema{
+			Services: []messageflow.Service{
+				{
+					Name:        "User Service",
+					Description: "Manages users.",
+					Operation: []messageflow.Operation{
+						{
+							Action:  messageflow.ActionSend,
+							Summary: "Publish created users",
+							Channel: messageflow.Channel{
+								Name:     "user.created",
+								Messages: []messageflow.Message{{Name: "UserCreated", Payload: payload}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	schema := newSchema(`{"id": "string"}`)
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"context.svg":              []byte("context_services:"),
+		"service_user-service.svg": []byte("service_services:User Service"),
+		"channel_usercreated.svg":  []byte("channel_services:user.created"),
+	}, artifacts.Diagrams)
+	assert.Contains(t, artifacts.README, "# Docs")
+	assert.Contains(t, artifacts.README, "![User Service Service Channels](diagrams/service_user-service.svg)")
+	assert.Contains(t, artifacts.README, "![user.created Channel Services](diagrams/channel_usercreated.svg)")
+	assert.Contains(t, artifacts.README, "Manages users.\n\n| Send | Receive | Request/Reply |\n|------|---------|---------------|\n| 1 | 0 | 0 |\n\n")
+	assert.Contains(t, artifacts.README, "#### Operations\n\n- **send** [user.created](#usercreated): Publish created users\n")
+	assert.Nil(t, artifacts.Changelog)
+	assert.Equal(t, schema, artifacts.Metadata.Schema)
+	assert.Equal(t, Index{
+		Title:    "Docs",
+		README:   "README.md",
+		Metadata: "messageflow.json",
+		Context:  "diagrams/context.svg",
+		Services: []IndexElement{
+			{Name: "User Service", Anchor: "user-service", Diagram: "diagrams/service_user-service.svg"},
+		},
+		Channels: []IndexElement{
+			{Name: "user.created", Anchor: "usercreated", Diagram: "diagrams/channel_usercreated.svg"},
+		},
+	}, artifacts.Index)
+
+	artifacts, err = Build(context.Background(), newSchema(`{"id": "string[uuid]"}`), testutil.Target{}, "Docs", &artifacts.Metadata)
+	require.NoError(t, err)
+	require.NotNil(t, artifacts.Changelog)
+	assert.Len(t, artifacts.Changelog.Changes, 1)
+	assert.Len(t, artifacts.Metadata.Changelogs, 1)
+	assert.Contains(t, artifacts.README, "## Changelog")
+	assert.NotContains(t, artifacts.README, "Migration note")
+
+	noted := newSchema(`{"uuid": "string[uuid]"}`)
+	noted.Services[0].Operation[0].Channel.Messages[0].DeprecationNote = "id is renamed to uuid."
+
+	artifacts, err = Build(context.Background(), noted, testutil.Target{}, "Docs", &artifacts.Metadata)
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README,
+		"- **changed** message: Messages changed for operation 'send' on channel 'user.created' in service 'User Service'\n"+
+			"  > **Migration note:** id is renamed to uuid.\n```json\n")
+}
+
+func TestSummarizeOperations(t *testing.T) {
+	t.Parallel()
+
+	service := messageflow.Service{
+		Name: "Order Service",
+		Operation: []messageflow.Operation{
+			{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "order.created"}},
+			{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "order.cancelled"}},
+			{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "payment.completed"}},
+			{
+				Action:  messageflow.ActionSend,
+				Channel: messageflow.Channel{Name: "inventory.reserve"},
+				Reply:   &messageflow.Channel{Name: "inventory.reserve.reply"},
+			},
+			{
+				Action:  messageflow.ActionReceive,
+				Channel: messageflow.Channel{Name: "order.status"},
+				Reply:   &messageflow.Channel{Name: "order.status.reply"},
+			},
+		},
+	}
+
+	assert.Equal(t, OperationSummary{Send: 2, Receive: 1, RequestReply: 2}, summarizeOperations(service))
+	assert.Equal(t, OperationSummary{}, summarizeOperations(messageflow.Service{Name: "Idle Service"}))
+}
+
+func TestBuildDiffFormat(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(payload string) messageflow.Schema {
+		return messageflow.Schema{
+			Services: []messageflow.Service{
+				{
+					Name: "User Service",
+					Operation: []messageflow.Operation{
+						{
+							Action: messageflow.ActionSend,
+							Channel: messageflow.Channel{
+								Name:     "user.created",
+								Messages: []messageflow.Message{{Name: "UserCreated", Payload: payload}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	artifacts, err := Build(context.Background(), newSchema(`{"id": "string"}`), testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+
+	metadata := artifacts.Metadata
+	schema := newSchema(`{"id": "string[uuid]"}`)
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", &metadata)
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README, "```json\n")
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", &metadata,
+		WithDiffFormat(messageflow.DiffFormatUnified))
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README, "```diff\n--- old\n+++ new\n")
+	assert.Contains(t, artifacts.README, "-    \"id\": \"string\"\n+    \"id\": \"string[uuid]\"\n")
+
+	_, err = Build(context.Background(), schema, testutil.Target{}, "Docs", &metadata, WithDiffFormat("html"))
+	require.EqualError(t, err, "unsupported diff format: html")
+}
+
+func TestBuildHTML(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:        "User Service",
+				Description: "Manages <users>.",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "user.created",
+							Messages: []messageflow.Message{{Name: "UserCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+	assert.Empty(t, artifacts.HTML)
+	assert.Empty(t, artifacts.Index.HTML)
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithOutputFormat(OutputFormatHTML))
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README, "# Docs")
+	assert.Contains(t, artifacts.HTML, "<h1>Docs</h1>")
+	assert.Contains(t, artifacts.HTML, "<p>Manages &lt;users&gt;.</p>")
+	assert.Contains(t, artifacts.HTML, "<tr><td>1</td><td>0</td><td>0</td></tr>")
+	assert.Contains(t, artifacts.HTML, `<a href="#user-service">User Service</a>`)
+	assert.Contains(t, artifacts.HTML, `<img src="diagrams/channel_usercreated.svg" alt="user.created Channel Services">`)
+	assert.Contains(t, artifacts.HTML, "<tr><td><code>id</code></td><td>string</td><td></td></tr>")
+	assert.Equal(t, "index.html", artifacts.Index.HTML)
+
+	_, err = Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithOutputFormat("docx"))
+	require.EqualError(t, err, "unsupported output format: docx")
+}
+
+func TestBuildInlineDiagrams(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+		},
+	}
+
+	dataURI := func(content string) string {
+		return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(content))
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil,
+		WithOutputFormat(OutputFormatHTML), WithInlineDiagrams(true))
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README, "![Context]("+dataURI("context_services:")+")")
+	assert.Contains(t, artifacts.README,
+		"![User Service Service Channels]("+dataURI("service_services:User Service")+")")
+	assert.NotContains(t, artifacts.README, "diagrams/")
+	// HTML escapes + in attributes, browsers decode it.
+	assert.Contains(t, artifacts.HTML, `<img src="`+strings.ReplaceAll(dataURI("channel_services:user.created"), "+", "&#43;")+
+		`" alt="user.created Channel Services">`)
+
+	// Unchanged diagrams of a previous run are rendered again to be inlined.
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", &artifacts.Metadata,
+		WithInlineDiagrams(true), WithExistingDiagrams("context.svg", "service_user-service.svg", "channel_usercreated.svg"))
+	require.NoError(t, err)
+	assert.Len(t, artifacts.Diagrams, 3)
+	assert.Contains(t, artifacts.README, "![Context]("+dataURI("context_services:")+")")
+}
+
+// linksTarget formats service links of the context diagram.
+type linksTarget struct {
+	testutil.Target
+}
+
+func (linksTarget) FormatSchema(
+	_ context.Context,
+	_ messageflow.Schema,
+	opts messageflow.FormatOptions,
+) (messageflow.FormattedSchema, error) {
+	var links []string
+	for _, service := range slices.Sorted(maps.Keys(opts.ServiceLinks)) {
+		links = append(links, service+"="+opts.ServiceLinks[service])
+	}
+
+	return messageflow.FormattedSchema{Type: "fake", Data: []byte(strings.Join(links, ","))}, nil
+}
+
+func TestBuildServiceLinks(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+			{
+				Name: "Mail Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, linksTarget{}, "Docs", nil,
+		WithServiceLinks(func(service, anchor string) string {
+			if service == "Mail Service" {
+				return ""
+			}
+
+			return "../README.md#" + anchor
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, "User Service=../README.md#user-service", string(artifacts.Diagrams["context.svg"]))
+	assert.Empty(t, artifacts.Diagrams["service_user-service.svg"])
+
+	artifacts, err = Build(context.Background(), schema, linksTarget{}, "Docs", nil)
+	require.NoError(t, err)
+	assert.Empty(t, artifacts.Diagrams["context.svg"])
+}
+
+func TestBuildProgress(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "order.placed"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "order.cancelled"}},
+				},
+			},
+			{
+				Name: "Billing Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "order.placed"}},
+				},
+			},
+		},
+	}
+
+	var (
+		mu    sync.Mutex
+		done  []int
+		total = 1 + 2 + 2 // context, services and channels
+	)
+
+	_, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithConcurrency(2),
+		WithProgress(func(n, all int) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Equal(t, total, all)
+			done = append(done, n)
+		}))
+	require.NoError(t, err)
+
+	sort.Ints(done)
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, done)
+}
+
+func TestBuildSecurity(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "order.placed"},
+						Security: []messageflow.SecurityRequirement{
+							{Scheme: "orderAuth", Type: "oauth2", Scopes: []string{"orders:write", "orders:read"}},
+							{Scheme: "apiKey", Type: "httpApiKey"},
+						},
+					},
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "order.cancelled"},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithOutputFormat(OutputFormatHTML))
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "(diagrams/channel_orderplaced.svg)\n\n**Security**:\n\n"+
+		"- orderAuth (oauth2): orders:write, orders:read\n- apiKey (httpApiKey)\n")
+	assert.Equal(t, 1, strings.Count(artifacts.README, "**Security**"))
+	assert.Contains(t, artifacts.HTML, "<li>orderAuth (oauth2): orders:write, orders:read</li>\n<li>apiKey (httpApiKey)</li>")
+}
+
+func TestBuildSharedTypes(t *testing.T) {
+	t.Parallel()
+
+	profile := messageflow.Message{Name: "UserCreated", Payload: `{"id": "string"}`, SchemaRef: "UserProfile"}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created", Messages: []messageflow.Message{profile}},
+					},
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.updated", Messages: []messageflow.Message{
+							{Name: "UserUpdated", Payload: profile.Payload, SchemaRef: "UserProfile"},
+						}},
+					},
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.deleted", Messages: []messageflow.Message{
+							{Name: "UserDeleted", Payload: profile.Payload, SchemaRef: "UserRef"},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithOutputFormat(OutputFormatHTML))
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "**UserCreated**\n\nShared type: `UserProfile`, also used on [user.updated](#userupdated)\n\n| Field")
+	assert.Contains(t, artifacts.README, "**UserUpdated**\n\nShared type: `UserProfile`, also used on [user.created](#usercreated)\n")
+	assert.NotContains(t, artifacts.README, "`UserRef`")
+	assert.Contains(t, artifacts.HTML, `<p>Shared type: <code>UserProfile</code>, also used on <a href="#userupdated">user.updated</a></p>`)
+}
+
+func TestBuildRawPayload(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Payment Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "payment.captured",
+							Messages: []messageflow.Message{
+								{
+									Name:         "PaymentCaptured",
+									Payload:      "message PaymentCaptured {\n  string id = 1;\n}",
+									ContentType:  "application/protobuf",
+									SchemaFormat: "application/vnd.google.protobuf;version=3",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "**PaymentCaptured** `application/protobuf`\n```\nmessage PaymentCaptured {")
+	assert.NotContains(t, artifacts.README, "```json")
+}
+
+func TestBuildMessageVariants(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "user.events",
+							Messages: []messageflow.Message{
+								{Name: "UserCreated", Payload: `{"id": "string"}`},
+								{Name: "UserDeleted", Payload: `{"id": "string"}`, Headers: `{"traceparent": "string"}`},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name: "Audit Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionReceive,
+						Channel: messageflow.Channel{
+							Name:     "user.events",
+							Messages: []messageflow.Message{{Name: "UserCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "#### Messages\n\n**UserCreated**\n\n| Field | Type | Format |\n"+
+		"|-------|------|--------|\n| `id` | string |  |\n\n**UserDeleted**\n\n| Field |")
+	assert.Contains(t, artifacts.README, "| `id` | string |  |\n\n| Header | Type | Format |\n"+
+		"|--------|------|--------|\n| `traceparent` | string |  |\n")
+	assert.Equal(t, 1, strings.Count(artifacts.README, "**UserCreated**"))
+}
+
+func TestBuildMessageDirections(t *testing.T) {
+	t.Parallel()
+
+	service := func(name string, action messageflow.Action, messages ...messageflow.Message) messageflow.Service {
+		return messageflow.Service{
+			Name: name,
+			Operation: []messageflow.Operation{
+				{Action: action, Channel: messageflow.Channel{Name: "user.events", Messages: messages}},
+			},
+		}
+	}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			service("User Service", messageflow.ActionSend,
+				messageflow.Message{Name: "UserCreated", Payload: `{"id": "string"}`},
+				messageflow.Message{Name: "UserUpdated", Payload: `{"id": "string", "name": "string"}`},
+			),
+			service("Audit Service", messageflow.ActionReceive,
+				messageflow.Message{Name: "UserCreated", Payload: `{"id": "string"}`},
+				messageflow.Message{Name: "UserUpdated", Payload: `{"id": "integer"}`},
+			),
+		},
+	}
+
+	info := extractChannelInfo(schema)["user.events"]
+	assert.True(t, info.Directional)
+
+	directions := make([]string, 0, len(info.Messages))
+	for _, msg := range info.Messages {
+		directions = append(directions, msg.Direction+": "+msg.Name)
+	}
+	assert.Equal(t, []string{
+		"send, receive: UserCreated", "receive: UserUpdated", "send: UserUpdated",
+	}, directions)
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "**send, receive**: UserCreated\n")
+	assert.Contains(t, artifacts.README, "**receive**: UserUpdated\n\n| Field | Type | Format |\n"+
+		"|-------|------|--------|\n| `id` | integer |  |\n")
+	assert.Contains(t, artifacts.README, "**send**: UserUpdated\n")
+}
+
+func TestBuildEnvironments(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "User Service", Operation: []messageflow.Operation{
+				{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created", Servers: []string{"production", "staging"}}},
+				{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.debug", Servers: []string{"staging"}}},
+			}},
+			{Name: "Debug Service", Operation: []messageflow.Operation{
+				{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.debug", Servers: []string{"staging"}}},
+			}},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil,
+		WithOutputFormat(OutputFormatHTML), WithEnvironmentDiagrams(true))
+	require.NoError(t, err)
+
+	assert.Equal(t, []IndexEnvironment{
+		{Name: "production", Context: "diagrams/context-env-production.svg"},
+		{Name: "staging", Context: "diagrams/context-env-staging.svg"},
+	}, artifacts.Index.Environments)
+	assert.Contains(t, artifacts.Diagrams, "context-env-production.svg")
+	assert.Contains(t, artifacts.Diagrams, "context-env-staging.svg")
+
+	assert.Contains(t, artifacts.README, "<summary>staging</summary>\n\n![staging Context](diagrams/context-env-staging.svg)\n")
+	assert.Contains(t, artifacts.README, "**Servers**: production, staging\n")
+	assert.Contains(t, artifacts.HTML, `<img src="diagrams/context-env-production.svg" alt="production Context">`)
+	assert.Contains(t, artifacts.HTML, "<p><strong>Servers</strong>: staging</p>")
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", nil)
+	require.NoError(t, err)
+	assert.Empty(t, artifacts.Index.Environments)
+	assert.NotContains(t, artifacts.Diagrams, "context-env-staging.svg")
+
+	// Channels available on the same environments don't call for diagrams of their own.
+	schema = messageflow.Schema{Services: []messageflow.Service{{Name: "User Service", Operation: []messageflow.Operation{
+		{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created", Servers: []string{"production", "staging"}}},
+	}}}}
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithEnvironmentDiagrams(true))
+	require.NoError(t, err)
+
+	assert.Empty(t, artifacts.Index.Environments)
+	assert.NotContains(t, artifacts.README, "<details>")
+	assert.Contains(t, artifacts.README, "**Servers**: production, staging\n")
+
+	// Channels without servers are available on all servers of their service and don't list them.
+	schema = messageflow.Schema{Services: []messageflow.Service{
+		{Name: "User Service", Servers: []string{"production", "staging"}, Operation: []messageflow.Operation{
+			{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+		}},
+		{Name: "Audit Service", Servers: []string{"production"}, Operation: []messageflow.Operation{
+			{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.created"}},
+		}},
+	}}
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", nil, WithEnvironmentDiagrams(true))
+	require.NoError(t, err)
+
+	assert.Len(t, artifacts.Index.Environments, 2)
+	assert.NotContains(t, artifacts.README, "**Servers**")
+}
+
+func TestBuildIgnorePatterns(t *testing.T) {
+	t.Parallel()
+
+	schema := func(payload string) messageflow.Schema {
+		return messageflow.Schema{Services: []messageflow.Service{{
+			Name: "User Service",
+			Operation: []messageflow.Operation{{
+				Action: messageflow.ActionSend,
+				Channel: messageflow.Channel{
+					Name:     "user.created",
+					Messages: []messageflow.Message{{Name: "UserCreated", Payload: payload}},
+				},
+			}},
+		}}}
+	}
+
+	existing := &Metadata{Schema: schema(`{"id": "string", "build": "string"}`)}
+
+	artifacts, err := Build(context.Background(), schema(`{"id": "string", "build": "integer"}`), testutil.Target{},
+		"Docs", existing, WithIgnorePatterns("*:*:build"))
+	require.NoError(t, err)
+	assert.Nil(t, artifacts.Changelog)
+	assert.JSONEq(t, `{"id": "string", "build": "integer"}`,
+		artifacts.Metadata.Schema.Services[0].Operation[0].Channel.Messages[0].Payload)
+
+	artifacts, err = Build(context.Background(), schema(`{"id": "integer", "build": "integer"}`), testutil.Target{},
+		"Docs", existing, WithIgnorePatterns("*:*:build"))
+	require.NoError(t, err)
+	require.NotNil(t, artifacts.Changelog)
+	assert.Len(t, artifacts.Changelog.Changes, 1)
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, action, channel string) messageflow.Service {
+		return messageflow.Service{
+			Name: name,
+			Operation: []messageflow.Operation{
+				{
+					Action:  messageflow.Action(action),
+					Channel: messageflow.Channel{Name: channel},
+				},
+			},
+		}
+	}
+
+	outputDir := t.TempDir()
+	diagramsDir := filepath.Join(outputDir, "diagrams")
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			service("A", "send", "a.events"),
+			service("B", "receive", "a.events"),
+			service("C", "send", "c.events"),
+		},
+	}
+
+	_, err := Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	for _, name := range []string{"context.svg", "service_a.svg", "service_b.svg", "service_c.svg", "channel_cevents.svg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(diagramsDir, name), []byte("previous"), 0644))
+	}
+
+	schema.Services[0].Description = "Changed."
+	schema.Services = schema.Services[:2]
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	readDiagram := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(diagramsDir, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "context_services:", readDiagram("context.svg"))
+	assert.Equal(t, "service_services:A", readDiagram("service_a.svg"))
+	assert.Equal(t, "service_services:B", readDiagram("service_b.svg"))
+	assert.NoFileExists(t, filepath.Join(diagramsDir, "service_c.svg"))
+	assert.NoFileExists(t, filepath.Join(diagramsDir, "channel_cevents.svg"))
+
+	schema.Services = append(schema.Services, service("D", "send", "d.events"))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(diagramsDir, "service_a.svg"), []byte("previous"), 0644))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", readDiagram("service_a.svg"))
+	assert.Equal(t, "service_services:D", readDiagram("service_d.svg"))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, WithForce(true))
+	require.NoError(t, err)
+	assert.Equal(t, "service_services:A", readDiagram("service_a.svg"))
+}
+
+func TestBuildRenderSettings(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+		},
+	}
+	existing := WithExistingDiagrams("context.svg", "service_user-service.svg", "channel_usercreated.svg")
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", nil,
+		WithRenderSettings("payload-style=table"))
+	require.NoError(t, err)
+
+	metadata := artifacts.Metadata
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", &metadata,
+		existing, WithRenderSettings("payload-style=table"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, artifacts.Summary.DiagramsReused)
+
+	tests := []struct {
+		name string
+		opts []Opt
+		// legacy drops the fingerprint of the previous run, as in metadata written by older versions.
+		legacy bool
+	}{
+		{
+			name: "render settings",
+			opts: []Opt{WithRenderSettings("payload-style=code")},
+		},
+		{
+			name: "excluded channels",
+			opts: []Opt{WithRenderSettings("payload-style=table"), WithExcludeChannelPatterns("*.internal")},
+		},
+		{
+			name:   "no fingerprint",
+			opts:   []Opt{WithRenderSettings("payload-style=table")},
+			legacy: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			previous := metadata
+			if tt.legacy {
+				previous.RenderFingerprint = ""
+			}
+
+			artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", &previous,
+				append(tt.opts, existing)...)
+			require.NoError(t, err)
+			assert.Zero(t, artifacts.Summary.DiagramsReused)
+		})
+	}
+}
+
+func TestGenerateLogger(t *testing.T) {
+	t.Parallel()
+
+	outputDir := t.TempDir()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "A",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "a.events"}},
+				},
+			},
+		},
+	}
+
+	_, err := Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, WithLogger(logger))
+	require.NoError(t, err)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `msg="generated diagram" diagram=context.svg duration=`)
+	assert.Contains(t, logs, `msg="skipped up to date diagram" diagram=service_a.svg`)
+	assert.Contains(t, logs, `msg="skipped up to date diagram" diagram=channel_aevents.svg`)
+}
+
+func TestNewPlanSummary(t *testing.T) {
+	t.Parallel()
+
+	outputDir := t.TempDir()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "A",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "a.events"}},
+				},
+			},
+			{
+				Name: "B",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "a.events"}},
+				},
+			},
+		},
+	}
+
+	plan, err := NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+	require.NoError(t, plan.Apply())
+
+	summary := plan.Artifacts.Summary
+	assert.Equal(t, 2, summary.Services)
+	assert.Equal(t, 1, summary.Channels)
+	assert.Equal(t, 4, summary.DiagramsRendered)
+	assert.Equal(t, 0, summary.DiagramsReused)
+	assert.Equal(t, 0, summary.Changes)
+
+	schema.Services = append(schema.Services, messageflow.Service{
+		Name: "C",
+		Operation: []messageflow.Operation{
+			{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "c.events"}},
+		},
+	})
+
+	plan, err = NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	summary = plan.Artifacts.Summary
+	assert.Equal(t, 3, summary.Services)
+	assert.Equal(t, 2, summary.Channels)
+	assert.Equal(t, 4, summary.DiagramsRendered, "service C, its channel, context and context diff")
+	assert.Equal(t, 3, summary.DiagramsReused)
+	assert.Equal(t, 1, summary.Changes)
+
+	summary.RenderTime = 1500 * time.Millisecond
+
+	data, err := json.Marshal(summary)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"services": 3,
+		"channels": 2,
+		"diagramsRendered": 4,
+		"diagramsReused": 3,
+		"changes": 1,
+		"renderTimeMs": 1500
+	}`, string(data))
+}
+
+func TestGenerateChangelogLimit(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created"},
+					},
+				},
+			},
+		},
+	}
+
+	changelog := func(day int, name string) messageflow.Changelog {
+		return messageflow.Changelog{
+			Date: time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC),
+			Changes: []messageflow.Change{
+				{Type: messageflow.ChangeTypeAdded, Category: "service", Name: name, Details: "Added " + name},
+			},
+		}
+	}
+
+	metadata := &Metadata{
+		Schema: schema,
+		Changelogs: []messageflow.Changelog{
+			changelog(1, "Oldest Service"),
+			changelog(3, "Newest Service"),
+			changelog(2, "Older Service"),
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", metadata, WithChangelogLimit(1))
+	require.NoError(t, err)
+
+	assert.Len(t, artifacts.Metadata.Changelogs, 3)
+	assert.Contains(t, artifacts.README, "Added Newest Service")
+	assert.NotContains(t, artifacts.README, "Added Older Service")
+	assert.Contains(t, artifacts.README, "Older changes are archived in [CHANGELOG.md](CHANGELOG.md).")
+	assert.Equal(t, "CHANGELOG.md", artifacts.Index.Changelog)
+	assert.Equal(t, `# Docs Changelog
+
+### 2025-01-02
+- **added** service: Added Older Service
+
+### 2025-01-01
+- **added** service: Added Oldest Service
+`, artifacts.ChangelogArchive)
+
+	outputDir := t.TempDir()
+	require.NoError(t, writeMetadata(outputDir, *metadata))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, WithChangelogLimit(2))
+	require.NoError(t, err)
+
+	archive, err := os.ReadFile(filepath.Join(outputDir, "CHANGELOG.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(archive), "Added Oldest Service")
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(outputDir, "CHANGELOG.md"))
+
+	readme, err := os.ReadFile(filepath.Join(outputDir, "README.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(readme), "Added Oldest Service")
+	assert.NotContains(t, string(readme), "CHANGELOG.md")
+}
+
+func TestBuildChangelogOrder(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:      "User Service",
+				Operation: []messageflow.Operation{{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}}},
+			},
+		},
+	}
+
+	changelog := func(day int, name string) messageflow.Changelog {
+		return messageflow.Changelog{
+			Date: time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC),
+			Changes: []messageflow.Change{
+				{Type: messageflow.ChangeTypeAdded, Category: messageflow.ChangeCategoryService, Name: name, Details: "Added " + name},
+			},
+		}
+	}
+
+	metadata := &Metadata{
+		Schema:     schema,
+		Changelogs: []messageflow.Changelog{changelog(2, "Middle"), changelog(3, "Newest"), changelog(1, "Oldest")},
+	}
+
+	artifacts, err := Build(context.Background(), schema, testutil.Target{}, "Docs", metadata,
+		WithChangelogOrder(ChangelogOrderAsc), WithChangelogLimit(2))
+	require.NoError(t, err)
+
+	assert.Contains(t, artifacts.README, "### 2025-01-02\n- **added** service: Added Middle\n\n### 2025-01-03\n")
+	assert.NotContains(t, artifacts.README, "Added Oldest")
+	assert.Contains(t, artifacts.ChangelogArchive, "Added Oldest")
+
+	artifacts, err = Build(context.Background(), schema, testutil.Target{}, "Docs", metadata)
+	require.NoError(t, err)
+	assert.Contains(t, artifacts.README, "### 2025-01-03\n- **added** service: Added Newest\n\n### 2025-01-02\n")
+
+	_, err = Build(context.Background(), schema, testutil.Target{}, "Docs", metadata, WithChangelogOrder("random"))
+	require.EqualError(t, err, "unsupported changelog order: random")
+}
+
+func TestNewPlan(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, channel string) messageflow.Service {
+		return messageflow.Service{
+			Name: name,
+			Operation: []messageflow.Operation{
+				{
+					Action:  messageflow.ActionSend,
+					Channel: messageflow.Channel{Name: channel},
+				},
+			},
+		}
+	}
+
+	outputDir := t.TempDir()
+	diagramsDir := filepath.Join(outputDir, "diagrams")
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{service("A", "a.events"), service("C", "c.events")},
+	}
+
+	_, err := Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	metadata, err := os.ReadFile(filepath.Join(outputDir, "messageflow.json"))
+	require.NoError(t, err)
+
+	schema.Services = schema.Services[:1]
+
+	plan, err := NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	require.NotNil(t, plan.Artifacts.Changelog)
+	assert.Len(t, plan.Artifacts.Changelog.Changes, 1)
+	assert.Subset(t, plan.Write, []string{
+		"messageflow.json", "README.md", "index.json", "diagrams/context.svg", "diagrams/context-diff.svg",
+	})
+	assert.ElementsMatch(t, []string{"diagrams/service_c.svg", "diagrams/channel_cevents.svg"}, plan.Delete)
+	assert.Equal(t, "diagrams/context-diff.svg", plan.Artifacts.Index.ContextDiff)
+
+	unchanged, err := os.ReadFile(filepath.Join(outputDir, "messageflow.json"))
+	require.NoError(t, err)
+	assert.Equal(t, metadata, unchanged)
+	assert.FileExists(t, filepath.Join(diagramsDir, "service_c.svg"))
+
+	require.NoError(t, plan.Apply())
+
+	assert.NoFileExists(t, filepath.Join(diagramsDir, "service_c.svg"))
+	assert.NoFileExists(t, filepath.Join(diagramsDir, "channel_cevents.svg"))
+
+	updated, err := ReadMetadata(outputDir)
+	require.NoError(t, err)
+	assert.Equal(t, schema, updated.Schema)
+
+	plan, err = NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Artifacts.Index.ContextDiff)
+	assert.Equal(t, []string{"diagrams/context-diff.svg"}, plan.Delete)
+}
+
+func TestGenerateCustomLayout(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, channel string) messageflow.Service {
+		return messageflow.Service{
+			Name: name,
+			Operation: []messageflow.Operation{
+				{
+					Action:  messageflow.ActionSend,
+					Channel: messageflow.Channel{Name: channel},
+				},
+			},
+		}
+	}
+
+	outputDir := t.TempDir()
+	opts := []Opt{WithReadmeName("messageflow.md"), WithDiagramsDir("assets/messageflow")}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{service("A", "a.events"), service("C", "c.events")},
+	}
+
+	_, err := Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, opts...)
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(outputDir, "README.md"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "diagrams"))
+	assert.FileExists(t, filepath.Join(outputDir, "assets", "messageflow", "service_c.svg"))
+
+	readme, err := os.ReadFile(filepath.Join(outputDir, "messageflow.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(readme), "![Context](assets/messageflow/context.svg)")
+
+	var index Index
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &index))
+	assert.Equal(t, "messageflow.md", index.README)
+	assert.Equal(t, "assets/messageflow/context.svg", index.Context)
+
+	// Other files of the shared diagrams directory are kept.
+	for _, name := range []string{"logo.png", "architecture.svg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, "assets", "messageflow", name), nil, 0644))
+	}
+
+	schema.Services = schema.Services[:1]
+
+	plan, err := NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir, opts...)
+	require.NoError(t, err)
+	assert.Subset(t, plan.Write, []string{"messageflow.md", "assets/messageflow/context-diff.svg"})
+	assert.ElementsMatch(t, []string{
+		"assets/messageflow/service_c.svg", "assets/messageflow/channel_cevents.svg",
+	}, plan.Delete)
+
+	require.NoError(t, plan.Apply())
+	assert.NoFileExists(t, filepath.Join(outputDir, "assets", "messageflow", "service_c.svg"))
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, append(opts, WithForce(true))...)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "assets", "messageflow", "logo.png"))
+	assert.FileExists(t, filepath.Join(outputDir, "assets", "messageflow", "architecture.svg"))
+	assert.FileExists(t, filepath.Join(outputDir, "assets", "messageflow", "service_a.svg"))
+}
+
+func TestBuildInvalidLayout(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opt  Opt
+		err  string
+	}{
+		{name: "readme path", opt: WithReadmeName("docs/README.md"), err: "must be a file name"},
+		{name: "readme clash", opt: WithReadmeName("index.json"), err: "clashes with another generated file"},
+		{name: "output diagrams", opt: WithDiagramsDir("."), err: "invalid diagrams directory"},
+		{name: "parent diagrams", opt: WithDiagramsDir("../diagrams"), err: "invalid diagrams directory"},
+		{name: "absolute diagrams", opt: WithDiagramsDir("/tmp/diagrams"), err: "invalid diagrams directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Build(context.Background(), messageflow.Schema{}, testutil.Target{}, "Docs", nil, tt.opt)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestGenerateSplitByDomain(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, group string, action messageflow.Action, channel string) messageflow.Service {
+		return messageflow.Service{
+			Name:  name,
+			Group: group,
+			Operation: []messageflow.Operation{
+				{
+					Action: action,
+					Channel: messageflow.Channel{
+						Name:     channel,
+						Messages: []messageflow.Message{{Name: "Event", Payload: `{"id": "string"}`}},
+					},
+				},
+			},
+		}
+	}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			service("Order Service", "Orders", messageflow.ActionSend, "order.created"),
+			service("Billing Service", "Billing", messageflow.ActionReceive, "order.created"),
+			service("Audit Service", "", messageflow.ActionReceive, "order.created"),
+		},
+	}
+
+	outputDir := t.TempDir()
+
+	_, err := Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir, WithSplitByDomain(true))
+	require.NoError(t, err)
+
+	readme, err := os.ReadFile(filepath.Join(outputDir, "README.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(readme), "- [Domains](#domains)\n")
+	assert.Contains(t, string(readme),
+		"## Domains\n\n- [Billing](domains/billing/README.md)\n- [Orders](domains/orders/README.md)\n")
+
+	orders, err := os.ReadFile(filepath.Join(outputDir, "domains", "orders", "README.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(orders), "# Orders\n\nPart of [Docs](../../README.md).\n")
+	assert.Contains(t, string(orders), "![Context](../../diagrams/context.svg)")
+	assert.Contains(t, string(orders), "![Order Service Service Channels](../../diagrams/service_order-service.svg)")
+	assert.Contains(t, string(orders),
+		"![order.created Channel Services](../../diagrams/channel_ordercreated.svg)\n\nShared with domains: Billing\n")
+	assert.NotContains(t, string(orders), "### Billing Service")
+	assert.NotContains(t, string(orders), "### Audit Service")
+
+	index, err := os.ReadFile(filepath.Join(outputDir, "index.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(index), `"readme": "domains/orders/README.md"`)
+
+	schema = messageflow.Schema{
+		Services: []messageflow.Service{service("Order Service", "Orders", messageflow.ActionSend, "order.created")},
+	}
+
+	plan, err := NewPlan(context.Background(), schema, testutil.Target{}, "Docs", outputDir, WithSplitByDomain(true))
+	require.NoError(t, err)
+	assert.Contains(t, plan.Write, "domains/orders/README.md")
+	assert.Contains(t, plan.Delete, "domains/billing/README.md")
+
+	require.NoError(t, plan.Apply())
+	assert.NoDirExists(t, filepath.Join(outputDir, "domains", "billing"))
+
+	orders, err = os.ReadFile(filepath.Join(outputDir, "domains", "orders", "README.md"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(orders), "Shared with domains")
+
+	_, err = Generate(context.Background(), schema, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(outputDir, "domains"))
+}
+
+func TestReadMetadataVersions(t *testing.T) {
+	t.Parallel()
+
+	write := func(t *testing.T, data string) string {
+		t.Helper()
+
+		outputDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, "messageflow.json"), []byte(data), 0644))
+
+		return outputDir
+	}
+
+	legacy := write(t, `{
+  "schema": {"services": [{"name": "User Service", "operations": [{
+    "action": "send",
+    "channel": {"name": "user.info", "message": {"name": "UserInfoRequest", "payload": "{}"}},
+    "reply": {"name": "user.info.reply", "message": {"name": "UserInfoReply", "payload": "{}"}}
+  }]}]},
+  "changelogs": [{"date": "2025-01-01T00:00:00Z", "changes": [{"type": "added", "category": "service", "name": "User Service", "timestamp": "2025-01-01T00:00:00Z"}]}]
+}`)
+
+	metadata, err := ReadMetadata(legacy)
+	require.NoError(t, err)
+	assert.Equal(t, MetadataVersion, metadata.SchemaVersion)
+	assert.Equal(t, []messageflow.Service{{
+		Name: "User Service",
+		Operation: []messageflow.Operation{{
+			Action:  messageflow.ActionSend,
+			Channel: messageflow.Channel{Name: "user.info", Messages: []messageflow.Message{{Name: "UserInfoRequest", Payload: "{}"}}},
+			Reply:   &messageflow.Channel{Name: "user.info.reply", Messages: []messageflow.Message{{Name: "UserInfoReply", Payload: "{}"}}},
+		}},
+	}}, metadata.Schema.Services)
+	assert.Len(t, metadata.Changelogs, 1)
+
+	_, err = ReadMetadata(write(t, `{"schemaVersion": 3, "schema": {"services": []}}`))
+	require.EqualError(t, err, "messageflow data version 3 is newer than the supported version 2, upgrade messageflow")
+
+	outputDir := t.TempDir()
+	_, err = Generate(context.Background(), messageflow.Schema{}, testutil.Target{}, "Docs", outputDir)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "messageflow.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"schemaVersion": 2`)
+}
+
+// heavyTarget simulates CPU and memory heavy diagram compiles, tracking the peak memory held by
+// renders in flight.
+type heavyTarget struct {
+	testutil.Target
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+const heavyTargetAlloc = 1 << 20
+
+func (h *heavyTarget) RenderSchema(ctx context.Context, fs messageflow.FormattedSchema) ([]byte, error) {
+	h.mu.Lock()
+	h.inFlight++
+	h.peak = max(h.peak, h.inFlight)
+	h.mu.Unlock()
+
+	buf := make([]byte, heavyTargetAlloc)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	time.Sleep(time.Millisecond)
+
+	h.mu.Lock()
+	h.inFlight--
+	h.mu.Unlock()
+
+	return h.Target.RenderSchema(ctx, fs)
+}
+
+func TestBuildConcurrency(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{}
+	for i := range 10 {
+		schema.Services = append(schema.Services, messageflow.Service{
+			Name: fmt.Sprintf("Service %d", i),
+			Operation: []messageflow.Operation{
+				{
+					Action:  messageflow.ActionSend,
+					Channel: messageflow.Channel{Name: fmt.Sprintf("channel.%d", i)},
+				},
+			},
+		})
+	}
+
+	limited := &heavyTarget{}
+	expected, err := Build(context.Background(), schema, limited, "Docs", nil, WithConcurrency(2))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, limited.peak, 2)
+
+	actual, err := Build(context.Background(), schema, &heavyTarget{}, "Docs", nil, WithConcurrency(-1))
+	require.NoError(t, err)
+
+	expected.Summary.RenderTime, actual.Summary.RenderTime = 0, 0
+	assert.Equal(t, expected, actual)
+}
+
+func BenchmarkBuildConcurrency(b *testing.B) {
+	schema := messageflow.Schema{}
+	for i := range 5 {
+		operations := []messageflow.Operation{
+			{
+				Action: messageflow.ActionSend,
+				Channel: messageflow.Channel{
+					Name:     fmt.Sprintf("channel.%d", i),
+					Messages: []messageflow.Message{{Name: fmt.Sprintf("Event%d", i), Payload: `{"id": "string[uuid]"}`}},
+				},
+			},
+		}
+		if i > 0 {
+			operations = append(operations, messageflow.Operation{
+				Action:  messageflow.ActionReceive,
+				Channel: messageflow.Channel{Name: fmt.Sprintf("channel.%d", i-1)},
+			})
+		}
+
+		schema.Services = append(schema.Services, messageflow.Service{
+			Name:      fmt.Sprintf("Service %d", i),
+			Operation: operations,
+		})
+	}
+
+	target, err := d2.NewTarget()
+	require.NoError(b, err)
+
+	for _, bc := range []struct {
+		name        string
+		concurrency int
+	}{
+		{name: "Unlimited", concurrency: -1},
+		{name: "GOMAXPROCS", concurrency: 0},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for range b.N {
+				_, err := Build(context.Background(), schema, target, "Docs", nil, WithConcurrency(bc.concurrency))
+				require.NoError(b, err)
+			}
+		})
+	}
+}
+
+func TestNewAnchors(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Context",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.info"},
+					},
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "userinfo",
+							Messages: []messageflow.Message{{Name: "UserInfo"}},
+						},
+					},
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "messages"},
+					},
+				},
+			},
+			{
+				Name: "User Service",
+			},
+		},
+	}
+
+	actual := newAnchors(schema, "Message Flow")
+
+	assert.Equal(t, map[string]string{
+		"Context":      "context-1",
+		"User Service": "user-service",
+	}, actual.services)
+	assert.Equal(t, map[string]string{
+		"messages":  "messages",
+		"user.info": "userinfo",
+		"userinfo":  "userinfo-1",
+	}, actual.channels)
+}
+
+func TestSanitizeAnchor(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"Notification Service":             "notification-service",
+		"notification.user.{user_id}.push": "notificationuseruser_idpush",
+		"Billing - Invoices":               "billing---invoices",
+		" Trimmed ":                        "trimmed",
+	}
+
+	for name, expected := range tests {
+		assert.Equal(t, expected, sanitizeAnchor(name), name)
+	}
+}
@@ -0,0 +1,201 @@
+package docs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// domainsDir is the directory of domain READMEs written by WithSplitByDomain, one subdirectory per domain.
+const domainsDir = "domains"
+
+// createDomainPages renders a README for each domain of the schema services. Pages list services of the domain
+// and channels they operate on, marking channels shared with other domains, and link diagrams of the README.
+// It returns the pages keyed by their paths relative to the output directory and links to them sorted by domain.
+// readme and diagramsDir are the README and the diagrams directory relative to the output directory.
+func createDomainPages(
+	schema messageflow.Schema,
+	title string,
+	channelInfo map[string]ChannelInfo,
+	diagrams *anchors,
+	inline map[string][]byte,
+	readme, diagramsDir string,
+) (map[string]string, []pageLink, error) {
+	domains := schemaDomains(schema)
+	if len(domains) == 0 {
+		return nil, nil, nil
+	}
+
+	var (
+		s     = newSlugger()
+		pages = make(map[string]string, len(domains))
+		links = make([]pageLink, 0, len(domains))
+	)
+
+	for _, domain := range domains {
+		domainSchema := domainServices(schema, domain)
+
+		readme, err := createContent(OutputFormatMarkdown, page{
+			title:       domain,
+			schema:      domainSchema,
+			channelInfo: channelInfo,
+			anchors:     newAnchors(domainSchema, domain),
+			diagrams:    diagrams,
+			diagramsDir: path.Join("../..", diagramsDir),
+			inline:      inline,
+			parent:      &pageLink{Name: title, Path: path.Join("../..", readme)},
+			boundaries:  domainBoundaries(schema, domain),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating README of domain %s: %w", domain, err)
+		}
+
+		readmePath := path.Join(domainsDir, s.slug(domain), "README.md")
+		pages[readmePath] = readme
+		links = append(links, pageLink{Name: domain, Path: readmePath})
+	}
+
+	return pages, links, nil
+}
+
+// schemaDomains returns sorted unique domains of the schema services, services without a domain are skipped.
+func schemaDomains(schema messageflow.Schema) []string {
+	seen := make(map[string]bool)
+
+	var domains []string
+	for _, service := range schema.Services {
+		if service.Group == "" || seen[service.Group] {
+			continue
+		}
+		seen[service.Group] = true
+		domains = append(domains, service.Group)
+	}
+
+	sort.Strings(domains)
+
+	return domains
+}
+
+// domainServices returns the schema restricted to services of the domain.
+func domainServices(schema messageflow.Schema, domain string) messageflow.Schema {
+	var services []messageflow.Service
+	for _, service := range schema.Services {
+		if service.Group == domain {
+			services = append(services, service)
+		}
+	}
+
+	return messageflow.Schema{Services: services}
+}
+
+// domainBoundaries maps channels the domain services operate on, which services of other domains
+// operate on as well, to the sorted comma separated names of those domains.
+func domainBoundaries(schema messageflow.Schema, domain string) map[string]string {
+	channelDomains := make(map[string]map[string]bool)
+
+	for _, service := range schema.Services {
+		if service.Group == "" {
+			continue
+		}
+
+		for _, operation := range service.Operation {
+			if channelDomains[operation.Channel.Name] == nil {
+				channelDomains[operation.Channel.Name] = make(map[string]bool)
+			}
+			channelDomains[operation.Channel.Name][service.Group] = true
+		}
+	}
+
+	boundaries := make(map[string]string)
+
+	for channel, domains := range channelDomains {
+		if !domains[domain] || len(domains) == 1 {
+			continue
+		}
+
+		var others []string
+		for other := range domains {
+			if other != domain {
+				others = append(others, other)
+			}
+		}
+		sort.Strings(others)
+
+		boundaries[channel] = strings.Join(others, ", ")
+	}
+
+	return boundaries
+}
+
+// readDomainPages returns paths of domain READMEs in the output directory relative to it, nil if there are none.
+func readDomainPages(outputDir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(outputDir, domainsDir, "*", "README.md"))
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]string, 0, len(matches))
+	for _, match := range matches {
+		rel, err := filepath.Rel(outputDir, match)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, filepath.ToSlash(rel))
+	}
+
+	sort.Strings(pages)
+
+	return pages, nil
+}
+
+// staleDomainPages returns paths of existing domain READMEs which aren't generated anymore,
+// e.g. of removed domains or when WithSplitByDomain isn't used.
+func staleDomainPages(existing []string, pages map[string]string) []string {
+	var stale []string
+	for _, name := range existing {
+		if _, ok := pages[name]; !ok {
+			stale = append(stale, name)
+		}
+	}
+
+	return stale
+}
+
+// writeDomainPages writes domain READMEs into the output directory and removes stale ones
+// along with their directories left empty.
+func writeDomainPages(outputDir string, pages map[string]string) error {
+	existing, err := readDomainPages(outputDir)
+	if err != nil {
+		return fmt.Errorf("error reading domain READMEs: %w", err)
+	}
+
+	for _, name := range staleDomainPages(existing, pages) {
+		if err := os.Remove(filepath.Join(outputDir, name)); err != nil {
+			return fmt.Errorf("error removing stale %s: %w", name, err)
+		}
+
+		// Directories holding other files are kept.
+		_ = os.Remove(filepath.Dir(filepath.Join(outputDir, name)))
+	}
+
+	_ = os.Remove(filepath.Join(outputDir, domainsDir))
+
+	for name, readme := range pages {
+		pagePath := filepath.Join(outputDir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(pagePath), 0755); err != nil {
+			return fmt.Errorf("error creating directory of %s: %w", name, err)
+		}
+
+		if err := os.WriteFile(pagePath, []byte(readme), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package docs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// PayloadField is a row of the field table of a flattened payload.
+type PayloadField struct {
+	// Path is the dot-delimited path of the field, fields of array items follow the array name suffixed by [].
+	Path string
+	// Type is the type of the field, arrays are described as "array of" their item type.
+	Type string
+	// Format is the format or constraints of the field, e.g. uuid or allowed enum values.
+	Format string
+	// Required marks fields of payloads flattened with constraints their object requires.
+	Required bool
+}
+
+// payloadFields parses a payload flattened into field types (e.g. {"id": "string[uuid]", "tags": ["string"]})
+// into rows sorted by path, with nested objects listed after their parent. Array payloads are listed as
+// a [] row, e.g. "array of object", followed by fields of their items, e.g. [].id. It returns nil for
+// payloads which aren't non-empty JSON objects or arrays.
+func payloadFields(payload string) []PayloadField {
+	var root any
+	if err := json.Unmarshal([]byte(payload), &root); err != nil {
+		return nil
+	}
+
+	var fields []PayloadField
+
+	switch v := root.(type) {
+	case map[string]any:
+		collectFields(&fields, "", v)
+	case []any:
+		if len(v) > 0 {
+			collectField(&fields, "", v)
+			fields[0].Path = "[]"
+		}
+	}
+
+	return fields
+}
+
+// collectFields appends rows of the object fields to fields, prefixing paths with prefix.
+func collectFields(fields *[]PayloadField, prefix string, object map[string]any) {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		collectField(fields, path, object[name])
+	}
+}
+
+// collectField appends the row of the field at path and rows of its nested fields.
+func collectField(fields *[]PayloadField, path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		*fields = append(*fields, PayloadField{Path: path, Type: "object"})
+		collectFields(fields, path, v)
+	case []any:
+		typ, itemPath, item := "", path, any(v)
+		for {
+			items, ok := item.([]any)
+			if !ok || len(items) == 0 {
+				break
+			}
+			typ, itemPath, item = typ+"array of ", itemPath+"[]", items[0]
+		}
+
+		switch item := item.(type) {
+		case []any:
+			*fields = append(*fields, PayloadField{Path: path, Type: typ + "array"})
+		case map[string]any:
+			*fields = append(*fields, PayloadField{Path: path, Type: typ + "object"})
+			collectFields(fields, itemPath, item)
+		default:
+			field := leafField(path, item)
+			field.Type = typ + field.Type
+			*fields = append(*fields, field)
+		}
+	default:
+		*fields = append(*fields, leafField(path, v))
+	}
+}
+
+// leafField parses a flattened type such as string, string[uuid], string[enum:a,b] or
+// string[required,maxLength:36], see messageflow.SplitFieldType.
+func leafField(path string, value any) PayloadField {
+	typ, ok := value.(string)
+	if !ok {
+		return PayloadField{Path: path, Type: fmt.Sprint(value)}
+	}
+
+	name, tokens, required := messageflow.SplitFieldType(typ)
+
+	for i, token := range tokens {
+		if values, ok := strings.CutPrefix(token, "enum:"); ok {
+			tokens[i] = "enum: " + strings.ReplaceAll(values, ",", ", ")
+		}
+	}
+
+	return PayloadField{Path: path, Type: name, Format: strings.Join(tokens, ", "), Required: required}
+}
+
+// escapeTableCell escapes text for a markdown table cell.
+func escapeTableCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
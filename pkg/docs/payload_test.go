@@ -0,0 +1,62 @@
+package docs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadFields(t *testing.T) {
+	t.Parallel()
+
+	payload := `{
+		"user_id": "string[uuid]",
+		"status": "string[enum:active,blocked]",
+		"tags": ["string"],
+		"address": {"city": "string", "zip": "string[pattern:^\\d{5}|\\d{9}$]"},
+		"devices": [{"id": "string[uuid]", "push": "boolean", "sessions": [{"token": "string"}]}],
+		"attributes": [],
+		"matrix": [["number"]],
+		"batches": [[{"sku": "string"}]]
+	}`
+
+	assert.Equal(t, []PayloadField{
+		{Path: "address", Type: "object"},
+		{Path: "address.city", Type: "string"},
+		{Path: "address.zip", Type: "string", Format: `pattern:^\d{5}|\d{9}$`},
+		{Path: "attributes", Type: "array"},
+		{Path: "batches", Type: "array of array of object"},
+		{Path: "batches[][].sku", Type: "string"},
+		{Path: "devices", Type: "array of object"},
+		{Path: "devices[].id", Type: "string", Format: "uuid"},
+		{Path: "devices[].push", Type: "boolean"},
+		{Path: "devices[].sessions", Type: "array of object"},
+		{Path: "devices[].sessions[].token", Type: "string"},
+		{Path: "matrix", Type: "array of array of number"},
+		{Path: "status", Type: "string", Format: "enum: active, blocked"},
+		{Path: "tags", Type: "array of string"},
+		{Path: "user_id", Type: "string", Format: "uuid"},
+	}, payloadFields(payload))
+
+	assert.Equal(t, []PayloadField{
+		{Path: "email", Type: "string", Format: "email, maxLength:254", Required: true},
+		{Path: "role", Type: "string", Format: "enum: admin, required"},
+		{Path: "score", Type: "number", Format: "minimum:1, maximum:5"},
+	}, payloadFields(`{
+		"email": "string[email,required,maxLength:254]",
+		"role": "string[enum:admin,required]",
+		"score": "number[minimum:1,maximum:5]"
+	}`))
+
+	assert.Equal(t, []PayloadField{
+		{Path: "[]", Type: "array of object"},
+		{Path: "[].id", Type: "string", Format: "uuid"},
+		{Path: "[].items", Type: "array of object"},
+		{Path: "[].items[].sku", Type: "string"},
+	}, payloadFields(`[{"id": "string[uuid]", "items": [{"sku": "string"}]}]`))
+	assert.Equal(t, []PayloadField{{Path: "[]", Type: "array of string"}}, payloadFields(`["string"]`))
+	assert.Nil(t, payloadFields(`[]`))
+	assert.Nil(t, payloadFields(`{}`))
+	assert.Nil(t, payloadFields(`message PaymentCaptured {}`))
+	assert.Equal(t, `pattern:^\d{5}\|\d{9}$`, escapeTableCell(`pattern:^\d{5}|\d{9}$`))
+}
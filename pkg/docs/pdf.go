@@ -0,0 +1,585 @@
+package docs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/internal/raster"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// pdfFile is the file name of the PDF documentation.
+const pdfFile = "docs.pdf"
+
+// PDF pages are A4, sizes are in points.
+const (
+	pdfPageWidth     = 595.0
+	pdfPageHeight    = 842.0
+	pdfMargin        = 50.0
+	pdfContentWidth  = pdfPageWidth - 2*pdfMargin
+	pdfContentHeight = pdfPageHeight - 2*pdfMargin
+	// pdfDiagramScale rasterizes diagrams at twice the size they are shown at, keeping them sharp when zoomed.
+	pdfDiagramScale = 2.0
+)
+
+// pdfFont is a resource name of one of the standard fonts every PDF reader provides.
+type pdfFont string
+
+const (
+	pdfFontRegular pdfFont = "F1"
+	pdfFontBold    pdfFont = "F2"
+	pdfFontMono    pdfFont = "F3"
+)
+
+var pdfBaseFonts = []struct {
+	font pdfFont
+	name string
+}{
+	{font: pdfFontRegular, name: "Helvetica"},
+	{font: pdfFontBold, name: "Helvetica-Bold"},
+	{font: pdfFontMono, name: "Courier"},
+}
+
+// helveticaWidths are widths of printable ASCII characters in Helvetica per 1000 units of font size.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// textWidth estimates the width of text set in the font. Helvetica-Bold is approximated by
+// widened Helvetica, characters outside of ASCII by the width of digits.
+func textWidth(text string, font pdfFont, size float64) float64 {
+	if font == pdfFontMono {
+		return float64(len([]rune(text))) * 0.6 * size
+	}
+
+	var units int
+	for _, r := range text {
+		if r >= ' ' && r <= '~' {
+			units += helveticaWidths[r-' ']
+		} else {
+			units += 556
+		}
+	}
+
+	width := float64(units) * size / 1000
+	if font == pdfFontBold {
+		width *= 1.1
+	}
+
+	return width
+}
+
+// pdfPage holds the content stream of a page and images and links placed on it.
+type pdfPage struct {
+	content bytes.Buffer
+	images  []int
+	links   []pdfLink
+}
+
+// pdfLink is a clickable area leading to a position on another page.
+type pdfLink struct {
+	x1, y1, x2, y2 float64
+	page           int
+	top            float64
+}
+
+// pdfImage is an RGB image compressed for embedding.
+type pdfImage struct {
+	width, height int
+	data          []byte
+}
+
+// pdfSection is a heading listed in the table of contents.
+type pdfSection struct {
+	title string
+	level int
+	page  int
+	top   float64
+}
+
+// pdfLayout places text and images onto pages top to bottom, starting new pages as they fill up.
+type pdfLayout struct {
+	pages    []*pdfPage
+	images   []pdfImage
+	sections []pdfSection
+	// y is the distance of the cursor from the bottom of the page, as PDF coordinates go.
+	y float64
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &pdfPage{})
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// ensure starts a new page unless the height fits onto the current one.
+func (l *pdfLayout) ensure(height float64) {
+	if len(l.pages) == 0 || l.y-height < pdfMargin {
+		l.newPage()
+	}
+}
+
+func (l *pdfLayout) page() *pdfPage {
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *pdfLayout) space(height float64) {
+	l.y -= height
+}
+
+// line writes a single line of text at the cursor, indented by x.
+func (l *pdfLayout) line(text string, font pdfFont, size, x float64) {
+	lineHeight := size * 1.4
+	l.ensure(lineHeight)
+	l.y -= lineHeight
+
+	if text == "" {
+		return
+	}
+
+	fmt.Fprintf(&l.page().content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, pdfMargin+x, l.y+size*0.3, pdfString(text))
+}
+
+// paragraph writes text wrapped to the content width, keeping its line breaks.
+func (l *pdfLayout) paragraph(text string, font pdfFont, size float64) {
+	for _, line := range strings.Split(text, "\n") {
+		for _, wrapped := range wrapText(line, font, size, pdfContentWidth) {
+			l.line(wrapped, font, size, 0)
+		}
+	}
+}
+
+// heading writes a heading and records it for the table of contents, level 1 headings start new pages.
+func (l *pdfLayout) heading(title string, level int) {
+	size := 18.0
+	if level > 1 {
+		size = 14.0
+	}
+
+	if level == 1 {
+		l.newPage()
+	} else {
+		// Keep the heading together with the beginning of the section.
+		l.ensure(size * 6)
+		l.space(size)
+	}
+
+	l.sections = append(l.sections, pdfSection{title: title, level: level, page: len(l.pages) - 1, top: l.y})
+	l.line(title, pdfFontBold, size, 0)
+	l.space(size / 2)
+}
+
+// image places the image scaled to fit the content width and height of a page.
+func (l *pdfLayout) image(img image.Image) error {
+	compressed, err := compressImage(img)
+	if err != nil {
+		return err
+	}
+
+	width := float64(compressed.width) / pdfDiagramScale
+	height := float64(compressed.height) / pdfDiagramScale
+
+	// Diagrams are shrunk into the rest of the page rather than leaving the heading above them alone,
+	// unless less than half of the page is left.
+	available := pdfContentHeight
+	if len(l.pages) > 0 && l.y-pdfMargin >= pdfContentHeight/2 {
+		available = l.y - pdfMargin
+	}
+
+	scale := min(1, pdfContentWidth/width, available/height)
+	width *= scale
+	height *= scale
+
+	l.ensure(height)
+	l.y -= height
+
+	l.images = append(l.images, compressed)
+	l.page().images = append(l.page().images, len(l.images)-1)
+
+	fmt.Fprintf(&l.page().content, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+		width, height, pdfMargin+(pdfContentWidth-width)/2, l.y, len(l.images)-1)
+
+	l.space(12)
+
+	return nil
+}
+
+// wrapText splits text into lines fitting the width, breaking words longer than a line.
+func wrapText(text string, font pdfFont, size, width float64) []string {
+	// Leading indentation matters for code, so lines are only reflowed when too long.
+	if textWidth(text, font, size) <= width {
+		return []string{text}
+	}
+
+	var (
+		lines   []string
+		current string
+	)
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+
+		if textWidth(candidate, font, size) <= width {
+			current = candidate
+			continue
+		}
+
+		if current != "" {
+			lines = append(lines, current)
+		}
+
+		current = ""
+		for _, r := range word {
+			if current != "" && textWidth(current+string(r), font, size) > width {
+				lines = append(lines, current)
+				current = ""
+			}
+			current += string(r)
+		}
+	}
+
+	return append(lines, current)
+}
+
+// pdfString encodes text for a string literal of the standard fonts, which use Windows-1252.
+// Characters outside of it are replaced with question marks.
+func pdfString(text string) string {
+	var b strings.Builder
+
+	for _, r := range text {
+		c, ok := charmap.Windows1252.EncodeRune(r)
+		if !ok {
+			c = '?'
+		}
+
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// diagramImage decodes a rendered diagram, PNG diagrams are decoded as they are, SVG diagrams are rasterized.
+func diagramImage(diagram []byte) (image.Image, error) {
+	if bytes.HasPrefix(diagram, []byte("\x89PNG")) {
+		return png.Decode(bytes.NewReader(diagram))
+	}
+
+	return raster.Rasterize(diagram, pdfDiagramScale)
+}
+
+// compressImage flattens the image onto a white background and compresses its RGB samples.
+func compressImage(img image.Image) (pdfImage, error) {
+	bounds := img.Bounds()
+
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+
+	row := make([]byte, 0, bounds.Dx()*3)
+	for y := 0; y < bounds.Dy(); y++ {
+		row = row[:0]
+		for x := 0; x < bounds.Dx(); x++ {
+			i := flat.PixOffset(x, y)
+			row = append(row, flat.Pix[i], flat.Pix[i+1], flat.Pix[i+2])
+		}
+
+		if _, err := w.Write(row); err != nil {
+			return pdfImage{}, fmt.Errorf("compressing image: %w", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return pdfImage{}, fmt.Errorf("compressing image: %w", err)
+	}
+
+	return pdfImage{width: bounds.Dx(), height: bounds.Dy(), data: buf.Bytes()}, nil
+}
+
+// createPDF lays out the documentation as a PDF: a table of contents, the context diagram followed by
+// those of the environments, services with their diagrams and operations and the channel catalog with diagrams
+// and message payloads. Diagrams must contain all diagrams of the documentation.
+func createPDF(
+	schema messageflow.Schema,
+	title string,
+	anchors *anchors,
+	environments []string,
+	diagrams map[string][]byte,
+) ([]byte, error) {
+	body := &pdfLayout{}
+
+	addDiagram := func(name string) error {
+		diagram, ok := diagrams[name]
+		if !ok {
+			return fmt.Errorf("diagram %s not found", name)
+		}
+
+		img, err := diagramImage(diagram)
+		if err != nil {
+			return fmt.Errorf("error decoding diagram %s: %w", name, err)
+		}
+
+		return body.image(img)
+	}
+
+	body.heading("Context", 1)
+	if err := addDiagram(contextDiagram); err != nil {
+		return nil, err
+	}
+
+	for _, env := range environments {
+		body.heading("Environment: "+env, 2)
+		if err := addDiagram(environmentDiagram(env)); err != nil {
+			return nil, err
+		}
+	}
+
+	body.heading("Services", 1)
+
+	for i, service := range schema.Services {
+		if i > 0 {
+			body.newPage()
+		}
+
+		body.heading(service.Name, 2)
+
+		if service.Description != "" {
+			body.paragraph(service.Description, pdfFontRegular, 10)
+			body.space(8)
+		}
+
+		if len(service.Operation) > 0 {
+			summary := summarizeOperations(service)
+			body.line(fmt.Sprintf("Send: %d   Receive: %d   Request/Reply: %d",
+				summary.Send, summary.Receive, summary.RequestReply), pdfFontRegular, 10, 0)
+			body.space(8)
+		}
+
+		if err := addDiagram(serviceDiagram(anchors.services[service.Name])); err != nil {
+			return nil, err
+		}
+
+		if len(service.Operation) > 0 {
+			body.line("Operations", pdfFontBold, 11, 0)
+
+			for _, op := range service.Operation {
+				text := fmt.Sprintf("%s %s", op.Action, op.Channel.Name)
+				if op.Summary != "" {
+					text += ": " + op.Summary
+				}
+
+				for _, line := range wrapText(text, pdfFontRegular, 10, pdfContentWidth-12) {
+					body.line(line, pdfFontRegular, 10, 12)
+				}
+			}
+		}
+	}
+
+	body.heading("Channels", 1)
+
+	channelInfo := extractChannelInfo(schema)
+
+	for _, channel := range schema.ChannelNames() {
+		body.heading(channel, 2)
+
+		if err := addDiagram(channelDiagram(anchors.channels[channel])); err != nil {
+			return nil, err
+		}
+
+		for _, msg := range channelInfo[channel].Messages {
+			name := msg.Name
+			if msg.Direction == "request" || msg.Direction == "reply" || channelInfo[channel].Directional {
+				name = msg.Direction + ": " + name
+			}
+			if msg.ContentType != "" {
+				name += " (" + msg.ContentType + ")"
+			}
+
+			body.space(6)
+			body.line(name, pdfFontBold, 11, 0)
+
+			if msg.Payload != "" {
+				body.paragraph(msg.Payload, pdfFontMono, 8)
+			}
+		}
+	}
+
+	// The table of contents doesn't change its length with page numbers, so its page count
+	// is taken from a first pass.
+	offset := len(tableOfContents(title, body.sections, 0).pages)
+	toc := tableOfContents(title, body.sections, offset)
+
+	pages := append(toc.pages, body.pages...)
+
+	return encodePDF(title, pages, append(toc.images, body.images...))
+}
+
+// tableOfContents lays out the document title followed by sections with their page numbers,
+// linking to them. Body pages follow offset pages of the table of contents.
+func tableOfContents(title string, sections []pdfSection, offset int) *pdfLayout {
+	toc := &pdfLayout{}
+	toc.newPage()
+
+	toc.line(title, pdfFontBold, 24, 0)
+	toc.space(12)
+	toc.line("Table of Contents", pdfFontBold, 14, 0)
+	toc.space(6)
+
+	for _, section := range sections {
+		indent := float64(section.level-1) * 16
+		number := fmt.Sprint(offset + section.page + 1)
+
+		font := pdfFontRegular
+		if section.level == 1 {
+			font = pdfFontBold
+		}
+
+		// Titles are cut to a single line, leaving room for the page number.
+		text := section.title
+		for text != "" && textWidth(text, font, 10) > pdfContentWidth-indent-40 {
+			text = string([]rune(text)[:len([]rune(text))-1])
+		}
+
+		toc.line(text, font, 10, indent)
+
+		numberWidth := textWidth(number, pdfFontRegular, 10)
+		fmt.Fprintf(&toc.page().content, "BT /%s 10.0 Tf %.2f %.2f Td (%s) Tj ET\n",
+			pdfFontRegular, pdfPageWidth-pdfMargin-numberWidth, toc.y+3, number)
+
+		toc.page().links = append(toc.page().links, pdfLink{
+			x1:   pdfMargin + indent,
+			y1:   toc.y,
+			x2:   pdfPageWidth - pdfMargin,
+			y2:   toc.y + 14,
+			page: offset + section.page,
+			top:  section.top,
+		})
+	}
+
+	return toc
+}
+
+// encodePDF serializes pages and images into a PDF document.
+func encodePDF(title string, pages []*pdfPage, images []pdfImage) ([]byte, error) {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+
+	// Objects are numbered: catalog, page tree, info, fonts, images, then a page and its content per page.
+	const (
+		catalogObj = 1
+		pagesObj   = 2
+		infoObj    = 3
+		fontsObj   = 4
+	)
+
+	imagesObj := fontsObj + len(pdfBaseFonts)
+	pageObj := func(i int) int { return imagesObj + len(images) + 2*i }
+
+	object := func(format string, args ...any) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteString("\nendobj\n")
+	}
+
+	stream := func(dict string, data []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", len(offsets), dict, len(data))
+		buf.Write(data)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	object("<< /Type /Catalog /Pages %d 0 R >>", pagesObj)
+
+	kids := make([]string, 0, len(pages))
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj(i)))
+	}
+	object("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	object("<< /Title (%s) /Producer (messageflow) >>", pdfString(title))
+
+	fonts := make([]string, 0, len(pdfBaseFonts))
+	for i, f := range pdfBaseFonts {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.name)
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", f.font, fontsObj+i))
+	}
+
+	for _, img := range images {
+		stream(fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+			img.width, img.height,
+		), img.data)
+	}
+
+	for i, page := range pages {
+		xobjects := make([]string, 0, len(page.images))
+		for _, img := range page.images {
+			xobjects = append(xobjects, fmt.Sprintf("/Im%d %d 0 R", img, imagesObj+img))
+		}
+
+		annots := make([]string, 0, len(page.links))
+		for _, link := range page.links {
+			annots = append(annots, fmt.Sprintf(
+				"<< /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /Dest [%d 0 R /XYZ 0 %.2f null] >>",
+				link.x1, link.y1, link.x2, link.y2, pageObj(link.page), link.top,
+			))
+		}
+
+		object(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] /Contents %d 0 R "+
+				"/Resources << /Font << %s >> /XObject << %s >> >> /Annots [%s] >>",
+			pagesObj, pdfPageWidth, pdfPageHeight, pageObj(i)+1,
+			strings.Join(fonts, " "), strings.Join(xobjects, " "), strings.Join(annots, " "),
+		)
+
+		var content bytes.Buffer
+		w := zlib.NewWriter(&content)
+		if _, err := w.Write(page.content.Bytes()); err != nil {
+			return nil, fmt.Errorf("compressing page content: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("compressing page content: %w", err)
+		}
+
+		stream("/Filter /FlateDecode", content.Bytes())
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, catalogObj, infoObj, xref)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,126 @@
+package docs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/internal/testutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// svgTarget renders every diagram as a small SVG, so it can be rasterized.
+type svgTarget struct {
+	testutil.Target
+}
+
+func (svgTarget) RenderSchema(_ context.Context, _ messageflow.FormattedSchema) ([]byte, error) {
+	return []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 200 100">` +
+		`<rect x="10" y="10" width="180" height="80" fill="#e3f2fd" stroke="#1565c0"/>` +
+		`<text x="100" y="55" style="text-anchor:middle;font-size:16px">Service</text></svg>`), nil
+}
+
+var pdfStreamRe = regexp.MustCompile(`<< /Filter /FlateDecode /Length (\d+) >>\nstream\n`)
+
+// pdfText returns decompressed content streams of the pages.
+func pdfText(t *testing.T, pdf []byte) string {
+	t.Helper()
+
+	var text bytes.Buffer
+
+	for _, m := range pdfStreamRe.FindAllSubmatchIndex(pdf, -1) {
+		length, err := strconv.Atoi(string(pdf[m[2]:m[3]]))
+		require.NoError(t, err)
+
+		r, err := zlib.NewReader(bytes.NewReader(pdf[m[1] : m[1]+length]))
+		require.NoError(t, err)
+
+		_, err = io.Copy(&text, r)
+		require.NoError(t, err)
+	}
+
+	return text.String()
+}
+
+func TestBuildPDF(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:        "User Service",
+				Description: "Manages (users).",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Summary: "Publish created users",
+						Channel: messageflow.Channel{
+							Name:     "user.created",
+							Messages: []messageflow.Message{{Name: "UserCreated", Payload: "{\n  \"id\": \"string\"\n}"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	artifacts, err := Build(context.Background(), schema, svgTarget{}, "Docs", nil)
+	require.NoError(t, err)
+	assert.Nil(t, artifacts.PDF)
+	assert.Empty(t, artifacts.Index.PDF)
+
+	artifacts, err = Build(context.Background(), schema, svgTarget{}, "Docs", nil, WithOutputFormat(OutputFormatPDF))
+	require.NoError(t, err)
+	assert.Equal(t, "docs.pdf", artifacts.Index.PDF)
+
+	pdf := artifacts.PDF
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), "/Title (Docs)")
+	// Table of contents, context, services and channels.
+	assert.Contains(t, string(pdf), "/Count 4")
+	assert.Contains(t, string(pdf), "/Subtype /Link")
+	assert.Equal(t, 3, bytes.Count(pdf, []byte("/Subtype /Image")))
+
+	text := pdfText(t, pdf)
+	assert.Contains(t, text, "(Table of Contents) Tj")
+	assert.Contains(t, text, "(User Service) Tj")
+	assert.Contains(t, text, `(Manages \(users\).) Tj`)
+	assert.Contains(t, text, "(send user.created: Publish created users) Tj")
+	assert.Contains(t, text, `(  "id": "string") Tj`)
+
+	outputDir := t.TempDir()
+
+	plan, err := NewPlan(context.Background(), schema, svgTarget{}, "Docs", outputDir, WithOutputFormat(OutputFormatPDF))
+	require.NoError(t, err)
+	assert.Contains(t, plan.Write, "docs.pdf")
+
+	require.NoError(t, plan.Apply())
+	assert.FileExists(t, filepath.Join(outputDir, "docs.pdf"))
+
+	// Diagrams of the previous run aren't reused, the PDF embeds all of them.
+	plan, err = NewPlan(context.Background(), schema, svgTarget{}, "Docs", outputDir, WithOutputFormat(OutputFormatPDF))
+	require.NoError(t, err)
+	assert.Len(t, plan.Artifacts.Diagrams, 3)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"pdf": "docs.pdf"`)
+}
+
+func TestWrapText(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"  indented"}, wrapText("  indented", pdfFontMono, 10, 100))
+	assert.Equal(t, []string{"aaaa bbbb", "cccc"}, wrapText("aaaa bbbb cccc", pdfFontMono, 10, 60))
+	assert.Equal(t, []string{"aaaaaaaaaa", "aaaaa"}, wrapText("aaaaaaaaaaaaaaa", pdfFontMono, 10, 60))
+	assert.Equal(t, "caf\xe9 \\(1\\) ?", pdfString("café (1) ✓"))
+}
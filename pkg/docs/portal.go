@@ -0,0 +1,216 @@
+package docs
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+//go:embed templates/portal.tmpl
+var portalTemplateFS embed.FS
+
+// PortalEntry is documentation generated by gen-docs into a directory, linked from the portal.
+type PortalEntry struct {
+	Title string
+	// README is the path of the README relative to the portal directory, separated by slashes.
+	README string
+	Schema messageflow.Schema
+}
+
+// Portal is a README linking several documentation outputs, e.g. of independent repositories,
+// with a context diagram of all their services.
+type Portal struct {
+	README string
+	// Diagrams maps diagram filenames (relative to the diagrams directory) to rendered diagrams.
+	Diagrams map[string][]byte
+}
+
+// ReadPortalEntries finds documentation outputs in dir and its subdirectories by their messageflow.json,
+// sorted by path. READMEs are linked relative to portalDir, titles and README names are read from index.json
+// falling back to the directory name and README.md.
+func ReadPortalEntries(dir, portalDir string) ([]PortalEntry, error) {
+	var dirs []string
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && d.Name() == "messageflow.json" {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+	}
+
+	sort.Strings(dirs)
+
+	entries := make([]PortalEntry, 0, len(dirs))
+
+	for _, outputDir := range dirs {
+		metadata, err := ReadMetadata(outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading documentation in %s: %w", outputDir, err)
+		}
+
+		index, err := readPortalIndex(outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading documentation in %s: %w", outputDir, err)
+		}
+
+		readme, err := filepath.Rel(portalDir, filepath.Join(outputDir, filepath.FromSlash(index.README)))
+		if err != nil {
+			return nil, fmt.Errorf("error linking documentation in %s: %w", outputDir, err)
+		}
+
+		entries = append(entries, PortalEntry{
+			Title:  index.Title,
+			README: filepath.ToSlash(readme),
+			Schema: metadata.Schema,
+		})
+	}
+
+	return entries, nil
+}
+
+// readPortalIndex returns index.json of outputDir, defaulting the title to the directory name
+// and the README to README.md when they or index.json are missing.
+func readPortalIndex(outputDir string) (Index, error) {
+	var index Index
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.json"))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return Index{}, fmt.Errorf("error reading index.json: %w", err)
+	default:
+		if err := json.Unmarshal(data, &index); err != nil {
+			return Index{}, fmt.Errorf("error unmarshaling index.json: %w", err)
+		}
+	}
+
+	if index.Title == "" {
+		index.Title = filepath.Base(outputDir)
+	}
+
+	if index.README == "" {
+		index.README = "README.md"
+	}
+
+	return index, nil
+}
+
+// BuildPortal generates the portal of the entries in memory, its context diagram shows
+// the schemas of all entries merged with messageflow.MergeSchemas.
+func BuildPortal(
+	ctx context.Context,
+	entries []PortalEntry,
+	target messageflow.Target,
+	title string,
+) (*Portal, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("no documentation to index")
+	}
+
+	schemas := make([]messageflow.Schema, 0, len(entries))
+	for _, entry := range entries {
+		schemas = append(schemas, entry.Schema)
+	}
+
+	diagram, err := renderDiagram(ctx, messageflow.MergeSchemas(schemas...), target, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating diagram %s: %w", contextDiagram, err)
+	}
+
+	tmpl, err := template.New("portal.tmpl").
+		Funcs(template.FuncMap{
+			"EscapeTableCell": escapeTableCell,
+			"ServiceNames": func(s messageflow.Schema) string {
+				return strings.Join(s.ServiceNames(), ", ")
+			},
+		}).
+		ParseFS(portalTemplateFS, "templates/portal.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing portal template: %w", err)
+	}
+
+	data := struct {
+		Title   string
+		Context string
+		Entries []PortalEntry
+	}{
+		Title:   title,
+		Context: path.Join("diagrams", contextDiagram),
+		Entries: entries,
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error executing portal template: %w", err)
+	}
+
+	return &Portal{
+		README:   buf.String(),
+		Diagrams: map[string][]byte{contextDiagram: diagram},
+	}, nil
+}
+
+// GeneratePortal generates the portal of documentation found in dir into outputDir, see ReadPortalEntries.
+func GeneratePortal(
+	ctx context.Context,
+	target messageflow.Target,
+	title, dir, outputDir string,
+) error {
+	entries, err := ReadPortalEntries(dir, outputDir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return fmt.Errorf("no messageflow.json found in %s", dir)
+	}
+
+	for _, entry := range entries {
+		if entry.README == "README.md" {
+			return fmt.Errorf("output directory %s holds documentation of %s, its README would be overwritten", outputDir, entry.Title)
+		}
+	}
+
+	portal, err := BuildPortal(ctx, entries, target, title)
+	if err != nil {
+		return err
+	}
+
+	diagramsDir := filepath.Join(outputDir, "diagrams")
+	if err := os.MkdirAll(diagramsDir, 0755); err != nil {
+		return fmt.Errorf("error creating diagrams directory: %w", err)
+	}
+
+	for name, diagram := range portal.Diagrams {
+		if err := os.WriteFile(filepath.Join(diagramsDir, name), diagram, 0644); err != nil {
+			return fmt.Errorf("error writing diagram %s: %w", name, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(outputDir, "README.md"), []byte(portal.README), 0644); err != nil {
+		return fmt.Errorf("error writing README.md: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package docs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/internal/testutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servicesTarget renders names of the services of formatted schemas.
+type servicesTarget struct {
+	testutil.Target
+}
+
+func (servicesTarget) FormatSchema(
+	_ context.Context,
+	s messageflow.Schema,
+	_ messageflow.FormatOptions,
+) (messageflow.FormattedSchema, error) {
+	return messageflow.FormattedSchema{Type: "fake", Data: []byte(strings.Join(s.ServiceNames(), ","))}, nil
+}
+
+func TestGeneratePortal(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	service := func(name string, action messageflow.Action) messageflow.Service {
+		return messageflow.Service{Name: name, Operation: []messageflow.Operation{
+			{Action: action, Channel: messageflow.Channel{Name: "user.created"}},
+		}}
+	}
+
+	for _, outputDir := range []string{"repos/users", "repos/notifications/docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, outputDir), 0755))
+	}
+
+	_, err := Generate(ctx, messageflow.Schema{Services: []messageflow.Service{
+		service("User Service", messageflow.ActionSend),
+	}}, testutil.Target{}, "Users | Accounts", filepath.Join(dir, "repos", "users"))
+	require.NoError(t, err)
+
+	_, err = Generate(ctx, messageflow.Schema{Services: []messageflow.Service{
+		service("Notification Service", messageflow.ActionReceive),
+		service("User Service", messageflow.ActionSend),
+	}}, testutil.Target{}, "Notifications", filepath.Join(dir, "repos", "notifications", "docs"))
+	require.NoError(t, err)
+
+	// Outputs without index.json are titled by their directory.
+	require.NoError(t, os.Remove(filepath.Join(dir, "repos", "notifications", "docs", "index.json")))
+
+	portalDir := filepath.Join(dir, "portal")
+
+	entries, err := ReadPortalEntries(filepath.Join(dir, "repos"), portalDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "docs", entries[0].Title)
+	assert.Equal(t, "../repos/notifications/docs/README.md", entries[0].README)
+	assert.Equal(t, "Users | Accounts", entries[1].Title)
+
+	portal, err := BuildPortal(ctx, entries, servicesTarget{}, "Portal")
+	require.NoError(t, err)
+	assert.Equal(t, "Notification Service,User Service", string(portal.Diagrams["context.svg"]))
+	assert.Contains(t, portal.README, "# Portal\n")
+	assert.Contains(t, portal.README, "![Context](diagrams/context.svg)")
+	assert.Contains(t, portal.README,
+		"| [docs](../repos/notifications/docs/README.md) | Notification Service, User Service | 1 |\n")
+	assert.Contains(t, portal.README, `| [Users \| Accounts](../repos/users/README.md) | User Service | 1 |`)
+
+	require.NoError(t, GeneratePortal(ctx, servicesTarget{}, "Portal", filepath.Join(dir, "repos"), portalDir))
+	assert.FileExists(t, filepath.Join(portalDir, "README.md"))
+	assert.FileExists(t, filepath.Join(portalDir, "diagrams", "context.svg"))
+
+	err = GeneratePortal(ctx, servicesTarget{}, "Portal", filepath.Join(dir, "repos"), filepath.Join(dir, "repos", "users"))
+	require.ErrorContains(t, err, "README would be overwritten")
+
+	err = GeneratePortal(ctx, servicesTarget{}, "Portal", portalDir, portalDir)
+	require.ErrorContains(t, err, "no messageflow.json found")
+}
+
+func TestReadPortalEntriesCustomReadme(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "repos", "users")
+
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	_, err := Generate(context.Background(), messageflow.Schema{Services: []messageflow.Service{{Name: "User Service"}}},
+		testutil.Target{}, "Users", outputDir, WithReadmeName("messageflow.md"))
+	require.NoError(t, err)
+
+	entries, err := ReadPortalEntries(filepath.Join(dir, "repos"), filepath.Join(dir, "portal"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "../repos/users/messageflow.md", entries[0].README)
+}
@@ -0,0 +1,168 @@
+// Package gitref reads files as of a git ref by shelling out to git, e.g. a baseline schema committed on main.
+package gitref
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFile returns the content of the file at path as of ref in the git repository of dir.
+// Relative paths are relative to dir. It returns false when the file doesn't exist on the ref
+// and fails when the ref doesn't name a commit.
+func ReadFile(ctx context.Context, dir, ref, path string) ([]byte, bool, error) {
+	if _, err := git(ctx, dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}"); err != nil {
+		return nil, false, fmt.Errorf("error resolving git ref %s: %w", ref, err)
+	}
+
+	spec, err := objectSpec(dir, ref, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := git(ctx, dir, "cat-file", "-e", spec); err != nil {
+		return nil, false, nil
+	}
+
+	content, err := git(ctx, dir, "cat-file", "blob", spec)
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading %s at git ref %s: %w", path, ref, err)
+	}
+
+	return content, true, nil
+}
+
+// Checkout writes the files of the git repository of dir as of ref into dst, keeping their layout,
+// so that files referencing each other by relative paths resolve as they did on the ref.
+// It returns the path of dir within dst and fails when the ref doesn't name a commit.
+func Checkout(ctx context.Context, dir, ref, dst string) (string, error) {
+	if _, err := git(ctx, dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}"); err != nil {
+		return "", fmt.Errorf("error resolving git ref %s: %w", ref, err)
+	}
+
+	out, err := git(ctx, dir, "rev-parse", "--show-toplevel", "--show-prefix")
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory %s in git repository: %w", dir, err)
+	}
+
+	// The prefix is an empty line when dir is the top level.
+	topLevel, prefix, _ := strings.Cut(strings.TrimSuffix(string(out), "\n"), "\n")
+
+	// Archives contain only the directory git runs in, so it runs in the top level.
+	archive, err := git(ctx, topLevel, "archive", "--format=tar", ref)
+	if err != nil {
+		return "", fmt.Errorf("error archiving git ref %s: %w", ref, err)
+	}
+
+	if err := extract(tar.NewReader(bytes.NewReader(archive)), dst); err != nil {
+		return "", fmt.Errorf("error extracting git ref %s: %w", ref, err)
+	}
+
+	return filepath.Join(dst, filepath.FromSlash(prefix)), nil
+}
+
+// extract writes directories, files and symlinks of the tar archive into dst.
+func extract(r *tar.Reader, dst string) error {
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path %s in archive", header.Name)
+		}
+
+		path := filepath.Join(dst, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			if err := writeFile(path, r, header.FileInfo().Mode().Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeFile writes the content of r to the file at path.
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// objectSpec returns the git object name of path at ref, e.g. main:./docs/messageflow.json.
+// Git resolves paths starting with ./ or ../ relative to the directory it runs in.
+func objectSpec(dir, ref, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", fmt.Errorf("error resolving directory %s: %w", dir, err)
+		}
+
+		if path, err = filepath.Rel(absDir, path); err != nil {
+			return "", fmt.Errorf("error resolving %s relative to %s: %w", path, dir, err)
+		}
+	}
+
+	path = filepath.ToSlash(filepath.Clean(path))
+	if !strings.HasPrefix(path, "../") {
+		path = "./" + path
+	}
+
+	return ref + ":" + path, nil
+}
+
+// git runs the git command in dir and returns its output, errors include what git printed to stderr.
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
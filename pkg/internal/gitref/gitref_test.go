@@ -0,0 +1,110 @@
+package gitref
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	run := func(args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "messageflow.json"), []byte(`{"v":1}`), 0644))
+
+	run("init", "-q", "-b", "main")
+	run("add", "-A")
+	run("commit", "-q", "-m", "baseline")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "messageflow.json"), []byte(`{"v":2}`), 0644))
+
+	content, ok, err := ReadFile(ctx, dir, "main", "docs/messageflow.json")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"v":1}`, string(content))
+
+	content, ok, err = ReadFile(ctx, filepath.Join(dir, "docs"), "main", filepath.Join(dir, "docs", "messageflow.json"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"v":1}`, string(content))
+
+	content, ok, err = ReadFile(ctx, filepath.Join(dir, "docs"), "main", "../docs/messageflow.json")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"v":1}`, string(content))
+
+	_, ok, err = ReadFile(ctx, dir, "main", "docs/missing.json")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = ReadFile(ctx, dir, "unknown", "docs/messageflow.json")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error resolving git ref unknown")
+}
+
+func TestCheckout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	run := func(args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "specs", "components"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "specs", "service.yaml"), []byte("v: 1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "specs", "components", "messages.yaml"), []byte("v: 1"), 0644))
+
+	run("init", "-q", "-b", "main")
+	run("add", "-A")
+	run("commit", "-q", "-m", "baseline")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "specs", "service.yaml"), []byte("v: 2"), 0644))
+
+	dst := t.TempDir()
+
+	refDir, err := Checkout(ctx, filepath.Join(dir, "specs"), "main", dst)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dst, "specs"), refDir)
+
+	content, err := os.ReadFile(filepath.Join(refDir, "service.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "v: 1", string(content))
+
+	content, err = os.ReadFile(filepath.Join(refDir, "components", "messages.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "v: 1", string(content))
+
+	refDir, err = Checkout(ctx, dir, "main", t.TempDir())
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(refDir, "specs", "service.yaml"))
+
+	_, err = Checkout(ctx, dir, "unknown", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error resolving git ref unknown")
+}
@@ -0,0 +1,206 @@
+// Package raster converts SVG documents produced by d2svg into images using a pure-Go rasterizer.
+package raster
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	styleRe    = regexp.MustCompile(`(?s)<style[^>]*>.*?</style>`)
+	maskRe     = regexp.MustCompile(`(?s)<mask[^>]*>.*?</mask>`)
+	iconRe     = regexp.MustCompile(`(?s)<g[^>]*class="appendix-icon"[^>]*>.*?</svg>\s*</g>`)
+	fontSizeRe = regexp.MustCompile(`font-size:\s*([0-9.]+)px`)
+)
+
+// Rasterize converts an SVG document produced by d2svg into an image, scaling its viewbox by scale.
+// Shapes and connections are rasterized by oksvg, text labels are drawn separately with the Go fonts
+// since oksvg doesn't support text. CSS styling, embedded fonts, tooltips and markdown blocks are not
+// supported, so the result is intended for places where SVG can't be displayed rather than as a
+// pixel-perfect replacement. The background is left transparent.
+func Rasterize(svg []byte, scale float64) (*image.RGBA, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("invalid scale %v, must be greater than 0", scale)
+	}
+
+	// Styles, masks and tooltip icons are not supported by the rasterizer.
+	svg = styleRe.ReplaceAll(svg, nil)
+	svg = maskRe.ReplaceAll(svg, nil)
+	svg = iconRe.ReplaceAll(svg, nil)
+
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(svg), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("parsing svg: %w", err)
+	}
+
+	w := int(icon.ViewBox.W * scale)
+	h := int(icon.ViewBox.H * scale)
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid svg dimensions %dx%d", w, h)
+	}
+
+	icon.SetTarget(0, 0, float64(w), float64(h))
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	scanner := rasterx.NewScannerGV(w, h, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(w, h, scanner), 1)
+
+	if err := drawTexts(img, svg, icon.ViewBox.X, icon.ViewBox.Y, scale); err != nil {
+		return nil, fmt.Errorf("drawing texts: %w", err)
+	}
+
+	return img, nil
+}
+
+// svgText represents a text element of a d2svg document.
+type svgText struct {
+	X     float64
+	Y     float64
+	Fill  string
+	Class string
+	Style string
+	Value string
+}
+
+// drawTexts draws all text elements of the SVG document on top of the rasterized image.
+func drawTexts(img *image.RGBA, svg []byte, offsetX, offsetY, scale float64) error {
+	texts, err := parseTexts(svg)
+	if err != nil {
+		return err
+	}
+
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return fmt.Errorf("parsing regular font: %w", err)
+	}
+
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return fmt.Errorf("parsing bold font: %w", err)
+	}
+
+	for _, text := range texts {
+		fnt := regular
+		if strings.Contains(text.Class, "text-bold") {
+			fnt = bold
+		}
+
+		size := 16.0
+		if m := fontSizeRe.FindStringSubmatch(text.Style); m != nil {
+			if parsed, err := strconv.ParseFloat(m[1], 64); err == nil {
+				size = parsed
+			}
+		}
+
+		face, err := opentype.NewFace(fnt, &opentype.FaceOptions{
+			Size:    size * scale,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return fmt.Errorf("creating font face: %w", err)
+		}
+
+		var textColor color.Color = color.Black
+		if text.Fill != "" {
+			if c, err := oksvg.ParseSVGColor(text.Fill); err == nil && c != nil {
+				textColor = c
+			}
+		}
+
+		drawer := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(textColor),
+			Face: face,
+		}
+
+		x := (text.X - offsetX) * scale
+		width := float64(drawer.MeasureString(text.Value)) / 64
+
+		switch {
+		case strings.Contains(text.Style, "text-anchor:middle"):
+			x -= width / 2
+		case strings.Contains(text.Style, "text-anchor:end"):
+			x -= width
+		}
+
+		drawer.Dot = fixed.Point26_6{
+			X: fixed.Int26_6(x * 64),
+			Y: fixed.Int26_6((text.Y - offsetY) * scale * 64),
+		}
+		drawer.DrawString(text.Value)
+
+		if err := face.Close(); err != nil {
+			return fmt.Errorf("closing font face: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// parseTexts extracts text elements with their position and styling from the SVG document.
+func parseTexts(svg []byte) ([]svgText, error) {
+	var (
+		texts   []svgText
+		decoder = xml.NewDecoder(bytes.NewReader(svg))
+	)
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return texts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding svg: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "text" {
+			continue
+		}
+
+		text := svgText{}
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "x":
+				text.X, _ = strconv.ParseFloat(attr.Value, 64)
+			case "y":
+				text.Y, _ = strconv.ParseFloat(attr.Value, 64)
+			case "fill":
+				text.Fill = attr.Value
+			case "class":
+				text.Class = attr.Value
+			case "style":
+				text.Style = attr.Value
+			}
+		}
+
+		var value struct {
+			Text string `xml:",chardata"`
+		}
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return nil, fmt.Errorf("decoding svg text: %w", err)
+		}
+
+		text.Value = strings.TrimSpace(value.Text)
+		if text.Value != "" {
+			texts = append(texts, text)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package testutil provides test doubles shared by tests of several packages.
+package testutil
+
+import (
+	"context"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// Ensure Target implements messageflow interfaces.
+var (
+	_ messageflow.Target = Target{}
+)
+
+// Target is a messageflow.Target rendering diagrams as the mode, service and channel of their format
+// options, e.g. "service_services:User Service", so tests tell diagrams apart without rendering them.
+type Target struct{}
+
+// Capabilities reports that the target formats and renders schemas.
+func (Target) Capabilities() messageflow.TargetCapabilities {
+	return messageflow.TargetCapabilities{Format: true, Render: true}
+}
+
+// FormatSchema formats the schema as the mode, service and channel of the options.
+func (Target) FormatSchema(
+	_ context.Context,
+	_ messageflow.Schema,
+	opts messageflow.FormatOptions,
+) (messageflow.FormattedSchema, error) {
+	return messageflow.FormattedSchema{
+		Type: "fake",
+		Data: []byte(string(opts.Mode) + ":" + opts.Service + opts.Channel),
+	}, nil
+}
+
+// RenderSchema returns the formatted schema as it is.
+func (Target) RenderSchema(_ context.Context, fs messageflow.FormattedSchema) ([]byte, error) {
+	return fs.Data, nil
+}
@@ -0,0 +1,564 @@
+package messageflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// CompatibilityImpact represents the side of a channel an incompatible change breaks.
+type CompatibilityImpact string
+
+const (
+	// CompatibilityImpactConsumer breaks services receiving messages, e.g. a field they read was removed.
+	CompatibilityImpactConsumer CompatibilityImpact = "consumer"
+	// CompatibilityImpactProducer breaks services sending messages, e.g. messages they send are no longer accepted.
+	CompatibilityImpactProducer CompatibilityImpact = "producer"
+	// CompatibilityImpactBoth breaks both sides, e.g. the channel protocol changed.
+	CompatibilityImpactBoth CompatibilityImpact = "both"
+)
+
+// Incompatibility is a change of the head schema breaking services relying on the base schema.
+type Incompatibility struct {
+	Category ChangeCategory      `json:"category"`
+	Impact   CompatibilityImpact `json:"impact"`
+	Service  string              `json:"service"`
+	Channel  string              `json:"channel,omitempty"`
+	Message  string              `json:"message,omitempty"`
+	// Field is the dot-delimited path of the payload field, with [] for array items, e.g. items[].sku.
+	Field   string `json:"field,omitempty"`
+	Details string `json:"details"`
+	// Change is the name of the breaking Change of CompareSchemas the incompatibility was found in.
+	Change string `json:"change"`
+}
+
+// CompatibilityReport lists incompatibilities of the head schema with the base schema.
+type CompatibilityReport struct {
+	Compatible        bool              `json:"compatible"`
+	Incompatibilities []Incompatibility `json:"incompatibilities"`
+}
+
+// CheckCompatibility reports whether the head schema is backward compatible with the base schema.
+//
+// It narrows down breaking changes of CompareSchemas to the ones services actually depend on:
+//   - operations removed while other services still operate on the channel, e.g. a removed send breaks
+//     consumers still receiving from the channel and a removed receive breaks producers still sending to it;
+//   - message variants and payload fields removed from messages a service sends, and fields changing type;
+//   - message variants removed from messages a service receives, as producers keep sending them;
+//   - replies removed while other services still operate on the channel, and protocol changes;
+//   - channels no longer available on servers they were, e.g. environments.
+//
+// Messages a service sends are the channel messages of its send operations and reply messages of its
+// receive operations. Payloads flattened with constraints (see SplitFieldType) additionally report fields of
+// sent messages no longer required, and fields of received messages added as or made required. Without them
+// fields added to received messages aren't reported, as required fields can't be told apart. Payloads which
+// aren't flattened JSON objects are reported as changed when they differ.
+func CheckCompatibility(base, head Schema) CompatibilityReport {
+	c := compatChecker{
+		base:       base,
+		head:       head,
+		operations: changedOperations(base, head),
+	}
+
+	incompatibilities := []Incompatibility{}
+
+	for _, change := range CompareSchemas(base, head).BreakingChanges() {
+		incompatibilities = append(incompatibilities, c.incompatibilities(change)...)
+	}
+
+	sort.SliceStable(incompatibilities, func(i, j int) bool {
+		a, b := incompatibilities[i], incompatibilities[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+
+		return a.Details < b.Details
+	})
+
+	return CompatibilityReport{
+		Compatible:        len(incompatibilities) == 0,
+		Incompatibilities: incompatibilities,
+	}
+}
+
+// operationPair is an operation of a service in the base and head schemas, nil where it's missing.
+type operationPair struct {
+	service string
+	base    *Operation
+	head    *Operation
+	// baseService and headService are the service in the base and head schemas,
+	// whose servers are the servers of channels without servers of their own.
+	baseService Service
+	headService Service
+}
+
+// changedOperations returns operations of services present in both schemas by the names CompareSchemas
+// gives their changes, e.g. "User Service:getUserInfo".
+func changedOperations(base, head Schema) map[string]operationPair {
+	headServices := make(map[string]Service)
+	for _, service := range head.Services {
+		headServices[service.Name] = service
+	}
+
+	pairs := make(map[string]operationPair)
+
+	for _, baseService := range base.Services {
+		headService, ok := headServices[baseService.Name]
+		if !ok {
+			continue
+		}
+
+		keyFn := operationKeyFunc(baseService, headService)
+
+		for _, op := range baseService.Operation {
+			name := fmt.Sprintf("%s:%s", baseService.Name, keyFn(op))
+			pairs[name] = operationPair{service: baseService.Name, base: &op, baseService: baseService, headService: headService}
+		}
+
+		for _, op := range headService.Operation {
+			name := fmt.Sprintf("%s:%s", headService.Name, keyFn(op))
+			pair := pairs[name]
+			pair.service = headService.Name
+			pair.head = &op
+			pair.baseService, pair.headService = baseService, headService
+			pairs[name] = pair
+		}
+	}
+
+	return pairs
+}
+
+type compatChecker struct {
+	base       Schema
+	head       Schema
+	operations map[string]operationPair
+}
+
+// incompatibilities returns incompatibilities found in the breaking change.
+func (c compatChecker) incompatibilities(change Change) []Incompatibility {
+	if change.Category == ChangeCategoryService {
+		var incompatibilities []Incompatibility
+
+		for _, service := range c.base.Services {
+			if service.Name != change.Name {
+				continue
+			}
+
+			for _, op := range service.Operation {
+				incompatibilities = append(incompatibilities, c.removed(change, service.Name, op)...)
+			}
+		}
+
+		return incompatibilities
+	}
+
+	name, part := change.Name, ""
+	for _, suffix := range []string{"reply", "protocol", "servers", "reply-servers"} {
+		if trimmed, ok := strings.CutSuffix(change.Name, ":"+suffix); ok {
+			if _, exists := c.operations[change.Name]; !exists {
+				name, part = trimmed, suffix
+			}
+		}
+	}
+
+	pair, ok := c.operations[name]
+	if !ok || pair.base == nil {
+		return nil
+	}
+
+	switch {
+	case change.Category == ChangeCategoryChannel && part == "protocol":
+		return []Incompatibility{{
+			Category: change.Category,
+			Impact:   CompatibilityImpactBoth,
+			Service:  pair.service,
+			Channel:  pair.head.Channel.Name,
+			Details: fmt.Sprintf("Protocol of channel '%s' changed from '%s' to '%s'",
+				pair.head.Channel.Name, pair.base.Channel.Protocol, pair.head.Channel.Protocol),
+			Change: change.Name,
+		}}
+	case change.Category == ChangeCategoryChannel && part == "servers":
+		return serversIncompatibilities(change, pair, pair.base.Channel, pair.head.Channel)
+	case change.Category == ChangeCategoryReply && part == "reply-servers":
+		return serversIncompatibilities(change, pair, *pair.base.Reply, *pair.head.Reply)
+	case change.Category == ChangeCategoryChannel:
+		// Operations removed or moved to another channel or action no longer serve the base channel.
+		return c.removed(change, pair.service, *pair.base)
+	case change.Category == ChangeCategoryReply:
+		return c.removedReply(change, pair)
+	case change.Category == ChangeCategoryMessage && part == "reply":
+		return messagesIncompatibilities(change, pair.service, pair.head.Channel.Name,
+			pair.base.Reply.Messages, pair.head.Reply.Messages, pair.head.Action == ActionReceive)
+	case change.Category == ChangeCategoryMessage:
+		return messagesIncompatibilities(change, pair.service, pair.head.Channel.Name,
+			pair.base.Channel.Messages, pair.head.Channel.Messages, pair.head.Action == ActionSend)
+	}
+
+	return nil
+}
+
+// removed returns the incompatibility of the service no longer performing the base operation,
+// if other services of the head schema still depend on it. Operations matched by synthesized keys look
+// removed when their messages change, so messages are compared instead when the service still performs
+// the action on the channel.
+func (c compatChecker) removed(change Change, service string, op Operation) []Incompatibility {
+	for _, headOp := range c.head.OperationsForChannel(op.Channel.Name) {
+		if !headOp.Reply && headOp.Service == service && headOp.Operation.Action == op.Action {
+			return messagesIncompatibilities(change, service, op.Channel.Name,
+				op.Channel.Messages, headOp.Operation.Channel.Messages, op.Action == ActionSend)
+		}
+	}
+
+	incompatibility := Incompatibility{
+		Category: ChangeCategoryChannel,
+		Service:  service,
+		Channel:  op.Channel.Name,
+		Change:   change.Name,
+	}
+
+	if op.Action == ActionSend {
+		consumers := c.counterparts(op.Channel.Name, ActionReceive, service)
+		incompatibility.Impact = CompatibilityImpactConsumer
+		incompatibility.Details = fmt.Sprintf("'%s' no longer sends to channel '%s' received from by %s",
+			service, op.Channel.Name, quotedNames(consumers))
+
+		if len(consumers) == 0 {
+			return nil
+		}
+
+		return []Incompatibility{incompatibility}
+	}
+
+	producers := c.counterparts(op.Channel.Name, ActionSend, service)
+	incompatibility.Impact = CompatibilityImpactProducer
+	incompatibility.Details = fmt.Sprintf("'%s' no longer receives from channel '%s' sent to by %s",
+		service, op.Channel.Name, quotedNames(producers))
+
+	if len(producers) == 0 {
+		return nil
+	}
+
+	return []Incompatibility{incompatibility}
+}
+
+// removedReply returns the incompatibility of the reply removed from the operation, if other services
+// of the head schema still operate on the channel. Repliers no longer replying break requesters,
+// requesters no longer expecting replies break repliers.
+func (c compatChecker) removedReply(change Change, pair operationPair) []Incompatibility {
+	incompatibility := Incompatibility{
+		Category: ChangeCategoryReply,
+		Service:  pair.service,
+		Channel:  pair.head.Channel.Name,
+		Change:   change.Name,
+	}
+
+	var counterparts []string
+
+	if pair.head.Action == ActionReceive {
+		counterparts = c.counterparts(pair.head.Channel.Name, ActionSend, pair.service)
+		incompatibility.Impact = CompatibilityImpactConsumer
+		incompatibility.Details = fmt.Sprintf("'%s' no longer replies to requests on channel '%s' sent by %s",
+			pair.service, pair.head.Channel.Name, quotedNames(counterparts))
+	} else {
+		counterparts = c.counterparts(pair.head.Channel.Name, ActionReceive, pair.service)
+		incompatibility.Impact = CompatibilityImpactProducer
+		incompatibility.Details = fmt.Sprintf("'%s' no longer expects replies to requests on channel '%s' from %s",
+			pair.service, pair.head.Channel.Name, quotedNames(counterparts))
+	}
+
+	if len(counterparts) == 0 {
+		return nil
+	}
+
+	return []Incompatibility{incompatibility}
+}
+
+// serversIncompatibilities returns the incompatibility of the channel of the operation, or its reply channel,
+// no longer available on servers it was, e.g. an environment. Making it available on more servers is compatible.
+func serversIncompatibilities(change Change, pair operationPair, base, head Channel) []Incompatibility {
+	headServers := pair.headService.ChannelServers(head)
+
+	var removed []string
+	for _, server := range pair.baseService.ChannelServers(base) {
+		if !slices.Contains(headServers, server) {
+			removed = append(removed, server)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	return []Incompatibility{{
+		Category: change.Category,
+		Impact:   CompatibilityImpactBoth,
+		Service:  pair.service,
+		Channel:  head.Name,
+		Details: fmt.Sprintf("Channel '%s' is no longer available on servers %s",
+			head.Name, quotedNames(removed)),
+		Change: change.Name,
+	}}
+}
+
+// counterparts returns names of head services other than the given one performing the action on the channel.
+func (c compatChecker) counterparts(channel string, action Action, except string) []string {
+	var names []string
+
+	for _, op := range c.head.OperationsForChannel(channel) {
+		if !op.Reply && op.Operation.Action == action && op.Service != except && !slices.Contains(names, op.Service) {
+			names = append(names, op.Service)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// messagesIncompatibilities compares messages of an operation matched by name. Messages the service sends
+// break consumers when variants or fields are removed or fields change type, messages it receives break
+// producers when variants are removed or fields change type.
+func messagesIncompatibilities(
+	change Change,
+	service, channel string,
+	baseMessages, headMessages []Message,
+	sent bool,
+) []Incompatibility {
+	impact := CompatibilityImpactProducer
+	if sent {
+		impact = CompatibilityImpactConsumer
+	}
+
+	var incompatibilities []Incompatibility
+
+	add := func(message, field, details string) {
+		incompatibilities = append(incompatibilities, Incompatibility{
+			Category: ChangeCategoryMessage,
+			Impact:   impact,
+			Service:  service,
+			Channel:  channel,
+			Message:  message,
+			Field:    field,
+			Details:  details,
+			Change:   change.Name,
+		})
+	}
+
+	for _, baseMessage := range baseMessages {
+		i := slices.IndexFunc(headMessages, func(msg Message) bool { return msg.Name == baseMessage.Name })
+		if i < 0 {
+			add(baseMessage.Name, "", fmt.Sprintf("Message '%s' was removed", baseMessage.Name))
+			continue
+		}
+
+		headMessage := headMessages[i]
+		if baseMessage.Payload == headMessage.Payload {
+			continue
+		}
+
+		baseFields, baseOK := payloadFields(baseMessage)
+		headFields, headOK := payloadFields(headMessage)
+
+		if !baseOK || !headOK {
+			add(baseMessage.Name, "", fmt.Sprintf("Payload of message '%s' changed", baseMessage.Name))
+			continue
+		}
+
+		paths := make([]string, 0, len(baseFields))
+		for path := range baseFields {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			parent := parentField(path)
+			if parent != "" && baseFields[parent] != headFields[parent] {
+				// Reported by the parent field.
+				continue
+			}
+
+			baseField := baseFields[path]
+			headField, exists := headFields[path]
+
+			switch {
+			case !exists && sent && baseField.required:
+				add(baseMessage.Name, path, fmt.Sprintf("Required field '%s' of message '%s' was removed", path, baseMessage.Name))
+			case !exists && sent:
+				add(baseMessage.Name, path, fmt.Sprintf("Field '%s' of message '%s' was removed", path, baseMessage.Name))
+			case exists && headField.typ != baseField.typ:
+				add(baseMessage.Name, path, fmt.Sprintf("Field '%s' of message '%s' changed type from '%s' to '%s'",
+					path, baseMessage.Name, baseField.typ, headField.typ))
+			case exists && sent && baseField.required && !headField.required:
+				add(baseMessage.Name, path, fmt.Sprintf("Field '%s' of message '%s' is no longer required", path, baseMessage.Name))
+			case exists && !sent && !baseField.required && headField.required:
+				add(baseMessage.Name, path, fmt.Sprintf("Field '%s' of message '%s' became required", path, baseMessage.Name))
+			}
+		}
+
+		if sent {
+			continue
+		}
+
+		paths = paths[:0]
+		for path, field := range headFields {
+			if _, exists := baseFields[path]; !exists && field.required {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if parent := parentField(path); parent != "" && baseFields[parent] != headFields[parent] {
+				// Reported by the parent field.
+				continue
+			}
+
+			add(baseMessage.Name, path, fmt.Sprintf("Required field '%s' was added to message '%s'", path, baseMessage.Name))
+		}
+	}
+
+	return incompatibilities
+}
+
+// payloadField is a field of a flattened payload, its type excluding the required marker.
+type payloadField struct {
+	typ      string
+	required bool
+}
+
+// payloadFields returns fields of the flattened payload by their paths, e.g. "string" for
+// items[].sku, "object" and "array" for nested objects and arrays, fields of array payloads follow [],
+// e.g. [].sku. It reports false for payloads which aren't flattened JSON objects or arrays.
+func payloadFields(msg Message) (map[string]payloadField, bool) {
+	var root any
+	if msg.SchemaFormat != "" || json.Unmarshal([]byte(msg.Payload), &root) != nil {
+		return nil, false
+	}
+
+	switch root.(type) {
+	case map[string]any, []any:
+	default:
+		return nil, false
+	}
+
+	fields := make(map[string]payloadField)
+	collectFields(fields, "", root)
+
+	return fields, true
+}
+
+func collectFields(fields map[string]payloadField, path string, v any) {
+	switch value := v.(type) {
+	case map[string]any:
+		for name, field := range value {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			fields[fieldPath] = newPayloadField(fieldType(field))
+			collectFields(fields, fieldPath, field)
+		}
+	case []any:
+		if len(value) > 0 {
+			fields[path+"[]"] = newPayloadField(fieldType(value[0]))
+			collectFields(fields, path+"[]", value[0])
+		}
+	}
+}
+
+func fieldType(v any) string {
+	switch value := v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// newPayloadField splits the required marker off the flattened field type.
+func newPayloadField(typ string) payloadField {
+	name, tokens, required := SplitFieldType(typ)
+	if !required {
+		return payloadField{typ: typ}
+	}
+
+	if len(tokens) > 0 {
+		name += "[" + strings.Join(tokens, ",") + "]"
+	}
+
+	return payloadField{typ: name, required: true}
+}
+
+// SplitFieldType splits a flattened field type such as "string[uuid,required,maxLength:36]" into the type,
+// its format and constraints other than the required marker, and whether the field is required. Enum values
+// and patterns, e.g. "enum:a,b" or "pattern:^[a-z]+$", are the last tokens and may contain commas, a pattern
+// follows enum values.
+func SplitFieldType(typ string) (name string, tokens []string, required bool) {
+	name, rest, found := strings.Cut(typ, "[")
+	if !found || !strings.HasSuffix(rest, "]") {
+		return typ, nil, false
+	}
+
+	rest = strings.TrimSuffix(rest, "]")
+	for rest != "" {
+		if strings.HasPrefix(rest, "enum:") {
+			enum, pattern, found := strings.Cut(rest, ",pattern:")
+			tokens = append(tokens, enum)
+			if found {
+				tokens = append(tokens, "pattern:"+pattern)
+			}
+			break
+		}
+
+		if strings.HasPrefix(rest, "pattern:") {
+			tokens = append(tokens, rest)
+			break
+		}
+
+		var token string
+		token, rest, _ = strings.Cut(rest, ",")
+
+		if token == "required" {
+			required = true
+			continue
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return name, tokens, required
+}
+
+// parentField returns the path of the object or array holding the field, "" for top-level fields.
+func parentField(path string) string {
+	if trimmed, ok := strings.CutSuffix(path, "[]"); ok {
+		return trimmed
+	}
+
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+
+	return ""
+}
+
+// quotedNames joins quoted names separated by comma, e.g. 'A', 'B'.
+func quotedNames(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, "'"+name+"'")
+	}
+
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,260 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	t.Parallel()
+
+	base := Schema{
+		Services: []Service{
+			{Name: "Order Service", Operation: []Operation{
+				{ID: "sendOrderPlaced", Action: ActionSend, Channel: Channel{Name: "orders.placed", Messages: []Message{{
+					Name:    "OrderPlaced",
+					Payload: `{"id": "string[uuid]", "total": "number", "address": {"city": "string"}, "items": [{"sku": "string"}]}`,
+				}}}},
+				{ID: "sendOrderAudit", Action: ActionSend, Channel: Channel{Name: "orders.audit"}},
+				{ID: "sendOrderArchived", Action: ActionSend, Channel: Channel{Name: "orders.archived"}},
+			}},
+			{Name: "Billing Service", Operation: []Operation{
+				{ID: "receiveOrderPlaced", Action: ActionReceive, Channel: Channel{Name: "orders.placed", Messages: []Message{
+					{Name: "OrderPlaced", Payload: `{"id": "string[uuid]", "total": "number"}`},
+					{Name: "OrderAmended", Payload: `{"id": "string[uuid]"}`},
+				}}},
+				{ID: "receiveInvoice", Action: ActionReceive, Channel: Channel{Name: "invoice.request", Protocol: "kafka"},
+					Reply: &Channel{Name: "invoice.reply"}},
+			}},
+			{Name: "Audit Service", Operation: []Operation{
+				{ID: "receiveOrderAudit", Action: ActionReceive, Channel: Channel{Name: "orders.audit"}},
+				{ID: "sendInvoice", Action: ActionSend, Channel: Channel{Name: "invoice.request", Protocol: "kafka"},
+					Reply: &Channel{Name: "invoice.reply"}},
+			}},
+		},
+	}
+
+	report := CheckCompatibility(base, base)
+	assert.True(t, report.Compatible)
+	assert.Empty(t, report.Incompatibilities)
+
+	head := Schema{
+		Services: []Service{
+			{Name: "Order Service", Operation: []Operation{
+				{ID: "sendOrderPlaced", Action: ActionSend, Channel: Channel{Name: "orders.placed", Messages: []Message{{
+					Name:    "OrderPlaced",
+					Payload: `{"id": "string", "total": "number", "currency": "string", "items": [{"sku": "string"}]}`,
+				}}}},
+			}},
+			{Name: "Billing Service", Operation: []Operation{
+				{ID: "receiveOrderPlaced", Action: ActionReceive, Channel: Channel{Name: "orders.placed", Messages: []Message{
+					{Name: "OrderPlaced", Payload: `{"id": "string[uuid]", "total": "string", "note": "string"}`},
+				}}},
+				{ID: "receiveInvoice", Action: ActionReceive, Channel: Channel{Name: "invoice.request", Protocol: "amqp"}},
+			}},
+			{Name: "Audit Service", Operation: []Operation{
+				{ID: "receiveOrderAudit", Action: ActionReceive, Channel: Channel{Name: "orders.audit"}},
+				{ID: "sendInvoice", Action: ActionSend, Channel: Channel{Name: "invoice.request", Protocol: "amqp"},
+					Reply: &Channel{Name: "invoice.reply"}},
+			}},
+		},
+	}
+
+	report = CheckCompatibility(base, head)
+	assert.False(t, report.Compatible)
+	assert.Equal(t, []Incompatibility{
+		{
+			Category: ChangeCategoryChannel,
+			Impact:   CompatibilityImpactBoth,
+			Service:  "Audit Service",
+			Channel:  "invoice.request",
+			Details:  "Protocol of channel 'invoice.request' changed from 'kafka' to 'amqp'",
+			Change:   "Audit Service:sendInvoice:protocol",
+		},
+		{
+			Category: ChangeCategoryReply,
+			Impact:   CompatibilityImpactConsumer,
+			Service:  "Billing Service",
+			Channel:  "invoice.request",
+			Details:  "'Billing Service' no longer replies to requests on channel 'invoice.request' sent by 'Audit Service'",
+			Change:   "Billing Service:receiveInvoice:reply",
+		},
+		{
+			Category: ChangeCategoryChannel,
+			Impact:   CompatibilityImpactBoth,
+			Service:  "Billing Service",
+			Channel:  "invoice.request",
+			Details:  "Protocol of channel 'invoice.request' changed from 'kafka' to 'amqp'",
+			Change:   "Billing Service:receiveInvoice:protocol",
+		},
+		{
+			Category: ChangeCategoryMessage,
+			Impact:   CompatibilityImpactProducer,
+			Service:  "Billing Service",
+			Channel:  "orders.placed",
+			Message:  "OrderPlaced",
+			Field:    "total",
+			Details:  "Field 'total' of message 'OrderPlaced' changed type from 'number' to 'string'",
+			Change:   "Billing Service:receiveOrderPlaced",
+		},
+		{
+			Category: ChangeCategoryMessage,
+			Impact:   CompatibilityImpactProducer,
+			Service:  "Billing Service",
+			Channel:  "orders.placed",
+			Message:  "OrderAmended",
+			Details:  "Message 'OrderAmended' was removed",
+			Change:   "Billing Service:receiveOrderPlaced",
+		},
+		{
+			Category: ChangeCategoryChannel,
+			Impact:   CompatibilityImpactConsumer,
+			Service:  "Order Service",
+			Channel:  "orders.audit",
+			Details:  "'Order Service' no longer sends to channel 'orders.audit' received from by 'Audit Service'",
+			Change:   "Order Service:sendOrderAudit",
+		},
+		{
+			Category: ChangeCategoryMessage,
+			Impact:   CompatibilityImpactConsumer,
+			Service:  "Order Service",
+			Channel:  "orders.placed",
+			Message:  "OrderPlaced",
+			Field:    "address",
+			Details:  "Field 'address' of message 'OrderPlaced' was removed",
+			Change:   "Order Service:sendOrderPlaced",
+		},
+		{
+			Category: ChangeCategoryMessage,
+			Impact:   CompatibilityImpactConsumer,
+			Service:  "Order Service",
+			Channel:  "orders.placed",
+			Message:  "OrderPlaced",
+			Field:    "id",
+			Details:  "Field 'id' of message 'OrderPlaced' changed type from 'string[uuid]' to 'string'",
+			Change:   "Order Service:sendOrderPlaced",
+		},
+	}, report.Incompatibilities)
+}
+
+func TestCheckCompatibilitySynthesizedKeys(t *testing.T) {
+	t.Parallel()
+
+	base := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				{Action: ActionSend, Channel: Channel{Name: "user.created", Messages: []Message{
+					{Name: "UserCreated", Payload: `{"id": "string", "email": "string"}`},
+				}}},
+			}},
+			{Name: "Mail Service", Operation: []Operation{
+				{Action: ActionReceive, Channel: Channel{Name: "user.created", Messages: []Message{
+					{Name: "UserCreated", Payload: `{"id": "string", "email": "string"}`},
+				}}},
+			}},
+		},
+	}
+
+	head := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				{Action: ActionSend, Channel: Channel{Name: "user.created", Messages: []Message{
+					{Name: "UserRegistered", Payload: `{"id": "string"}`},
+				}}},
+			}},
+			base.Services[1],
+		},
+	}
+
+	report := CheckCompatibility(base, head)
+	assert.Equal(t, []Incompatibility{{
+		Category: ChangeCategoryMessage,
+		Impact:   CompatibilityImpactConsumer,
+		Service:  "User Service",
+		Channel:  "user.created",
+		Message:  "UserCreated",
+		Details:  "Message 'UserCreated' was removed",
+		Change:   "User Service:send-user.created-UserCreated",
+	}}, report.Incompatibilities)
+}
+
+func TestCheckCompatibilityRequiredFields(t *testing.T) {
+	t.Parallel()
+
+	schema := func(sent, received string) Schema {
+		return Schema{
+			Services: []Service{
+				{Name: "User Service", Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created", Messages: []Message{
+						{Name: "UserCreated", Payload: sent},
+					}}},
+					{Action: ActionReceive, Channel: Channel{Name: "user.update", Messages: []Message{
+						{Name: "UpdateUser", Payload: received},
+					}}},
+				}},
+				{Name: "Mail Service", Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created", Messages: []Message{
+						{Name: "UserCreated", Payload: sent},
+					}}},
+				}},
+				{Name: "Admin Service", Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.update", Messages: []Message{
+						{Name: "UpdateUser", Payload: received},
+					}}},
+				}},
+			},
+		}
+	}
+
+	base := schema(
+		`{"id": "string[uuid,required]", "email": "string[required]", "name": "string[maxLength:64]"}`,
+		`{"id": "string[uuid]", "name": "string"}`,
+	)
+	head := schema(
+		`{"id": "string[uuid]", "name": "string[maxLength:64]"}`,
+		`{"id": "string[uuid,required]", "name": "string", "code": "string[required,maxLength:8]", "note": "string"}`,
+	)
+
+	var details []string
+	for _, incompatibility := range CheckCompatibility(base, head).Incompatibilities {
+		if incompatibility.Service == "User Service" {
+			details = append(details, incompatibility.Details)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"Field 'id' of message 'UserCreated' is no longer required",
+		"Required field 'email' of message 'UserCreated' was removed",
+		"Field 'id' of message 'UpdateUser' became required",
+		"Required field 'code' was added to message 'UpdateUser'",
+	}, details)
+
+	assert.True(t, CheckCompatibility(base, base).Compatible)
+}
+
+func TestSplitFieldType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		typ      string
+		name     string
+		tokens   []string
+		required bool
+	}{
+		{typ: "string", name: "string"},
+		{typ: "string[uuid]", name: "string", tokens: []string{"uuid"}},
+		{typ: "string[uuid,required,maxLength:36]", name: "string", tokens: []string{"uuid", "maxLength:36"}, required: true},
+		{typ: "string[required,enum:a,required]", name: "string", tokens: []string{"enum:a,required"}, required: true},
+		{typ: "string[pattern:^a,b$]", name: "string", tokens: []string{"pattern:^a,b$"}},
+		{typ: "string[enum:a,b,pattern:^[ab],$]", name: "string", tokens: []string{"enum:a,b", "pattern:^[ab],$"}},
+		{typ: "string[uuid", name: "string[uuid"},
+	}
+
+	for _, tt := range tests {
+		name, tokens, required := SplitFieldType(tt.typ)
+		assert.Equal(t, tt.name, name, tt.typ)
+		assert.Equal(t, tt.tokens, tokens, tt.typ)
+		assert.Equal(t, tt.required, required, tt.typ)
+	}
+}
@@ -0,0 +1,107 @@
+package messageflow
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DiffFormat is the format of message diffs in changes, see WithDiffFormat.
+type DiffFormat string
+
+const (
+	// DiffFormatCmp diffs messages as Go values with go-cmp.
+	DiffFormatCmp DiffFormat = "cmp"
+	// DiffFormatUnified diffs messages pretty-printed as JSON line by line, as git diff does.
+	DiffFormatUnified DiffFormat = "unified"
+)
+
+// CompareOpt configures schema comparison.
+type CompareOpt func(*compareOptions)
+
+type compareOptions struct {
+	diffFormat DiffFormat
+	ignore     []ignorePattern
+}
+
+// WithDiffFormat sets the format of diffs of changed messages, DiffFormatCmp by default.
+func WithDiffFormat(format DiffFormat) CompareOpt {
+	return func(o *compareOptions) {
+		o.diffFormat = format
+	}
+}
+
+// messagesDiff returns the diff of old and new messages in the given format.
+func messagesDiff(oldMessages, newMessages []Message, format DiffFormat) string {
+	if format != DiffFormatUnified {
+		return cmp.Diff(oldMessages, newMessages)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(messagesText(oldMessages)),
+		B:        difflib.SplitLines(messagesText(newMessages)),
+		FromFile: "old",
+		ToFile:   "new",
+		Context:  3,
+	})
+	if err != nil {
+		// Writing to a buffer doesn't fail.
+		return cmp.Diff(oldMessages, newMessages)
+	}
+
+	return strings.TrimSuffix(diff, "\n")
+}
+
+// messagesText lists the messages pretty-printed as JSON, one after another. JSON payloads, headers and examples
+// are nested as JSON values, so that changes of any message field show up line by line.
+func messagesText(messages []Message) string {
+	blocks := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		blocks = append(blocks, messageText(msg))
+	}
+
+	return strings.Join(blocks, "\n")
+}
+
+// messageText pretty-prints the message as JSON with two spaces indentation.
+func messageText(msg Message) string {
+	examples := make([]any, 0, len(msg.Examples))
+	for _, example := range msg.Examples {
+		examples = append(examples, jsonValue(example))
+	}
+
+	// Fields of the outer struct take precedence over the ones of the embedded message.
+	data, err := json.MarshalIndent(struct {
+		Message
+		Payload  any   `json:"payload"`
+		Headers  any   `json:"headers,omitempty"`
+		Examples []any `json:"examples,omitempty"`
+	}{
+		Message:  msg,
+		Payload:  jsonValue(msg.Payload),
+		Headers:  jsonValue(msg.Headers),
+		Examples: examples,
+	}, "", "  ")
+	if err != nil {
+		// Values are either valid JSON or strings, so marshaling doesn't fail.
+		return msg.Name + ":\n" + msg.Payload
+	}
+
+	return string(data)
+}
+
+// jsonValue returns the document as a raw JSON value to be nested, other documents as they are.
+// Empty documents are returned as nil.
+func jsonValue(document string) any {
+	if document == "" {
+		return nil
+	}
+
+	if json.Valid([]byte(document)) {
+		return json.RawMessage(document)
+	}
+
+	return document
+}
@@ -0,0 +1,104 @@
+package messageflow
+
+import (
+	"slices"
+	"sort"
+)
+
+// Environments returns unique names of the servers services declare and channels are available on,
+// including reply channels, sorted alphabetically. Specifications declaring a server per environment,
+// e.g. production and staging, list the environments.
+func (s Schema) Environments() []string {
+	seen := make(map[string]bool)
+
+	for _, service := range s.Services {
+		for _, server := range service.Servers {
+			seen[server] = true
+		}
+
+		for _, op := range service.Operation {
+			for _, server := range op.Channel.Servers {
+				seen[server] = true
+			}
+
+			if op.Reply != nil {
+				for _, server := range op.Reply.Servers {
+					seen[server] = true
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ForEnvironment returns a copy of the schema tagged with the environment, keeping operations on channels
+// available on its server, replies over channels that aren't are dropped from the remaining operations.
+// Channels available on all servers of services declaring none, e.g. of specifications without servers,
+// are kept. Servers of the remaining services and channels listing their own are narrowed to the environment.
+// Services left without operations aren't deployed in the environment and are dropped.
+func (s Schema) ForEnvironment(env string) Schema {
+	services := make([]Service, 0, len(s.Services))
+
+	for _, service := range s.Services {
+		operations := make([]Operation, 0, len(service.Operation))
+
+		for _, op := range service.Operation {
+			channel, ok := channelForEnvironment(service, op.Channel, env)
+			if !ok {
+				continue
+			}
+
+			op.Channel = channel
+
+			if op.Reply != nil {
+				if reply, ok := channelForEnvironment(service, *op.Reply, env); ok {
+					op.Reply = &reply
+				} else {
+					op.Reply = nil
+				}
+			}
+
+			operations = append(operations, op)
+		}
+
+		if len(operations) == 0 && len(service.Operation) > 0 {
+			continue
+		}
+
+		if slices.Contains(service.Servers, env) {
+			service.Servers = []string{env}
+		}
+
+		service.Operation = operations
+		services = append(services, service)
+	}
+
+	return Schema{Services: services}
+}
+
+// channelForEnvironment returns the channel of the service with servers narrowed to the environment,
+// false when the channel isn't available on it.
+func channelForEnvironment(service Service, channel Channel, env string) (Channel, bool) {
+	servers := service.ChannelServers(channel)
+	if len(servers) == 0 {
+		return channel, true
+	}
+
+	if !slices.Contains(servers, env) {
+		return Channel{}, false
+	}
+
+	if len(channel.Servers) > 0 {
+		channel.Servers = []string{env}
+	}
+
+	return channel, true
+}
@@ -0,0 +1,150 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEnvironment(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created", Servers: []string{"production", "staging"}}},
+					{
+						Action:  ActionReceive,
+						Channel: Channel{Name: "user.info"},
+						Reply:   &Channel{Name: "user.info.debug", Servers: []string{"staging"}},
+					},
+				},
+			},
+			{
+				Name: "Debug Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created", Servers: []string{"staging"}}},
+				},
+			},
+			{Name: "Idle Service"},
+		},
+	}
+
+	assert.Equal(t, []string{"production", "staging"}, schema.Environments())
+
+	assert.Equal(t, Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created", Servers: []string{"production"}}},
+					{Action: ActionReceive, Channel: Channel{Name: "user.info"}},
+				},
+			},
+			{Name: "Idle Service", Operation: []Operation{}},
+		},
+	}, schema.ForEnvironment("production"))
+
+	staging := schema.ForEnvironment("staging")
+	assert.Equal(t, []string{"staging"}, staging.Environments())
+	assert.Equal(t, []string{"Debug Service", "Idle Service", "User Service"}, staging.ServiceNames())
+	assert.Equal(t, &Channel{Name: "user.info.debug", Servers: []string{"staging"}}, staging.Services[0].Operation[1].Reply)
+
+	assert.Empty(t, Schema{}.Environments())
+
+	// Channels without servers are available on all servers of their service.
+	schema = Schema{Services: []Service{
+		{Name: "User Service", Servers: []string{"production"}, Operation: []Operation{
+			{Action: ActionSend, Channel: Channel{Name: "user.created"}},
+		}},
+		{Name: "Debug Service", Servers: []string{"production", "staging"}, Operation: []Operation{
+			{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+		}},
+	}}
+
+	assert.Equal(t, []string{"production", "staging"}, schema.Environments())
+	assert.Equal(t, Schema{Services: []Service{
+		{Name: "Debug Service", Servers: []string{"staging"}, Operation: []Operation{
+			{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+		}},
+	}}, schema.ForEnvironment("staging"))
+}
+
+func TestCompareSchemasServers(t *testing.T) {
+	t.Parallel()
+
+	schema := func(servers ...string) Schema {
+		return Schema{Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				{Action: ActionSend, Channel: Channel{Name: "user.created", Servers: servers}},
+			}},
+			{Name: "Audit Service", Operation: []Operation{
+				{Action: ActionReceive, Channel: Channel{Name: "user.created", Servers: servers}},
+			}},
+		}}
+	}
+
+	changelog := CompareSchemas(schema("production"), schema("production", "staging"))
+	if assert.Len(t, changelog.Changes, 2) {
+		assert.Equal(t, ChangeCategoryChannel, changelog.Changes[0].Category)
+		assert.Equal(t, ChangeSeverityNonBreaking, changelog.Changes[0].Severity())
+		assert.Contains(t, changelog.Changes[0].Details, "Servers changed for channel 'user.created'")
+		assert.Contains(t, changelog.Changes[0].Details, "added [staging]")
+	}
+
+	changelog = CompareSchemas(schema("production", "staging"), schema("production"))
+	if assert.Len(t, changelog.Changes, 2) {
+		assert.Equal(t, ChangeSeverityBreaking, changelog.Changes[0].Severity())
+		assert.Contains(t, changelog.Changes[0].Details, "removed [staging]")
+	}
+
+	assert.True(t, CheckCompatibility(schema(), schema()).Compatible)
+	assert.True(t, CheckCompatibility(schema("production"), schema("production", "staging")).Compatible)
+	assert.True(t, CheckCompatibility(schema(), schema("staging")).Compatible)
+
+	report := CheckCompatibility(schema("production", "staging"), schema("production"))
+	if assert.Len(t, report.Incompatibilities, 2) {
+		assert.Equal(t, CompatibilityImpactBoth, report.Incompatibilities[0].Impact)
+		assert.Equal(t, "Channel 'user.created' is no longer available on servers 'staging'",
+			report.Incompatibilities[0].Details)
+	}
+
+	// Channels without servers are available on all servers of their service.
+	implicit := func(servers ...string) Schema {
+		return Schema{Services: []Service{
+			{Name: "User Service", Servers: servers, Operation: []Operation{
+				{
+					Action:  ActionSend,
+					Channel: Channel{Name: "user.created"},
+					Reply:   &Channel{Name: "user.created.ack"},
+				},
+			}},
+		}}
+	}
+
+	// Schemas listing all servers on channels, e.g. persisted by earlier versions, match ones listing none.
+	listed := implicit("production")
+	listed.Services[0].Operation[0].Channel.Servers = []string{"production"}
+	listed.Services[0].Operation[0].Reply.Servers = []string{"production"}
+
+	assert.Empty(t, CompareSchemas(listed, implicit("production")).Changes)
+
+	explicit := implicit("production", "staging")
+	explicit.Services[0].Operation[0].Reply.Servers = []string{"staging"}
+
+	changelog = CompareSchemas(implicit("production", "staging"), explicit)
+	if assert.Len(t, changelog.Changes, 1) {
+		assert.Equal(t, ChangeCategoryReply, changelog.Changes[0].Category)
+		assert.Equal(t, ChangeSeverityBreaking, changelog.Changes[0].Severity())
+		assert.Contains(t, changelog.Changes[0].Details, "Servers changed for reply channel 'user.created.ack'")
+		assert.Contains(t, changelog.Changes[0].Details, "removed [production]")
+	}
+
+	report = CheckCompatibility(implicit("production", "staging"), explicit)
+	if assert.Len(t, report.Incompatibilities, 1) {
+		assert.Equal(t, "Channel 'user.created.ack' is no longer available on servers 'production'",
+			report.Incompatibilities[0].Details)
+	}
+}
@@ -0,0 +1,288 @@
+package messageflow
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Labels of graph edges describing how connected services communicate.
+const (
+	EdgeLabelPub    = "Pub"
+	EdgeLabelReq    = "Req"
+	EdgeLabelPubReq = "Pub/Req"
+)
+
+// GraphNode is a service in the service graph.
+type GraphNode struct {
+	Name  string `json:"name"`
+	Group string `json:"group,omitempty"`
+}
+
+// GraphEdge connects a service sending messages to a service receiving them.
+// Bidirectional edges connect services sending to each other, From is the one with the lesser name.
+type GraphEdge struct {
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Label         string `json:"label"`
+	Bidirectional bool   `json:"bidirectional,omitempty"`
+	// Channels lists sorted channels the services communicate over.
+	Channels []string `json:"channels"`
+}
+
+// Graph is the communication graph of services, see BuildServiceGraph.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// BuildServiceGraph builds the graph of services connected by channels one of them sends to and
+// the other receives from. Edges are labeled EdgeLabelPub for plain messages, EdgeLabelReq for requests
+// expecting a reply and EdgeLabelPubReq for both. Nodes keep the order of services in the schema,
+// edges are sorted by their ends.
+func BuildServiceGraph(s Schema) Graph {
+	graph := Graph{
+		Nodes: make([]GraphNode, 0, len(s.Services)),
+		Edges: []GraphEdge{},
+	}
+
+	services := make(map[string]Service, len(s.Services))
+	for _, service := range s.Services {
+		graph.Nodes = append(graph.Nodes, GraphNode{Name: service.Name, Group: service.Group})
+		services[service.Name] = service
+	}
+
+	// sends maps senders to receivers of their messages.
+	sends := make(map[string]map[string]bool)
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			if op.Action != ActionSend {
+				continue
+			}
+
+			for _, other := range s.Services {
+				if other.Name == service.Name {
+					continue
+				}
+
+				for _, otherOp := range other.Operation {
+					if otherOp.Channel.Name == op.Channel.Name && otherOp.Action == ActionReceive {
+						if sends[service.Name] == nil {
+							sends[service.Name] = make(map[string]bool)
+						}
+						sends[service.Name][other.Name] = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	edges := make(map[string]GraphEdge)
+
+	for sender, receivers := range sends {
+		for receiver := range receivers {
+			bidirectional := sends[receiver][sender]
+
+			from, to := sender, receiver
+			if bidirectional && receiver < sender {
+				from, to = receiver, sender
+			}
+
+			label, channels := connection(services[from], services[to])
+
+			edges[fmt.Sprintf("%s->%s", from, to)] = GraphEdge{
+				From:          from,
+				To:            to,
+				Label:         label,
+				Bidirectional: bidirectional,
+				Channels:      channels,
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(edges))
+	for key := range edges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		graph.Edges = append(graph.Edges, edges[key])
+	}
+
+	return graph
+}
+
+// SelfLoops returns edges of services sending to a channel they receive from themselves, e.g. an internal
+// work queue the service enqueues tasks to and processes, with the service as both ends. A self-loop needs
+// a send and a receive operation of the same service on the same channel, requests the service replies to
+// itself are labeled EdgeLabelReq. BuildServiceGraph leaves self-loops out. Edges are sorted by service.
+func SelfLoops(s Schema) []GraphEdge {
+	loops := []GraphEdge{}
+
+	for _, service := range s.Services {
+		label, channels := connection(service, service)
+		if len(channels) == 0 {
+			continue
+		}
+
+		loops = append(loops, GraphEdge{
+			From:     service.Name,
+			To:       service.Name,
+			Label:    label,
+			Channels: channels,
+		})
+	}
+
+	sort.Slice(loops, func(i, j int) bool {
+		return loops[i].From < loops[j].From
+	})
+
+	return loops
+}
+
+// Neighbors returns sorted names of services connected to the service in either direction.
+func (g Graph) Neighbors(name string) []string {
+	var neighbors []string
+
+	for _, edge := range g.Edges {
+		switch name {
+		case edge.From:
+			neighbors = append(neighbors, edge.To)
+		case edge.To:
+			neighbors = append(neighbors, edge.From)
+		}
+	}
+
+	sort.Strings(neighbors)
+
+	return slices.Compact(neighbors)
+}
+
+// connection returns the edge label and sorted channels shared by the services with opposite actions.
+func connection(service1, service2 Service) (string, []string) {
+	var (
+		hasPub, hasReq bool
+		channels       []string
+	)
+
+	for _, op1 := range service1.Operation {
+		for _, op2 := range service2.Operation {
+			if op1.Channel.Name != op2.Channel.Name || op1.Action == op2.Action {
+				continue
+			}
+
+			if !slices.Contains(channels, op1.Channel.Name) {
+				channels = append(channels, op1.Channel.Name)
+			}
+
+			switch {
+			case op1.Action == ActionSend && op2.Action == ActionReceive:
+				if op1.Reply != nil {
+					hasReq = true
+					continue
+				}
+
+				hasPub = true
+			case op1.Action == ActionReceive && op2.Action == ActionSend:
+				if op2.Reply != nil {
+					hasReq = true
+					continue
+				}
+
+				hasPub = true
+			}
+		}
+	}
+
+	sort.Strings(channels)
+
+	switch {
+	case hasPub && hasReq:
+		return EdgeLabelPubReq, channels
+	case hasReq:
+		return EdgeLabelReq, channels
+	default:
+		return EdgeLabelPub, channels
+	}
+}
+
+// CycleOpt configures cycle detection.
+type CycleOpt func(*cycleOptions)
+
+type cycleOptions struct {
+	twoNodeCycles bool
+}
+
+// WithTwoNodeCycles includes cycles of two services sending to each other, i.e. bidirectional edges,
+// which are left out by default as plain back-and-forth communication.
+func WithTwoNodeCycles(include bool) CycleOpt {
+	return func(o *cycleOptions) {
+		o.twoNodeCycles = include
+	}
+}
+
+// DetectCycles returns cycles of services sending messages to each other, e.g. A -> B -> C -> A.
+// Each cycle is listed once as services in the order messages flow, starting with the service with
+// the least name, the last service sends back to the first one. Cycles are sorted by their services.
+func DetectCycles(s Schema, opts ...CycleOpt) [][]string {
+	return BuildServiceGraph(s).Cycles(opts...)
+}
+
+// Cycles returns cycles of the graph, see DetectCycles.
+func (g Graph) Cycles(opts ...CycleOpt) [][]string {
+	var o cycleOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	adjacency := make(map[string][]string)
+	for _, edge := range g.Edges {
+		adjacency[edge.From] = append(adjacency[edge.From], edge.To)
+		if edge.Bidirectional {
+			adjacency[edge.To] = append(adjacency[edge.To], edge.From)
+		}
+	}
+
+	names := make([]string, 0, len(adjacency))
+	for name, next := range adjacency {
+		sort.Strings(next)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		cycles [][]string
+		path   []string
+		onPath = make(map[string]bool)
+		visit  func(start, name string)
+	)
+
+	// Each cycle is found once from its least service, only greater services are visited.
+	visit = func(start, name string) {
+		path = append(path, name)
+		onPath[name] = true
+
+		for _, next := range adjacency[name] {
+			switch {
+			case next == start:
+				if len(path) > 2 || o.twoNodeCycles {
+					cycles = append(cycles, slices.Clone(path))
+				}
+			case next > start && !onPath[next]:
+				visit(start, next)
+			}
+		}
+
+		path = path[:len(path)-1]
+		onPath[name] = false
+	}
+
+	for _, name := range names {
+		visit(name, name)
+	}
+
+	return cycles
+}
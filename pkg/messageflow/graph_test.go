@@ -0,0 +1,145 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildServiceGraph(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name:  "User Service",
+				Group: "Identity",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created"}},
+					{Action: ActionReceive, Channel: Channel{Name: "user.info"}, Reply: &Channel{Name: "user.info.reply"}},
+				},
+			},
+			{
+				Name: "Notification Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+					{Action: ActionSend, Channel: Channel{Name: "user.info"}, Reply: &Channel{Name: "user.info.reply"}},
+					{Action: ActionSend, Channel: Channel{Name: "notification.sent"}},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+					{Action: ActionReceive, Channel: Channel{Name: "notification.sent"}},
+				},
+			},
+		},
+	}
+
+	graph := BuildServiceGraph(schema)
+
+	assert.Equal(t, []GraphNode{
+		{Name: "User Service", Group: "Identity"},
+		{Name: "Notification Service"},
+		{Name: "Analytics Service"},
+	}, graph.Nodes)
+
+	assert.Equal(t, []GraphEdge{
+		{
+			From:     "Notification Service",
+			To:       "Analytics Service",
+			Label:    EdgeLabelPub,
+			Channels: []string{"notification.sent"},
+		},
+		{
+			From:          "Notification Service",
+			To:            "User Service",
+			Label:         EdgeLabelPubReq,
+			Bidirectional: true,
+			Channels:      []string{"user.created", "user.info"},
+		},
+		{
+			From:     "User Service",
+			To:       "Analytics Service",
+			Label:    EdgeLabelPub,
+			Channels: []string{"user.created"},
+		},
+	}, graph.Edges)
+
+	assert.Equal(t, []string{"Notification Service", "User Service"}, graph.Neighbors("Analytics Service"))
+	assert.Equal(t, []string{"Analytics Service", "User Service"}, graph.Neighbors("Notification Service"))
+	assert.Empty(t, graph.Neighbors("Unknown Service"))
+}
+
+func TestDetectCycles(t *testing.T) {
+	t.Parallel()
+
+	service := func(name string, sends []string, receives []string) Service {
+		service := Service{Name: name}
+		for _, channel := range sends {
+			service.Operation = append(service.Operation, Operation{Action: ActionSend, Channel: Channel{Name: channel}})
+		}
+		for _, channel := range receives {
+			service.Operation = append(service.Operation, Operation{Action: ActionReceive, Channel: Channel{Name: channel}})
+		}
+		return service
+	}
+
+	schema := Schema{
+		Services: []Service{
+			service("C", []string{"c.events"}, []string{"b.events"}),
+			service("A", []string{"a.events"}, []string{"c.events", "d.events"}),
+			service("B", []string{"b.events"}, []string{"a.events"}),
+			service("D", []string{"d.events"}, []string{"a.events"}),
+			service("E", nil, []string{"a.events"}),
+		},
+	}
+
+	assert.Equal(t, [][]string{{"A", "B", "C"}}, DetectCycles(schema))
+	assert.Equal(t, [][]string{{"A", "B", "C"}, {"A", "D"}}, DetectCycles(schema, WithTwoNodeCycles(true)))
+
+	assert.Empty(t, DetectCycles(Schema{Services: schema.Services[3:]}))
+}
+
+func TestSelfLoops(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "Worker Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "tasks"}},
+					{Action: ActionReceive, Channel: Channel{Name: "tasks"}},
+					{Action: ActionSend, Channel: Channel{Name: "task.done"}},
+				},
+			},
+			{
+				Name: "Cache Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "cache.get"}, Reply: &Channel{Name: "cache.get.reply"}},
+					{Action: ActionReceive, Channel: Channel{Name: "cache.get"}, Reply: &Channel{Name: "cache.get.reply"}},
+				},
+			},
+			{
+				Name: "Audit Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "task.done"}},
+					{Action: ActionReceive, Channel: Channel{Name: "tasks"}},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []GraphEdge{
+		{From: "Cache Service", To: "Cache Service", Label: EdgeLabelReq, Channels: []string{"cache.get"}},
+		{From: "Worker Service", To: "Worker Service", Label: EdgeLabelPub, Channels: []string{"tasks"}},
+	}, SelfLoops(schema))
+
+	for _, edge := range BuildServiceGraph(schema).Edges {
+		assert.NotEqual(t, edge.From, edge.To)
+	}
+
+	assert.Empty(t, SelfLoops(Schema{Services: schema.Services[2:]}))
+}
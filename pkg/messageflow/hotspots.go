@@ -0,0 +1,111 @@
+package messageflow
+
+import (
+	"sort"
+)
+
+// ServiceHotspot is the fan-in and fan-out of a service in the service graph.
+type ServiceHotspot struct {
+	Name string `json:"name"`
+	// FanIn is the number of services sending messages to the service.
+	FanIn int `json:"fanIn"`
+	// FanOut is the number of services receiving messages from the service.
+	FanOut int `json:"fanOut"`
+	// Degree is the sum of FanIn and FanOut.
+	Degree int `json:"degree"`
+	// Hotspot marks services whose degree reaches the threshold, see WithHotspotThreshold.
+	Hotspot bool `json:"hotspot,omitempty"`
+}
+
+// ChannelHotspot is the number of services operating on a channel.
+type ChannelHotspot struct {
+	Name string `json:"name"`
+	// Services is the number of services sending to, receiving from or replying over the channel.
+	Services int `json:"services"`
+	// Hotspot marks channels whose number of services reaches the threshold, see WithHotspotThreshold.
+	Hotspot bool `json:"hotspot,omitempty"`
+}
+
+// HotspotReport ranks services and channels by how many services they connect, see Hotspots.
+type HotspotReport struct {
+	Services []ServiceHotspot `json:"services"`
+	Channels []ChannelHotspot `json:"channels"`
+}
+
+// HotspotOpt configures hotspot detection.
+type HotspotOpt func(*hotspotOptions)
+
+type hotspotOptions struct {
+	threshold int
+}
+
+// WithHotspotThreshold marks services with a degree and channels with a number of services of at least
+// threshold as hotspots, i.e. potential bottlenecks. Zero, the default, marks none.
+func WithHotspotThreshold(threshold int) HotspotOpt {
+	return func(o *hotspotOptions) {
+		o.threshold = threshold
+	}
+}
+
+// Hotspots ranks services by their degree in the service graph, see BuildServiceGraph, and channels by
+// the number of services operating on them, both with the highest first and ties sorted by name.
+// Services sending to each other count in both the fan-in and the fan-out of either service.
+func Hotspots(s Schema, opts ...HotspotOpt) HotspotReport {
+	var o hotspotOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	fanIn := make(map[string]int)
+	fanOut := make(map[string]int)
+
+	for _, edge := range BuildServiceGraph(s).Edges {
+		fanOut[edge.From]++
+		fanIn[edge.To]++
+
+		if edge.Bidirectional {
+			fanOut[edge.To]++
+			fanIn[edge.From]++
+		}
+	}
+
+	report := HotspotReport{
+		Services: make([]ServiceHotspot, 0, len(s.Services)),
+		Channels: []ChannelHotspot{},
+	}
+
+	for _, name := range s.ServiceNames() {
+		hotspot := ServiceHotspot{
+			Name:   name,
+			FanIn:  fanIn[name],
+			FanOut: fanOut[name],
+			Degree: fanIn[name] + fanOut[name],
+		}
+		hotspot.Hotspot = o.threshold > 0 && hotspot.Degree >= o.threshold
+
+		report.Services = append(report.Services, hotspot)
+	}
+
+	for _, channel := range s.ChannelNames() {
+		services := make(map[string]bool)
+		for _, op := range s.OperationsForChannel(channel) {
+			services[op.Service] = true
+		}
+
+		report.Channels = append(report.Channels, ChannelHotspot{
+			Name:     channel,
+			Services: len(services),
+			Hotspot:  o.threshold > 0 && len(services) >= o.threshold,
+		})
+	}
+
+	sort.SliceStable(report.Services, func(i, j int) bool {
+		return report.Services[i].Degree > report.Services[j].Degree
+	})
+
+	sort.SliceStable(report.Channels, func(i, j int) bool {
+		return report.Channels[i].Services > report.Channels[j].Services
+	})
+
+	return report
+}
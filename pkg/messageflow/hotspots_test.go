@@ -0,0 +1,61 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotspots(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created"}},
+					{Action: ActionReceive, Channel: Channel{Name: "user.info"}, Reply: &Channel{Name: "user.info.reply"}},
+				},
+			},
+			{
+				Name: "Notification Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+					{Action: ActionSend, Channel: Channel{Name: "user.info"}, Reply: &Channel{Name: "user.info.reply"}},
+					{Action: ActionSend, Channel: Channel{Name: "notification.sent"}},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created"}},
+					{Action: ActionReceive, Channel: Channel{Name: "notification.sent"}},
+				},
+			},
+			{
+				Name: "Audit Service",
+			},
+		},
+	}
+
+	report := Hotspots(schema, WithHotspotThreshold(3))
+
+	assert.Equal(t, []ServiceHotspot{
+		{Name: "Notification Service", FanIn: 1, FanOut: 2, Degree: 3, Hotspot: true},
+		{Name: "User Service", FanIn: 1, FanOut: 2, Degree: 3, Hotspot: true},
+		{Name: "Analytics Service", FanIn: 2, Degree: 2},
+		{Name: "Audit Service"},
+	}, report.Services)
+
+	assert.Equal(t, []ChannelHotspot{
+		{Name: "user.created", Services: 3, Hotspot: true},
+		{Name: "notification.sent", Services: 2},
+		{Name: "user.info", Services: 2},
+		{Name: "user.info.reply", Services: 2},
+	}, report.Channels)
+
+	for _, service := range Hotspots(schema).Services {
+		assert.False(t, service.Hotspot, service.Name)
+	}
+}
@@ -0,0 +1,195 @@
+package messageflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// WithIgnorePatterns leaves changes matching any of the patterns out of the changelog, e.g. of a churny
+// internal field. Patterns are service:channel:field globs, see Schema.ExcludeChannels for the glob syntax,
+// trailing segments may be left out to match anything:
+//
+//   - Service patterns, e.g. Legacy*, leave out all changes of matching services, additions and removals included.
+//   - Service and channel patterns, e.g. *:*.internal, leave out changes of operations on matching channels.
+//   - Field patterns, e.g. *:*:metadata.*, match dot-delimited paths of payload and header fields, fields of
+//     array items follow the array name suffixed by [], e.g. items[].id. Matching fields are removed from
+//     messages of matching operations before comparing them, so messages differing only in them are unchanged.
+//
+// Channels are matched by the channel of the operation, so patterns can't match channel names with colons.
+func WithIgnorePatterns(patterns ...string) CompareOpt {
+	return func(o *compareOptions) {
+		for _, pattern := range patterns {
+			o.ignore = append(o.ignore, parseIgnorePattern(pattern))
+		}
+	}
+}
+
+// ignorePattern is a pattern of WithIgnorePatterns, segments left out are nil.
+type ignorePattern struct {
+	service, channel, field *regexp.Regexp
+}
+
+func parseIgnorePattern(pattern string) ignorePattern {
+	var p ignorePattern
+
+	segments := strings.SplitN(pattern, ":", 3)
+	for i, target := range []**regexp.Regexp{&p.service, &p.channel, &p.field} {
+		if i < len(segments) {
+			*target = channelPatternRegexp(strings.TrimSpace(segments[i]))
+		}
+	}
+
+	return p
+}
+
+// matches reports whether the pattern matches operations of the service on the channel,
+// or the service itself when channel is empty.
+func (p ignorePattern) matches(service, channel string) bool {
+	if !p.service.MatchString(service) {
+		return false
+	}
+
+	if p.channel == nil {
+		return true
+	}
+
+	return channel != "" && p.channel.MatchString(channel)
+}
+
+// ignoreChanges applies the patterns to both schemas before they are compared, see WithIgnorePatterns.
+// Services matched entirely are dropped from both, so neither their additions nor removals are reported.
+func ignoreChanges(oldSchema, newSchema Schema, patterns []ignorePattern) (Schema, Schema) {
+	if len(patterns) == 0 {
+		return oldSchema, newSchema
+	}
+
+	return applyIgnorePatterns(oldSchema, patterns), applyIgnorePatterns(newSchema, patterns)
+}
+
+func applyIgnorePatterns(s Schema, patterns []ignorePattern) Schema {
+	services := make([]Service, 0, len(s.Services))
+
+	for _, service := range s.Services {
+		if slices.ContainsFunc(patterns, func(p ignorePattern) bool {
+			return p.channel == nil && p.matches(service.Name, "")
+		}) {
+			continue
+		}
+
+		operations := make([]Operation, 0, len(service.Operation))
+
+		for _, op := range service.Operation {
+			var fields []*regexp.Regexp
+			ignored := false
+
+			for _, p := range patterns {
+				if !p.matches(service.Name, op.Channel.Name) {
+					continue
+				}
+
+				if p.field == nil {
+					ignored = true
+					break
+				}
+
+				fields = append(fields, p.field)
+			}
+
+			if ignored {
+				continue
+			}
+
+			if len(fields) > 0 {
+				op.Channel.Messages = withoutFields(op.Channel.Messages, fields)
+				if op.Reply != nil {
+					reply := *op.Reply
+					reply.Messages = withoutFields(reply.Messages, fields)
+					op.Reply = &reply
+				}
+			}
+
+			operations = append(operations, op)
+		}
+
+		service.Operation = operations
+		services = append(services, service)
+	}
+
+	return Schema{Services: services}
+}
+
+// withoutFields returns copies of the messages with payload and header fields matching any of the globs removed.
+func withoutFields(messages []Message, fields []*regexp.Regexp) []Message {
+	result := make([]Message, len(messages))
+
+	for i, msg := range messages {
+		msg.Payload = removeFields(msg.Payload, fields)
+		msg.Headers = removeFields(msg.Headers, fields)
+		result[i] = msg
+	}
+
+	return result
+}
+
+// removeFields removes fields matching any of the globs from the JSON document, documents which aren't
+// valid JSON, e.g. raw payloads of other schema formats, are returned as they are.
+func removeFields(document string, fields []*regexp.Regexp) string {
+	var value any
+	if document == "" || json.Unmarshal([]byte(document), &value) != nil {
+		return document
+	}
+
+	if !removeFieldsAt(value, "", fields) {
+		return document
+	}
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(value); err != nil {
+		return document
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// removeFieldsAt removes fields of the value at path matching any of the globs, reporting whether any were.
+func removeFieldsAt(value any, path string, fields []*regexp.Regexp) bool {
+	removed := false
+
+	switch v := value.(type) {
+	case map[string]any:
+		for name, nested := range v {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			if slices.ContainsFunc(fields, func(field *regexp.Regexp) bool {
+				return field.MatchString(fieldPath)
+			}) {
+				delete(v, name)
+				removed = true
+
+				continue
+			}
+
+			if removeFieldsAt(nested, fieldPath, fields) {
+				removed = true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if removeFieldsAt(item, path+"[]", fields) {
+				removed = true
+			}
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,100 @@
+package messageflow
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareSchemasIgnorePatterns(t *testing.T) {
+	t.Parallel()
+
+	service := func(name, payload, internalPayload string) Service {
+		return Service{Name: name, Operation: []Operation{
+			{
+				Action: ActionSend,
+				Channel: Channel{Name: "order.created", Messages: []Message{
+					{Name: "OrderCreated", Payload: payload, Headers: `{"trace_id": "string"}`},
+				}},
+			},
+			{
+				Action:  ActionSend,
+				Channel: Channel{Name: "order.internal", Messages: []Message{{Name: "Tick", Payload: internalPayload}}},
+			},
+		}}
+	}
+
+	oldSchema := Schema{Services: []Service{
+		service("Order Service", `{"id": "string", "metadata": {"build": "string"}, "items": [{"sku": "string"}]}`, `{}`),
+		{Name: "Legacy Service"},
+	}}
+
+	newSchema := Schema{Services: []Service{
+		service("Order Service", `{"id": "string", "metadata": {"build": "integer"}, "items": [{"sku": "integer"}]}`, `{"n": 1}`),
+		{Name: "Audit Service"},
+	}}
+
+	names := func(changelog Changelog) []string {
+		var names []string
+		for _, change := range changelog.Changes {
+			names = append(names, string(change.Category)+" "+change.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{
+		"service Audit Service",
+		"service Legacy Service",
+		"message Order Service:send-order.created-OrderCreated",
+		"message Order Service:send-order.internal-Tick",
+	}, names(CompareSchemas(oldSchema, newSchema)))
+
+	changelog := CompareSchemas(oldSchema, newSchema, WithIgnorePatterns(
+		"Legacy*",
+		"*:*.internal",
+		"Order Service:order.*:metadata.*",
+	))
+	assert.ElementsMatch(t, []string{
+		"service Audit Service",
+		"message Order Service:send-order.created-OrderCreated",
+	}, names(changelog))
+
+	for _, change := range changelog.Changes {
+		if change.Category == ChangeCategoryMessage {
+			assert.NotContains(t, change.Diff, "build")
+			assert.Contains(t, change.Diff, "sku")
+		}
+	}
+
+	changelog = CompareSchemas(oldSchema, newSchema, WithIgnorePatterns(
+		"Legacy*", "Audit Service", "*:*.internal", "*:*:metadata", "*:order.created:items[].sku",
+	))
+	require.Empty(t, changelog.Changes)
+
+	// Patterns of other services and channels leave changes in.
+	changelog = CompareSchemas(oldSchema, newSchema, WithIgnorePatterns("Billing*:*", "*:payment.*:items[].sku"))
+	assert.Len(t, changelog.Changes, 4)
+}
+
+func TestRemoveFields(t *testing.T) {
+	t.Parallel()
+
+	fields := []string{"metadata", "items[].internal_*", "<x>"}
+
+	ignore := make([]ignorePattern, 0, len(fields))
+	for _, field := range fields {
+		ignore = append(ignore, parseIgnorePattern("*:*:"+field))
+	}
+
+	messages := withoutFields([]Message{
+		{Payload: `{"id": "<b>", "metadata": {"a": "b"}, "items": [{"internal_rank": 1, "sku": "string"}], "<x>": 1}`},
+		{Payload: `id: string`, Headers: `{"trace": "string"}`},
+	}, []*regexp.Regexp{ignore[0].field, ignore[1].field, ignore[2].field})
+
+	assert.JSONEq(t, `{"id": "<b>", "items": [{"sku": "string"}]}`, messages[0].Payload)
+	assert.Contains(t, messages[0].Payload, "<b>")
+	assert.Equal(t, `id: string`, messages[1].Payload)
+	assert.Equal(t, `{"trace": "string"}`, messages[1].Headers)
+}
@@ -5,11 +5,18 @@ package messageflow
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 // TargetType represents the type of target format for schema conversion.
@@ -23,6 +30,12 @@ const (
 	FormatModeServiceChannels = FormatMode("service_channels")
 	FormatModeChannelServices = FormatMode("channel_services")
 	FormatModeServiceServices = FormatMode("service_services")
+	// FormatModeServiceOverview combines FormatModeServiceChannels and FormatModeServiceServices
+	// of a service into one diagram.
+	FormatModeServiceOverview = FormatMode("service_overview")
+	// FormatModeSequence shows how messages flow from send operations of the service on the channel
+	// as a sequence diagram, see TraceSequence.
+	FormatModeSequence = FormatMode("sequence")
 )
 
 type FormatOptions struct {
@@ -30,6 +43,39 @@ type FormatOptions struct {
 	Service      string
 	Channel      string
 	OmitPayloads bool
+	// PreserveOrder keeps operations in the order of the schema instead of sorting them.
+	PreserveOrder bool
+	// Depth is the number of hops from the service included in FormatModeServiceServices and FormatModeServiceOverview,
+	// values below 2 include only immediate neighbors.
+	Depth int
+	// ExcludeDeprecated leaves deprecated operations out, showing only the current state.
+	ExcludeDeprecated bool
+	// ChannelPrefixDepth lists channels on connections of FormatModeContextServices grouped by
+	// the given number of dot-delimited name segments, e.g. notification.* for 1.
+	// Zero leaves channels out.
+	ChannelPrefixDepth int
+	// HighlightCycles highlights connections of FormatModeContextServices forming cycles of services,
+	// see DetectCycles.
+	HighlightCycles bool
+	// HighlightField highlights channels of FormatModeContextServices and FormatModeChannelServices
+	// carrying messages with the payload field at the given dot-delimited path, e.g. user.id.
+	HighlightField string
+	// Baseline highlights services and connections of FormatModeContextServices added, removed or changed
+	// since the baseline schema, e.g. the one of the previous documentation run. Removed ones are shown faded.
+	Baseline *Schema
+	// EdgeMetadata shows values of the Operation.Metadata key, e.g. x-throughput, under labels of
+	// FormatModeContextServices connections, taken from operations over the channels of the connections.
+	EdgeMetadata string
+	// ExcludeChannelPatterns leaves out operations on channels matching any of the patterns,
+	// e.g. *.dlq for dead letter queues, so services linked only over them aren't connected.
+	// See Schema.ExcludeChannels for the pattern syntax.
+	ExcludeChannelPatterns []string
+	// ServiceLinks maps service names to URLs service nodes of FormatModeContextServices link to,
+	// e.g. README sections of the services, making rendered SVGs navigable. Unmapped services aren't linked.
+	ServiceLinks map[string]string
+	// SelfLoops shows services of FormatModeContextServices sending to channels they also receive from
+	// as connections of the service to itself, see SelfLoops. Such services aren't connected by default.
+	SelfLoops bool
 }
 
 // Schema defines the structure of a message flow schema containing services and their operations.
@@ -39,6 +85,12 @@ type Schema struct {
 
 // Sort sorts the services and their operations in a consistent order.
 func (s *Schema) Sort() {
+	s.SortOperations()
+	s.SortServices()
+}
+
+// SortOperations sorts the operations of each service keeping the order of services.
+func (s *Schema) SortOperations() {
 	for i := range s.Services {
 		sort.Slice(s.Services[i].Operation, func(j, k int) bool {
 			op1 := s.Services[i].Operation[j]
@@ -59,17 +111,202 @@ func (s *Schema) Sort() {
 			return len(op1.Channel.Messages) > len(op2.Channel.Messages)
 		})
 	}
+}
 
+// SortServices sorts the services by name keeping the order of their operations.
+func (s *Schema) SortServices() {
 	sort.Slice(s.Services, func(i, j int) bool {
 		return s.Services[i].Name < s.Services[j].Name
 	})
 }
 
+// ServiceNames returns unique names of the services sorted alphabetically.
+func (s Schema) ServiceNames() []string {
+	names := make([]string, 0, len(s.Services))
+	for _, service := range s.Services {
+		if !slices.Contains(names, service.Name) {
+			names = append(names, service.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ChannelNames returns unique names of the channels operated on, including reply channels,
+// sorted alphabetically.
+func (s Schema) ChannelNames() []string {
+	seen := make(map[string]bool)
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			seen[op.Channel.Name] = true
+			if op.Reply != nil {
+				seen[op.Reply.Name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ExcludeChannels returns a copy of the schema without operations on channels matching any of the patterns,
+// replies over matching channels are dropped from the remaining operations. Services are kept even when
+// left without operations.
+//
+// Patterns are globs matching whole channel names, where * matches any characters including dots and
+// slashes and ? matches a single character, e.g. *.dlq matches orders.payment.dlq. Globs are used instead
+// of regular expressions since channel names are full of dots, which would need escaping.
+func (s Schema) ExcludeChannels(patterns ...string) Schema {
+	matchers := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		matchers = append(matchers, channelPatternRegexp(pattern))
+	}
+
+	excluded := func(name string) bool {
+		return slices.ContainsFunc(matchers, func(matcher *regexp.Regexp) bool {
+			return matcher.MatchString(name)
+		})
+	}
+
+	services := make([]Service, len(s.Services))
+	for i, service := range s.Services {
+		operations := make([]Operation, 0, len(service.Operation))
+		for _, op := range service.Operation {
+			if excluded(op.Channel.Name) {
+				continue
+			}
+
+			if op.Reply != nil && excluded(op.Reply.Name) {
+				op.Reply = nil
+			}
+
+			operations = append(operations, op)
+		}
+
+		service.Operation = operations
+		services[i] = service
+	}
+
+	return Schema{Services: services}
+}
+
+// channelPatternRegexp translates a glob of Schema.ExcludeChannels into an anchored regular expression.
+func channelPatternRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+
+	expr.WriteString("^")
+
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String())
+}
+
+// MatchService returns the name of the service matching the query, see matchName.
+func (s Schema) MatchService(query string) (string, error) {
+	return matchName("service", query, s.ServiceNames())
+}
+
+// MatchChannel returns the name of the channel matching the query, see matchName.
+func (s Schema) MatchChannel(query string) (string, error) {
+	return matchName("channel", query, s.ChannelNames())
+}
+
+// matchName returns the name equal to the query, otherwise the only name containing the query
+// case-insensitively. The error lists candidates when several names match and all names when none do.
+func matchName(kind, query string, names []string) (string, error) {
+	if slices.Contains(names, query) {
+		return query, nil
+	}
+
+	lowerQuery := strings.ToLower(query)
+
+	var candidates []string
+	for _, name := range names {
+		if strings.ToLower(name) == lowerQuery {
+			return name, nil
+		}
+
+		if strings.Contains(strings.ToLower(name), lowerQuery) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no %s matches '%s', available: %s", kind, query, strings.Join(names, ", "))
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%s '%s' is ambiguous, candidates: %s", kind, query, strings.Join(candidates, ", "))
+	}
+}
+
+// ChannelOperation is an operation of a service on a channel.
+// Reply is true when the channel is the reply channel of the operation.
+type ChannelOperation struct {
+	Service   string
+	Operation Operation
+	Reply     bool
+}
+
+// OperationsForChannel returns operations of all services on the channel in the order of the schema.
+func (s Schema) OperationsForChannel(name string) []ChannelOperation {
+	var ops []ChannelOperation
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			switch {
+			case op.Channel.Name == name:
+				ops = append(ops, ChannelOperation{Service: service.Name, Operation: op})
+			case op.Reply != nil && op.Reply.Name == name:
+				ops = append(ops, ChannelOperation{Service: service.Name, Operation: op, Reply: true})
+			}
+		}
+	}
+
+	return ops
+}
+
 // Service represents a service in the message flow with its name and operations.
+// Services can optionally belong to a group (e.g. a bounded context).
 type Service struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description,omitempty"`
-	Operation   []Operation `json:"operations"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Group       string `json:"group,omitempty"`
+	// Servers lists names of the servers the specification of the service declares, e.g. production and staging,
+	// the servers of channels without servers of their own.
+	Servers   []string    `json:"servers,omitempty"`
+	Operation []Operation `json:"operations"`
+}
+
+// ChannelServers returns names of the servers the channel of the service is available on,
+// the servers of the service unless the channel lists its own.
+func (s Service) ChannelServers(channel Channel) []string {
+	if len(channel.Servers) > 0 {
+		return channel.Servers
+	}
+
+	return s.Servers
 }
 
 // Action represents the type of operation that can be performed on a channel.
@@ -80,23 +317,92 @@ const (
 	ActionReceive Action = "receive"
 )
 
-// Message represents a message with a name and payload.
+// Message represents a message with a name, payload and optional examples.
+// ContentType is the media type of the message. SchemaFormat is set for payloads not described
+// by a JSON schema, e.g. Avro, Payload then holds the raw schema to be shown verbatim.
+// CorrelationID is the location of the correlation identifier, e.g. $message.header#/correlationId.
+// DeprecationNote tells consumers how to migrate off a changing message, e.g. "field X removed, use Y".
+// Headers holds the message headers flattened into field types, the same way as flattened payloads.
 type Message struct {
-	Name    string `json:"name"`
-	Payload string `json:"payload"`
+	Name            string   `json:"name"`
+	Payload         string   `json:"payload"`
+	Headers         string   `json:"headers,omitempty"`
+	Examples        []string `json:"examples,omitempty"`
+	ContentType     string   `json:"contentType,omitempty"`
+	SchemaFormat    string   `json:"schemaFormat,omitempty"`
+	CorrelationID   string   `json:"correlationId,omitempty"`
+	DeprecationNote string   `json:"deprecationNote,omitempty"`
+	// SchemaRef is the name of the schema component the payload references, e.g. UserProfile,
+	// telling messages sharing a payload type apart from ones with equal inline payloads.
+	SchemaRef string `json:"schemaRef,omitempty"`
 }
 
-// Channel represents a communication channel with a name and messages.
+// Channel represents a communication channel with a name, messages and optional tags.
 type Channel struct {
 	Name     string    `json:"name"`
 	Messages []Message `json:"messages"`
+	Tags     []string  `json:"tags,omitempty"`
+	// Protocol is the transport of the channel (e.g. kafka, amqp), multiple protocols are separated by comma.
+	Protocol string `json:"protocol,omitempty"`
+	// Servers lists names of the servers the channel is available on, e.g. production and staging,
+	// empty when it's available on all servers of the service. See Service.ChannelServers.
+	Servers []string `json:"servers,omitempty"`
 }
 
 // Operation defines an action to be performed on a channel, optionally with a reply channel.
+// ID is the operation identifier from the source specification, if any.
 type Operation struct {
+	ID      string   `json:"id,omitempty"`
 	Action  Action   `json:"action"`
 	Channel Channel  `json:"channel"`
 	Reply   *Channel `json:"reply,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Deprecated marks operations which should no longer be used, see also IsDeprecated.
+	Deprecated bool `json:"deprecated,omitempty"`
+	// Summary and Description explain the intent of the operation.
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Metadata holds scalar specification extensions of the operation by name, e.g. x-throughput or x-sla.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Security lists security schemes the operation requires, empty for unsecured operations.
+	Security []SecurityRequirement `json:"security,omitempty"`
+}
+
+// SecurityRequirement is a security scheme an operation requires, e.g. an API key or OAuth2 with scopes.
+type SecurityRequirement struct {
+	// Scheme is the name of the security scheme, or its type for schemes without a name.
+	Scheme string `json:"scheme"`
+	// Type is the type of the scheme, e.g. httpApiKey, oauth2 or userPassword.
+	Type string `json:"type,omitempty"`
+	// Scopes lists scopes required by the operation, if the scheme has any.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// String describes the requirement, e.g. "orderAuth (oauth2): orders:write, orders:read".
+func (r SecurityRequirement) String() string {
+	text := r.Scheme
+	if r.Type != "" && r.Type != r.Scheme {
+		text += " (" + r.Type + ")"
+	}
+
+	if len(r.Scopes) > 0 {
+		text += ": " + strings.Join(r.Scopes, ", ")
+	}
+
+	return text
+}
+
+// TagDeprecated marks operations and channels which should no longer be used.
+const TagDeprecated = "deprecated"
+
+// IsDeprecated reports whether the operation is marked deprecated, either by the Deprecated field or TagDeprecated.
+func (o Operation) IsDeprecated() bool {
+	return o.Deprecated || HasTag(o.Tags, TagDeprecated)
+}
+
+// HasTag reports whether tags contain the given tag.
+func HasTag(tags []string, tag string) bool {
+	return slices.Contains(tags, tag)
 }
 
 // FormattedSchema represents a schema that has been formatted for a specific target type.
@@ -120,14 +426,58 @@ const (
 	ChangeTypeChanged ChangeType = "changed"
 )
 
+// ChangeCategory represents the part of the schema a change applies to.
+type ChangeCategory string
+
+const (
+	// ChangeCategoryService is a service added or removed.
+	ChangeCategoryService ChangeCategory = "service"
+	// ChangeCategoryChannel is an operation added, removed or moved to another channel or action,
+	// or a channel protocol changed.
+	ChangeCategoryChannel ChangeCategory = "channel"
+	// ChangeCategoryReply is a reply added to or removed from an operation.
+	ChangeCategoryReply ChangeCategory = "reply"
+	// ChangeCategoryMessage is a change of messages of an operation or its reply.
+	ChangeCategoryMessage ChangeCategory = "message"
+	// ChangeCategoryDeprecation is an operation deprecated.
+	ChangeCategoryDeprecation ChangeCategory = "deprecation"
+	// ChangeCategorySummary is a change of an operation summary.
+	ChangeCategorySummary ChangeCategory = "summary"
+	// ChangeCategoryTags is a change of operation or channel tags.
+	ChangeCategoryTags ChangeCategory = "tags"
+)
+
 // Change represents a single change in the schema.
 type Change struct {
-	Type      ChangeType `json:"type"`
-	Category  string     `json:"category"`
-	Name      string     `json:"name"`
-	Details   string     `json:"details,omitempty"`
-	Diff      string     `json:"diff,omitempty"`
-	Timestamp time.Time  `json:"timestamp"`
+	Type      ChangeType     `json:"type"`
+	Category  ChangeCategory `json:"category"`
+	Name      string         `json:"name"`
+	Details   string         `json:"details,omitempty"`
+	Diff      string         `json:"diff,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+	// DiffFormat is the format of Diff, changes persisted without it are diffed with DiffFormatCmp.
+	DiffFormat DiffFormat `json:"diffFormat,omitempty"`
+	// Note is the deprecation note of the changed messages, see Message.DeprecationNote.
+	Note string `json:"note,omitempty"`
+}
+
+// ChangeSeverity represents how a change affects existing producers and consumers.
+type ChangeSeverity string
+
+const (
+	ChangeSeverityBreaking    ChangeSeverity = "breaking"
+	ChangeSeverityNonBreaking ChangeSeverity = "non-breaking"
+)
+
+// Severity classifies the change. Removals and message changes are breaking,
+// additions, tag and summary changes and deprecations are not.
+func (c Change) Severity() ChangeSeverity {
+	if c.Type == ChangeTypeAdded || c.Category == ChangeCategoryTags || c.Category == ChangeCategoryDeprecation ||
+		c.Category == ChangeCategorySummary {
+		return ChangeSeverityNonBreaking
+	}
+
+	return ChangeSeverityBreaking
 }
 
 // Changelog represents a collection of changes with a version and date.
@@ -136,6 +486,32 @@ type Changelog struct {
 	Changes []Change  `json:"changes"`
 }
 
+// BreakingChanges returns changes of the changelog classified as breaking.
+func (c Changelog) BreakingChanges() []Change {
+	breaking := []Change{}
+
+	for _, change := range c.Changes {
+		if change.Severity() == ChangeSeverityBreaking {
+			breaking = append(breaking, change)
+		}
+	}
+
+	return breaking
+}
+
+// FilterByCategory returns a copy of the changelog with only changes of the given categories.
+func (c Changelog) FilterByCategory(categories ...ChangeCategory) Changelog {
+	filtered := Changelog{Date: c.Date, Changes: []Change{}}
+
+	for _, change := range c.Changes {
+		if slices.Contains(categories, change.Category) {
+			filtered.Changes = append(filtered.Changes, change)
+		}
+	}
+
+	return filtered
+}
+
 // Source interface defines the contract for schema extraction.
 type Source interface {
 	SchemaExtractor
@@ -164,6 +540,7 @@ type SchemaRenderer interface {
 }
 
 // MergeSchemas combines multiple Schema objects into a single Schema.
+// The merged services and their operations are sorted, so the same inputs always give the same output.
 func MergeSchemas(schemas ...Schema) Schema {
 	if len(schemas) == 0 {
 		return Schema{Services: []Service{}}
@@ -186,12 +563,16 @@ func MergeSchemas(schemas ...Schema) Schema {
 					opMap[key] = op
 				}
 
+				// Collected in key order, so the sort below gets the same input on every run.
+				keys := slices.Sorted(maps.Keys(opMap))
+
 				mergedOps := make([]Operation, 0, len(opMap))
-				for _, op := range opMap {
-					mergedOps = append(mergedOps, op)
+				for _, key := range keys {
+					mergedOps = append(mergedOps, opMap[key])
 				}
 
 				existingService.Operation = mergedOps
+				existingService.Servers = mergeServers(existingService.Servers, service.Servers)
 				serviceMap[service.Name] = existingService
 			} else {
 				serviceMap[service.Name] = service
@@ -204,11 +585,308 @@ func MergeSchemas(schemas ...Schema) Schema {
 		mergedServices = append(mergedServices, service)
 	}
 
+	merged := Schema{Services: mergedServices}
+	merged.Sort()
+
+	return merged
+}
+
+// MergeSchemasInOrder combines multiple Schema objects like MergeSchemas, but keeps services and their
+// operations in the order they are first defined across the schemas instead of sorting them, e.g. to keep
+// the authoring order of specifications. Operations defined again replace the earlier definition in place.
+func MergeSchemasInOrder(schemas ...Schema) Schema {
+	var (
+		serviceNames = []string{}
+		serviceMap   = make(map[string]*Service)
+		opIndexes    = make(map[string]map[string]int)
+	)
+
+	for _, schema := range schemas {
+		for _, service := range schema.Services {
+			existingService, exists := serviceMap[service.Name]
+			if !exists {
+				service.Operation = slices.Clone(service.Operation)
+				serviceMap[service.Name] = &service
+				serviceNames = append(serviceNames, service.Name)
+
+				opIndexes[service.Name] = make(map[string]int)
+				for i, op := range service.Operation {
+					if _, ok := opIndexes[service.Name][operationKey(op)]; !ok {
+						opIndexes[service.Name][operationKey(op)] = i
+					}
+				}
+
+				continue
+			}
+
+			existingService.Servers = mergeServers(existingService.Servers, service.Servers)
+
+			for _, op := range service.Operation {
+				key := operationKey(op)
+
+				if idx, exists := opIndexes[service.Name][key]; exists {
+					existingService.Operation[idx] = op
+					continue
+				}
+
+				opIndexes[service.Name][key] = len(existingService.Operation)
+				existingService.Operation = append(existingService.Operation, op)
+			}
+		}
+	}
+
+	mergedServices := make([]Service, 0, len(serviceNames))
+	for _, name := range serviceNames {
+		mergedServices = append(mergedServices, *serviceMap[name])
+	}
+
 	return Schema{Services: mergedServices}
 }
 
+// mergeServers returns the servers of both services sorted alphabetically, nil when neither declares any.
+func mergeServers(servers, other []string) []string {
+	if len(other) == 0 {
+		return servers
+	}
+
+	merged := append(slices.Clone(servers), other...)
+	slices.Sort(merged)
+
+	return slices.Compact(merged)
+}
+
+// MergeConflict represents the same operation of a service defined differently across merged schemas,
+// or a message defined differently by services sharing a channel, see ChannelPayloadConflicts.
+type MergeConflict struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation,omitempty"`
+	Channel   string `json:"channel,omitempty"`
+	Details   string `json:"details"`
+}
+
+// MergeSchemasStrict combines multiple Schema objects into a single Schema like MergeSchemas,
+// but instead of silently keeping the last definition it reports operations of the same service
+// that differ in channels, actions, payloads or replies across inputs. The first definition is kept in the merged schema.
+func MergeSchemasStrict(schemas ...Schema) (Schema, []MergeConflict, error) {
+	for i, schema := range schemas {
+		for _, service := range schema.Services {
+			if service.Name == "" {
+				return Schema{}, nil, fmt.Errorf("service without name in schema %d", i)
+			}
+		}
+	}
+
+	merged, conflicts := mergeFirst(schemas)
+
+	return merged, conflicts, nil
+}
+
+// MergeConflicts reports operations of the same service that differ in channels, actions, payloads or replies
+// across the schemas, which MergeSchemas silently resolves by keeping the last definition.
+func MergeConflicts(schemas ...Schema) []MergeConflict {
+	_, conflicts := mergeFirst(schemas)
+
+	return conflicts
+}
+
+// mergeFirst merges the schemas keeping the first definition of each operation and services in the order
+// they are first defined, and reports later definitions differing from the first one.
+func mergeFirst(schemas []Schema) (Schema, []MergeConflict) {
+	var (
+		conflicts    = []MergeConflict{}
+		serviceNames = []string{}
+		serviceMap   = make(map[string]*Service)
+		opIndexes    = make(map[string]map[string]int)
+	)
+
+	for _, schema := range schemas {
+		for _, service := range schema.Services {
+			existingService, exists := serviceMap[service.Name]
+			if !exists {
+				existingService = &Service{
+					Name:        service.Name,
+					Description: service.Description,
+					Group:       service.Group,
+					Operation:   []Operation{},
+				}
+				serviceMap[service.Name] = existingService
+				serviceNames = append(serviceNames, service.Name)
+				opIndexes[service.Name] = make(map[string]int)
+			}
+
+			existingService.Servers = mergeServers(existingService.Servers, service.Servers)
+
+			for _, op := range service.Operation {
+				key := operationKey(op)
+
+				idx, exists := opIndexes[service.Name][key]
+				if !exists {
+					opIndexes[service.Name][key] = len(existingService.Operation)
+					existingService.Operation = append(existingService.Operation, op)
+					continue
+				}
+
+				conflicts = append(conflicts, operationConflicts(service.Name, key, existingService.Operation[idx], op)...)
+			}
+		}
+	}
+
+	mergedServices := make([]Service, 0, len(serviceNames))
+	for _, name := range serviceNames {
+		mergedServices = append(mergedServices, *serviceMap[name])
+	}
+
+	return Schema{Services: mergedServices}, conflicts
+}
+
+// operationConflicts reports differences of a later definition of the operation from the existing one.
+func operationConflicts(service, key string, existingOp, op Operation) []MergeConflict {
+	var conflicts []MergeConflict
+
+	// Operations matched by ID may be defined on another channel or with another action.
+	if existingOp.Action != op.Action || existingOp.Channel.Name != op.Channel.Name {
+		conflicts = append(conflicts, MergeConflict{
+			Service:   service,
+			Operation: key,
+			Details: fmt.Sprintf(
+				"operation '%s' in service '%s' is defined as '%s' on channel '%s' and as '%s' on channel '%s' across schemas",
+				key, service, existingOp.Action, existingOp.Channel.Name, op.Action, op.Channel.Name,
+			),
+		})
+	}
+
+	if !cmp.Equal(existingOp.Channel.Messages, op.Channel.Messages) {
+		conflicts = append(conflicts, MergeConflict{
+			Service:   service,
+			Operation: key,
+			Details: fmt.Sprintf(
+				"messages of operation '%s' on channel '%s' in service '%s' differ across schemas:\n%s",
+				op.Action, op.Channel.Name, service,
+				cmp.Diff(existingOp.Channel.Messages, op.Channel.Messages),
+			),
+		})
+	}
+
+	if !cmp.Equal(existingOp.Reply, op.Reply) {
+		conflicts = append(conflicts, MergeConflict{
+			Service:   service,
+			Operation: key,
+			Details: fmt.Sprintf(
+				"reply of operation '%s' on channel '%s' in service '%s' differs across schemas:\n%s",
+				op.Action, op.Channel.Name, service,
+				cmp.Diff(existingOp.Reply, op.Reply),
+			),
+		})
+	}
+
+	return conflicts
+}
+
+// ChannelPayloadConflicts reports messages of the same name carrying different payloads on the same
+// channel in different services, e.g. a consumer describing a stale version of the producer's message.
+// Each service is compared against the first service defining the message, messages without payload
+// are skipped. Conflicts are ordered by channel and then by services in the schema.
+func ChannelPayloadConflicts(s Schema) []MergeConflict {
+	type definition struct {
+		service string
+		payload string
+	}
+
+	var (
+		conflicts   = []MergeConflict{}
+		definitions = make(map[string]map[string]definition)
+		reported    = make(map[string]bool)
+	)
+
+	add := func(service string, channel Channel) {
+		if definitions[channel.Name] == nil {
+			definitions[channel.Name] = make(map[string]definition)
+		}
+
+		for _, msg := range channel.Messages {
+			if msg.Payload == "" {
+				continue
+			}
+
+			first, ok := definitions[channel.Name][msg.Name]
+			if !ok {
+				definitions[channel.Name][msg.Name] = definition{service: service, payload: msg.Payload}
+				continue
+			}
+
+			key := fmt.Sprintf("%s:%s:%s", channel.Name, msg.Name, service)
+			if first.service == service || first.payload == msg.Payload || reported[key] {
+				continue
+			}
+			reported[key] = true
+
+			conflicts = append(conflicts, MergeConflict{
+				Service: service,
+				Channel: channel.Name,
+				Details: fmt.Sprintf(
+					"message '%s' on channel '%s' differs between services '%s' and '%s':\n%s",
+					msg.Name, channel.Name, first.service, service, cmp.Diff(first.payload, msg.Payload),
+				),
+			})
+		}
+	}
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			add(service.Name, op.Channel)
+			if op.Reply != nil {
+				add(service.Name, *op.Reply)
+			}
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		return conflicts[i].Channel < conflicts[j].Channel
+	})
+
+	return conflicts
+}
+
+// ignoreSchemaRef leaves Message.SchemaRef out of comparisons of messages, renaming or inlining
+// a payload type doesn't change the contract.
+var ignoreSchemaRef = cmpopts.IgnoreFields(Message{}, "SchemaRef")
+
+// semanticPayloads compares JSON payloads and headers of messages by value, so reformatting a spec,
+// e.g. reordering object keys, isn't reported as a change. Array order is significant.
+var semanticPayloads = cmp.FilterPath(func(p cmp.Path) bool {
+	field, ok := p.Last().(cmp.StructField)
+
+	return ok && (field.Name() == "Payload" || field.Name() == "Headers") &&
+		p.Index(-2).Type() == reflect.TypeOf(Message{})
+}, cmp.Comparer(equalJSON))
+
+// compareMessages are options of comparing messages of operations in CompareSchemas.
+var compareMessages = cmp.Options{ignoreSchemaRef, semanticPayloads}
+
+// equalJSON reports whether the JSON documents are equal ignoring formatting and object key order,
+// documents which aren't valid JSON, e.g. raw payloads of other schema formats, are compared as text.
+func equalJSON(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	var valueA, valueB any
+	if json.Unmarshal([]byte(a), &valueA) != nil || json.Unmarshal([]byte(b), &valueB) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(valueA, valueB)
+}
+
 // CompareSchemas compares two schemas and returns a changelog of differences.
-func CompareSchemas(oldSchema, newSchema Schema) Changelog {
+func CompareSchemas(oldSchema, newSchema Schema, opts ...CompareOpt) Changelog {
+	o := compareOptions{diffFormat: DiffFormatCmp}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	oldSchema, newSchema = ignoreChanges(oldSchema, newSchema, o.ignore)
+
 	changes := []Change{}
 	now := time.Now()
 
@@ -227,7 +905,7 @@ func CompareSchemas(oldSchema, newSchema Schema) Changelog {
 		if _, exists := oldServices[name]; !exists {
 			changes = append(changes, Change{
 				Type:      ChangeTypeAdded,
-				Category:  "service",
+				Category:  ChangeCategoryService,
 				Name:      name,
 				Details:   fmt.Sprintf("'%s' was added", newService.Name),
 				Timestamp: now,
@@ -239,14 +917,14 @@ func CompareSchemas(oldSchema, newSchema Schema) Changelog {
 		if _, exists := newServices[name]; !exists {
 			changes = append(changes, Change{
 				Type:      ChangeTypeRemoved,
-				Category:  "service",
+				Category:  ChangeCategoryService,
 				Name:      name,
 				Details:   fmt.Sprintf("'%s' was removed", name),
 				Timestamp: now,
 			})
 		} else {
 			// Compare operations within the same service
-			serviceChanges := compareServiceOperations(oldService, newServices[name], now)
+			serviceChanges := compareServiceOperations(oldService, newServices[name], now, o)
 			changes = append(changes, serviceChanges...)
 		}
 	}
@@ -257,19 +935,21 @@ func CompareSchemas(oldSchema, newSchema Schema) Changelog {
 	}
 }
 
-func compareServiceOperations(oldService, newService Service, timestamp time.Time) []Change {
+func compareServiceOperations(oldService, newService Service, timestamp time.Time, o compareOptions) []Change {
 	changes := []Change{}
 
+	keyFn := operationKeyFunc(oldService, newService)
+
 	oldOps := make(map[string]Operation)
 	newOps := make(map[string]Operation)
 
 	for _, op := range oldService.Operation {
-		key := operationKey(op)
+		key := keyFn(op)
 		oldOps[key] = op
 	}
 
 	for _, op := range newService.Operation {
-		key := operationKey(op)
+		key := keyFn(op)
 		newOps[key] = op
 	}
 
@@ -277,7 +957,7 @@ func compareServiceOperations(oldService, newService Service, timestamp time.Tim
 		if _, exists := oldOps[key]; !exists {
 			changes = append(changes, Change{
 				Type:     ChangeTypeAdded,
-				Category: "channel",
+				Category: ChangeCategoryChannel,
 				Name:     fmt.Sprintf("%s:%s", newService.Name, key),
 				Details: fmt.Sprintf(
 					"'%s' on channel '%s' was added to service '%s'",
@@ -292,7 +972,7 @@ func compareServiceOperations(oldService, newService Service, timestamp time.Tim
 		if _, exists := newOps[key]; !exists {
 			changes = append(changes, Change{
 				Type:     ChangeTypeRemoved,
-				Category: "channel",
+				Category: ChangeCategoryChannel,
 				Name:     fmt.Sprintf("%s:%s", oldService.Name, key),
 				Details: fmt.Sprintf(
 					"'%s' on channel '%s' was removed from service '%s'",
@@ -302,49 +982,167 @@ func compareServiceOperations(oldService, newService Service, timestamp time.Tim
 			})
 		} else {
 			newOp := newOps[key]
+			// Operations matched by ID may have moved to another channel or action
+			if oldOp.Action != newOp.Action || oldOp.Channel.Name != newOp.Channel.Name {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategoryChannel,
+					Name:     fmt.Sprintf("%s:%s", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Operation '%s' in service '%s' changed from '%s' on channel '%s' to '%s' on channel '%s'",
+						key, newService.Name, oldOp.Action, oldOp.Channel.Name, newOp.Action, newOp.Channel.Name,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			if !oldOp.IsDeprecated() && newOp.IsDeprecated() {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategoryDeprecation,
+					Name:     fmt.Sprintf("%s:%s", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Operation '%s' on channel '%s' in service '%s' was deprecated",
+						newOp.Action, newOp.Channel.Name, newService.Name,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			if oldOp.Summary != newOp.Summary {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategorySummary,
+					Name:     fmt.Sprintf("%s:%s", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Summary changed for operation '%s' on channel '%s' in service '%s' from '%s' to '%s'",
+						newOp.Action, newOp.Channel.Name, newService.Name, oldOp.Summary, newOp.Summary,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			if details, changed := tagsDiff(oldOp.Tags, newOp.Tags); changed {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategoryTags,
+					Name:     fmt.Sprintf("%s:%s", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Tags changed for operation '%s' on channel '%s' in service '%s': %s",
+						newOp.Action, newOp.Channel.Name, newService.Name, details,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			if details, changed := tagsDiff(oldOp.Channel.Tags, newOp.Channel.Tags); changed {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategoryTags,
+					Name:     fmt.Sprintf("%s:%s:channel", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Tags changed for channel '%s' in service '%s': %s",
+						newOp.Channel.Name, newService.Name, details,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			if oldOp.Channel.Protocol != newOp.Channel.Protocol {
+				changes = append(changes, Change{
+					Type:     ChangeTypeChanged,
+					Category: ChangeCategoryChannel,
+					Name:     fmt.Sprintf("%s:%s:protocol", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Protocol changed for channel '%s' in service '%s' from '%s' to '%s'",
+						newOp.Channel.Name, newService.Name, oldOp.Channel.Protocol, newOp.Channel.Protocol,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
+			oldServers, newServers := oldService.ChannelServers(oldOp.Channel), newService.ChannelServers(newOp.Channel)
+			if details, changed := serversDiff(oldServers, newServers); changed {
+				changes = append(changes, Change{
+					Type:     serversChangeType(oldServers, newServers),
+					Category: ChangeCategoryChannel,
+					Name:     fmt.Sprintf("%s:%s:servers", newService.Name, key),
+					Details: fmt.Sprintf(
+						"Servers changed for channel '%s' in service '%s': %s",
+						newOp.Channel.Name, newService.Name, details,
+					),
+					Timestamp: timestamp,
+				})
+			}
+
 			// Compare channel messages
-			if !cmp.Equal(oldOp.Channel.Messages, newOp.Channel.Messages) {
-				diff := cmp.Diff(
-					oldOp.Channel.Messages,
-					newOp.Channel.Messages,
-				)
+			if !cmp.Equal(oldOp.Channel.Messages, newOp.Channel.Messages, compareMessages) {
+				diff := messagesDiff(oldOp.Channel.Messages, newOp.Channel.Messages, o.diffFormat)
 
 				changes = append(changes, Change{
 					Type:     ChangeTypeChanged,
-					Category: "message",
+					Category: ChangeCategoryMessage,
 					Name:     fmt.Sprintf("%s:%s", newService.Name, key),
 					Details: fmt.Sprintf(
 						"Messages changed for operation '%s' on channel '%s' in service '%s'",
 						newOp.Action, newOp.Channel.Name, newService.Name,
 					),
-					Diff:      diff,
-					Timestamp: timestamp,
+					Diff:       diff,
+					DiffFormat: o.diffFormat,
+					Timestamp:  timestamp,
+					Note:       deprecationNotes(newOp.Channel.Messages),
 				})
 			}
 
 			if oldOp.Reply != nil && newOp.Reply != nil {
-				if !cmp.Equal(oldOp.Reply.Messages, newOp.Reply.Messages) {
-					diff := cmp.Diff(
-						oldOp.Reply.Messages,
-						newOp.Reply.Messages,
-					)
+				oldServers, newServers := oldService.ChannelServers(*oldOp.Reply), newService.ChannelServers(*newOp.Reply)
+				if details, changed := serversDiff(oldServers, newServers); changed {
+					changes = append(changes, Change{
+						Type:     serversChangeType(oldServers, newServers),
+						Category: ChangeCategoryReply,
+						Name:     fmt.Sprintf("%s:%s:reply-servers", newService.Name, key),
+						Details: fmt.Sprintf(
+							"Servers changed for reply channel '%s' of operation '%s' in service '%s': %s",
+							newOp.Reply.Name, key, newService.Name, details,
+						),
+						Timestamp: timestamp,
+					})
+				}
 
+				if details, changed := tagsDiff(oldOp.Reply.Tags, newOp.Reply.Tags); changed {
 					changes = append(changes, Change{
 						Type:     ChangeTypeChanged,
-						Category: "message",
+						Category: ChangeCategoryTags,
+						Name:     fmt.Sprintf("%s:%s:reply-channel", newService.Name, key),
+						Details: fmt.Sprintf(
+							"Tags changed for reply channel '%s' of operation '%s' in service '%s': %s",
+							newOp.Reply.Name, key, newService.Name, details,
+						),
+						Timestamp: timestamp,
+					})
+				}
+
+				if !cmp.Equal(oldOp.Reply.Messages, newOp.Reply.Messages, compareMessages) {
+					diff := messagesDiff(oldOp.Reply.Messages, newOp.Reply.Messages, o.diffFormat)
+
+					changes = append(changes, Change{
+						Type:     ChangeTypeChanged,
+						Category: ChangeCategoryMessage,
 						Name:     fmt.Sprintf("%s:%s:reply", newService.Name, key),
 						Details: fmt.Sprintf(
 							"Reply messages changed for operation '%s' on channel '%s' in service '%s'",
 							newOp.Action, newOp.Channel.Name, newService.Name,
 						),
-						Diff:      diff,
-						Timestamp: timestamp,
+						Diff:       diff,
+						DiffFormat: o.diffFormat,
+						Timestamp:  timestamp,
+						Note:       deprecationNotes(newOp.Reply.Messages),
 					})
 				}
 			} else if oldOp.Reply != nil && newOp.Reply == nil {
 				changes = append(changes, Change{
 					Type:     ChangeTypeRemoved,
-					Category: "channel",
+					Category: ChangeCategoryReply,
 					Name:     fmt.Sprintf("%s:%s:reply", newService.Name, key),
 					Details: fmt.Sprintf(
 						"Reply channel removed for operation '%s' on channel '%s' in service '%s'",
@@ -355,7 +1153,7 @@ func compareServiceOperations(oldService, newService Service, timestamp time.Tim
 			} else if oldOp.Reply == nil && newOp.Reply != nil {
 				changes = append(changes, Change{
 					Type:     ChangeTypeAdded,
-					Category: "channel",
+					Category: ChangeCategoryReply,
 					Name:     fmt.Sprintf("%s:%s:reply", newService.Name, key),
 					Details: fmt.Sprintf(
 						"Reply channel added for operation '%s' on channel '%s' in service '%s'",
@@ -370,7 +1168,99 @@ func compareServiceOperations(oldService, newService Service, timestamp time.Tim
 	return changes
 }
 
+// deprecationNotes joins unique deprecation notes of the messages into a single line.
+func deprecationNotes(messages []Message) string {
+	var notes []string
+
+	for _, msg := range messages {
+		note := strings.Join(strings.Fields(msg.DeprecationNote), " ")
+		if note != "" && !slices.Contains(notes, note) {
+			notes = append(notes, note)
+		}
+	}
+
+	return strings.Join(notes, " ")
+}
+
+// tagsDiff describes tags added and removed between the old and new tags.
+func tagsDiff(oldTags, newTags []string) (string, bool) {
+	var added, removed []string
+
+	for _, tag := range newTags {
+		if !HasTag(oldTags, tag) {
+			added = append(added, tag)
+		}
+	}
+
+	for _, tag := range oldTags {
+		if !HasTag(newTags, tag) {
+			removed = append(removed, tag)
+		}
+	}
+
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, fmt.Sprintf("added %v", added))
+	}
+	if len(removed) > 0 {
+		parts = append(parts, fmt.Sprintf("removed %v", removed))
+	}
+
+	return strings.Join(parts, ", "), len(parts) > 0
+}
+
+// serversDiff describes servers added to and removed from a channel, nothing when the old servers are unknown,
+// e.g. of schemas persisted before servers were tracked, or available on all servers of a service declaring none.
+func serversDiff(oldServers, newServers []string) (string, bool) {
+	if len(oldServers) == 0 {
+		return "", false
+	}
+
+	return tagsDiff(oldServers, newServers)
+}
+
+// serversChangeType returns ChangeTypeAdded when the channel is only made available on more servers,
+// as it doesn't break services, otherwise ChangeTypeChanged.
+func serversChangeType(oldServers, newServers []string) ChangeType {
+	if slices.ContainsFunc(oldServers, func(server string) bool { return !slices.Contains(newServers, server) }) {
+		return ChangeTypeChanged
+	}
+
+	return ChangeTypeAdded
+}
+
+// operationKey returns the identity of the operation, its ID when present.
 func operationKey(op Operation) string {
+	if op.ID != "" {
+		return op.ID
+	}
+
+	return synthesizedOperationKey(op)
+}
+
+// operationKeyFunc returns the function matching operations of the old and new versions of a service.
+func operationKeyFunc(oldService, newService Service) func(Operation) string {
+	if !hasOperationIDs(oldService) || !hasOperationIDs(newService) {
+		// Schemas persisted before operation IDs were tracked can only be matched by synthesized keys.
+		return synthesizedOperationKey
+	}
+
+	return operationKey
+}
+
+// hasOperationIDs reports whether all operations of the service have IDs.
+func hasOperationIDs(service Service) bool {
+	for _, op := range service.Operation {
+		if op.ID == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// synthesizedOperationKey returns a key of the operation built from its action, channel and messages.
+func synthesizedOperationKey(op Operation) string {
 	messageName := ""
 	if len(op.Channel.Messages) > 0 {
 		messageName = op.Channel.Messages[0].Name
@@ -0,0 +1,857 @@
+package messageflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSchemasStrict(t *testing.T) {
+	t.Parallel()
+
+	schema1 := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action: ActionSend,
+						Channel: Channel{
+							Name:     "user.created",
+							Messages: []Message{{Name: "UserCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	schema2 := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action: ActionSend,
+						Channel: Channel{
+							Name:     "user.created",
+							Messages: []Message{{Name: "UserCreated", Payload: `{"id": "string[uuid]"}`}},
+						},
+					},
+					{
+						Action: ActionSend,
+						Channel: Channel{
+							Name:     "user.deleted",
+							Messages: []Message{{Name: "UserDeleted", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	merged, conflicts, err := MergeSchemasStrict(schema1, schema2)
+	require.NoError(t, err)
+
+	require.Len(t, merged.Services, 1)
+	require.Len(t, merged.Services[0].Operation, 2)
+	assert.Equal(t, schema1.Services[0].Operation[0], merged.Services[0].Operation[0])
+
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "User Service", conflicts[0].Service)
+	assert.Equal(t, "send-user.created-UserCreated", conflicts[0].Operation)
+	assert.Contains(t, conflicts[0].Details, "messages of operation 'send' on channel 'user.created'")
+
+	_, conflicts, err = MergeSchemasStrict(schema1, schema1)
+	require.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	_, _, err = MergeSchemasStrict(Schema{Services: []Service{{}}})
+	require.Error(t, err)
+}
+
+func TestMergeConflicts(t *testing.T) {
+	t.Parallel()
+
+	op := func(payload string) Operation {
+		return Operation{
+			Action:  ActionSend,
+			Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated", Payload: payload}}},
+		}
+	}
+
+	schema1 := Schema{Services: []Service{{Operation: []Operation{op(`{"id": "string"}`)}}}}
+	schema2 := Schema{Services: []Service{{Operation: []Operation{op(`{"id": "string[uuid]"}`)}}}}
+
+	conflicts := MergeConflicts(schema1, schema2)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "send-user.created-UserCreated", conflicts[0].Operation)
+
+	merged := MergeSchemas(schema1, schema2)
+	require.Len(t, merged.Services, 1)
+	assert.Equal(t, []Operation{op(`{"id": "string[uuid]"}`)}, merged.Services[0].Operation)
+
+	assert.Empty(t, MergeConflicts(schema1, schema1))
+
+	moved := op(`{"id": "string"}`)
+	moved.ID = "publishUserCreated"
+	schema3 := Schema{Services: []Service{{Operation: []Operation{moved}}}}
+
+	moved.Channel.Name = "user.registered"
+	schema4 := Schema{Services: []Service{{Operation: []Operation{moved}}}}
+
+	conflicts = MergeConflicts(schema3, schema4)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "publishUserCreated", conflicts[0].Operation)
+	assert.Contains(t, conflicts[0].Details, "as 'send' on channel 'user.created' and as 'send' on channel 'user.registered'")
+}
+
+func TestMergeSchemasInOrder(t *testing.T) {
+	t.Parallel()
+
+	op := func(action Action, channel, payload string) Operation {
+		return Operation{Action: action, Channel: Channel{Name: channel, Messages: []Message{{Name: channel, Payload: payload}}}}
+	}
+
+	schema1 := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				op(ActionSend, "user.updated", "v1"),
+				op(ActionReceive, "user.delete", "v1"),
+			}},
+			{Name: "Billing Service", Operation: []Operation{op(ActionReceive, "user.created", "v1")}},
+		},
+	}
+
+	schema2 := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				op(ActionSend, "user.created", "v1"),
+				op(ActionSend, "user.updated", "v2"),
+			}},
+		},
+	}
+
+	merged := MergeSchemasInOrder(schema1, schema2)
+
+	require.Len(t, merged.Services, 2)
+	assert.Equal(t, "User Service", merged.Services[0].Name)
+	assert.Equal(t, []Operation{
+		op(ActionSend, "user.updated", "v2"),
+		op(ActionReceive, "user.delete", "v1"),
+		op(ActionSend, "user.created", "v1"),
+	}, merged.Services[0].Operation)
+	assert.Equal(t, op(ActionSend, "user.updated", "v1"), schema1.Services[0].Operation[0])
+}
+
+func TestMergeSchemasDeterministic(t *testing.T) {
+	t.Parallel()
+
+	op := func(action Action, channel string) Operation {
+		return Operation{Action: action, Channel: Channel{Name: channel}}
+	}
+
+	schema1 := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				op(ActionSend, "user.updated"),
+				op(ActionReceive, "user.delete"),
+			}},
+			{Name: "Notification Service", Operation: []Operation{op(ActionReceive, "user.updated")}},
+			{Name: "Billing Service", Operation: []Operation{op(ActionReceive, "user.created")}},
+		},
+	}
+
+	schema2 := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				op(ActionSend, "user.created"),
+				op(ActionSend, "user.deleted"),
+				op(ActionSend, "user.updated"),
+			}},
+			{Name: "Analytics Service", Operation: []Operation{op(ActionReceive, "user.created")}},
+		},
+	}
+
+	expected := MergeSchemas(schema1, schema2)
+
+	names := make([]string, 0, len(expected.Services))
+	for _, service := range expected.Services {
+		names = append(names, service.Name)
+	}
+
+	assert.Equal(t, []string{"Analytics Service", "Billing Service", "Notification Service", "User Service"}, names)
+	assert.Equal(t, []Operation{
+		op(ActionReceive, "user.delete"),
+		op(ActionSend, "user.created"),
+		op(ActionSend, "user.deleted"),
+		op(ActionSend, "user.updated"),
+	}, expected.Services[3].Operation)
+
+	for range 20 {
+		assert.Equal(t, expected, MergeSchemas(schema1, schema2))
+	}
+}
+
+func TestChannelPayloadConflicts(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action: ActionSend,
+						Channel: Channel{
+							Name:     "user.created",
+							Messages: []Message{{Name: "UserCreated", Payload: `{"id": "string", "email": "string"}`}},
+						},
+					},
+				},
+			},
+			{
+				Name: "Notification Service",
+				Operation: []Operation{
+					{
+						Action: ActionReceive,
+						Channel: Channel{
+							Name:     "user.created",
+							Messages: []Message{{Name: "UserCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []Operation{
+					{
+						Action: ActionReceive,
+						Channel: Channel{
+							Name:     "user.created",
+							Messages: []Message{{Name: "UserCreated", Payload: `{"id": "string", "email": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	conflicts := ChannelPayloadConflicts(schema)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "Notification Service", conflicts[0].Service)
+	assert.Equal(t, "user.created", conflicts[0].Channel)
+	assert.Empty(t, conflicts[0].Operation)
+	assert.Contains(t, conflicts[0].Details,
+		"message 'UserCreated' on channel 'user.created' differs between services 'User Service' and 'Notification Service'")
+
+	schema.Services[1].Operation[0].Channel.Messages[0].Payload = `{"id": "string", "email": "string"}`
+	assert.Empty(t, ChannelPayloadConflicts(schema))
+}
+
+func TestChangelogBreakingChanges(t *testing.T) {
+	t.Parallel()
+
+	oldSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated"}}},
+					},
+				},
+			},
+		},
+	}
+
+	added := Schema{
+		Services: []Service{
+			oldSchema.Services[0],
+			{Name: "Billing Service", Operation: []Operation{}},
+		},
+	}
+
+	changelog := CompareSchemas(oldSchema, added)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeSeverityNonBreaking, changelog.Changes[0].Severity())
+	assert.Empty(t, changelog.BreakingChanges())
+
+	removed := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{}},
+		},
+	}
+
+	changelog = CompareSchemas(oldSchema, removed)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeSeverityBreaking, changelog.Changes[0].Severity())
+	assert.Len(t, changelog.BreakingChanges(), 1)
+}
+
+func TestCompareSchemasDeprecationNote(t *testing.T) {
+	t.Parallel()
+
+	schema := func(messages ...Message) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "Payment Service",
+					Operation: []Operation{
+						{
+							Action:  ActionSend,
+							Channel: Channel{Name: "payment.refunded", Messages: messages},
+							Reply:   &Channel{Name: "payment.refunded.ack", Messages: []Message{{Name: "Ack"}}},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	oldSchema := schema(Message{Name: "PaymentRefunded", Payload: `{"amount": "number", "payment_id": "string"}`})
+	newSchema := schema(
+		Message{
+			Name:            "PaymentRefunded",
+			Payload:         `{"payment_id": "string"}`,
+			DeprecationNote: "amount is removed,\n  use payment.captured instead.",
+		},
+		Message{Name: "PaymentRefundedV2", Payload: `{"payment_id": "string"}`, DeprecationNote: "amount is removed, use payment.captured instead."},
+	)
+
+	changelog := CompareSchemas(oldSchema, newSchema)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeCategoryMessage, changelog.Changes[0].Category)
+	assert.Equal(t, "amount is removed, use payment.captured instead.", changelog.Changes[0].Note)
+
+	changelog = CompareSchemas(oldSchema, schema(Message{Name: "PaymentRefunded", Payload: `{"payment_id": "string"}`}))
+	require.Len(t, changelog.Changes, 1)
+	assert.Empty(t, changelog.Changes[0].Note)
+}
+
+func TestCompareSchemasOperationIDs(t *testing.T) {
+	t.Parallel()
+
+	oldSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated"}}},
+					},
+				},
+			},
+		},
+	}
+
+	newSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						ID:      "sendUserCreated",
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated"}}},
+					},
+				},
+			},
+		},
+	}
+
+	// Operations without IDs are matched by synthesized keys.
+	assert.Empty(t, CompareSchemas(oldSchema, newSchema).Changes)
+
+	movedSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						ID:      "sendUserCreated",
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.registered", Messages: []Message{{Name: "UserCreated"}}},
+					},
+				},
+			},
+		},
+	}
+
+	changelog := CompareSchemas(newSchema, movedSchema)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeTypeChanged, changelog.Changes[0].Type)
+	assert.Equal(t, "User Service:sendUserCreated", changelog.Changes[0].Name)
+}
+
+func TestCompareSchemasTags(t *testing.T) {
+	t.Parallel()
+
+	oldSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Tags: []string{"pii"}},
+						Reply:   &Channel{Name: "user.created.ack"},
+					},
+				},
+			},
+		},
+	}
+
+	newSchema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Tags:    []string{TagDeprecated},
+						Channel: Channel{Name: "user.created"},
+						Reply:   &Channel{Name: "user.created.ack", Tags: []string{"audited"}},
+					},
+				},
+			},
+		},
+	}
+
+	changelog := CompareSchemas(oldSchema, newSchema)
+	require.Len(t, changelog.Changes, 4)
+
+	for _, change := range changelog.Changes {
+		assert.Equal(t, ChangeTypeChanged, change.Type)
+		assert.Equal(t, ChangeSeverityNonBreaking, change.Severity())
+	}
+
+	// The deprecated tag also deprecates the operation.
+	assert.Equal(t, ChangeCategoryDeprecation, changelog.Changes[0].Category)
+	assert.Equal(t, ChangeCategoryTags, changelog.Changes[1].Category)
+	assert.Contains(t, changelog.Changes[1].Details, "added [deprecated]")
+	assert.Equal(t, ChangeCategoryTags, changelog.Changes[2].Category)
+	assert.Contains(t, changelog.Changes[2].Details, "removed [pii]")
+	assert.Equal(t, ChangeCategoryTags, changelog.Changes[3].Category)
+	assert.Equal(t, "User Service:send-user.created--reply-user.created.ack-:reply-channel", changelog.Changes[3].Name)
+	assert.Contains(t, changelog.Changes[3].Details, "Tags changed for reply channel 'user.created.ack'")
+	assert.Contains(t, changelog.Changes[3].Details, "added [audited]")
+}
+
+func TestCompareSchemasDeprecation(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(deprecated bool) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "User Service",
+					Operation: []Operation{
+						{
+							Action:     ActionSend,
+							Channel:    Channel{Name: "user.created"},
+							Deprecated: deprecated,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	changelog := CompareSchemas(newSchema(false), newSchema(true))
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, ChangeTypeChanged, changelog.Changes[0].Type)
+	assert.Equal(t, ChangeCategoryDeprecation, changelog.Changes[0].Category)
+	assert.Equal(t, ChangeSeverityNonBreaking, changelog.Changes[0].Severity())
+	assert.Equal(t,
+		"Operation 'send' on channel 'user.created' in service 'User Service' was deprecated",
+		changelog.Changes[0].Details,
+	)
+
+	assert.Empty(t, CompareSchemas(newSchema(true), newSchema(false)).Changes)
+}
+
+func TestCompareSchemasSummary(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(summary string) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "User Service",
+					Operation: []Operation{
+						{
+							Action:  ActionSend,
+							Channel: Channel{Name: "user.created"},
+							Summary: summary,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	changelog := CompareSchemas(newSchema("Publish users"), newSchema("Publish created users"))
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, ChangeTypeChanged, changelog.Changes[0].Type)
+	assert.Equal(t, ChangeCategorySummary, changelog.Changes[0].Category)
+	assert.Equal(t, ChangeSeverityNonBreaking, changelog.Changes[0].Severity())
+	assert.Equal(t,
+		"Summary changed for operation 'send' on channel 'user.created' in service 'User Service' "+
+			"from 'Publish users' to 'Publish created users'",
+		changelog.Changes[0].Details,
+	)
+}
+
+func TestCompareSchemasProtocol(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(protocol string) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "User Service",
+					Operation: []Operation{
+						{
+							Action:  ActionSend,
+							Channel: Channel{Name: "user.created", Protocol: protocol},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	changelog := CompareSchemas(newSchema("amqp"), newSchema("kafka"))
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, ChangeTypeChanged, changelog.Changes[0].Type)
+	assert.Equal(t, ChangeCategoryChannel, changelog.Changes[0].Category)
+	assert.Equal(t, ChangeSeverityBreaking, changelog.Changes[0].Severity())
+	assert.Equal(t,
+		"Protocol changed for channel 'user.created' in service 'User Service' from 'amqp' to 'kafka'",
+		changelog.Changes[0].Details,
+	)
+}
+
+func TestSchemaNames(t *testing.T) {
+	t.Parallel()
+
+	request := Operation{
+		Action:  ActionSend,
+		Channel: Channel{Name: "user.info"},
+		Reply:   &Channel{Name: "user.info.reply"},
+	}
+	reply := Operation{
+		Action:  ActionReceive,
+		Channel: Channel{Name: "user.info"},
+		Reply:   &Channel{Name: "user.info.reply"},
+	}
+	created := Operation{
+		Action:  ActionSend,
+		Channel: Channel{Name: "user.created"},
+	}
+
+	schema := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{reply, created}},
+			{Name: "Notification Service", Operation: []Operation{request}},
+		},
+	}
+
+	assert.Equal(t, []string{"Notification Service", "User Service"}, schema.ServiceNames())
+	assert.Equal(t, []string{"user.created", "user.info", "user.info.reply"}, schema.ChannelNames())
+	assert.Equal(t, []ChannelOperation{
+		{Service: "User Service", Operation: reply},
+		{Service: "Notification Service", Operation: request},
+	}, schema.OperationsForChannel("user.info"))
+	assert.Equal(t, []ChannelOperation{
+		{Service: "User Service", Operation: reply, Reply: true},
+		{Service: "Notification Service", Operation: request, Reply: true},
+	}, schema.OperationsForChannel("user.info.reply"))
+	assert.Empty(t, schema.OperationsForChannel("unknown"))
+}
+
+func TestSchemaMatch(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{Name: "User Service", Operation: []Operation{
+				{Action: ActionSend, Channel: Channel{Name: "user.created"}},
+				{Action: ActionSend, Channel: Channel{Name: "user.info"}, Reply: &Channel{Name: "user.info.reply"}},
+			}},
+			{Name: "Notification Service"},
+			{Name: "Notification"},
+		},
+	}
+
+	for _, tt := range []struct {
+		query string
+		match func(string) (string, error)
+		want  string
+		err   string
+	}{
+		{query: "User Service", match: schema.MatchService, want: "User Service"},
+		{query: "user", match: schema.MatchService, want: "User Service"},
+		{query: "notification", match: schema.MatchService, want: "Notification"},
+		{query: "Notification Service", match: schema.MatchService, want: "Notification Service"},
+		{query: "service", match: schema.MatchService, err: "service 'service' is ambiguous, candidates: Notification Service, User Service"},
+		{query: "order", match: schema.MatchService, err: "no service matches 'order', available: Notification, Notification Service, User Service"},
+		{query: "CREATED", match: schema.MatchChannel, want: "user.created"},
+		{query: "user.info", match: schema.MatchChannel, want: "user.info"},
+		{query: "reply", match: schema.MatchChannel, want: "user.info.reply"},
+		{query: "info", match: schema.MatchChannel, err: "channel 'info' is ambiguous, candidates: user.info, user.info.reply"},
+	} {
+		got, err := tt.match(tt.query)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.query)
+			continue
+		}
+
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, got, tt.query)
+	}
+}
+
+func TestSchemaExcludeChannels(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{Name: "Order Service", Operation: []Operation{
+				{Action: ActionSend, Channel: Channel{Name: "orders.placed"}},
+				{Action: ActionSend, Channel: Channel{Name: "orders/payment.dlq"}},
+				{Action: ActionSend, Channel: Channel{Name: "orders.status"}, Reply: &Channel{Name: "orders.status.retry"}},
+			}},
+			{Name: "Audit Service", Operation: []Operation{
+				{Action: ActionReceive, Channel: Channel{Name: "orders/payment.dlq"}},
+			}},
+		},
+	}
+
+	for _, tt := range []struct {
+		patterns []string
+		want     []string
+	}{
+		{want: []string{"orders.placed", "orders.status", "orders.status.retry", "orders/payment.dlq"}},
+		{patterns: []string{"*.dlq"}, want: []string{"orders.placed", "orders.status", "orders.status.retry"}},
+		{patterns: []string{"*.dlq", "*.retry"}, want: []string{"orders.placed", "orders.status"}},
+		{patterns: []string{"orders.?laced"}, want: []string{"orders.status", "orders.status.retry", "orders/payment.dlq"}},
+		{patterns: []string{"orders"}, want: []string{"orders.placed", "orders.status", "orders.status.retry", "orders/payment.dlq"}},
+		{patterns: []string{"orders.*"}, want: []string{"orders/payment.dlq"}},
+	} {
+		excluded := schema.ExcludeChannels(tt.patterns...)
+		assert.Equal(t, tt.want, excluded.ChannelNames(), tt.patterns)
+		assert.Equal(t, []string{"Audit Service", "Order Service"}, excluded.ServiceNames(), tt.patterns)
+	}
+
+	assert.Len(t, schema.Services[0].Operation, 3)
+	assert.NotNil(t, schema.Services[0].Operation[2].Reply)
+}
+
+func TestCompareSchemasUnifiedDiff(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(payload string) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "User Service",
+					Operation: []Operation{
+						{
+							Action: ActionSend,
+							Channel: Channel{
+								Name:     "user.created",
+								Messages: []Message{{Name: "UserCreated", Payload: payload}},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	oldSchema := newSchema(`{"id": "string", "name": "string"}`)
+	newerSchema := newSchema(`{"id": "string", "email": "string"}`)
+
+	changelog := CompareSchemas(oldSchema, newerSchema, WithDiffFormat(DiffFormatUnified))
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, DiffFormatUnified, changelog.Changes[0].DiffFormat)
+	assert.Equal(t, `--- old
++++ new
+@@ -2,6 +2,6 @@
+   "name": "UserCreated",
+   "payload": {
+     "id": "string",
+-    "name": "string"
++    "email": "string"
+   }
+ }`, changelog.Changes[0].Diff)
+
+	// Fields other than the payload are diffed as well.
+	newerSchema = newSchema(`{"id": "string", "name": "string"}`)
+	newerSchema.Services[0].Operation[0].Channel.Messages[0].ContentType = "application/json"
+	newerSchema.Services[0].Operation[0].Channel.Messages[0].Examples = []string{`{"id": "1", "name": "Alice"}`}
+
+	changelog = CompareSchemas(oldSchema, newerSchema, WithDiffFormat(DiffFormatUnified))
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, `--- old
++++ new
+@@ -1,7 +1,14 @@
+ {
+   "name": "UserCreated",
++  "contentType": "application/json",
+   "payload": {
+     "id": "string",
+     "name": "string"
+-  }
++  },
++  "examples": [
++    {
++      "id": "1",
++      "name": "Alice"
++    }
++  ]
+ }`, changelog.Changes[0].Diff)
+
+	changelog = CompareSchemas(oldSchema, newerSchema)
+	require.Len(t, changelog.Changes, 1)
+
+	assert.Equal(t, DiffFormatCmp, changelog.Changes[0].DiffFormat)
+	assert.Contains(t, changelog.Changes[0].Diff, "[]messageflow.Message{")
+}
+
+func TestCompareSchemasReply(t *testing.T) {
+	t.Parallel()
+
+	newSchema := func(reply *Channel) Schema {
+		return Schema{
+			Services: []Service{
+				{
+					Name: "User Service",
+					Operation: []Operation{
+						{
+							ID:      "getUserInfo",
+							Action:  ActionReceive,
+							Channel: Channel{Name: "user.info.request"},
+							Reply:   reply,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	withoutReply := newSchema(nil)
+	withReply := newSchema(&Channel{Name: "user.info.reply"})
+
+	changelog := CompareSchemas(withoutReply, withReply)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeTypeAdded, changelog.Changes[0].Type)
+	assert.Equal(t, ChangeCategoryReply, changelog.Changes[0].Category)
+
+	changelog = CompareSchemas(withReply, withoutReply)
+	require.Len(t, changelog.Changes, 1)
+	assert.Equal(t, ChangeTypeRemoved, changelog.Changes[0].Type)
+	assert.Equal(t, ChangeCategoryReply, changelog.Changes[0].Category)
+	assert.Equal(t, ChangeSeverityBreaking, changelog.Changes[0].Severity())
+}
+
+func TestChangelogFilterByCategory(t *testing.T) {
+	t.Parallel()
+
+	changelog := Changelog{
+		Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Changes: []Change{
+			{Type: ChangeTypeAdded, Category: ChangeCategoryService, Name: "a"},
+			{Type: ChangeTypeRemoved, Category: ChangeCategoryReply, Name: "b"},
+			{Type: ChangeTypeChanged, Category: ChangeCategoryMessage, Name: "c"},
+		},
+	}
+
+	filtered := changelog.FilterByCategory(ChangeCategoryReply, ChangeCategoryMessage)
+	assert.Equal(t, changelog.Date, filtered.Date)
+	assert.Equal(t, changelog.Changes[1:], filtered.Changes)
+	assert.Len(t, changelog.Changes, 3)
+
+	assert.Empty(t, changelog.FilterByCategory().Changes)
+}
+
+func TestCompareSchemasSchemaRef(t *testing.T) {
+	t.Parallel()
+
+	schema := func(schemaRef string) Schema {
+		return Schema{Services: []Service{{Name: "User Service", Operation: []Operation{{
+			Action: ActionSend,
+			Channel: Channel{Name: "user.created", Messages: []Message{
+				{Name: "UserCreated", Payload: `{"id": "string"}`, SchemaRef: schemaRef},
+			}},
+		}}}}}
+	}
+
+	assert.Empty(t, CompareSchemas(schema(""), schema("UserProfile")).Changes)
+}
+
+func TestCompareSchemasSemanticPayloads(t *testing.T) {
+	t.Parallel()
+
+	schema := func(payload, headers string) Schema {
+		return Schema{Services: []Service{{Name: "User Service", Operation: []Operation{{
+			Action: ActionSend,
+			Channel: Channel{Name: "user.created", Messages: []Message{
+				{Name: "UserCreated", Payload: payload, Headers: headers},
+			}},
+		}}}}}
+	}
+
+	base := schema(`{"id": "string", "roles": ["string"], "tags": ["a", "b"]}`, `{"trace": "string", "tenant": "string"}`)
+
+	tests := []struct {
+		name    string
+		schema  Schema
+		changed bool
+	}{
+		{
+			name:   "reordered keys",
+			schema: schema("{\n  \"tags\": [\"a\", \"b\"],\n  \"roles\": [\"string\"],\n  \"id\": \"string\"\n}", `{"tenant":"string","trace":"string"}`),
+		},
+		{
+			name:    "reordered array items",
+			schema:  schema(`{"id": "string", "roles": ["string"], "tags": ["b", "a"]}`, `{"trace": "string", "tenant": "string"}`),
+			changed: true,
+		},
+		{
+			name:    "changed type",
+			schema:  schema(`{"id": "integer", "roles": ["string"], "tags": ["a", "b"]}`, `{"trace": "string", "tenant": "string"}`),
+			changed: true,
+		},
+		{
+			name:    "changed non-JSON payload",
+			schema:  schema(`id: string`, `{"trace": "string", "tenant": "string"}`),
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			changes := CompareSchemas(base, tt.schema).Changes
+			if tt.changed {
+				require.Len(t, changes, 1)
+				assert.Equal(t, ChangeCategoryMessage, changes[0].Category)
+			} else {
+				assert.Empty(t, changes)
+			}
+		})
+	}
+}
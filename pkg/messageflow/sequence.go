@@ -0,0 +1,156 @@
+package messageflow
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// SequenceStep is a message passed from one service to another in a traced flow, see TraceSequence.
+type SequenceStep struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Channel string `json:"channel"`
+	// Messages lists names of the messages passed, empty when the operations declare none.
+	Messages []string `json:"messages,omitempty"`
+	// Request marks requests expecting a reply, Reply marks replies to them.
+	Request bool `json:"request,omitempty"`
+	Reply   bool `json:"reply,omitempty"`
+	// Revisit marks steps to a service whose flow is already traced, e.g. when services form a cycle,
+	// the flow isn't followed from it again.
+	Revisit bool `json:"revisit,omitempty"`
+}
+
+// TraceSequence traces how messages flow through services, starting with send operations of the service
+// on the channel. Either one may be empty, selecting send operations of the service on any channel or of
+// any service on the channel. Messages are followed to the services receiving them, assuming a service sends
+// all its messages in turn, and requests are followed by replies once the replying service is done.
+// Each service is followed once, so the trace ends on cycles. Steps are listed in the order they happen.
+func TraceSequence(s Schema, service, channel string) ([]SequenceStep, error) {
+	if service == "" && channel == "" {
+		return nil, errors.New("service or channel to trace from is required")
+	}
+
+	t := sequenceTracer{
+		schema:  s,
+		visited: make(map[string]bool),
+	}
+
+	var seeds []ChannelOperation
+
+	for _, svc := range s.Services {
+		if service != "" && svc.Name != service {
+			continue
+		}
+
+		for _, op := range svc.Operation {
+			if op.Action == ActionSend && (channel == "" || op.Channel.Name == channel) {
+				seeds = append(seeds, ChannelOperation{Service: svc.Name, Operation: op})
+				t.visited[svc.Name] = true
+			}
+		}
+	}
+
+	if len(seeds) == 0 {
+		return nil, fmt.Errorf("no send operations to trace from, service '%s', channel '%s'", service, channel)
+	}
+
+	for _, seed := range seeds {
+		t.send(seed.Service, seed.Operation)
+	}
+
+	return t.steps, nil
+}
+
+type sequenceTracer struct {
+	schema Schema
+	// visited holds services whose sends are traced.
+	visited map[string]bool
+	steps   []SequenceStep
+}
+
+// send adds steps of the operation to each receiving service, followed by the flow of the receiver
+// and, for requests, the reply.
+func (t *sequenceTracer) send(sender string, op Operation) {
+	for _, receiver := range t.schema.Services {
+		if receiver.Name == sender {
+			continue
+		}
+
+		for _, receiverOp := range receiver.Operation {
+			if receiverOp.Action != ActionReceive || receiverOp.Channel.Name != op.Channel.Name {
+				continue
+			}
+
+			t.steps = append(t.steps, SequenceStep{
+				From:     sender,
+				To:       receiver.Name,
+				Channel:  op.Channel.Name,
+				Messages: sequenceMessages(op.Channel.Messages, receiverOp.Channel.Messages...),
+				Request:  op.Reply != nil,
+				Revisit:  t.visited[receiver.Name],
+			})
+
+			t.follow(receiver)
+
+			if reply := sequenceReply(op, receiverOp); reply != nil {
+				t.steps = append(t.steps, SequenceStep{
+					From:     receiver.Name,
+					To:       sender,
+					Channel:  reply.Name,
+					Messages: sequenceMessages(reply.Messages),
+					Reply:    true,
+				})
+			}
+
+			break
+		}
+	}
+}
+
+// follow adds steps of the messages the service sends, unless they are already traced.
+func (t *sequenceTracer) follow(service Service) {
+	if t.visited[service.Name] {
+		return
+	}
+
+	t.visited[service.Name] = true
+
+	for _, op := range service.Operation {
+		if op.Action == ActionSend {
+			t.send(service.Name, op)
+		}
+	}
+}
+
+// sequenceReply returns the reply channel of a request, preferring the one of the replying operation.
+func sequenceReply(request, receive Operation) *Channel {
+	if request.Reply == nil {
+		return nil
+	}
+
+	if receive.Reply != nil {
+		return receive.Reply
+	}
+
+	return request.Reply
+}
+
+// sequenceMessages returns unique names of the sent messages, or of the received ones when the sender
+// declares none.
+func sequenceMessages(sent []Message, received ...Message) []string {
+	messages := sent
+	if len(messages) == 0 {
+		messages = received
+	}
+
+	var names []string
+
+	for _, msg := range messages {
+		if !slices.Contains(names, msg.Name) {
+			names = append(names, msg.Name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,89 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceSequence(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "Gateway",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "order.create", Messages: []Message{{Name: "CreateOrder"}}},
+						Reply:   &Channel{Name: "order.create.reply", Messages: []Message{{Name: "OrderCreated"}}},
+					},
+					{Action: ActionReceive, Channel: Channel{Name: "order.shipped"}},
+				},
+			},
+			{
+				Name: "Order Service",
+				Operation: []Operation{
+					{
+						Action:  ActionReceive,
+						Channel: Channel{Name: "order.create", Messages: []Message{{Name: "CreateOrder"}}},
+						Reply:   &Channel{Name: "order.create.reply", Messages: []Message{{Name: "OrderCreated"}}},
+					},
+					{Action: ActionSend, Channel: Channel{Name: "order.placed", Messages: []Message{{Name: "OrderPlaced"}}}},
+					{Action: ActionReceive, Channel: Channel{Name: "payment.captured"}},
+				},
+			},
+			{
+				Name: "Payment Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "order.placed"}},
+					{Action: ActionSend, Channel: Channel{Name: "payment.captured", Messages: []Message{{Name: "PaymentCaptured"}}}},
+				},
+			},
+			{
+				Name: "Shipping Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "order.placed"}},
+					{Action: ActionSend, Channel: Channel{Name: "order.shipped"}},
+				},
+			},
+		},
+	}
+
+	steps, err := TraceSequence(schema, "Gateway", "")
+	require.NoError(t, err)
+
+	assert.Equal(t, []SequenceStep{
+		{From: "Gateway", To: "Order Service", Channel: "order.create", Messages: []string{"CreateOrder"}, Request: true},
+		{From: "Order Service", To: "Payment Service", Channel: "order.placed", Messages: []string{"OrderPlaced"}},
+		{
+			From: "Payment Service", To: "Order Service", Channel: "payment.captured",
+			Messages: []string{"PaymentCaptured"}, Revisit: true,
+		},
+		{From: "Order Service", To: "Shipping Service", Channel: "order.placed", Messages: []string{"OrderPlaced"}},
+		{From: "Shipping Service", To: "Gateway", Channel: "order.shipped", Revisit: true},
+		{From: "Order Service", To: "Gateway", Channel: "order.create.reply", Messages: []string{"OrderCreated"}, Reply: true},
+	}, steps)
+
+	steps, err = TraceSequence(schema, "", "payment.captured")
+	require.NoError(t, err)
+	assert.Equal(t, []SequenceStep{
+		{From: "Payment Service", To: "Order Service", Channel: "payment.captured", Messages: []string{"PaymentCaptured"}},
+		{From: "Order Service", To: "Payment Service", Channel: "order.placed", Messages: []string{"OrderPlaced"}, Revisit: true},
+		{From: "Order Service", To: "Shipping Service", Channel: "order.placed", Messages: []string{"OrderPlaced"}},
+		{From: "Shipping Service", To: "Gateway", Channel: "order.shipped"},
+		{
+			From: "Gateway", To: "Order Service", Channel: "order.create",
+			Messages: []string{"CreateOrder"}, Request: true, Revisit: true,
+		},
+		{From: "Order Service", To: "Gateway", Channel: "order.create.reply", Messages: []string{"OrderCreated"}, Reply: true},
+	}, steps)
+
+	_, err = TraceSequence(schema, "", "")
+	require.Error(t, err)
+
+	_, err = TraceSequence(schema, "Shipping Service", "order.create")
+	require.Error(t, err)
+}
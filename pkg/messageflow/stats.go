@@ -0,0 +1,170 @@
+package messageflow
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// PayloadStats holds complexity metrics of a message payload.
+type PayloadStats struct {
+	// Fields is the number of fields at all nesting levels.
+	Fields int `json:"fields"`
+	// Depth is the maximum nesting level of objects, 1 for a flat object.
+	Depth int `json:"depth"`
+	// ArrayRoot reports whether the payload is an array instead of an object.
+	ArrayRoot bool `json:"array_root"`
+}
+
+// MessageStats holds metrics of a single message.
+type MessageStats struct {
+	Name string `json:"name"`
+	PayloadStats
+}
+
+// ChannelStats holds metrics of messages sent over a channel.
+// Payload metrics are the maximums across the messages of the channel.
+type ChannelStats struct {
+	Channel  string         `json:"channel"`
+	Messages []MessageStats `json:"messages"`
+	PayloadStats
+}
+
+// ServiceStats holds metrics of messages a service sends and receives.
+type ServiceStats struct {
+	Service  string `json:"service"`
+	Channels int    `json:"channels"`
+	Messages int    `json:"messages"`
+	// Fields is the total number of fields across messages of the service.
+	Fields int `json:"fields"`
+	// MaxDepth is the maximum nesting level across messages of the service.
+	MaxDepth int `json:"max_depth"`
+}
+
+// Stats holds payload complexity metrics of a schema.
+type Stats struct {
+	Services []ServiceStats `json:"services"`
+	Channels []ChannelStats `json:"channels"`
+}
+
+// SchemaStats computes payload complexity metrics per service and per channel.
+// Messages are identified by channel and name, payloads which are not valid JSON count as empty.
+// Services and channels are returned sorted by name.
+func SchemaStats(s Schema) Stats {
+	var (
+		channels        = make(map[string]*ChannelStats)
+		channelMessages = make(map[string]map[string]bool)
+		stats           = Stats{
+			Services: []ServiceStats{},
+			Channels: []ChannelStats{},
+		}
+	)
+
+	addMessages := func(channel Channel, service *ServiceStats, serviceChannels, serviceMessages map[string]bool) {
+		cs, ok := channels[channel.Name]
+		if !ok {
+			cs = &ChannelStats{Channel: channel.Name, Messages: []MessageStats{}}
+			channels[channel.Name] = cs
+			channelMessages[channel.Name] = make(map[string]bool)
+		}
+
+		if !serviceChannels[channel.Name] {
+			serviceChannels[channel.Name] = true
+			service.Channels++
+		}
+
+		for _, msg := range channel.Messages {
+			ms := MessageStats{Name: msg.Name, PayloadStats: payloadStats(msg.Payload)}
+
+			if !channelMessages[channel.Name][msg.Name] {
+				channelMessages[channel.Name][msg.Name] = true
+				cs.Messages = append(cs.Messages, ms)
+				cs.Fields = max(cs.Fields, ms.Fields)
+				cs.Depth = max(cs.Depth, ms.Depth)
+				cs.ArrayRoot = cs.ArrayRoot || ms.ArrayRoot
+			}
+
+			key := channel.Name + "/" + msg.Name
+			if !serviceMessages[key] {
+				serviceMessages[key] = true
+				service.Messages++
+				service.Fields += ms.Fields
+				service.MaxDepth = max(service.MaxDepth, ms.Depth)
+			}
+		}
+	}
+
+	for _, service := range s.Services {
+		var (
+			ss              = ServiceStats{Service: service.Name}
+			serviceChannels = make(map[string]bool)
+			serviceMessages = make(map[string]bool)
+		)
+
+		for _, op := range service.Operation {
+			addMessages(op.Channel, &ss, serviceChannels, serviceMessages)
+			if op.Reply != nil {
+				addMessages(*op.Reply, &ss, serviceChannels, serviceMessages)
+			}
+		}
+
+		stats.Services = append(stats.Services, ss)
+	}
+
+	for _, cs := range channels {
+		stats.Channels = append(stats.Channels, *cs)
+	}
+
+	sort.Slice(stats.Services, func(i, j int) bool {
+		return stats.Services[i].Service < stats.Services[j].Service
+	})
+
+	sort.Slice(stats.Channels, func(i, j int) bool {
+		return stats.Channels[i].Channel < stats.Channels[j].Channel
+	})
+
+	return stats
+}
+
+// payloadStats computes metrics of a JSON payload.
+func payloadStats(payload string) PayloadStats {
+	var root any
+	if err := json.Unmarshal([]byte(payload), &root); err != nil {
+		return PayloadStats{}
+	}
+
+	_, isArray := root.([]any)
+	fields, depth := countFields(root)
+
+	return PayloadStats{
+		Fields:    fields,
+		Depth:     depth,
+		ArrayRoot: isArray,
+	}
+}
+
+// countFields returns the number of fields and the object nesting depth of a decoded JSON value.
+// Arrays don't add a nesting level, fields of their items are counted once.
+func countFields(v any) (int, int) {
+	switch value := v.(type) {
+	case map[string]any:
+		fields, depth := len(value), 0
+		for _, field := range value {
+			f, d := countFields(field)
+			fields += f
+			depth = max(depth, d)
+		}
+
+		return fields, depth + 1
+	case []any:
+		fields, depth := 0, 0
+		for _, item := range value {
+			f, d := countFields(item)
+			fields = max(fields, f)
+			depth = max(depth, d)
+		}
+
+		return fields, depth
+	default:
+		return 0, 0
+	}
+}
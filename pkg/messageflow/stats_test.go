@@ -0,0 +1,74 @@
+package messageflow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaStats(t *testing.T) {
+	t.Parallel()
+
+	userCreated := Message{
+		Name: "UserCreated",
+		Payload: `{
+  "user_id": "string[uuid]",
+  "profile": {
+    "name": "string",
+    "address": {
+      "city": "string"
+    }
+  },
+  "tags": ["string"]
+}`,
+	}
+
+	userBatch := Message{
+		Name:    "UserBatch",
+		Payload: `[{"user_id": "string[uuid]"}]`,
+	}
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{Action: ActionSend, Channel: Channel{Name: "user.created", Messages: []Message{userCreated}}},
+					{Action: ActionSend, Channel: Channel{Name: "user.batch", Messages: []Message{userBatch}}},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []Operation{
+					{Action: ActionReceive, Channel: Channel{Name: "user.created", Messages: []Message{userCreated}}},
+					{Action: ActionReceive, Channel: Channel{Name: "user.invalid", Messages: []Message{{Name: "Invalid", Payload: "not json"}}}},
+				},
+			},
+		},
+	}
+
+	expected := Stats{
+		Services: []ServiceStats{
+			{Service: "Analytics Service", Channels: 2, Messages: 2, Fields: 6, MaxDepth: 3},
+			{Service: "User Service", Channels: 2, Messages: 2, Fields: 7, MaxDepth: 3},
+		},
+		Channels: []ChannelStats{
+			{
+				Channel:      "user.batch",
+				Messages:     []MessageStats{{Name: "UserBatch", PayloadStats: PayloadStats{Fields: 1, Depth: 1, ArrayRoot: true}}},
+				PayloadStats: PayloadStats{Fields: 1, Depth: 1, ArrayRoot: true},
+			},
+			{
+				Channel:      "user.created",
+				Messages:     []MessageStats{{Name: "UserCreated", PayloadStats: PayloadStats{Fields: 6, Depth: 3}}},
+				PayloadStats: PayloadStats{Fields: 6, Depth: 3},
+			},
+			{
+				Channel:  "user.invalid",
+				Messages: []MessageStats{{Name: "Invalid"}},
+			},
+		},
+	}
+
+	assert.Equal(t, expected, SchemaStats(schema))
+}
@@ -0,0 +1,224 @@
+package messageflow
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ValidationIssueType represents the type of issue found during schema validation.
+type ValidationIssueType string
+
+const (
+	ValidationIssueNoReceivers         ValidationIssueType = "no_receivers"
+	ValidationIssueNoSenders           ValidationIssueType = "no_senders"
+	ValidationIssueReplyNotConsumed    ValidationIssueType = "reply_not_consumed"
+	ValidationIssueCorrelationMismatch ValidationIssueType = "correlation_mismatch"
+)
+
+// ValidationIssue represents a single integration gap found in the schema.
+type ValidationIssue struct {
+	Type    ValidationIssueType `json:"type"`
+	Service string              `json:"service,omitempty"`
+	Channel string              `json:"channel"`
+	Details string              `json:"details"`
+}
+
+// String returns a human readable representation of the issue.
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", i.Type, i.Details)
+}
+
+// ValidateSchema checks the schema for channels with senders but no receivers,
+// channels with receivers but no senders, replies that are never consumed and
+// requests and replies correlated by different correlation IDs.
+// Issues are returned in a deterministic order.
+func ValidateSchema(s Schema) []ValidationIssue {
+	var (
+		issues    = []ValidationIssue{}
+		senders   = make(map[string][]string)
+		receivers = make(map[string][]string)
+		// requesters holds reply channels awaited by send operations.
+		requesters = make(map[string]bool)
+	)
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			switch op.Action {
+			case ActionSend:
+				senders[op.Channel.Name] = append(senders[op.Channel.Name], service.Name)
+				if op.Reply != nil {
+					requesters[op.Reply.Name] = true
+				}
+			case ActionReceive:
+				receivers[op.Channel.Name] = append(receivers[op.Channel.Name], service.Name)
+			}
+		}
+	}
+
+	channels := make([]string, 0, len(senders)+len(receivers))
+	for channel := range senders {
+		if _, ok := receivers[channel]; !ok {
+			channels = append(channels, channel)
+		}
+	}
+	for channel := range receivers {
+		if _, ok := senders[channel]; !ok {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+
+	for _, channel := range channels {
+		if services, ok := senders[channel]; ok {
+			issues = append(issues, ValidationIssue{
+				Type:    ValidationIssueNoReceivers,
+				Channel: channel,
+				Details: fmt.Sprintf("channel '%s' has senders %v but no receivers", channel, services),
+			})
+			continue
+		}
+
+		issues = append(issues, ValidationIssue{
+			Type:    ValidationIssueNoSenders,
+			Channel: channel,
+			Details: fmt.Sprintf("channel '%s' has receivers %v but no senders", channel, receivers[channel]),
+		})
+	}
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			if op.Action != ActionReceive || op.Reply == nil || requesters[op.Reply.Name] {
+				continue
+			}
+
+			// Channels without senders are already reported above.
+			if len(senders[op.Channel.Name]) == 0 {
+				continue
+			}
+
+			issues = append(issues, ValidationIssue{
+				Type:    ValidationIssueReplyNotConsumed,
+				Service: service.Name,
+				Channel: op.Reply.Name,
+				Details: fmt.Sprintf(
+					"reply on channel '%s' of service '%s' is never consumed",
+					op.Reply.Name, service.Name,
+				),
+			})
+		}
+	}
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			if op.Reply == nil {
+				continue
+			}
+
+			if issue, ok := correlationMismatch(service.Name, op); ok {
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	return issues
+}
+
+// correlationMismatch reports a request and reply of the operation using different correlation IDs,
+// including one side having a correlation ID and the other not.
+func correlationMismatch(service string, op Operation) (ValidationIssue, bool) {
+	for _, request := range op.Channel.Messages {
+		for _, reply := range op.Reply.Messages {
+			if request.CorrelationID == reply.CorrelationID {
+				continue
+			}
+
+			return ValidationIssue{
+				Type:    ValidationIssueCorrelationMismatch,
+				Service: service,
+				Channel: op.Reply.Name,
+				Details: fmt.Sprintf(
+					"reply '%s' on channel '%s' of service '%s' is correlated by %s, request '%s' on channel '%s' by %s",
+					reply.Name, op.Reply.Name, service, correlationIDString(reply.CorrelationID),
+					request.Name, op.Channel.Name, correlationIDString(request.CorrelationID),
+				),
+			}, true
+		}
+	}
+
+	return ValidationIssue{}, false
+}
+
+func correlationIDString(correlationID string) string {
+	if correlationID == "" {
+		return "no correlation id"
+	}
+
+	return fmt.Sprintf("'%s'", correlationID)
+}
+
+// Validate checks structural invariants of the schema: operation channels and replies are named,
+// operations within a service are unique and messages have payloads. Send operations with a reply
+// are valid, they describe requesters of request/reply channels.
+// Violations are returned joined into a single error, nil if the schema is valid.
+func (s Schema) Validate() error {
+	var errs []error
+
+	for _, service := range s.Services {
+		var (
+			keys = make(map[string]bool)
+			ids  = make(map[string]bool)
+		)
+
+		for i, op := range service.Operation {
+			if op.Channel.Name == "" {
+				errs = append(errs, fmt.Errorf("service '%s': operation #%d has empty channel name", service.Name, i+1))
+			}
+
+			if op.Reply != nil && op.Reply.Name == "" {
+				errs = append(errs, fmt.Errorf(
+					"service '%s': operation #%d on channel '%s' has empty reply channel name",
+					service.Name, i+1, op.Channel.Name,
+				))
+			}
+
+			if key := synthesizedOperationKey(op); keys[key] {
+				errs = append(errs, fmt.Errorf(
+					"service '%s': duplicate %s operation on channel '%s'",
+					service.Name, op.Action, op.Channel.Name,
+				))
+			} else {
+				keys[key] = true
+			}
+
+			if op.ID != "" {
+				if ids[op.ID] {
+					errs = append(errs, fmt.Errorf("service '%s': duplicate operation id '%s'", service.Name, op.ID))
+				}
+				ids[op.ID] = true
+			}
+
+			errs = append(errs, validateMessages(service.Name, op.Channel)...)
+			if op.Reply != nil {
+				errs = append(errs, validateMessages(service.Name, *op.Reply)...)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateMessages(service string, channel Channel) []error {
+	var errs []error
+
+	for _, msg := range channel.Messages {
+		if msg.Payload == "" {
+			errs = append(errs, fmt.Errorf(
+				"service '%s': message '%s' on channel '%s' has empty payload",
+				service, msg.Name, channel.Name,
+			))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,172 @@
+package messageflow
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name: "Notification Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "notification.analytics"},
+					},
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "notification.sent"},
+					},
+					{
+						Action:  ActionReceive,
+						Channel: Channel{Name: "notification.preferences.get"},
+						Reply:   &Channel{Name: "notification.preferences.get"},
+					},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []Operation{
+					{
+						Action:  ActionReceive,
+						Channel: Channel{Name: "notification.analytics"},
+					},
+					{
+						Action:  ActionReceive,
+						Channel: Channel{Name: "user.created"},
+					},
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "notification.preferences.get"},
+					},
+				},
+			},
+		},
+	}
+
+	expected := []ValidationIssue{
+		{
+			Type:    ValidationIssueNoReceivers,
+			Channel: "notification.sent",
+			Details: "channel 'notification.sent' has senders [Notification Service] but no receivers",
+		},
+		{
+			Type:    ValidationIssueNoSenders,
+			Channel: "user.created",
+			Details: "channel 'user.created' has receivers [Analytics Service] but no senders",
+		},
+		{
+			Type:    ValidationIssueReplyNotConsumed,
+			Service: "Notification Service",
+			Channel: "notification.preferences.get",
+			Details: "reply on channel 'notification.preferences.get' of service 'Notification Service' is never consumed",
+		},
+	}
+
+	assert.Equal(t, expected, ValidateSchema(schema))
+}
+
+func TestValidateSchemaCorrelationMismatch(t *testing.T) {
+	t.Parallel()
+
+	operation := func(action Action, requestCorrelationID, replyCorrelationID string) Operation {
+		return Operation{
+			Action: action,
+			Channel: Channel{
+				Name:     "user.info",
+				Messages: []Message{{Name: "UserInfoRequest", CorrelationID: requestCorrelationID}},
+			},
+			Reply: &Channel{
+				Name:     "user.info.reply",
+				Messages: []Message{{Name: "UserInfoReply", CorrelationID: replyCorrelationID}},
+			},
+		}
+	}
+
+	schema := Schema{
+		Services: []Service{
+			{
+				Name:      "Notification Service",
+				Operation: []Operation{operation(ActionSend, "$message.header#/correlationId", "$message.header#/correlationId")},
+			},
+			{
+				Name:      "User Service",
+				Operation: []Operation{operation(ActionReceive, "$message.header#/correlationId", "")},
+			},
+		},
+	}
+
+	assert.Equal(t, []ValidationIssue{
+		{
+			Type:    ValidationIssueCorrelationMismatch,
+			Service: "User Service",
+			Channel: "user.info.reply",
+			Details: "reply 'UserInfoReply' on channel 'user.info.reply' of service 'User Service' is correlated by " +
+				"no correlation id, request 'UserInfoRequest' on channel 'user.info' by '$message.header#/correlationId'",
+		},
+	}, ValidateSchema(schema))
+}
+
+func TestSchemaValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.info", Messages: []Message{{Name: "UserInfoRequest", Payload: "{}"}}},
+						Reply:   &Channel{Name: "user.info.reply", Messages: []Message{{Name: "UserInfo", Payload: "{}"}}},
+					},
+				},
+			},
+		},
+	}
+	assert.NoError(t, valid.Validate())
+
+	invalid := Schema{
+		Services: []Service{
+			{
+				Name: "User Service",
+				Operation: []Operation{
+					{
+						Action:  ActionSend,
+						Channel: Channel{},
+					},
+					{
+						ID:      "sendUserCreated",
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated"}}},
+					},
+					{
+						ID:      "sendUserCreated",
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated", Payload: "{}"}}},
+						Reply:   &Channel{},
+					},
+					{
+						Action:  ActionSend,
+						Channel: Channel{Name: "user.created", Messages: []Message{{Name: "UserCreated", Payload: "{}"}}},
+					},
+				},
+			},
+		},
+	}
+
+	err := invalid.Validate()
+	assert.EqualError(t, err, strings.Join([]string{
+		"service 'User Service': operation #1 has empty channel name",
+		"service 'User Service': message 'UserCreated' on channel 'user.created' has empty payload",
+		"service 'User Service': operation #3 on channel 'user.created' has empty reply channel name",
+		"service 'User Service': duplicate operation id 'sendUserCreated'",
+		"service 'User Service': duplicate send operation on channel 'user.created'",
+	}, "\n"))
+}
@@ -2,34 +2,462 @@ package schema
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/holydocs/messageflow/pkg/internal/gitref"
 	"github.com/holydocs/messageflow/pkg/messageflow"
 	"github.com/holydocs/messageflow/pkg/schema/source/asyncapi"
+	"github.com/holydocs/messageflow/pkg/schema/source/snapshot"
+	"gopkg.in/yaml.v3"
 )
 
-func Load(ctx context.Context, paths []string) (messageflow.Schema, error) {
+// LoadOpt is a function type that allows customization of schema loading.
+type LoadOpt func(*loadOptions)
+
+type loadOptions struct {
+	strict             bool
+	rawPayloads        bool
+	payloadConstraints bool
+	typeFormatter      asyncapi.TypeFormatter
+	channelConsistency bool
+	nameMap            map[string]string
+	environment        string
+	sourceOrder        bool
+	reportExamples     func(path string, mismatch asyncapi.ExampleMismatch)
+	logger             *slog.Logger
+}
+
+// WithLogger returns a LoadOpt that sets the logger reporting loaded files at debug level, slog.Default by default.
+func WithLogger(logger *slog.Logger) LoadOpt {
+	return func(o *loadOptions) {
+		o.logger = logger
+	}
+}
+
+// WithStrict returns a LoadOpt that validates the loaded schema with messageflow.Schema.Validate,
+// failing on malformed schemas instead of passing them to targets.
+func WithStrict(strict bool) LoadOpt {
+	return func(o *loadOptions) {
+		o.strict = strict
+	}
+}
+
+// WithRawPayloads returns a LoadOpt that keeps message payloads as JSON schemas, see asyncapi.WithRawPayloads.
+func WithRawPayloads(rawPayloads bool) LoadOpt {
+	return func(o *loadOptions) {
+		o.rawPayloads = rawPayloads
+	}
+}
+
+// WithPayloadConstraints returns a LoadOpt that keeps constraints such as required fields in flattened payloads,
+// see asyncapi.WithPayloadConstraints.
+func WithPayloadConstraints(payloadConstraints bool) LoadOpt {
+	return func(o *loadOptions) {
+		o.payloadConstraints = payloadConstraints
+	}
+}
+
+// WithTypeFormatter returns a LoadOpt that formats fields of flattened payloads with the formatter,
+// see asyncapi.WithTypeFormatter.
+func WithTypeFormatter(formatter asyncapi.TypeFormatter) LoadOpt {
+	return func(o *loadOptions) {
+		o.typeFormatter = formatter
+	}
+}
+
+// WithValidateExamples returns a LoadOpt that validates message examples of AsyncAPI files against payload schemas
+// of the messages, see asyncapi.WithValidateExamples, passing mismatches to report along with the file path.
+// Examples aren't validated when report is nil.
+func WithValidateExamples(report func(path string, mismatch asyncapi.ExampleMismatch)) LoadOpt {
+	return func(o *loadOptions) {
+		o.reportExamples = report
+	}
+}
+
+// WithChannelConsistency returns a LoadOpt that additionally reports messages carrying different payloads
+// in services sharing a channel as conflicts, see messageflow.ChannelPayloadConflicts.
+func WithChannelConsistency(check bool) LoadOpt {
+	return func(o *loadOptions) {
+		o.channelConsistency = check
+	}
+}
+
+// WithNameMap returns a LoadOpt that renames services before schemas are merged, so services titled
+// inconsistently across files aren't split. Keys are file paths, as passed to Load, or service names
+// taken from titles, values are canonical service names. Paths take precedence over names,
+// unmapped services keep their names. Loading fails when a path key matches a file with several services.
+func WithNameMap(nameMap map[string]string) LoadOpt {
+	return func(o *loadOptions) {
+		o.nameMap = nameMap
+	}
+}
+
+// WithEnvironment returns a LoadOpt that keeps only channels available on the server of the environment,
+// e.g. staging, see messageflow.Schema.ForEnvironment. Loading fails when no channel is available on the server.
+func WithEnvironment(env string) LoadOpt {
+	return func(o *loadOptions) {
+		o.environment = env
+	}
+}
+
+// WithSourceOrder returns a LoadOpt that keeps operations in the order they are defined in the files,
+// see messageflow.MergeSchemasInOrder, instead of sorting them. Services are sorted by name either way.
+func WithSourceOrder(sourceOrder bool) LoadOpt {
+	return func(o *loadOptions) {
+		o.sourceOrder = sourceOrder
+	}
+}
+
+// Load extracts schemas from AsyncAPI files, or schemas serialized as JSON such as messageflow.json,
+// and merges them into a single sorted schema like messageflow.MergeSchemas, keeping the last definition
+// of operations defined in several files.
+// Loading stops with the context error once the context is cancelled.
+func Load(ctx context.Context, paths []string, opts ...LoadOpt) (messageflow.Schema, error) {
+	s, _, err := LoadWithConflicts(ctx, paths, opts...)
+	return s, err
+}
+
+// LoadWithConflicts works like Load, additionally reporting operations defined differently across files
+// and, with WithChannelConsistency, messages defined differently by services sharing a channel.
+func LoadWithConflicts(
+	ctx context.Context,
+	paths []string,
+	opts ...LoadOpt,
+) (messageflow.Schema, []messageflow.MergeConflict, error) {
+	o := loadOptions{
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	schemas := make([]messageflow.Schema, 0, len(paths))
 
 	for _, filePath := range paths {
 		trimmedPath := strings.TrimSpace(filePath)
 
-		s, err := asyncapi.NewSource(trimmedPath)
+		if err := ctx.Err(); err != nil {
+			return messageflow.Schema{}, nil, fmt.Errorf("error loading schema from %s: %w", trimmedPath, err)
+		}
+
+		start := time.Now()
+
+		s, err := newSource(trimmedPath, o)
 		if err != nil {
-			return messageflow.Schema{}, fmt.Errorf("error creating schema source from %s: %w", trimmedPath, err)
+			return messageflow.Schema{}, nil, fmt.Errorf("error creating schema source from %s: %w", trimmedPath, err)
 		}
 
-		schema, err := s.ExtractSchema(ctx)
+		schema, err := extractSchema(ctx, s, trimmedPath, o)
 		if err != nil {
-			return messageflow.Schema{}, fmt.Errorf("error extracting schema from %s: %w", trimmedPath, err)
+			return messageflow.Schema{}, nil, fmt.Errorf("error extracting schema from %s: %w", trimmedPath, err)
+		}
+
+		o.logger.DebugContext(ctx, "loaded schema",
+			slog.String("path", trimmedPath),
+			slog.Int("services", len(schema.Services)),
+			slog.Duration("duration", time.Since(start)))
+
+		if err := renameServices(&schema, trimmedPath, o.nameMap); err != nil {
+			return messageflow.Schema{}, nil, err
 		}
 
 		schemas = append(schemas, schema)
 	}
 
-	mergedSchema := messageflow.MergeSchemas(schemas...)
-	mergedSchema.Sort()
+	var mergedSchema messageflow.Schema
+	if o.sourceOrder {
+		mergedSchema = messageflow.MergeSchemasInOrder(schemas...)
+		mergedSchema.SortServices()
+	} else {
+		mergedSchema = messageflow.MergeSchemas(schemas...)
+	}
+
+	conflicts := messageflow.MergeConflicts(schemas...)
+
+	if o.environment != "" {
+		environments := mergedSchema.Environments()
+		if !slices.Contains(environments, o.environment) {
+			return messageflow.Schema{}, nil, fmt.Errorf("unknown environment '%s', available: %s",
+				o.environment, strings.Join(environments, ", "))
+		}
+
+		mergedSchema = mergedSchema.ForEnvironment(o.environment)
+	}
+
+	if o.channelConsistency {
+		conflicts = append(conflicts, messageflow.ChannelPayloadConflicts(mergedSchema)...)
+	}
+
+	if o.strict {
+		if err := mergedSchema.Validate(); err != nil {
+			return messageflow.Schema{}, nil, fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+
+	return mergedSchema, conflicts, nil
+}
+
+// LoadAtRef works like Load, reading the files as of the git ref, e.g. main, in the repository of the working
+// directory instead of the working tree. The repository is checked out at the ref into a temporary directory,
+// so AsyncAPI files referencing other files by relative paths resolve them as of the ref too.
+// Files missing on the ref are skipped, so a baseline without any of them is an empty schema.
+func LoadAtRef(ctx context.Context, ref string, paths []string, opts ...LoadOpt) (messageflow.Schema, error) {
+	o := loadOptions{
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "messageflow-ref-")
+	if err != nil {
+		return messageflow.Schema{}, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	refDir, err := gitref.Checkout(ctx, ".", ref, tmpDir)
+	if err != nil {
+		return messageflow.Schema{}, err
+	}
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		return messageflow.Schema{}, fmt.Errorf("error getting working directory: %w", err)
+	}
+
+	nameMap := maps.Clone(o.nameMap)
+	refPaths := make([]string, 0, len(paths))
+	origPaths := make(map[string]string, len(paths))
+
+	for _, filePath := range paths {
+		trimmedPath := strings.TrimSpace(filePath)
+
+		relPath := trimmedPath
+		if filepath.IsAbs(relPath) {
+			if relPath, err = filepath.Rel(workDir, relPath); err != nil {
+				return messageflow.Schema{}, fmt.Errorf("error resolving %s relative to %s: %w", trimmedPath, workDir, err)
+			}
+		}
+
+		refPath := filepath.Join(refDir, relPath)
+		if rel, err := filepath.Rel(tmpDir, refPath); err != nil || !filepath.IsLocal(rel) {
+			return messageflow.Schema{}, fmt.Errorf("%s is outside of the git repository", trimmedPath)
+		}
+
+		if _, err := os.Stat(refPath); err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return messageflow.Schema{}, fmt.Errorf("error reading %s at git ref %s: %w", trimmedPath, ref, err)
+			}
+
+			o.logger.WarnContext(ctx, "file doesn't exist at git ref, skipping it",
+				slog.String("path", trimmedPath), slog.String("ref", ref))
+			continue
+		}
+
+		for _, key := range []string{trimmedPath, filepath.Clean(trimmedPath)} {
+			if name, ok := o.nameMap[key]; ok {
+				nameMap[refPath] = name
+			}
+		}
+
+		origPaths[refPath] = trimmedPath
+		refPaths = append(refPaths, refPath)
+	}
+
+	if len(refPaths) == 0 {
+		return messageflow.Schema{}, nil
+	}
+
+	opts = append(opts, WithNameMap(nameMap))
+
+	// Example mismatches are reported with the paths they were passed as.
+	if report := o.reportExamples; report != nil {
+		opts = append(opts, WithValidateExamples(func(path string, mismatch asyncapi.ExampleMismatch) {
+			report(origPaths[path], mismatch)
+		}))
+	}
+
+	return Load(ctx, refPaths, opts...)
+}
+
+// renameServices renames services of the schema loaded from path according to the name map, see WithNameMap.
+// Path keys can't rename files with several services, e.g. schema JSON files, which would end up sharing a name.
+func renameServices(schema *messageflow.Schema, path string, nameMap map[string]string) error {
+	if len(nameMap) == 0 {
+		return nil
+	}
+
+	pathName, ok := nameMap[path]
+	if !ok {
+		pathName, ok = nameMap[filepath.Clean(path)]
+	}
+
+	if ok && len(schema.Services) > 1 {
+		return fmt.Errorf("name map renames %s with %d services to '%s', map their service names instead",
+			path, len(schema.Services), pathName)
+	}
+
+	for i, service := range schema.Services {
+		if ok {
+			schema.Services[i].Name = pathName
+			continue
+		}
+
+		if name, ok := nameMap[service.Name]; ok {
+			schema.Services[i].Name = name
+		}
+	}
+
+	return nil
+}
+
+// LoadNameMap reads a name map for WithNameMap from a YAML or JSON file
+// mapping file paths or service names to canonical service names.
+func LoadNameMap(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading name map %s: %w", path, err)
+	}
+
+	// JSON name maps are valid YAML, so both are decoded the same way.
+	var nameMap map[string]string
+	if err := yaml.Unmarshal(content, &nameMap); err != nil {
+		return nil, fmt.Errorf("error unmarshalling name map %s: %w", path, err)
+	}
+
+	for key, name := range nameMap {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("empty service name for %s in name map %s", key, path)
+		}
+	}
+
+	return nameMap, nil
+}
+
+// LoadIgnoreFile reads service:channel:field patterns of changes to leave out of changelogs, see
+// messageflow.WithIgnorePatterns, from a file such as .messageflowignore. Each line holds a pattern,
+// blank lines and lines starting with # are skipped.
+func LoadIgnoreFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ignore file %s: %w", path, err)
+	}
+
+	var patterns []string
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		for _, segment := range strings.SplitN(line, ":", 3) {
+			if strings.TrimSpace(segment) == "" {
+				return nil, fmt.Errorf("empty segment in pattern '%s' on line %d of ignore file %s, use * to match anything",
+					line, i+1, path)
+			}
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	return patterns, nil
+}
+
+// extractSchema extracts the schema of the source loaded from path, reporting mismatching message examples
+// of AsyncAPI sources when WithValidateExamples is used.
+func extractSchema(ctx context.Context, s messageflow.Source, path string, o loadOptions) (messageflow.Schema, error) {
+	source, ok := s.(*asyncapi.Source)
+	if !ok || o.reportExamples == nil {
+		return s.ExtractSchema(ctx)
+	}
+
+	schema, mismatches, err := source.ExtractSchemaWithWarnings(ctx)
+	if err != nil {
+		return messageflow.Schema{}, err
+	}
+
+	for _, mismatch := range mismatches {
+		o.reportExamples(path, mismatch)
+	}
+
+	return schema, nil
+}
+
+// newSource creates a source for the file, schemas serialized as JSON (e.g. messageflow.json)
+// are loaded as they are, other files are AsyncAPI specifications.
+func newSource(path string, o loadOptions) (messageflow.Source, error) {
+	if snapshot.IsSnapshot(path) {
+		return snapshot.NewSource(path)
+	}
+
+	return asyncapi.NewSource(path,
+		asyncapi.WithRawPayloads(o.rawPayloads),
+		asyncapi.WithPayloadConstraints(o.payloadConstraints),
+		asyncapi.WithTypeFormatter(o.typeFormatter),
+		asyncapi.WithValidateExamples(o.reportExamples != nil),
+	)
+}
+
+// FindAsyncAPIFiles walks the directory for AsyncAPI specifications, YAML and JSON files
+// with an asyncapi key. It fails if none are found.
+func FindAsyncAPIFiles(dir string) ([]string, error) {
+	var asyncAPIFiles []string
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".yml" && ext != ".yaml" && ext != ".json" {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading file %s: %w", path, err)
+		}
+
+		// JSON specs are valid YAML, so the asyncapi key is checked the same way. Documents which aren't
+		// mappings, e.g. JSON arrays of fixtures next to specs, aren't specs and are skipped.
+		var doc interface{}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return fmt.Errorf("error unmarshalling yaml file %s: %w", path, err)
+		}
+
+		yamlDoc, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		if _, hasAsyncAPI := yamlDoc["asyncapi"]; hasAsyncAPI {
+			asyncAPIFiles = append(asyncAPIFiles, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory %s: %w", dir, err)
+	}
+
+	if len(asyncAPIFiles) == 0 {
+		return nil, fmt.Errorf("no AsyncAPI specification files found in directory %s", dir)
+	}
 
-	return mergedSchema, nil
+	return asyncAPIFiles, nil
 }
@@ -0,0 +1,276 @@
+package schema
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/source/asyncapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadNameMap(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	nameMapPath := filepath.Join(dir, "names.yaml")
+	require.NoError(t, os.WriteFile(nameMapPath, []byte(
+		"source/asyncapi/testdata/user.yaml: Accounts\n"+
+			"Notification Service: notif-svc\n"+
+			"Campaign Service: notif-svc\n"), 0600))
+
+	nameMap, err := LoadNameMap(nameMapPath)
+	require.NoError(t, err)
+
+	s, err := Load(context.Background(), []string{
+		"./source/asyncapi/testdata/user.yaml",
+		"source/asyncapi/testdata/notification.yaml",
+		"source/asyncapi/testdata/campaign.yaml",
+		"source/asyncapi/testdata/analytics.yaml",
+	}, WithNameMap(nameMap))
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(s.Services))
+	for _, service := range s.Services {
+		names = append(names, service.Name)
+	}
+	assert.Equal(t, []string{"Accounts", "Analytics Service", "notif-svc"}, names)
+
+	emptyPath := filepath.Join(dir, "empty.json")
+	require.NoError(t, os.WriteFile(emptyPath, []byte(`{"User Service": " "}`), 0600))
+
+	_, err = LoadNameMap(emptyPath)
+	require.EqualError(t, err, "empty service name for User Service in name map "+emptyPath)
+}
+
+func TestFindAsyncAPIFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	spec, err := os.ReadFile("source/asyncapi/testdata/user.yaml")
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"user.yaml":     string(spec),
+		"spec.json":     `{"asyncapi": "3.0.0", "info": {"title": "Spec", "version": "1.0.0"}}`,
+		"fixtures.json": `[{"id": "1"}, {"id": "2"}]`,
+		"catalog.json":  `"catalog"`,
+		"config.yaml":   "debug: true\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	found, err := FindAsyncAPIFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "spec.json"), filepath.Join(dir, "user.yaml")}, found)
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ignorePath := filepath.Join(dir, ".messageflowignore")
+	require.NoError(t, os.WriteFile(ignorePath, []byte(
+		"# churny fields\n"+
+			"*:*:metadata.*\n"+
+			"\n"+
+			"  Legacy Service  \n"), 0600))
+
+	patterns, err := LoadIgnoreFile(ignorePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*:*:metadata.*", "Legacy Service"}, patterns)
+
+	invalidPath := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(invalidPath, []byte("*:*:id\nUser Service::id\n"), 0600))
+
+	_, err = LoadIgnoreFile(invalidPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	_, err = LoadIgnoreFile(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	t.Parallel()
+
+	specPath := filepath.Join(t.TempDir(), "user.yaml")
+	require.NoError(t, os.WriteFile(specPath, []byte(`asyncapi: 3.0.0
+info:
+  title: User Service
+  version: 1.0.0
+servers:
+  production:
+    host: kafka.example.com:9092
+    protocol: kafka
+  staging:
+    host: kafka.staging.example.com:9092
+    protocol: kafka
+channels:
+  user.created:
+    address: user.created
+    messages:
+      UserCreated:
+        payload:
+          type: string
+  user.debug:
+    address: user.debug
+    servers:
+      - $ref: '#/servers/staging'
+    messages:
+      UserDebug:
+        payload:
+          type: string
+operations:
+  sendUserCreated:
+    action: send
+    channel:
+      $ref: '#/channels/user.created'
+    messages:
+      - $ref: '#/channels/user.created/messages/UserCreated'
+  sendUserDebug:
+    action: send
+    channel:
+      $ref: '#/channels/user.debug'
+    messages:
+      - $ref: '#/channels/user.debug/messages/UserDebug'
+`), 0600))
+
+	s, err := Load(context.Background(), []string{specPath})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"production", "staging"}, s.Environments())
+
+	s, err = Load(context.Background(), []string{specPath}, WithEnvironment("production"))
+	require.NoError(t, err)
+	require.Len(t, s.Services, 1)
+	assert.Equal(t, []string{"user.created"}, s.ChannelNames())
+
+	s, err = Load(context.Background(), []string{specPath}, WithEnvironment("staging"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.created", "user.debug"}, s.ChannelNames())
+
+}
+
+func TestLoadValidateExamples(t *testing.T) {
+	t.Parallel()
+
+	type mismatch struct {
+		path    string
+		message string
+	}
+
+	var mismatches []mismatch
+
+	_, err := Load(context.Background(), []string{"source/asyncapi/testdata/orders.yaml"},
+		WithValidateExamples(func(path string, m asyncapi.ExampleMismatch) {
+			mismatches = append(mismatches, mismatch{path: path, message: m.Message})
+		}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []mismatch{{path: "source/asyncapi/testdata/orders.yaml", message: "OrderPlacedMessage"}}, mismatches)
+}
+
+func TestLoadWithConflicts(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, payload string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(`{"services": [{"name": "User Service", "operations": [
+			{"action": "send", "channel": {"name": "user.created", "messages": [{"name": "UserCreated", "payload": "`+payload+`"}]}}
+		]}]}`), 0644))
+
+		return path
+	}
+
+	paths := []string{write("v1.json", "v1"), write("v2.json", "v2")}
+
+	s, conflicts, err := LoadWithConflicts(context.Background(), paths)
+	require.NoError(t, err)
+
+	require.Len(t, s.Services, 1)
+	require.Len(t, s.Services[0].Operation, 1)
+	assert.Equal(t, "v2", s.Services[0].Operation[0].Channel.Messages[0].Payload)
+
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "User Service", conflicts[0].Service)
+}
+
+func TestLoadAtRef(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	run := func(args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	specs := filepath.Join(dir, "specs")
+	for _, name := range []string{"billing.yaml", "components/messages.yaml", "components/schemas.yaml"} {
+		content, err := os.ReadFile(filepath.Join("source/asyncapi/testdata/external", name))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(specs, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(specs, name), content, 0644))
+	}
+
+	run("init", "-q", "-b", "main")
+	run("add", "-A")
+	run("commit", "-q", "-m", "baseline")
+
+	// Referenced files are read as of the ref, not from the working tree.
+	require.NoError(t, os.RemoveAll(filepath.Join(specs, "components")))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(specs))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+
+	s, err := LoadAtRef(ctx, "main", []string{"billing.yaml", "missing.yaml"})
+	require.NoError(t, err)
+
+	require.Len(t, s.Services, 1)
+	assert.Equal(t, "Billing Service", s.Services[0].Name)
+	require.NotEmpty(t, s.Services[0].Operation)
+	require.Len(t, s.Services[0].Operation[0].Channel.Messages, 1)
+	assert.Equal(t, "InvoiceCreatedMessage", s.Services[0].Operation[0].Channel.Messages[0].Name)
+
+	s, err = LoadAtRef(ctx, "main", []string{filepath.Join(specs, "billing.yaml")},
+		WithNameMap(map[string]string{filepath.Join(specs, "billing.yaml"): "Invoicing"}))
+	require.NoError(t, err)
+
+	require.Len(t, s.Services, 1)
+	assert.Equal(t, "Invoicing", s.Services[0].Name)
+
+	_, err = LoadAtRef(ctx, "unknown", []string{"billing.yaml"})
+	require.ErrorContains(t, err, "error resolving git ref unknown")
+}
+
+func TestRenameServices(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{Services: []messageflow.Service{{Name: "notif-svc"}, {Name: "Billing"}}}
+	require.NoError(t, renameServices(&schema, "specs/notification.yaml",
+		map[string]string{"notif-svc": "Notification Service"}))
+	assert.Equal(t, "Notification Service", schema.Services[0].Name)
+	assert.Equal(t, "Billing", schema.Services[1].Name)
+
+	err := renameServices(&schema, "specs/notification.yaml", map[string]string{"specs/notification.yaml": "Notifications"})
+	require.EqualError(t, err, "name map renames specs/notification.yaml with 2 services to 'Notifications', "+
+		"map their service names instead")
+	assert.Equal(t, "Notification Service", schema.Services[0].Name)
+
+	schema = messageflow.Schema{Services: []messageflow.Service{{Name: "notif-svc"}}}
+	require.NoError(t, renameServices(&schema, "./specs/notification.yaml",
+		map[string]string{"specs/notification.yaml": "Notifications"}))
+	assert.Equal(t, "Notifications", schema.Services[0].Name)
+}
@@ -0,0 +1,309 @@
+// Package amqp provides functionality for extracting message flow schemas from RabbitMQ
+// topology definitions, such as definitions.json exported by the management plugin.
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/source/internal/jsonschema"
+)
+
+// Ensure Source implements messageflow interfaces.
+var (
+	_ messageflow.Source = (*Source)(nil)
+)
+
+// Binding destination types.
+const (
+	DestinationQueue    = "queue"
+	DestinationExchange = "exchange"
+)
+
+// Definitions describes the broker topology, only fields used for extraction are decoded.
+// Virtual hosts are ignored, names are expected to be unique across them.
+type Definitions struct {
+	Exchanges []Exchange `json:"exchanges"`
+	Queues    []Queue    `json:"queues"`
+	Bindings  []Binding  `json:"bindings"`
+}
+
+// Exchange is an exchange definition.
+type Exchange struct {
+	Name  string `json:"name"`
+	VHost string `json:"vhost"`
+	Type  string `json:"type"`
+}
+
+// Queue is a queue definition.
+type Queue struct {
+	Name  string `json:"name"`
+	VHost string `json:"vhost"`
+}
+
+// Binding routes messages from the source exchange to a queue or another exchange.
+type Binding struct {
+	Source          string `json:"source"`
+	VHost           string `json:"vhost"`
+	Destination     string `json:"destination"`
+	DestinationType string `json:"destination_type"`
+	RoutingKey      string `json:"routing_key"`
+}
+
+// ServiceEndpoints lists exchanges a service publishes to and queues it consumes from.
+type ServiceEndpoints struct {
+	Publishes []string
+	Consumes  []string
+}
+
+// QueueServiceStrategy maps a queue to the service consuming from it.
+// It returns false for queues without a known consumer.
+type QueueServiceStrategy func(queue string) (string, bool)
+
+// DefaultQueueServiceStrategy takes the consuming service from the queue name up to the first dot,
+// e.g. "notification-service.user-created" is consumed by "notification-service".
+func DefaultQueueServiceStrategy(queue string) (string, bool) {
+	service, _, ok := strings.Cut(queue, ".")
+	return service, ok && service != ""
+}
+
+// Source represents a RabbitMQ definitions file for schema extraction.
+type Source struct {
+	path                 string
+	services             map[string]ServiceEndpoints
+	queueServiceStrategy QueueServiceStrategy
+	schemas              map[string]json.RawMessage
+}
+
+// SourceOpt is a function type that allows customization of a Source instance.
+type SourceOpt func(*Source)
+
+// WithServices returns a SourceOpt that sets exchanges published to and queues consumed by each service.
+// Publishers can't be inferred from the topology, so without this mapping the extracted schema
+// contains no senders. Queues listed here aren't mapped by the QueueServiceStrategy.
+func WithServices(services map[string]ServiceEndpoints) SourceOpt {
+	return func(s *Source) {
+		s.services = services
+	}
+}
+
+// WithQueueServiceStrategy returns a SourceOpt that sets how queues are mapped to consuming services.
+// DefaultQueueServiceStrategy is used by default.
+func WithQueueServiceStrategy(strategy QueueServiceStrategy) SourceOpt {
+	return func(s *Source) {
+		s.queueServiceStrategy = strategy
+	}
+}
+
+// WithSchemas returns a SourceOpt that sets JSON schemas of messages published to exchanges,
+// by exchange name. Channels of exchanges without schema have no messages.
+func WithSchemas(schemas map[string]json.RawMessage) SourceOpt {
+	return func(s *Source) {
+		s.schemas = schemas
+	}
+}
+
+// NewSource creates a new AMQP source reading RabbitMQ definitions from the file at path.
+func NewSource(path string, opts ...SourceOpt) (*Source, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("reading definitions %s: %w", path, err)
+	}
+
+	s := &Source{
+		path:                 path,
+		queueServiceStrategy: DefaultQueueServiceStrategy,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// ExtractSchema extracts messageflow schema from the definitions.
+// Each exchange becomes a channel, services publishing to an exchange send to its channel and
+// services consuming from a queue receive from channels of all exchanges routing to the queue.
+func (s *Source) ExtractSchema(_ context.Context) (messageflow.Schema, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return messageflow.Schema{}, fmt.Errorf("reading definitions %s: %w", s.path, err)
+	}
+
+	var defs Definitions
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return messageflow.Schema{}, fmt.Errorf("unmarshalling definitions %s: %w", s.path, err)
+	}
+
+	consumers := s.queueConsumers(defs)
+
+	channels := make(map[string]messageflow.Channel)
+	channel := func(exchange string) (messageflow.Channel, error) {
+		if ch, ok := channels[exchange]; ok {
+			return ch, nil
+		}
+
+		ch, err := s.exchangeChannel(exchange)
+		if err != nil {
+			return messageflow.Channel{}, fmt.Errorf("exchange %s: %w", exchange, err)
+		}
+		channels[exchange] = ch
+
+		return ch, nil
+	}
+
+	operations := make(map[string][]messageflow.Operation)
+
+	for name, endpoints := range s.services {
+		exchanges := slices.Clone(endpoints.Publishes)
+		sort.Strings(exchanges)
+
+		for _, exchange := range slices.Compact(exchanges) {
+			ch, err := channel(exchange)
+			if err != nil {
+				return messageflow.Schema{}, err
+			}
+
+			operations[name] = append(operations[name], messageflow.Operation{
+				Action:  messageflow.ActionSend,
+				Channel: ch,
+			})
+		}
+	}
+
+	for name, queues := range consumers {
+		var exchanges []string
+		for _, queue := range queues {
+			exchanges = append(exchanges, upstreamExchanges(defs.Bindings, DestinationQueue, queue, nil)...)
+		}
+		sort.Strings(exchanges)
+
+		for _, exchange := range slices.Compact(exchanges) {
+			ch, err := channel(exchange)
+			if err != nil {
+				return messageflow.Schema{}, err
+			}
+
+			operations[name] = append(operations[name], messageflow.Operation{
+				Action:  messageflow.ActionReceive,
+				Channel: ch,
+			})
+		}
+	}
+
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := make([]messageflow.Service, 0, len(names))
+	for _, name := range names {
+		services = append(services, messageflow.Service{
+			Name:      name,
+			Operation: operations[name],
+		})
+	}
+
+	return messageflow.Schema{
+		Services: services,
+	}, nil
+}
+
+// queueConsumers returns queues consumed by each service, from the service mapping
+// or the queue service strategy for queues not mapped explicitly.
+func (s *Source) queueConsumers(defs Definitions) map[string][]string {
+	consumers := make(map[string][]string)
+	mapped := make(map[string]bool)
+
+	for name, endpoints := range s.services {
+		for _, queue := range endpoints.Consumes {
+			consumers[name] = append(consumers[name], queue)
+			mapped[queue] = true
+		}
+	}
+
+	for _, queue := range defs.Queues {
+		if mapped[queue.Name] {
+			continue
+		}
+
+		if name, ok := s.queueServiceStrategy(queue.Name); ok {
+			consumers[name] = append(consumers[name], queue.Name)
+		}
+	}
+
+	return consumers
+}
+
+// upstreamExchanges returns exchanges routing to the destination directly or through exchange to exchange
+// bindings. The default exchange, routing to every queue by its name, is left out.
+func upstreamExchanges(bindings []Binding, destinationType, destination string, visited map[string]bool) []string {
+	if visited == nil {
+		visited = make(map[string]bool)
+	}
+
+	var exchanges []string
+
+	for _, binding := range bindings {
+		if binding.DestinationType != destinationType || binding.Destination != destination {
+			continue
+		}
+
+		if binding.Source == "" || visited[binding.Source] {
+			continue
+		}
+		visited[binding.Source] = true
+
+		exchanges = append(exchanges, binding.Source)
+		exchanges = append(exchanges, upstreamExchanges(bindings, DestinationExchange, binding.Source, visited)...)
+	}
+
+	return exchanges
+}
+
+// exchangeChannel creates a channel named after the exchange carrying a message with its schema, if any.
+func (s *Source) exchangeChannel(exchange string) (messageflow.Channel, error) {
+	channel := messageflow.Channel{
+		Name:     exchange,
+		Messages: []messageflow.Message{},
+	}
+
+	raw, ok := s.schemas[exchange]
+	if !ok {
+		return channel, nil
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return messageflow.Channel{}, fmt.Errorf("unmarshalling schema: %w", err)
+	}
+
+	name, _ := schema["title"].(string)
+	if name == "" {
+		name = exchange
+	}
+
+	payload := jsonschema.Flatten(schema)
+	if _, ok := payload.(map[string]any); !ok {
+		payload = map[string]any{}
+	}
+
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return messageflow.Channel{}, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	channel.Messages = append(channel.Messages, messageflow.Message{
+		Name:    name,
+		Payload: string(data),
+	})
+
+	return channel, nil
+}
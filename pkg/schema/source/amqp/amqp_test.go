@@ -0,0 +1,102 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSchema(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSource("testdata/definitions.json",
+		WithServices(map[string]ServiceEndpoints{
+			"user-service":         {Publishes: []string{"user.events"}},
+			"notification-service": {Publishes: []string{"notification.events"}},
+			"reporting-service":    {Consumes: []string{"reports"}},
+		}),
+		WithSchemas(map[string]json.RawMessage{
+			"user.events": json.RawMessage(`{
+				"title": "UserEvent",
+				"type": "object",
+				"properties": {"id": {"type": "string", "format": "uuid"}}
+			}`),
+		}),
+	)
+	require.NoError(t, err)
+
+	schema, err := s.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	userEvents := messageflow.Channel{
+		Name: "user.events",
+		Messages: []messageflow.Message{
+			{
+				Name: "UserEvent",
+				Payload: `{
+  "id": "string[uuid]"
+}`,
+			},
+		},
+	}
+	notificationEvents := messageflow.Channel{Name: "notification.events", Messages: []messageflow.Message{}}
+	audit := messageflow.Channel{Name: "audit", Messages: []messageflow.Message{}}
+
+	assert.Equal(t, messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				// Receives from exchanges routing to the audit exchange as well.
+				Name: "audit-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: audit},
+					{Action: messageflow.ActionReceive, Channel: notificationEvents},
+					{Action: messageflow.ActionReceive, Channel: userEvents},
+				},
+			},
+			{
+				Name: "notification-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: notificationEvents},
+					{Action: messageflow.ActionReceive, Channel: userEvents},
+				},
+			},
+			{
+				Name: "reporting-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: notificationEvents},
+				},
+			},
+			{
+				Name: "user-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: userEvents},
+				},
+			},
+		},
+	}, schema)
+}
+
+func TestDefaultQueueServiceStrategy(t *testing.T) {
+	t.Parallel()
+
+	service, ok := DefaultQueueServiceStrategy("notification-service.user-created")
+	assert.True(t, ok)
+	assert.Equal(t, "notification-service", service)
+
+	_, ok = DefaultQueueServiceStrategy("dead-letters")
+	assert.False(t, ok)
+
+	_, ok = DefaultQueueServiceStrategy(".hidden")
+	assert.False(t, ok)
+}
+
+func TestNewSourceMissingFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewSource("testdata/missing.json")
+	require.Error(t, err)
+}
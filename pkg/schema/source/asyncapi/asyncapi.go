@@ -5,11 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/source/internal/jsonschema"
+	"github.com/lerenn/asyncapi-codegen/pkg/asyncapi"
 	"github.com/lerenn/asyncapi-codegen/pkg/asyncapi/parser"
 	asyncapiv3 "github.com/lerenn/asyncapi-codegen/pkg/asyncapi/v3"
+	"gopkg.in/yaml.v3"
 )
 
 // Ensure Source implements messageflow interfaces.
@@ -17,34 +27,152 @@ var (
 	_ messageflow.Source = (*Source)(nil)
 )
 
+// jsonSchemaFormat is the schema format of payloads kept as JSON schemas, see WithRawPayloads.
+const jsonSchemaFormat = "application/schema+json;version=draft-07"
+
+// supportedMajorVersion is the major AsyncAPI version whose operations model the source understands.
+const supportedMajorVersion = "3"
+
+// UnsupportedVersionError is returned for specifications of AsyncAPI versions other than 3.x.
+type UnsupportedVersionError struct {
+	// Path is the specification file.
+	Path string
+	// Version is the value of the asyncapi key, empty if it's missing.
+	Version string
+}
+
+// Error implements the error interface for UnsupportedVersionError.
+func (err *UnsupportedVersionError) Error() string {
+	if err.Version == "" {
+		return fmt.Sprintf("AsyncAPI version is missing in %s, only %s.x is supported", err.Path, supportedMajorVersion)
+	}
+
+	major, _, _ := strings.Cut(err.Version, ".")
+
+	return fmt.Sprintf("AsyncAPI %s.x detected in %s (%s), only %s.x is supported",
+		major, err.Path, err.Version, supportedMajorVersion)
+}
+
 // Source represents a AsyncAPI source for schema extraction.
 type Source struct {
-	path string
+	path               string
+	rawPayloads        bool
+	payloadConstraints bool
+	validateExamples   bool
+	typeFormatter      TypeFormatter
+}
+
+// Schema is a payload or header field passed to a TypeFormatter, with references resolved.
+type Schema struct {
+	*asyncapiv3.Schema
+	// Extensions holds specification extensions (x-*) of the field by name, which the parser doesn't keep.
+	// Only extensions of schemas in the specification file itself are read, not of referenced files.
+	Extensions map[string]any
+}
+
+// TypeFormatter formats a field of flattened payloads and headers into a custom type string,
+// e.g. "money[USD]" for a field with an x-currency extension. Fields it returns false for
+// are formatted as usual.
+type TypeFormatter func(*Schema) (string, bool)
+
+// SourceOpt is a function type that allows customization of a Source instance.
+type SourceOpt func(*Source)
+
+// WithRawPayloads returns a SourceOpt that keeps message payloads as JSON schemas instead of
+// flattening them into types, preserving constraints like required properties, limits or patterns.
+func WithRawPayloads(rawPayloads bool) SourceOpt {
+	return func(s *Source) {
+		s.rawPayloads = rawPayloads
+	}
+}
+
+// WithPayloadConstraints returns a SourceOpt that keeps key JSON schema constraints of scalar fields
+// in flattened payloads and headers, following the format, e.g. "string[uuid,required,maxLength:36]".
+// Constraints are required, minLength, maxLength, minimum, maximum, exclusiveMinimum, exclusiveMaximum
+// and pattern, which follows enum values as the last one as both may contain commas.
+// Without it fields are flattened into types and formats only.
+func WithPayloadConstraints(payloadConstraints bool) SourceOpt {
+	return func(s *Source) {
+		s.payloadConstraints = payloadConstraints
+	}
+}
+
+// WithValidateExamples returns a SourceOpt that validates message examples against payload schemas
+// of the messages, mismatches are reported by ExtractSchemaWithWarnings.
+func WithValidateExamples(validateExamples bool) SourceOpt {
+	return func(s *Source) {
+		s.validateExamples = validateExamples
+	}
+}
+
+// WithTypeFormatter returns a SourceOpt that formats fields of flattened payloads and headers with
+// the formatter before the default formatting, objects and arrays included, so custom extensions
+// can be rendered as custom types. With WithPayloadConstraints the required marker and limits of
+// the field are appended to the custom type, e.g. "money[USD,required,minimum:0]", the pattern
+// isn't. Payloads kept as JSON schemas aren't formatted.
+func WithTypeFormatter(formatter TypeFormatter) SourceOpt {
+	return func(s *Source) {
+		s.typeFormatter = formatter
+	}
 }
 
 // NewSource creates a new AsyncAPI source from a multiple paths to specifications.
-func NewSource(path string) (*Source, error) {
-	return &Source{
+func NewSource(path string, opts ...SourceOpt) (*Source, error) {
+	s := &Source{
 		path: path,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
 }
 
 // ExtractSchema extracts messageflow schema from AsyncAPI specifications.
-func (s *Source) ExtractSchema(_ context.Context) (messageflow.Schema, error) {
-	spec, err := s.loadAndProcessSpec()
+func (s *Source) ExtractSchema(ctx context.Context) (messageflow.Schema, error) {
+	schema, _, err := s.ExtractSchemaWithWarnings(ctx)
+	return schema, err
+}
+
+// ExtractSchemaWithWarnings works like ExtractSchema, additionally reporting message examples
+// not matching payload schemas when WithValidateExamples is used.
+// Cancelling the context stops loading between the spec and files it references.
+func (s *Source) ExtractSchemaWithWarnings(ctx context.Context) (messageflow.Schema, []ExampleMismatch, error) {
+	raw, err := readRawSpec(s.path)
+	if err != nil {
+		return messageflow.Schema{}, nil, err
+	}
+
+	// The parser only converts specifications it understands to v3, others would lose operations silently.
+	if major, _, _ := strings.Cut(raw.Version, "."); major != supportedMajorVersion {
+		return messageflow.Schema{}, nil, &UnsupportedVersionError{Path: s.path, Version: raw.Version}
+	}
+
+	spec, err := s.loadAndProcessSpec(ctx)
 	if err != nil {
-		return messageflow.Schema{}, err
+		return messageflow.Schema{}, nil, err
 	}
 
-	service := s.createServiceFromSpec(spec)
+	service := s.createServiceFromSpec(spec, raw)
+	service.Group = raw.Info.Domain
+
+	var mismatches []ExampleMismatch
+	if s.validateExamples {
+		mismatches = s.exampleMismatches(spec, raw)
+	}
 
 	return messageflow.Schema{
 		Services: []messageflow.Service{service},
-	}, nil
+	}, mismatches, nil
 }
 
 // loadAndProcessSpec loads and processes the AsyncAPI specification from file.
-func (s *Source) loadAndProcessSpec() (*asyncapiv3.Specification, error) {
+func (s *Source) loadAndProcessSpec(ctx context.Context) (*asyncapiv3.Specification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("loading AsyncAPI spec from %s: %w", s.path, err)
+	}
+
 	spec, err := parser.FromFile(parser.FromFileParams{
 		Path: s.path,
 	})
@@ -52,6 +180,24 @@ func (s *Source) loadAndProcessSpec() (*asyncapiv3.Specification, error) {
 		return nil, fmt.Errorf("parsing AsyncAPI spec from %s: %w", s.path, err)
 	}
 
+	if err := addDependencies(ctx, spec, s.path, make(map[string]asyncapi.Specification), make(map[string]bool)); err != nil {
+		return nil, fmt.Errorf("resolving external references from %s: %w", s.path, err)
+	}
+
+	// The parser doesn't resolve channel references to root servers (#/servers/...),
+	// channel protocols are read from the raw specification instead.
+	var traits map[*asyncapiv3.Message][]*asyncapiv3.MessageTrait
+	if v3, ok := spec.(*asyncapiv3.Specification); ok {
+		for _, ch := range v3.Channels {
+			ch.Servers = nil
+		}
+		for _, ch := range v3.Components.Channels {
+			ch.Servers = nil
+		}
+
+		traits = detachMessageTraits(v3)
+	}
+
 	if err := spec.Process(); err != nil {
 		return nil, fmt.Errorf("processing AsyncAPI spec from %s: %w", s.path, err)
 	}
@@ -61,20 +207,492 @@ func (s *Source) loadAndProcessSpec() (*asyncapiv3.Specification, error) {
 		return nil, fmt.Errorf("converting to v3 spec from %s: %w", s.path, err)
 	}
 
+	applyMessageTraits(v3Spec, traits)
+
 	return v3Spec, nil
 }
 
+// addDependencies loads files referenced via external $ref (e.g. 'components/messages.yaml#/components/messages/Msg')
+// relative to the spec file and registers them as spec dependencies, so they are resolved on Process.
+// Referenced files may reference other files themselves.
+func addDependencies(
+	ctx context.Context,
+	spec asyncapi.Specification,
+	path string,
+	loaded map[string]asyncapi.Specification,
+	loading map[string]bool,
+) error {
+	refs, err := externalRefs(path)
+	if err != nil {
+		return err
+	}
+
+	loading[path] = true
+	defer delete(loading, path)
+
+	for _, ref := range refs {
+		depPath := filepath.Join(filepath.Dir(path), ref)
+		if loading[depPath] {
+			return fmt.Errorf("circular external reference to %s", depPath)
+		}
+
+		dep, ok := loaded[depPath]
+		if !ok {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("loading referenced file %s: %w", depPath, err)
+			}
+
+			dep, err = parser.FromFile(parser.FromFileParams{
+				Path:         depPath,
+				MajorVersion: spec.MajorVersion(),
+			})
+			if err != nil {
+				return fmt.Errorf("parsing referenced file %s: %w", depPath, err)
+			}
+
+			if err := addDependencies(ctx, dep, depPath, loaded, loading); err != nil {
+				return err
+			}
+
+			loaded[depPath] = dep
+		}
+
+		if err := spec.AddDependency(ref, dep); err != nil {
+			return fmt.Errorf("adding dependency %s: %w", ref, err)
+		}
+	}
+
+	return nil
+}
+
+// rawSpec holds parts of the specification which are lost by the AsyncAPI parser.
+type rawSpec struct {
+	Info struct {
+		// Domain assigns the service to a group (bounded context).
+		Domain string `yaml:"x-domain"`
+	} `yaml:"info"`
+	Version            string                `yaml:"asyncapi"`
+	DefaultContentType string                `yaml:"defaultContentType"`
+	Servers            map[string]rawServer  `yaml:"servers"`
+	Channels           map[string]rawChannel `yaml:"channels"`
+	Operations         yaml.Node             `yaml:"operations"`
+
+	// doc is the whole specification, used to resolve local references the parser doesn't keep.
+	doc map[string]any
+}
+
+// rawTag is an inline tag object, the parser replaces tag names with generated ones.
+type rawTag struct {
+	Name string `yaml:"name"`
+}
+
+// rawRef is a reference object.
+type rawRef struct {
+	Ref string `yaml:"$ref"`
+}
+
+type rawServer struct {
+	Protocol string `yaml:"protocol"`
+}
+
+type rawChannel struct {
+	Address string   `yaml:"address"`
+	Tags    []rawTag `yaml:"tags"`
+	Servers []rawRef `yaml:"servers"`
+	// Bindings are keyed by protocol, e.g. ws, or reference a bindings object.
+	Bindings map[string]any `yaml:"bindings"`
+}
+
+type rawOperation struct {
+	Tags        []rawTag            `yaml:"tags"`
+	Deprecated  bool                `yaml:"deprecated"`
+	Summary     string              `yaml:"summary"`
+	Description string              `yaml:"description"`
+	Traits      []rawOperationTrait `yaml:"traits"`
+	// Fields holds the remaining fields of the operation, specification extensions among them.
+	Fields map[string]any `yaml:",inline"`
+}
+
+// readRawSpec decodes the given file into rawSpec.
+func readRawSpec(path string) (rawSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rawSpec{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var raw rawSpec
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return rawSpec{}, fmt.Errorf("unmarshalling %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, &raw.doc); err != nil {
+		return rawSpec{}, fmt.Errorf("unmarshalling %s: %w", path, err)
+	}
+
+	return raw, nil
+}
+
+// resolve returns the node of the specification the local reference (e.g. #/components/messages/Foo) points to.
+func (r rawSpec) resolve(ref string) (map[string]any, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, false
+	}
+
+	node := r.doc
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		next, ok := node[token].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		node = next
+	}
+
+	return node, true
+}
+
+// payloadSchema returns the format and raw schema of the payload of the referenced message
+// when it's defined as a multi format schema (schemaFormat and schema).
+func (r rawSpec) payloadSchema(messageRef string) (string, string, bool) {
+	msg, ok := r.resolve(messageRef)
+	if !ok {
+		return "", "", false
+	}
+
+	payload, ok := msg["payload"].(map[string]any)
+	if !ok {
+		return "", "", false
+	}
+
+	if ref, ok := payload["$ref"].(string); ok {
+		if payload, ok = r.resolve(ref); !ok {
+			return "", "", false
+		}
+	}
+
+	format, _ := payload["schemaFormat"].(string)
+	if format == "" || payload["schema"] == nil {
+		return "", "", false
+	}
+
+	if schema, ok := payload["schema"].(string); ok {
+		return format, strings.TrimSpace(schema), true
+	}
+
+	data, err := json.MarshalIndent(payload["schema"], "", "  ")
+	if err != nil {
+		return "", "", false
+	}
+
+	return format, string(data), true
+}
+
+// deprecationNote returns the x-deprecation-note extension of the referenced message.
+func (r rawSpec) deprecationNote(messageRef string) string {
+	msg, ok := r.resolve(messageRef)
+	if !ok {
+		return ""
+	}
+
+	note, _ := msg["x-deprecation-note"].(string)
+
+	return strings.TrimSpace(note)
+}
+
+// isJSONSchemaFormat reports whether payloads of the schema format are JSON schemas.
+func isJSONSchemaFormat(format string) bool {
+	for _, prefix := range []string{"application/vnd.aai.asyncapi", "application/schema+json", "application/schema+yaml"} {
+		if strings.HasPrefix(format, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// operationIDs returns the operation IDs in the order they are defined in the specification.
+func (r rawSpec) operationIDs() []string {
+	if r.Operations.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	ids := make([]string, 0, len(r.Operations.Content)/2)
+	for i := 0; i < len(r.Operations.Content); i += 2 {
+		ids = append(ids, r.Operations.Content[i].Value)
+	}
+
+	return ids
+}
+
+// operations returns operations by operation ID, with their traits applied.
+func (r rawSpec) operations() map[string]rawOperation {
+	var ops map[string]rawOperation
+	if err := r.Operations.Decode(&ops); err != nil {
+		return nil
+	}
+
+	for id, op := range ops {
+		ops[id] = r.applyOperationTraits(op)
+	}
+
+	return ops
+}
+
+// channelTags returns tag names of channels by channel address.
+func (r rawSpec) channelTags() map[string][]string {
+	tags := make(map[string][]string, len(r.Channels))
+
+	for key, ch := range r.Channels {
+		address := ch.Address
+		if address == "" {
+			address = key
+		}
+		tags[address] = tagNames(ch.Tags)
+	}
+
+	return tags
+}
+
+// channelProtocols returns protocols of servers channels are available on and of channel bindings
+// by channel address, multiple protocols are separated by comma. Channels without servers are
+// available on all servers.
+func (r rawSpec) channelProtocols() map[string]string {
+	protocols := make(map[string]string, len(r.Channels))
+
+	for key, ch := range r.Channels {
+		address := ch.Address
+		if address == "" {
+			address = key
+		}
+
+		var names []string
+		if len(ch.Servers) == 0 {
+			for _, server := range r.Servers {
+				names = append(names, server.Protocol)
+			}
+		}
+
+		for _, ref := range ch.Servers {
+			if server, ok := r.resolve(ref.Ref); ok {
+				protocol, _ := server["protocol"].(string)
+				names = append(names, protocol)
+			}
+		}
+
+		names = append(names, r.bindingProtocols(ch.Bindings)...)
+
+		names = slices.DeleteFunc(names, func(name string) bool { return name == "" })
+		slices.Sort(names)
+		protocols[address] = strings.Join(slices.Compact(names), ", ")
+	}
+
+	return protocols
+}
+
+// channelServers returns names of the servers channels list by channel address, sorted alphabetically.
+// Channels without servers are left out, as they are available on all servers, see messageflow.Service.Servers.
+func (r rawSpec) channelServers() map[string][]string {
+	servers := make(map[string][]string, len(r.Channels))
+
+	for key, ch := range r.Channels {
+		address := ch.Address
+		if address == "" {
+			address = key
+		}
+
+		var names []string
+		for _, ref := range ch.Servers {
+			if name, ok := strings.CutPrefix(ref.Ref, "#/servers/"); ok && name != "" {
+				names = append(names, name)
+			}
+		}
+
+		if len(names) > 0 {
+			slices.Sort(names)
+			servers[address] = slices.Compact(names)
+		}
+	}
+
+	return servers
+}
+
+// bindingProtocols returns protocols of the bindings, resolving a reference to a bindings object.
+func (r rawSpec) bindingProtocols(bindings map[string]any) []string {
+	if ref, ok := bindings["$ref"].(string); ok {
+		resolved, ok := r.resolve(ref)
+		if !ok {
+			return nil
+		}
+
+		bindings = resolved
+	}
+
+	return slices.Collect(maps.Keys(bindings))
+}
+
+// extensionMetadata returns scalar specification extensions (x-*) among the fields by name,
+// nil when there are none.
+func extensionMetadata(fields map[string]any) map[string]string {
+	var metadata map[string]string
+
+	for name, value := range fields {
+		if !strings.HasPrefix(name, "x-") {
+			continue
+		}
+
+		switch value.(type) {
+		case string, int, float64, bool:
+		default:
+			continue
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[name] = strings.TrimSpace(fmt.Sprint(value))
+	}
+
+	return metadata
+}
+
+// securityRequirements converts security schemes of an operation, named after the schemes they reference
+// in components, nil when there are none.
+func securityRequirements(schemes []*asyncapiv3.SecurityScheme) []messageflow.SecurityRequirement {
+	var requirements []messageflow.SecurityRequirement
+
+	for _, scheme := range schemes {
+		if scheme == nil {
+			continue
+		}
+
+		name := ""
+		resolved := scheme
+		for resolved.ReferenceTo != nil {
+			if resolved.Reference != "" {
+				name = path.Base(resolved.Reference)
+			}
+			resolved = resolved.ReferenceTo
+		}
+
+		if name == "" {
+			name = resolved.Type
+		}
+
+		scopes := scheme.Scopes
+		if len(scopes) == 0 {
+			scopes = resolved.Scopes
+		}
+
+		requirements = append(requirements, messageflow.SecurityRequirement{
+			Scheme: name,
+			Type:   resolved.Type,
+			Scopes: slices.Clone(scopes),
+		})
+	}
+
+	return requirements
+}
+
+// tagNames returns names of the tags, nil when there are none.
+func tagNames(tags []rawTag) []string {
+	var names []string
+	for _, tag := range tags {
+		if tag.Name != "" {
+			names = append(names, tag.Name)
+		}
+	}
+
+	return names
+}
+
+// externalRefs returns unique relative file paths referenced via $ref in the given file.
+func externalRefs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshalling %s: %w", path, err)
+	}
+
+	refsMap := make(map[string]bool)
+	collectExternalRefs(doc, refsMap)
+
+	refs := make([]string, 0, len(refsMap))
+	for ref := range refsMap {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	return refs, nil
+}
+
+// collectExternalRefs walks a decoded document collecting file parts of $ref values.
+func collectExternalRefs(node any, refs map[string]bool) {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, value := range n {
+			ref, ok := value.(string)
+			if key != "$ref" || !ok {
+				collectExternalRefs(value, refs)
+				continue
+			}
+
+			file, _, _ := strings.Cut(ref, "#")
+			if file == "" || strings.Contains(file, "://") {
+				continue
+			}
+
+			refs[file] = true
+		}
+	case []any:
+		for _, value := range n {
+			collectExternalRefs(value, refs)
+		}
+	}
+}
+
 // createServiceFromSpec creates a messageflow.Service from an AsyncAPI v3 specification.
-func (s *Source) createServiceFromSpec(spec *asyncapiv3.Specification) messageflow.Service {
+// Operations follow the order they are defined in the raw specification, operations missing
+// from it are appended sorted by ID.
+func (s *Source) createServiceFromSpec(spec *asyncapiv3.Specification, raw rawSpec) messageflow.Service {
 	service := messageflow.Service{
 		Name:        spec.Info.Title,
 		Description: spec.Info.Description,
 		Operation:   make([]messageflow.Operation, 0),
 	}
 
-	for _, op := range spec.Operations {
-		operation := s.createOperation(op)
+	if len(raw.Servers) > 0 {
+		service.Servers = slices.Sorted(maps.Keys(raw.Servers))
+	}
+
+	rawOperations := raw.operations()
+	channelTags := raw.channelTags()
+	channelProtocols := raw.channelProtocols()
+	channelServers := raw.channelServers()
+
+	for _, id := range orderedOperationIDs(spec, raw) {
+		operation := s.createOperation(spec.Operations[id], raw)
 		if operation != nil {
+			operation.ID = id
+			operation.Tags = tagNames(rawOperations[id].Tags)
+			operation.Deprecated = rawOperations[id].Deprecated
+			operation.Summary = rawOperations[id].Summary
+			operation.Description = rawOperations[id].Description
+			operation.Metadata = extensionMetadata(rawOperations[id].Fields)
+			operation.Security = securityRequirements(spec.Operations[id].Security)
+			operation.Channel.Tags = channelTags[operation.Channel.Name]
+			operation.Channel.Protocol = channelProtocols[operation.Channel.Name]
+			operation.Channel.Servers = channelServers[operation.Channel.Name]
+			if operation.Reply != nil {
+				operation.Reply.Tags = channelTags[operation.Reply.Name]
+				operation.Reply.Protocol = channelProtocols[operation.Reply.Name]
+				operation.Reply.Servers = channelServers[operation.Reply.Name]
+			}
 			service.Operation = append(service.Operation, *operation)
 		}
 	}
@@ -82,14 +700,38 @@ func (s *Source) createServiceFromSpec(spec *asyncapiv3.Specification) messagefl
 	return service
 }
 
+// orderedOperationIDs returns IDs of the operations in the order they are defined in the specification,
+// operations the raw specification doesn't list follow sorted by ID.
+func orderedOperationIDs(spec *asyncapiv3.Specification, raw rawSpec) []string {
+	ordered := make([]string, 0, len(spec.Operations))
+	seen := make(map[string]bool, len(spec.Operations))
+
+	for _, id := range raw.operationIDs() {
+		if _, ok := spec.Operations[id]; ok && !seen[id] {
+			ordered = append(ordered, id)
+			seen[id] = true
+		}
+	}
+
+	rest := make([]string, 0, len(spec.Operations)-len(ordered))
+	for id := range spec.Operations {
+		if !seen[id] {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(ordered, rest...)
+}
+
 // createOperation creates a messageflow.Operation from an AsyncAPI operation.
-func (s *Source) createOperation(op *asyncapiv3.Operation) *messageflow.Operation {
+func (s *Source) createOperation(op *asyncapiv3.Operation, raw rawSpec) *messageflow.Operation {
 	channel := op.Channel.Follow()
 	if channel == nil {
 		return nil
 	}
 
-	mainMessages := s.extractMainMessages(op)
+	mainMessages := s.extractMainMessages(op, raw)
 	if len(mainMessages) == 0 {
 		return nil
 	}
@@ -103,7 +745,7 @@ func (s *Source) createOperation(op *asyncapiv3.Operation) *messageflow.Operatio
 	}
 
 	if op.Reply != nil {
-		replyMessages := s.extractReplyMessages(op)
+		replyMessages := s.extractReplyMessages(op, raw)
 		if len(replyMessages) > 0 {
 			replyChannel := op.Reply.Channel.Follow()
 			if replyChannel != nil {
@@ -119,7 +761,7 @@ func (s *Source) createOperation(op *asyncapiv3.Operation) *messageflow.Operatio
 }
 
 // extractMainMessages extracts all main messages from an operation.
-func (s *Source) extractMainMessages(op *asyncapiv3.Operation) []messageflow.Message {
+func (s *Source) extractMainMessages(op *asyncapiv3.Operation, raw rawSpec) []messageflow.Message {
 	messages := make([]messageflow.Message, 0)
 
 	for _, msgRef := range op.Messages {
@@ -127,32 +769,40 @@ func (s *Source) extractMainMessages(op *asyncapiv3.Operation) []messageflow.Mes
 			continue
 		}
 
-		msg := msgRef
-		for msg != nil && msg.Payload == nil && msg.ReferenceTo != nil {
-			msg = msg.ReferenceTo
-		}
+		msg, ref := followMessage(msgRef)
 
 		if msg == nil || msg.Payload == nil {
 			continue
 		}
 
-		jsonSchema, err := jsonMessage(msg.Payload)
+		message, err := s.createMessage(msg, ref, raw)
 		if err != nil {
 			continue
 		}
 
-		messageName := s.extractMessageName(msg)
-		messages = append(messages, messageflow.Message{
-			Name:    messageName,
-			Payload: jsonSchema,
-		})
+		messages = append(messages, message)
 	}
 
 	return messages
 }
 
+// followMessage follows references of the message up to the one defining the payload,
+// returning it along with the last reference followed.
+func followMessage(msgRef *asyncapiv3.Message) (*asyncapiv3.Message, string) {
+	msg := msgRef
+	ref := msgRef.Reference
+	for msg != nil && msg.Payload == nil && msg.ReferenceTo != nil {
+		if msg.Reference != "" {
+			ref = msg.Reference
+		}
+		msg = msg.ReferenceTo
+	}
+
+	return msg, ref
+}
+
 // extractReplyMessages extracts all reply messages from an operation.
-func (s *Source) extractReplyMessages(op *asyncapiv3.Operation) []messageflow.Message {
+func (s *Source) extractReplyMessages(op *asyncapiv3.Operation, raw rawSpec) []messageflow.Message {
 	if op.Reply == nil {
 		return nil
 	}
@@ -164,30 +814,234 @@ func (s *Source) extractReplyMessages(op *asyncapiv3.Operation) []messageflow.Me
 			continue
 		}
 
-		msg := msgRef
-		for msg != nil && msg.Payload == nil && msg.ReferenceTo != nil {
-			msg = msg.ReferenceTo
-		}
+		msg, ref := followMessage(msgRef)
 
 		if msg == nil || msg.Payload == nil {
 			continue
 		}
 
-		jsonSchema, err := jsonMessage(msg.Payload)
+		message, err := s.createMessage(msg, ref, raw)
 		if err != nil {
 			continue
 		}
 
-		messageName := s.extractMessageName(msg)
-		messages = append(messages, messageflow.Message{
-			Name:    messageName,
-			Payload: jsonSchema,
-		})
+		messages = append(messages, message)
 	}
 
 	return messages
 }
 
+// createMessage creates a messageflow.Message from an AsyncAPI message resolved from ref.
+// Payloads in non JSON schema formats (e.g. Avro) are kept verbatim, headers are always flattened.
+func (s *Source) createMessage(msg *asyncapiv3.Message, ref string, raw rawSpec) (messageflow.Message, error) {
+	message := messageflow.Message{
+		Name:        s.extractMessageName(msg),
+		Examples:    jsonExamples(msg.Examples),
+		ContentType: msg.ContentType,
+	}
+
+	if message.ContentType == "" {
+		message.ContentType = raw.DefaultContentType
+	}
+
+	message.DeprecationNote = raw.deprecationNote(ref)
+	message.SchemaRef = schemaRefName(msg.Payload.Reference)
+
+	if msg.CorrelationID != nil {
+		message.CorrelationID = msg.CorrelationID.Location
+		if message.CorrelationID == "" {
+			if correlationID, ok := raw.resolve(msg.CorrelationID.Reference); ok {
+				message.CorrelationID, _ = correlationID["location"].(string)
+			}
+		}
+	}
+
+	if msg.Headers != nil {
+		headers, err := jsonMessage(msg.Headers, s.flattenOptions(raw, ref, "headers"))
+		if err != nil {
+			return messageflow.Message{}, err
+		}
+
+		if headers != "{}" {
+			message.Headers = headers
+		}
+	}
+
+	if format, schema, ok := raw.payloadSchema(ref); ok && !isJSONSchemaFormat(format) {
+		message.Payload = schema
+		message.SchemaFormat = format
+
+		return message, nil
+	}
+
+	if s.rawPayloads {
+		data, err := json.MarshalIndent(raw.rawJSONSchema(msg.Payload, raw.messageSchemaNode(ref, "payload"), nil), "", "  ")
+		if err != nil {
+			return messageflow.Message{}, fmt.Errorf("marshaling schema: %w", err)
+		}
+
+		message.Payload = string(data)
+		message.SchemaFormat = jsonSchemaFormat
+
+		return message, nil
+	}
+
+	jsonSchema, err := jsonMessage(msg.Payload, s.flattenOptions(raw, ref, "payload"))
+	if err != nil {
+		return messageflow.Message{}, err
+	}
+
+	message.Payload = jsonSchema
+
+	return message, nil
+}
+
+// schemaRefName returns the name of the schema component a payload references, e.g. UserProfile for
+// #/components/schemas/UserProfile or common.yaml#/components/schemas/UserProfile, empty for inline payloads.
+func schemaRefName(ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	if _, fragment, ok := strings.Cut(ref, "#"); ok && fragment != "" {
+		return path.Base(fragment)
+	}
+
+	return strings.TrimSuffix(path.Base(ref), path.Ext(ref))
+}
+
+// rawJSONSchema converts the parsed schema back into a JSON schema with references resolved.
+// Keywords are taken from the raw schema node when it's known, as the parsed schema can't tell
+// zero limits like "minimum: 0" from unset ones, and from the parsed schema otherwise, e.g. for
+// schemas of referenced files or merged from traits. Recursive references are kept as $ref,
+// path holds the schemas being converted.
+func (r *rawSpec) rawJSONSchema(schema *asyncapiv3.Schema, node map[string]any, path []*asyncapiv3.Schema) map[string]any {
+	ref := schema.Reference
+	for schema.ReferenceTo != nil {
+		schema = schema.ReferenceTo
+	}
+
+	if slices.Contains(path, schema) {
+		return map[string]any{"$ref": ref}
+	}
+	path = append(path, schema)
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return map[string]any{}
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return map[string]any{}
+	}
+
+	// The parsed schema has no omitempty tags, drop unset keywords. Zero limits like
+	// "minimum: 0" are indistinguishable from unset ones and are restored from the raw node.
+	for key, value := range result {
+		if rawValue, ok := node[key]; ok && !isSubschemaKeyword(key) {
+			result[key] = rawValue
+			continue
+		}
+
+		switch v := value.(type) {
+		case nil:
+			delete(result, key)
+		case bool:
+			if !v {
+				delete(result, key)
+			}
+		case string:
+			if v == "" {
+				delete(result, key)
+			}
+		case float64:
+			if v == 0 {
+				delete(result, key)
+			}
+		case []any:
+			if len(v) == 0 {
+				delete(result, key)
+			}
+		case map[string]any:
+			if len(v) == 0 {
+				delete(result, key)
+			}
+		}
+	}
+	delete(result, "$ref")
+
+	for key, sub := range map[string]*asyncapiv3.Schema{
+		"items":                schema.Items,
+		"additionalProperties": schema.AdditionalProperties,
+		"not":                  schema.Not,
+	} {
+		if sub != nil {
+			result[key] = r.rawJSONSchema(sub, r.schemaNode(node[key]), path)
+		}
+	}
+
+	for key, subs := range map[string][]*asyncapiv3.Schema{
+		"allOf":           schema.AllOf,
+		"anyOf":           schema.AnyOf,
+		"oneOf":           schema.OneOf,
+		"contains":        schema.Contains,
+		"additionalItems": schema.AdditionalItems,
+	} {
+		if len(subs) == 0 {
+			continue
+		}
+
+		nodes, _ := node[key].([]any)
+
+		list := make([]any, 0, len(subs))
+		for i, sub := range subs {
+			if sub == nil {
+				continue
+			}
+
+			var subNode map[string]any
+			if i < len(nodes) {
+				subNode = r.schemaNode(nodes[i])
+			}
+			list = append(list, r.rawJSONSchema(sub, subNode, path))
+		}
+		result[key] = list
+	}
+
+	for key, subs := range map[string]map[string]*asyncapiv3.Schema{
+		"properties":        schema.Properties,
+		"patternProperties": schema.PatternProperties,
+	} {
+		if len(subs) == 0 {
+			continue
+		}
+
+		nodes, _ := node[key].(map[string]any)
+
+		props := make(map[string]any, len(subs))
+		for name, sub := range subs {
+			if sub != nil {
+				props[name] = r.rawJSONSchema(sub, r.schemaNode(nodes[name]), path)
+			}
+		}
+		result[key] = props
+	}
+
+	return result
+}
+
+// isSubschemaKeyword reports whether values of the JSON schema keyword are schemas, converted by rawJSONSchema.
+func isSubschemaKeyword(key string) bool {
+	switch key {
+	case "items", "additionalProperties", "not", "allOf", "anyOf", "oneOf", "contains", "additionalItems",
+		"properties", "patternProperties":
+		return true
+	}
+
+	return false
+}
+
 // extractMessageName extracts the message name from a message reference.
 func (s *Source) extractMessageName(msg *asyncapiv3.Message) string {
 	if msg == nil {
@@ -213,8 +1067,19 @@ func (s *Source) extractMessageName(msg *asyncapiv3.Message) string {
 	return "UnknownMessage"
 }
 
-// jsonMessage converts an AsyncAPI schema into a pretty-printed JSON string.
-func jsonMessage(schema *asyncapiv3.Schema) (string, error) {
+// flattenOptions returns options flattening the field (payload or headers) of the referenced message.
+func (s *Source) flattenOptions(raw rawSpec, messageRef, field string) flattenOptions {
+	return flattenOptions{
+		constraints: s.payloadConstraints,
+		formatter:   s.typeFormatter,
+		raw:         &raw,
+		node:        raw.messageSchemaNode(messageRef, field),
+	}
+}
+
+// jsonMessage converts an AsyncAPI schema into a pretty-printed JSON string of flattened field types
+// using the options, see flattenSchema.
+func jsonMessage(schema *asyncapiv3.Schema, opts flattenOptions) (string, error) {
 	if schema == nil {
 		return "", nil
 	}
@@ -223,15 +1088,23 @@ func jsonMessage(schema *asyncapiv3.Schema) (string, error) {
 		schema = schema.ReferenceTo
 	}
 
-	schemaMap := make(map[string]any)
+	var schemaMap any = make(map[string]any)
+
+	if schema.Type == "array" || (schema.Type == "" && schema.Items != nil) {
+		// Array payloads are flattened into a list of their item type, e.g. [{"id": "string"}].
+		schemaMap = flattenSchema(schema, opts, make(map[*asyncapiv3.Schema]bool))
+	} else if properties := schemaProperties(schema); len(properties) > 0 {
+		var required []string
+		if opts.constraints {
+			required = schemaRequired(schema)
+		}
+
+		nodes := opts.raw.propertyNodes(opts.node)
 
-	if len(schema.Properties) > 0 {
 		props := make(map[string]any)
-		for name, prop := range schema.Properties {
-			for prop.ReferenceTo != nil {
-				prop = prop.ReferenceTo
-			}
-			props[name] = getTypeString(prop)
+		for name, prop := range properties {
+			props[name] = flattenSchema(prop, opts.property(nodes[name], slices.Contains(required, name)),
+				make(map[*asyncapiv3.Schema]bool))
 		}
 		schemaMap = props
 	}
@@ -244,50 +1117,316 @@ func jsonMessage(schema *asyncapiv3.Schema) (string, error) {
 	return string(data), nil
 }
 
+// jsonExamples converts AsyncAPI message example payloads into pretty-printed JSON strings.
+// Examples without payload or that can't be marshaled are skipped.
+func jsonExamples(examples []*asyncapiv3.MessageExample) []string {
+	var result []string
+
+	for _, example := range examples {
+		for example != nil && example.ReferenceTo != nil {
+			example = example.ReferenceTo
+		}
+
+		if example == nil || example.Payload == nil {
+			continue
+		}
+
+		data, err := json.MarshalIndent(example.Payload, "", "  ")
+		if err != nil {
+			continue
+		}
+
+		result = append(result, string(data))
+	}
+
+	return result
+}
+
 // getTypeString returns a string representation of the schema type
 func getTypeString(schema *asyncapiv3.Schema) any {
+	return flattenSchema(schema, flattenOptions{}, make(map[*asyncapiv3.Schema]bool))
+}
+
+// flattenOptions controls constraints kept by flattenSchema.
+type flattenOptions struct {
+	// constraints keeps constraints of scalar fields, see WithPayloadConstraints.
+	constraints bool
+	// required marks the flattened field as required by its parent object, used with constraints.
+	required bool
+	// formatter formats fields before the default formatting, see WithTypeFormatter.
+	formatter TypeFormatter
+	// raw is the specification raw schemas are resolved in.
+	raw *rawSpec
+	// node is the raw schema of the flattened field, nil when it isn't known.
+	node map[string]any
+}
+
+// property returns the options flattening a property or array item of the flattened field with the raw schema.
+func (opts flattenOptions) property(node any, required bool) flattenOptions {
+	opts.required = required
+	opts.node = opts.raw.schemaNode(node)
+
+	return opts
+}
+
+// flattenSchema flattens the schema into its field types, following references of nested
+// properties and array items at any depth. Array items are flattened into a one element list,
+// e.g. [{"sku": "string"}] for an array of objects. Schemas referencing themselves through
+// their ancestors in visiting are flattened to "object" to stop recursion.
+func flattenSchema(schema *asyncapiv3.Schema, opts flattenOptions, visiting map[*asyncapiv3.Schema]bool) any {
 	if schema == nil {
 		return "string"
 	}
 
-	if schema.ReferenceTo != nil {
+	for schema.ReferenceTo != nil {
 		schema = schema.ReferenceTo
 	}
 
-	if schema.Type == "array" {
+	if visiting[schema] {
+		return "object"
+	}
+
+	visiting[schema] = true
+	defer delete(visiting, schema)
+
+	if opts.formatter != nil {
+		if typ, ok := opts.formatter(&Schema{Schema: schema, Extensions: schemaExtensions(opts.node)}); ok {
+			if opts.constraints {
+				return appendTypeTokens(typ, constraintTokens(schema, opts.node, opts.required))
+			}
+			return typ
+		}
+	}
+
+	if schema.Type == "array" || (schema.Type == "" && schema.Items != nil) {
 		if schema.Items == nil {
 			return []any{}
 		}
-		if schema.Items.ReferenceTo != nil {
-			schema.Items = schema.Items.ReferenceTo
-		}
-		return []any{getTypeString(schema.Items)}
+		return []any{flattenSchema(schema.Items, opts.property(opts.node["items"], false), visiting)}
 	}
 
-	if schema.Type == "object" {
-		if len(schema.Properties) == 0 {
+	properties := schemaProperties(schema)
+
+	if schema.Type == "object" || (schema.Type == "" && len(properties) > 0) {
+		if len(properties) == 0 {
 			return "object"
 		}
-		props := make(map[string]any)
-		for name, prop := range schema.Properties {
-			props[name] = getTypeString(prop)
+		var required []string
+		if opts.constraints {
+			required = schemaRequired(schema)
+		}
+
+		nodes := opts.raw.propertyNodes(opts.node)
+
+		props := make(map[string]any, len(properties))
+		for name, prop := range properties {
+			props[name] = flattenSchema(prop, opts.property(nodes[name], slices.Contains(required, name)), visiting)
 		}
 		return props
 	}
 
-	if schema.Type != "" {
-		if schema.Format != "" {
-			return schema.Type + "[" + schema.Format + "]"
+	typ := schema.Type
+	var tokens []string
+
+	if typ != "" && schema.Format != "" {
+		tokens = append(tokens, schema.Format)
+	}
+
+	if opts.constraints {
+		tokens = append(tokens, constraintTokens(schema, opts.node, opts.required)...)
+	}
+
+	if schema.Format == "" && len(schema.Enum) > 0 && schema.Type != "" {
+		tokens = append(tokens, jsonschema.EnumToken(schema.Enum))
+	}
+
+	if opts.constraints && schema.Pattern != "" {
+		tokens = append(tokens, "pattern:"+schema.Pattern)
+	}
+
+	return jsonschema.ScalarType(typ, tokens...)
+}
+
+// appendTypeTokens appends the tokens to the bracketed tokens of the flattened type, e.g. required
+// to money[USD] makes money[USD,required].
+func appendTypeTokens(typ string, tokens []string) string {
+	if len(tokens) == 0 {
+		return typ
+	}
+
+	if trimmed, ok := strings.CutSuffix(typ, "]"); ok && strings.Contains(trimmed, "[") {
+		return trimmed + "," + strings.Join(tokens, ",") + "]"
+	}
+
+	return typ + "[" + strings.Join(tokens, ",") + "]"
+}
+
+// constraintTokens returns the required marker and limits of the scalar schema, e.g. minLength:1.
+// Limits are read from the raw schema node, as the parsed schema can't tell zero limits from unset ones.
+// Without the node, e.g. for schemas of referenced files, zero limits are left out.
+func constraintTokens(schema *asyncapiv3.Schema, node map[string]any, required bool) []string {
+	var tokens []string
+	if required {
+		tokens = append(tokens, "required")
+	}
+
+	for _, limit := range []struct {
+		name  string
+		value float64
+	}{
+		{"minLength", float64(schema.MinLength)},
+		{"maxLength", float64(schema.MaxLength)},
+		{"minimum", schema.Minimum},
+		{"exclusiveMinimum", schema.ExclusiveMinimum},
+		{"maximum", schema.Maximum},
+		{"exclusiveMaximum", schema.ExclusiveMaximum},
+	} {
+		value, ok := numericValue(node[limit.name])
+		if !ok && node == nil && limit.value != 0 {
+			value, ok = limit.value, true
 		}
-		if len(schema.Enum) > 0 {
-			enumValues := make([]string, len(schema.Enum))
-			for i, v := range schema.Enum {
-				enumValues[i] = fmt.Sprintf("%v", v)
-			}
-			return schema.Type + "[enum:" + strings.Join(enumValues, ",") + "]"
+
+		if ok {
+			tokens = append(tokens, limit.name+":"+strconv.FormatFloat(value, 'f', -1, 64))
 		}
-		return schema.Type
 	}
 
-	return "string"
+	return tokens
+}
+
+// numericValue returns the number of the raw schema keyword value, false for other values,
+// e.g. boolean exclusiveMinimum of draft-04 schemas.
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+
+	return 0, false
+}
+
+// messageSchemaNode returns the raw schema of the field (payload or headers) of the referenced message,
+// nil when it can't be resolved. Schemas of multi format payloads are returned without their format.
+func (r *rawSpec) messageSchemaNode(messageRef, field string) map[string]any {
+	if r == nil {
+		return nil
+	}
+
+	msg, ok := r.resolve(messageRef)
+	if !ok {
+		return nil
+	}
+
+	node := r.schemaNode(r.schemaNode(msg)[field])
+	if _, ok := node["schemaFormat"]; ok {
+		return r.schemaNode(node["schema"])
+	}
+
+	return node
+}
+
+// schemaNode returns the raw schema node following local references, nil when it isn't an object
+// or references another file.
+func (r *rawSpec) schemaNode(node any) map[string]any {
+	if r == nil {
+		return nil
+	}
+
+	schema, _ := node.(map[string]any)
+
+	for depth := 0; schema != nil && depth < 32; depth++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+
+		schema, _ = r.resolve(ref)
+	}
+
+	return nil
+}
+
+// propertyNodes returns raw schemas of properties of the raw schema node merged with properties
+// of its allOf schemas, mirroring schemaProperties.
+func (r *rawSpec) propertyNodes(node map[string]any) map[string]any {
+	if node == nil {
+		return nil
+	}
+
+	properties := make(map[string]any)
+
+	allOf, _ := node["allOf"].([]any)
+	for _, sub := range allOf {
+		maps.Copy(properties, r.propertyNodes(r.schemaNode(sub)))
+	}
+
+	own, _ := node["properties"].(map[string]any)
+	maps.Copy(properties, own)
+
+	return properties
+}
+
+// schemaExtensions returns specification extensions (x-*) of the raw schema node by name,
+// nil when there are none.
+func schemaExtensions(node map[string]any) map[string]any {
+	var extensions map[string]any
+
+	for name, value := range node {
+		if !strings.HasPrefix(name, "x-") {
+			continue
+		}
+
+		if extensions == nil {
+			extensions = make(map[string]any)
+		}
+		extensions[name] = value
+	}
+
+	return extensions
+}
+
+// schemaRequired returns names of required properties of the schema and its allOf schemas.
+func schemaRequired(schema *asyncapiv3.Schema) []string {
+	required := slices.Clone(schema.Required)
+
+	for _, sub := range schema.AllOf {
+		for sub != nil && sub.ReferenceTo != nil {
+			sub = sub.ReferenceTo
+		}
+		if sub != nil {
+			required = append(required, schemaRequired(sub)...)
+		}
+	}
+
+	return required
+}
+
+// schemaProperties returns properties of the schema merged with properties of its allOf schemas,
+// with properties declared on the schema itself taking precedence.
+func schemaProperties(schema *asyncapiv3.Schema) map[string]*asyncapiv3.Schema {
+	if len(schema.AllOf) == 0 {
+		return schema.Properties
+	}
+
+	properties := make(map[string]*asyncapiv3.Schema, len(schema.Properties))
+
+	for _, sub := range schema.AllOf {
+		for sub != nil && sub.ReferenceTo != nil {
+			sub = sub.ReferenceTo
+		}
+		if sub == nil {
+			continue
+		}
+		for name, prop := range schemaProperties(sub) {
+			properties[name] = prop
+		}
+	}
+
+	for name, prop := range schema.Properties {
+		properties[name] = prop
+	}
+
+	return properties
 }
@@ -3,10 +3,14 @@ package asyncapi
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"sort"
 	"testing"
 
 	"github.com/holydocs/messageflow/pkg/messageflow"
+	asyncapiv3 "github.com/lerenn/asyncapi-codegen/pkg/asyncapi/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,12 +29,15 @@ func TestExtractSchema(t *testing.T) {
 				Description: "A service that handles user notifications, preferences, and interactions.\nSupports real-time notifications, user preferences management.\n",
 				Operation: []messageflow.Operation{
 					{
-						Action: messageflow.ActionReceive,
+						ID:      "replyPreferences",
+						Action:  messageflow.ActionReceive,
+						Summary: "Receive user preferences updates",
 						Channel: messageflow.Channel{
 							Name: "notification.preferences.get",
 							Messages: []messageflow.Message{
 								{
-									Name: "PreferencesRequestMessage",
+									Name:        "PreferencesRequestMessage",
+									ContentType: "application/json",
 									Payload: `{
   "user_id": "string[uuid]"
 }`,
@@ -41,7 +48,8 @@ func TestExtractSchema(t *testing.T) {
 							Name: "notification.preferences.get",
 							Messages: []messageflow.Message{
 								{
-									Name: "PreferencesReplyMessage",
+									Name:        "PreferencesReplyMessage",
+									ContentType: "application/json",
 									Payload: `{
   "preferences": {
     "categories": {
@@ -65,12 +73,15 @@ func TestExtractSchema(t *testing.T) {
 						},
 					},
 					{
-						Action: messageflow.ActionReceive,
+						ID:      "receivePreferencesUpdate",
+						Action:  messageflow.ActionReceive,
+						Summary: "Receive user preferences updates",
 						Channel: messageflow.Channel{
 							Name: "notification.preferences.update",
 							Messages: []messageflow.Message{
 								{
-									Name: "PreferencesUpdateMessage",
+									Name:        "PreferencesUpdateMessage",
+									ContentType: "application/json",
 									Payload: `{
   "preferences": {
     "categories": {
@@ -95,12 +106,15 @@ func TestExtractSchema(t *testing.T) {
 						},
 					},
 					{
-						Action: messageflow.ActionReceive,
+						ID:      "receivePushNotification",
+						Action:  messageflow.ActionReceive,
+						Summary: "Receive a message to send a push notification to a specific user",
 						Channel: messageflow.Channel{
 							Name: "notification.user.{user_id}.push",
 							Messages: []messageflow.Message{
 								{
-									Name: "PushNotificationMessage",
+									Name:        "PushNotificationMessage",
+									ContentType: "application/json",
 									Payload: `{
   "body": "string",
   "created_at": "string[date-time]",
@@ -115,12 +129,15 @@ func TestExtractSchema(t *testing.T) {
 						},
 					},
 					{
-						Action: messageflow.ActionSend,
+						ID:      "requestUserInfo",
+						Action:  messageflow.ActionSend,
+						Summary: "Request user information from user service",
 						Channel: messageflow.Channel{
 							Name: "user.info.request",
 							Messages: []messageflow.Message{
 								{
-									Name: "UserInfoRequestMessage",
+									Name:        "UserInfoRequestMessage",
+									ContentType: "application/json",
 									Payload: `{
   "user_id": "string[uuid]"
 }`,
@@ -131,7 +148,8 @@ func TestExtractSchema(t *testing.T) {
 							Name: "user.info.request",
 							Messages: []messageflow.Message{
 								{
-									Name: "UserInfoReplyMessage",
+									Name:        "UserInfoReplyMessage",
+									ContentType: "application/json",
 									Payload: `{
   "email": "string[email]",
   "error": {
@@ -148,12 +166,15 @@ func TestExtractSchema(t *testing.T) {
 						},
 					},
 					{
-						Action: messageflow.ActionSend,
+						ID:      "sendAnalytics",
+						Action:  messageflow.ActionSend,
+						Summary: "Publish analytics events",
 						Channel: messageflow.Channel{
 							Name: "notification.analytics",
 							Messages: []messageflow.Message{
 								{
-									Name: "AnalyticsEventMessage",
+									Name:        "AnalyticsEventMessage",
+									ContentType: "application/json",
 									Payload: `{
   "event_id": "string[uuid]",
   "event_type": "string[enum:notification_sent,notification_opened,notification_clicked]",
@@ -234,7 +255,7 @@ func TestChangelogDetection(t *testing.T) {
 
 	change := changelog.Changes[0]
 	assert.Equal(t, messageflow.ChangeTypeChanged, change.Type, "Should be a change type")
-	assert.Equal(t, "message", change.Category, "Should be a message category")
+	assert.Equal(t, messageflow.ChangeCategoryMessage, change.Category, "Should be a message category")
 }
 
 func sortSchema(schema *messageflow.Schema) {
@@ -251,3 +272,844 @@ func sortSchema(schema *messageflow.Schema) {
 		})
 	}
 }
+
+func TestExtractSchemaExternalRefs(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/external/billing.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	expected := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:        "Billing Service",
+				Description: "A service that issues invoices. Message definitions are shared via external files.\n",
+				Group:       "Finance",
+				Operation: []messageflow.Operation{
+					{
+						ID:      "sendInvoiceCreated",
+						Action:  messageflow.ActionSend,
+						Summary: "Publish invoice created events",
+						Tags:    []string{"deprecated"},
+						Channel: messageflow.Channel{
+							Name: "billing.invoice.created",
+							Tags: []string{"pii"},
+							Messages: []messageflow.Message{
+								{
+									Name:        "InvoiceCreatedMessage",
+									ContentType: "application/json",
+									SchemaRef:   "Invoice",
+									Payload: `{
+  "amount": "number",
+  "currency": "string[enum:USD,EUR]",
+  "invoice_id": "string[uuid]"
+}`,
+									Examples: []string{`{
+  "amount": 42.5,
+  "currency": "USD",
+  "invoice_id": "5f0c1b3e-8a0d-4b1e-9c8f-2d7a6b4e1f3a"
+}`},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, expected, actual)
+}
+
+func TestExtractSchemaContentTypes(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Equal(t, []messageflow.Message{
+		{
+			Name: "PaymentCapturedMessage",
+			Payload: `{
+  "fields": [
+    {
+      "name": "payment_id",
+      "type": "string"
+    },
+    {
+      "name": "amount",
+      "type": "double"
+    }
+  ],
+  "name": "PaymentCaptured",
+  "type": "record"
+}`,
+			ContentType:  "avro/binary",
+			SchemaFormat: "application/vnd.apache.avro;version=1.9.0",
+		},
+	}, actual.Services[0].Operation[0].Channel.Messages)
+
+	assert.Equal(t, []messageflow.Message{
+		{
+			Name: "PaymentRefundedMessage",
+			Payload: `{
+  "payment_id": "string[uuid]"
+}`,
+			Headers: `{
+  "correlationId": "string"
+}`,
+			ContentType:     "application/json",
+			CorrelationID:   "$message.header#/correlationId",
+			DeprecationNote: "amount is removed, read refunds from payment.captured instead.",
+		},
+	}, actual.Services[0].Operation[1].Channel.Messages)
+}
+
+func TestExtractSchemaTraits(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/shipping.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	dispatched := actual.Services[0].Operation[0]
+	assert.Equal(t, "Publish dispatched shipments", dispatched.Summary)
+	assert.Equal(t, "Events are kept by the audit log.\n", dispatched.Description)
+	assert.Equal(t, []string{"audited"}, dispatched.Tags)
+	assert.Equal(t, []messageflow.Message{
+		{
+			Name: "ShipmentDispatchedMessage",
+			Payload: `{
+  "carrier": "string",
+  "packages": [
+    {
+      "dimensions": {
+        "size": "string[enum:small,medium,large]",
+        "weight_kg": "number"
+      },
+      "items": [
+        {
+          "quantity": "integer",
+          "sku": "string"
+        }
+      ],
+      "tracking_number": "string"
+    }
+  ],
+  "shipment_id": "string[uuid]"
+}`,
+			Headers: `{
+  "traceparent": "string",
+  "tracestate": "string"
+}`,
+			ContentType: "application/json",
+		},
+	}, dispatched.Channel.Messages)
+
+	delivered := actual.Services[0].Operation[1]
+	assert.Equal(t, "Publish shipment lifecycle events", delivered.Summary)
+	assert.Equal(t, []messageflow.Message{
+		{
+			Name: "ShipmentDeliveredMessage",
+			Payload: `{
+  "sent_at": "string[date-time]",
+  "shipment_id": "string[uuid]"
+}`,
+			Headers: `{
+  "retry_count": "integer",
+  "traceparent": "string",
+  "tracestate": "string"
+}`,
+			ContentType: "application/json",
+		},
+	}, delivered.Channel.Messages)
+}
+
+func TestExtractSchemaMetadata(t *testing.T) {
+	source, err := NewSource("testdata/shipping.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Equal(t, map[string]string{"x-throughput": "50/s", "x-sla": "200ms"}, actual.Services[0].Operation[0].Metadata)
+	assert.Nil(t, actual.Services[0].Operation[1].Metadata)
+}
+
+func TestExtractSchemaSecurity(t *testing.T) {
+	source, err := NewSource("testdata/shipping.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Equal(t, []messageflow.SecurityRequirement{
+		{Scheme: "carrierAuth", Type: "oauth2", Scopes: []string{"shipments:write"}},
+	}, actual.Services[0].Operation[0].Security)
+	assert.Nil(t, actual.Services[0].Operation[1].Security)
+}
+
+func TestExtractSchemaRawPayloads(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml", WithRawPayloads(true))
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	// Payloads in other schema formats are kept verbatim regardless.
+	assert.Equal(t, "application/vnd.apache.avro;version=1.9.0",
+		actual.Services[0].Operation[0].Channel.Messages[0].SchemaFormat)
+
+	assert.Equal(t, []messageflow.Message{
+		{
+			Name: "PaymentRefundedMessage",
+			Payload: `{
+  "properties": {
+    "payment_id": {
+      "format": "uuid",
+      "type": "string"
+    }
+  },
+  "required": [
+    "payment_id"
+  ],
+  "type": "object"
+}`,
+			Headers: `{
+  "correlationId": "string"
+}`,
+			ContentType:     "application/json",
+			SchemaFormat:    "application/schema+json;version=draft-07",
+			CorrelationID:   "$message.header#/correlationId",
+			DeprecationNote: "amount is removed, read refunds from payment.captured instead.",
+		},
+	}, actual.Services[0].Operation[1].Channel.Messages)
+}
+
+func TestExtractSchemaRawPayloadsZeroLimits(t *testing.T) {
+	t.Parallel()
+
+	spec := writeSpec(t, `asyncapi: 3.0.0
+info:
+  title: Inventory Service
+  version: 1.0.0
+channels:
+  stock.changed:
+    address: stock.changed
+    messages:
+      StockChanged:
+        $ref: '#/components/messages/StockChanged'
+operations:
+  sendStockChanged:
+    action: send
+    channel:
+      $ref: '#/channels/stock.changed'
+    messages:
+      - $ref: '#/channels/stock.changed/messages/StockChanged'
+components:
+  messages:
+    StockChanged:
+      name: StockChangedMessage
+      payload:
+        type: object
+        properties:
+          count:
+            type: integer
+            minimum: 0
+          sku:
+            $ref: '#/components/schemas/Sku'
+  schemas:
+    Sku:
+      type: string
+      minLength: 0
+      maxLength: 12
+`)
+
+	source, err := NewSource(spec, WithRawPayloads(true))
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 1)
+	require.Len(t, actual.Services[0].Operation[0].Channel.Messages, 1)
+
+	assert.JSONEq(t, `{
+  "type": "object",
+  "properties": {
+    "count": {"type": "integer", "minimum": 0},
+    "sku": {"type": "string", "minLength": 0, "maxLength": 12}
+  }
+}`, actual.Services[0].Operation[0].Channel.Messages[0].Payload)
+}
+
+func TestExtractSchemaArrayPayload(t *testing.T) {
+	t.Parallel()
+
+	spec := writeSpec(t, `asyncapi: 3.0.0
+info:
+  title: Inventory Service
+  version: 1.0.0
+channels:
+  stock.batch:
+    address: stock.batch
+    messages:
+      StockBatch:
+        payload:
+          type: array
+          items:
+            $ref: '#/components/schemas/Stock'
+operations:
+  sendStockBatch:
+    action: send
+    channel:
+      $ref: '#/channels/stock.batch'
+    messages:
+      - $ref: '#/channels/stock.batch/messages/StockBatch'
+components:
+  schemas:
+    Stock:
+      type: object
+      properties:
+        sku:
+          type: string
+        bins:
+          type: array
+          items:
+            type: object
+            properties:
+              id:
+                type: string
+                format: uuid
+`)
+
+	source, err := NewSource(spec)
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 1)
+	require.Len(t, actual.Services[0].Operation[0].Channel.Messages, 1)
+
+	assert.JSONEq(t, `[{"sku": "string", "bins": [{"id": "string[uuid]"}]}]`,
+		actual.Services[0].Operation[0].Channel.Messages[0].Payload)
+}
+
+func TestExtractSchemaProtocols(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Equal(t, "kafka", actual.Services[0].Operation[0].Channel.Protocol)
+	// Channels without servers are available on all servers.
+	assert.Equal(t, "amqp, kafka", actual.Services[0].Operation[1].Channel.Protocol)
+
+	assert.Equal(t, []string{"events", "legacy"}, actual.Services[0].Servers)
+	assert.Equal(t, []string{"events"}, actual.Services[0].Operation[0].Channel.Servers)
+	// Channels without servers are available on all servers of the service.
+	assert.Empty(t, actual.Services[0].Operation[1].Channel.Servers)
+	assert.Equal(t, []string{"events", "legacy"}, actual.Services[0].ChannelServers(actual.Services[0].Operation[1].Channel))
+}
+
+func TestExtractSchemaDeprecated(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.False(t, actual.Services[0].Operation[0].Deprecated)
+	assert.True(t, actual.Services[0].Operation[1].Deprecated)
+}
+
+func TestExtractSchemaDeprecationNote(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Empty(t, actual.Services[0].Operation[0].Channel.Messages[0].DeprecationNote)
+	assert.Equal(t,
+		"amount is removed, read refunds from payment.captured instead.",
+		actual.Services[0].Operation[1].Channel.Messages[0].DeprecationNote,
+	)
+}
+
+func TestExtractSchemaOperationSummary(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/payments.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 2)
+
+	assert.Equal(t, "Publish captured payments", actual.Services[0].Operation[0].Summary)
+	assert.Equal(t, "Sent once the payment provider confirms the capture.\n", actual.Services[0].Operation[0].Description)
+	assert.Empty(t, actual.Services[0].Operation[1].Summary)
+}
+
+func TestExtractSchemaValidateExamples(t *testing.T) {
+	ctx := context.Background()
+
+	source, err := NewSource("testdata/orders.yaml", WithValidateExamples(true))
+	require.NoError(t, err)
+	schema, mismatches, err := source.ExtractSchemaWithWarnings(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, schema.Services, 1)
+	require.Len(t, mismatches, 1)
+
+	assert.Equal(t, "sendOrderPlaced", mismatches[0].Operation)
+	assert.Equal(t, "OrderPlacedMessage", mismatches[0].Message)
+	assert.Equal(t, 1, mismatches[0].Example)
+	assert.Contains(t, mismatches[0].Details, "missing property 'amount'")
+	assert.Contains(t, mismatches[0].Details, "at '/id'")
+
+	source, err = NewSource("testdata/orders.yaml")
+	require.NoError(t, err)
+	_, mismatches, err = source.ExtractSchemaWithWarnings(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, mismatches)
+}
+
+func TestExtractSchemaValidateExamplesZeroLimits(t *testing.T) {
+	t.Parallel()
+
+	spec := writeSpec(t, `asyncapi: 3.0.0
+info:
+  title: Inventory Service
+  version: 1.0.0
+channels:
+  stock.changed:
+    address: stock.changed
+    messages:
+      StockChanged:
+        $ref: '#/components/messages/StockChanged'
+operations:
+  sendStockChanged:
+    action: send
+    channel:
+      $ref: '#/channels/stock.changed'
+    messages:
+      - $ref: '#/channels/stock.changed/messages/StockChanged'
+components:
+  messages:
+    StockChanged:
+      name: StockChangedMessage
+      payload:
+        type: object
+        properties:
+          count:
+            type: integer
+            minimum: 0
+      examples:
+        - payload:
+            count: 3
+        - payload:
+            count: -5
+`)
+
+	source, err := NewSource(spec, WithValidateExamples(true))
+	require.NoError(t, err)
+	_, mismatches, err := source.ExtractSchemaWithWarnings(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, mismatches, 1)
+	assert.Equal(t, 1, mismatches[0].Example)
+	assert.Contains(t, mismatches[0].Details, "at '/count'")
+}
+
+func TestExtractSchemaJSONSpec(t *testing.T) {
+	t.Parallel()
+
+	yamlSource, err := NewSource("testdata/notification.yaml")
+	require.NoError(t, err)
+
+	want, err := yamlSource.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	jsonSource, err := NewSource("testdata/notification.json")
+	require.NoError(t, err)
+
+	got, err := jsonSource.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, want, got)
+}
+
+func TestExtractSchemaCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	source, err := NewSource("testdata/external/billing.yaml")
+	require.NoError(t, err)
+
+	_, err = source.ExtractSchema(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestExtractSchemaUnsupportedVersion(t *testing.T) {
+	t.Parallel()
+
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	require.NoError(t, os.WriteFile(missing, []byte("info:\n  title: Missing\n  version: 1.0.0\n"), 0644))
+
+	tests := []struct {
+		name    string
+		path    string
+		version string
+		err     string
+	}{
+		{
+			name:    "v2",
+			path:    "testdata/legacy_v2.yaml",
+			version: "2.6.0",
+			err:     "AsyncAPI 2.x detected in testdata/legacy_v2.yaml (2.6.0), only 3.x is supported",
+		},
+		{
+			name: "missing",
+			path: missing,
+			err:  "AsyncAPI version is missing in " + missing + ", only 3.x is supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			source, err := NewSource(tt.path)
+			require.NoError(t, err)
+
+			_, err = source.ExtractSchema(context.Background())
+			require.EqualError(t, err, tt.err)
+
+			var versionErr *UnsupportedVersionError
+			require.ErrorAs(t, err, &versionErr)
+			assert.Equal(t, tt.version, versionErr.Version)
+		})
+	}
+}
+
+func TestGetTypeString(t *testing.T) {
+	node := &asyncapiv3.Schema{Type: "object", Properties: map[string]*asyncapiv3.Schema{
+		"name": {Type: "string"},
+	}}
+	node.Properties["children"] = &asyncapiv3.Schema{Type: "array", Items: &asyncapiv3.Schema{ReferenceTo: node}}
+
+	assert.Equal(t, map[string]any{
+		"name":     "string",
+		"children": []any{"object"},
+	}, getTypeString(node))
+
+	base := &asyncapiv3.Schema{Type: "object", Properties: map[string]*asyncapiv3.Schema{
+		"id":   {Type: "string", Format: "uuid"},
+		"note": {Type: "string"},
+	}}
+	item := &asyncapiv3.Schema{
+		AllOf:      []*asyncapiv3.Schema{{ReferenceTo: base}},
+		Properties: map[string]*asyncapiv3.Schema{"note": {Type: "integer"}},
+	}
+
+	assert.Equal(t, []any{map[string]any{
+		"id":   "string[uuid]",
+		"note": "integer",
+	}}, getTypeString(&asyncapiv3.Schema{Items: item}))
+}
+
+func TestExtractSchemaBindingProtocols(t *testing.T) {
+	ctx := context.Background()
+	source, err := NewSource("testdata/live.yaml")
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+
+	protocols := make(map[string]string)
+	for _, op := range actual.Services[0].Operation {
+		protocols[op.Channel.Name] = op.Channel.Protocol
+	}
+
+	assert.Equal(t, map[string]string{
+		"order.status": "kafka",
+		// Channels without servers are available on all servers in addition to their bindings.
+		"live.orders": "kafka, ws",
+		"live.feed":   "kafka, sse",
+	}, protocols)
+}
+
+func TestExtractSchemaPayloadConstraints(t *testing.T) {
+	ctx := context.Background()
+
+	payload := func(opts ...SourceOpt) map[string]any {
+		source, err := NewSource("testdata/user.yaml", opts...)
+		require.NoError(t, err)
+		actual, err := source.ExtractSchema(ctx)
+		require.NoError(t, err)
+
+		for _, service := range actual.Services {
+			for _, op := range service.Operation {
+				if op.Reply == nil {
+					continue
+				}
+
+				for _, msg := range op.Reply.Messages {
+					if msg.Name == "UserInfoReplyMessage" {
+						var fields map[string]any
+						require.NoError(t, json.Unmarshal([]byte(msg.Payload), &fields))
+						return fields
+					}
+				}
+			}
+		}
+
+		require.Fail(t, "UserInfoReplyMessage not found")
+		return nil
+	}
+
+	fields := payload()
+	assert.Equal(t, "string[uuid]", fields["user_id"])
+	assert.Equal(t, "string", fields["language"])
+
+	fields = payload(WithPayloadConstraints(true))
+	assert.Equal(t, "string[uuid,required]", fields["user_id"])
+	assert.Equal(t, "string[email]", fields["email"])
+	assert.Equal(t, "string[pattern:^[a-z]{2}-[A-Z]{2}$]", fields["language"])
+	assert.Equal(t, map[string]any{"code": "string", "message": "string"}, fields["error"])
+}
+
+func TestExtractSchemaTypeFormatter(t *testing.T) {
+	t.Parallel()
+
+	spec := filepath.Join(t.TempDir(), "billing.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte(`asyncapi: 3.0.0
+info:
+  title: Billing Service
+  version: 1.0.0
+channels:
+  invoice.issued:
+    address: invoice.issued
+    messages:
+      InvoiceIssued:
+        $ref: '#/components/messages/InvoiceIssued'
+operations:
+  sendInvoiceIssued:
+    action: send
+    channel:
+      $ref: '#/channels/invoice.issued'
+    messages:
+      - $ref: '#/channels/invoice.issued/messages/InvoiceIssued'
+components:
+  messages:
+    InvoiceIssued:
+      name: InvoiceIssuedMessage
+      headers:
+        type: object
+        properties:
+          customer_email:
+            type: string
+            x-pii: true
+      payload:
+        type: object
+        required:
+          - invoice_id
+          - total
+        properties:
+          invoice_id:
+            type: string
+            format: uuid
+          total:
+            $ref: '#/components/schemas/Money'
+          lines:
+            type: array
+            items:
+              type: object
+              properties:
+                price:
+                  $ref: '#/components/schemas/Money'
+  schemas:
+    Money:
+      type: number
+      minimum: 0
+      x-currency: USD
+`), 0644))
+
+	formatter := func(schema *Schema) (string, bool) {
+		if currency, ok := schema.Extensions["x-currency"].(string); ok {
+			return "money[" + currency + "]", true
+		}
+		if schema.Extensions["x-pii"] == true {
+			return schema.Type + "[pii]", true
+		}
+		return "", false
+	}
+
+	message := func(opts ...SourceOpt) messageflow.Message {
+		source, err := NewSource(spec, opts...)
+		require.NoError(t, err)
+		actual, err := source.ExtractSchema(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, actual.Services, 1)
+		require.Len(t, actual.Services[0].Operation, 1)
+		require.Len(t, actual.Services[0].Operation[0].Channel.Messages, 1)
+
+		return actual.Services[0].Operation[0].Channel.Messages[0]
+	}
+
+	msg := message()
+	assert.JSONEq(t, `{"invoice_id": "string[uuid]", "total": "number", "lines": [{"price": "number"}]}`, msg.Payload)
+	assert.JSONEq(t, `{"customer_email": "string"}`, msg.Headers)
+
+	msg = message(WithTypeFormatter(formatter))
+	assert.JSONEq(t, `{"invoice_id": "string[uuid]", "total": "money[USD]", "lines": [{"price": "money[USD]"}]}`,
+		msg.Payload)
+	assert.JSONEq(t, `{"customer_email": "string[pii]"}`, msg.Headers)
+
+	msg = message(WithTypeFormatter(formatter), WithPayloadConstraints(true))
+	assert.JSONEq(t, `{"invoice_id": "string[uuid,required]", "total": "money[USD,required,minimum:0]", "lines": [{"price": "money[USD,minimum:0]"}]}`,
+		msg.Payload)
+}
+
+func TestExtractSchemaPayloadConstraintsZeroLimits(t *testing.T) {
+	t.Parallel()
+
+	spec := writeSpec(t, `asyncapi: 3.0.0
+info:
+  title: Inventory Service
+  version: 1.0.0
+channels:
+  stock.changed:
+    address: stock.changed
+    messages:
+      StockChanged:
+        $ref: '#/components/messages/StockChanged'
+operations:
+  sendStockChanged:
+    action: send
+    channel:
+      $ref: '#/channels/stock.changed'
+    messages:
+      - $ref: '#/channels/stock.changed/messages/StockChanged'
+components:
+  messages:
+    StockChanged:
+      name: StockChangedMessage
+      payload:
+        type: object
+        required:
+          - count
+        properties:
+          count:
+            type: integer
+            minimum: 0
+          warehouse:
+            type: string
+            enum: [north, south]
+            pattern: ^[a-z]+$
+          sku:
+            $ref: '#/components/schemas/Sku'
+  schemas:
+    Sku:
+      type: string
+      minLength: 0
+`)
+
+	source, err := NewSource(spec, WithPayloadConstraints(true))
+	require.NoError(t, err)
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, actual.Services, 1)
+	require.Len(t, actual.Services[0].Operation, 1)
+	require.Len(t, actual.Services[0].Operation[0].Channel.Messages, 1)
+
+	assert.JSONEq(t, `{
+  "count": "integer[required,minimum:0]",
+  "sku": "string[minLength:0]",
+  "warehouse": "string[enum:north,south,pattern:^[a-z]+$]"
+}`, actual.Services[0].Operation[0].Channel.Messages[0].Payload)
+}
+
+func TestFlattenSchemaConstraints(t *testing.T) {
+	base := &asyncapiv3.Schema{Type: "object", Properties: map[string]*asyncapiv3.Schema{
+		"id": {Type: "string", Format: "uuid"},
+	}}
+	base.Required = []string{"id"}
+
+	schema := &asyncapiv3.Schema{
+		AllOf: []*asyncapiv3.Schema{{ReferenceTo: base}},
+		Properties: map[string]*asyncapiv3.Schema{
+			"name":   {Type: "string"},
+			"status": {Type: "string"},
+			"tags":   {Type: "array", Items: &asyncapiv3.Schema{Type: "string"}},
+		},
+	}
+	schema.Properties["status"].Enum = []any{"active", "blocked"}
+	schema.Properties["name"].MinLength = 1
+	schema.Properties["name"].MaxLength = 64
+	schema.Properties["tags"].Items.MaxLength = 16
+	schema.Required = []string{"status", "tags"}
+
+	count := &asyncapiv3.Schema{Type: "integer"}
+	count.Maximum = 2.5
+	schema.Properties["count"] = count
+
+	assert.Equal(t, map[string]any{
+		"id":     "string[uuid,required]",
+		"name":   "string[minLength:1,maxLength:64]",
+		"status": "string[required,enum:active,blocked]",
+		"tags":   []any{"string[maxLength:16]"},
+		"count":  "integer[maximum:2.5]",
+	}, flattenSchema(schema, flattenOptions{constraints: true}, make(map[*asyncapiv3.Schema]bool)))
+
+	assert.Equal(t, map[string]any{
+		"id":     "string[uuid]",
+		"name":   "string",
+		"status": "string[enum:active,blocked]",
+		"tags":   []any{"string"},
+		"count":  "integer",
+	}, getTypeString(schema))
+}
+
+// writeSpec writes the specification to a temporary file, returning its path.
+func writeSpec(t *testing.T, spec string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "spec.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(spec), 0644))
+
+	return path
+}
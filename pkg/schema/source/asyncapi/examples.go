@@ -0,0 +1,161 @@
+package asyncapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	asyncapiv3 "github.com/lerenn/asyncapi-codegen/pkg/asyncapi/v3"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// ExampleMismatch is a message example that doesn't match the payload schema of the message,
+// see WithValidateExamples.
+type ExampleMismatch struct {
+	Operation string `json:"operation"`
+	Message   string `json:"message"`
+	// Example is the index of the example in the message examples.
+	Example int    `json:"example"`
+	Details string `json:"details"`
+}
+
+// String returns a human readable description of the mismatch.
+func (m ExampleMismatch) String() string {
+	return fmt.Sprintf("example %d of message '%s' in operation '%s' doesn't match the payload schema: %s",
+		m.Example+1, m.Message, m.Operation, m.Details)
+}
+
+// payloadResource is the location payload schemas are compiled from.
+const payloadResource = "payload.json"
+
+// exampleMismatches validates examples of messages used by operations against payload schemas of the messages.
+// Messages shared by several operations are reported once. Payloads in non JSON schema formats and schemas
+// that can't be compiled, e.g. with recursive references, are skipped.
+func (s *Source) exampleMismatches(spec *asyncapiv3.Specification, raw rawSpec) []ExampleMismatch {
+	var (
+		mismatches []ExampleMismatch
+		validated  = make(map[*asyncapiv3.Message]bool)
+	)
+
+	for _, id := range orderedOperationIDs(spec, raw) {
+		op := spec.Operations[id]
+
+		refs := op.Messages
+		if op.Reply != nil {
+			refs = append(refs[:len(refs):len(refs)], op.Reply.Messages...)
+		}
+
+		for _, msgRef := range refs {
+			msg, ref := followMessage(msgRef)
+			if msg == nil || msg.Payload == nil || len(msg.Examples) == 0 || validated[msg] {
+				continue
+			}
+			validated[msg] = true
+
+			if format, _, ok := raw.payloadSchema(ref); ok && !isJSONSchemaFormat(format) {
+				continue
+			}
+
+			schema, err := compilePayloadSchema(raw.rawJSONSchema(msg.Payload, raw.messageSchemaNode(ref, "payload"), nil))
+			if err != nil {
+				continue
+			}
+
+			for i, example := range msg.Examples {
+				for example != nil && example.ReferenceTo != nil {
+					example = example.ReferenceTo
+				}
+
+				if example == nil || example.Payload == nil {
+					continue
+				}
+
+				if err := validateExample(schema, example.Payload); err != nil {
+					mismatches = append(mismatches, ExampleMismatch{
+						Operation: id,
+						Message:   s.extractMessageName(msg),
+						Example:   i,
+						Details:   err.Error(),
+					})
+				}
+			}
+		}
+	}
+
+	return mismatches
+}
+
+// compilePayloadSchema compiles the payload schema of a message, AsyncAPI schemas are a superset of draft-07.
+func compilePayloadSchema(payload map[string]any) (*jsonschema.Schema, error) {
+	doc, err := jsonValue(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft7)
+
+	if err := compiler.AddResource(payloadResource, doc); err != nil {
+		return nil, fmt.Errorf("adding schema: %w", err)
+	}
+
+	schema, err := compiler.Compile(payloadResource)
+	if err != nil {
+		return nil, fmt.Errorf("compiling schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// validateExample validates the example payload against the schema, returning violations joined by semicolon.
+func validateExample(schema *jsonschema.Schema, payload any) error {
+	value, err := jsonValue(payload)
+	if err != nil {
+		return err
+	}
+
+	err = schema.Validate(value)
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	printer := message.NewPrinter(language.English)
+
+	var violations []string
+	for _, cause := range leafErrors(validationErr) {
+		violations = append(violations, fmt.Sprintf("at '/%s': %s",
+			strings.Join(cause.InstanceLocation, "/"), cause.ErrorKind.LocalizedString(printer)))
+	}
+
+	return errors.New(strings.Join(violations, "; "))
+}
+
+// leafErrors returns the most specific causes of the validation error.
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+
+	return leaves
+}
+
+// jsonValue converts the value into the form the validator expects, numbers are kept as json.Number.
+func jsonValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling value: %w", err)
+	}
+
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
@@ -0,0 +1,197 @@
+package asyncapi
+
+import (
+	"slices"
+	"strings"
+
+	asyncapiv3 "github.com/lerenn/asyncapi-codegen/pkg/asyncapi/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// messageTraitsPrefix is the prefix of local references to message traits.
+const messageTraitsPrefix = "#/components/messageTraits/"
+
+// detachMessageTraits removes traits from messages of the specification, returning them by message.
+// The parser merges trait payloads into message headers, so traits are applied by applyMessageTraits instead.
+func detachMessageTraits(spec *asyncapiv3.Specification) map[*asyncapiv3.Message][]*asyncapiv3.MessageTrait {
+	traits := make(map[*asyncapiv3.Message][]*asyncapiv3.MessageTrait)
+
+	detach := func(messages map[string]*asyncapiv3.Message) {
+		for _, msg := range messages {
+			if msg != nil && len(msg.Traits) > 0 {
+				traits[msg] = msg.Traits
+				msg.Traits = nil
+			}
+		}
+	}
+
+	for _, ch := range spec.Channels {
+		if ch != nil {
+			detach(ch.Messages)
+		}
+	}
+	for _, ch := range spec.Components.Channels {
+		if ch != nil {
+			detach(ch.Messages)
+		}
+	}
+	detach(spec.Components.Messages)
+
+	return traits
+}
+
+// applyMessageTraits merges detached traits into their messages once the specification is processed.
+// Fields defined by the message take precedence over traits, and traits over the ones following them.
+// Traits referencing other files are skipped.
+func applyMessageTraits(spec *asyncapiv3.Specification, traits map[*asyncapiv3.Message][]*asyncapiv3.MessageTrait) {
+	for msg, msgTraits := range traits {
+		for _, trait := range msgTraits {
+			if trait = resolveMessageTrait(spec, trait); trait != nil {
+				applyMessageTrait(msg, trait)
+			}
+		}
+	}
+}
+
+// resolveMessageTrait follows local references of the trait to message traits in components.
+func resolveMessageTrait(spec *asyncapiv3.Specification, trait *asyncapiv3.MessageTrait) *asyncapiv3.MessageTrait {
+	for trait != nil && trait.Reference != "" {
+		name, ok := strings.CutPrefix(trait.Reference, messageTraitsPrefix)
+		if !ok {
+			return nil
+		}
+
+		trait = spec.Components.MessageTraits[strings.NewReplacer("~1", "/", "~0", "~").Replace(name)]
+	}
+
+	return trait
+}
+
+// applyMessageTrait fills fields of the message the trait defines and the message doesn't.
+func applyMessageTrait(msg *asyncapiv3.Message, trait *asyncapiv3.MessageTrait) {
+	msg.Headers = mergeTraitSchema(msg.Headers, trait.Headers)
+	msg.Payload = mergeTraitSchema(msg.Payload, trait.Payload)
+
+	if msg.CorrelationID == nil {
+		msg.CorrelationID = trait.CorrelationID
+	}
+
+	if msg.ContentType == "" {
+		msg.ContentType = trait.ContentType
+	}
+
+	if msg.Name == "" {
+		msg.Name = trait.Name
+	}
+
+	if msg.Title == "" {
+		msg.Title = trait.Title
+	}
+
+	if msg.Summary == "" {
+		msg.Summary = trait.Summary
+	}
+
+	msg.Examples = append(msg.Examples, trait.Examples...)
+}
+
+// mergeTraitSchema returns the schema with properties of the trait schema it doesn't define added.
+// Schemas are copied rather than modified, as they may be shared by other messages.
+func mergeTraitSchema(schema, trait *asyncapiv3.Schema) *asyncapiv3.Schema {
+	if trait == nil {
+		return schema
+	}
+
+	for trait.ReferenceTo != nil {
+		trait = trait.ReferenceTo
+	}
+
+	if schema == nil {
+		merged := *trait
+		return &merged
+	}
+
+	for schema.ReferenceTo != nil {
+		schema = schema.ReferenceTo
+	}
+
+	merged := *schema
+
+	if merged.Type == "" {
+		merged.Type = trait.Type
+	}
+
+	merged.Properties = make(map[string]*asyncapiv3.Schema, len(schema.Properties)+len(trait.Properties))
+	for name, prop := range trait.Properties {
+		merged.Properties[name] = prop
+	}
+	for name, prop := range schema.Properties {
+		merged.Properties[name] = prop
+	}
+
+	merged.Required = slices.Clone(schema.Required)
+	for _, name := range trait.Required {
+		if !slices.Contains(merged.Required, name) {
+			merged.Required = append(merged.Required, name)
+		}
+	}
+
+	return &merged
+}
+
+// rawOperationTrait holds fields of operation traits the source reads from the raw specification.
+type rawOperationTrait struct {
+	Ref         string   `yaml:"$ref"`
+	Tags        []rawTag `yaml:"tags"`
+	Summary     string   `yaml:"summary"`
+	Description string   `yaml:"description"`
+}
+
+// applyOperationTraits fills the summary and description of the operation from its traits
+// when it doesn't define them, and appends tags of the traits.
+func (r rawSpec) applyOperationTraits(op rawOperation) rawOperation {
+	for _, trait := range op.Traits {
+		if trait.Ref != "" {
+			var ok bool
+			if trait, ok = r.operationTrait(trait.Ref); !ok {
+				continue
+			}
+		}
+
+		if op.Summary == "" {
+			op.Summary = trait.Summary
+		}
+
+		if op.Description == "" {
+			op.Description = trait.Description
+		}
+
+		for _, tag := range trait.Tags {
+			if !slices.Contains(op.Tags, tag) {
+				op.Tags = append(op.Tags, tag)
+			}
+		}
+	}
+
+	return op
+}
+
+// operationTrait returns the operation trait the local reference points to.
+func (r rawSpec) operationTrait(ref string) (rawOperationTrait, bool) {
+	node, ok := r.resolve(ref)
+	if !ok {
+		return rawOperationTrait{}, false
+	}
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return rawOperationTrait{}, false
+	}
+
+	var trait rawOperationTrait
+	if err := yaml.Unmarshal(data, &trait); err != nil {
+		return rawOperationTrait{}, false
+	}
+
+	return trait, true
+}
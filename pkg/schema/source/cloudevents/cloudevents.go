@@ -0,0 +1,250 @@
+// Package cloudevents provides functionality for extracting message flow schemas from
+// event catalogs described as CloudEvents type definitions.
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/source/internal/jsonschema"
+)
+
+// Ensure Source implements messageflow interfaces.
+var (
+	_ messageflow.Source = (*Source)(nil)
+)
+
+// dataSchemaExt is the extension of data schema files referenced by definitions.
+const dataSchemaExt = ".schema.json"
+
+// Definition describes a CloudEvents type of the catalog.
+// DataSchema is either an inline JSON schema or a path to one relative to the definition file.
+type Definition struct {
+	Type       string          `json:"type"`
+	Source     string          `json:"source"`
+	DataSchema json.RawMessage `json:"dataschema,omitempty"`
+}
+
+// Source represents a directory of CloudEvents type definitions for schema extraction.
+type Source struct {
+	dir         string
+	subscribers map[string][]string
+}
+
+// SourceOpt is a function type that allows customization of a Source instance.
+type SourceOpt func(*Source)
+
+// WithSubscribers returns a SourceOpt that sets event types received by each service.
+// Definitions only describe the sending service, so without this mapping
+// the extracted schema contains no receivers.
+func WithSubscribers(subscribers map[string][]string) SourceOpt {
+	return func(s *Source) {
+		s.subscribers = subscribers
+	}
+}
+
+// NewSource creates a new CloudEvents source reading *.json definitions from dir and its subdirectories.
+// A file contains either a single definition or an array of them, *.schema.json files are data schemas.
+func NewSource(dir string, opts ...SourceOpt) (*Source, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog dir %s: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("catalog %s is not a directory", dir)
+	}
+
+	s := &Source{dir: dir}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// ExtractSchema extracts messageflow schema from the catalog.
+// Each event type becomes a channel sent by the service named after the event source,
+// with the data schema flattened into the message payload.
+func (s *Source) ExtractSchema(_ context.Context) (messageflow.Schema, error) {
+	channels := make(map[string]messageflow.Channel)
+	senders := make(map[string][]string)
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := strings.ToLower(d.Name())
+		if d.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, dataSchemaExt) {
+			return nil
+		}
+
+		definitions, err := readDefinitions(path)
+		if err != nil {
+			return err
+		}
+
+		for _, def := range definitions {
+			if def.Type == "" || def.Source == "" {
+				return fmt.Errorf("definition in %s: type and source are required", path)
+			}
+
+			if _, ok := channels[def.Type]; ok {
+				return fmt.Errorf("definition in %s: duplicate type %s", path, def.Type)
+			}
+
+			channel, err := definitionChannel(def, filepath.Dir(path))
+			if err != nil {
+				return fmt.Errorf("definition %s in %s: %w", def.Type, path, err)
+			}
+
+			channels[def.Type] = channel
+			senders[def.Source] = append(senders[def.Source], def.Type)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return messageflow.Schema{}, fmt.Errorf("reading catalog %s: %w", s.dir, err)
+	}
+
+	operations := make(map[string][]messageflow.Operation)
+
+	for source, types := range senders {
+		sort.Strings(types)
+		for _, typ := range types {
+			operations[source] = append(operations[source], messageflow.Operation{
+				Action:  messageflow.ActionSend,
+				Channel: channels[typ],
+			})
+		}
+	}
+
+	for service, types := range s.subscribers {
+		for _, typ := range types {
+			channel, ok := channels[typ]
+			if !ok {
+				channel = messageflow.Channel{Name: typ, Messages: []messageflow.Message{}}
+			}
+
+			operations[service] = append(operations[service], messageflow.Operation{
+				Action:  messageflow.ActionReceive,
+				Channel: channel,
+			})
+		}
+	}
+
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := make([]messageflow.Service, 0, len(names))
+	for _, name := range names {
+		services = append(services, messageflow.Service{
+			Name:      name,
+			Operation: operations[name],
+		})
+	}
+
+	return messageflow.Schema{
+		Services: services,
+	}, nil
+}
+
+// readDefinitions reads a single definition or an array of definitions from the file.
+func readDefinitions(path string) ([]Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", path, err)
+	}
+
+	data = []byte(strings.TrimSpace(string(data)))
+
+	if strings.HasPrefix(string(data), "[") {
+		var definitions []Definition
+		if err := json.Unmarshal(data, &definitions); err != nil {
+			return nil, fmt.Errorf("unmarshalling definitions %s: %w", path, err)
+		}
+
+		return definitions, nil
+	}
+
+	var definition Definition
+	if err := json.Unmarshal(data, &definition); err != nil {
+		return nil, fmt.Errorf("unmarshalling definition %s: %w", path, err)
+	}
+
+	return []Definition{definition}, nil
+}
+
+// definitionChannel creates a channel named after the event type carrying a message with the data schema.
+func definitionChannel(def Definition, dir string) (messageflow.Channel, error) {
+	schema, err := dataSchema(def.DataSchema, dir)
+	if err != nil {
+		return messageflow.Channel{}, err
+	}
+
+	name, _ := schema["title"].(string)
+	if name == "" {
+		name = def.Type
+	}
+
+	payload := jsonschema.Flatten(schema)
+	if _, ok := payload.(map[string]any); !ok {
+		payload = map[string]any{}
+	}
+
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return messageflow.Channel{}, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	return messageflow.Channel{
+		Name: def.Type,
+		Messages: []messageflow.Message{
+			{
+				Name:    name,
+				Payload: string(data),
+			},
+		},
+	}, nil
+}
+
+// dataSchema returns the inline data schema or reads the referenced one relative to dir.
+func dataSchema(raw json.RawMessage, dir string) (map[string]any, error) {
+	if len(raw) == 0 {
+		return map[string]any{}, nil
+	}
+
+	var ref string
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		if strings.Contains(ref, "://") {
+			return nil, fmt.Errorf("remote dataschema %s is not supported", ref)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+		if err != nil {
+			return nil, fmt.Errorf("reading dataschema: %w", err)
+		}
+
+		raw = data
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("unmarshalling dataschema: %w", err)
+	}
+
+	return schema, nil
+}
@@ -0,0 +1,95 @@
+package cloudevents
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSchema(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewSource("testdata/catalog", WithSubscribers(map[string][]string{
+		"notification-service": {"com.example.user.created", "com.example.order.placed"},
+	}))
+	require.NoError(t, err)
+
+	schema, err := s.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	userCreated := messageflow.Channel{
+		Name: "com.example.user.created",
+		Messages: []messageflow.Message{
+			{
+				Name: "UserCreated",
+				Payload: `{
+  "id": "string[uuid]",
+  "roles": [
+    "string[enum:admin,member]"
+  ]
+}`,
+			},
+		},
+	}
+
+	orderPlaced := messageflow.Channel{
+		Name: "com.example.order.placed",
+		Messages: []messageflow.Message{
+			{
+				Name: "com.example.order.placed",
+				Payload: `{
+  "order_id": "string",
+  "total": "number"
+}`,
+			},
+		},
+	}
+
+	userDeleted := messageflow.Channel{
+		Name:     "com.example.user.deleted",
+		Messages: []messageflow.Message{{Name: "com.example.user.deleted", Payload: "{}"}},
+	}
+
+	assert.Equal(t, messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "notification-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: userCreated},
+					{Action: messageflow.ActionReceive, Channel: orderPlaced},
+				},
+			},
+			{
+				Name: "order-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: orderPlaced},
+				},
+			},
+			{
+				Name: "user-service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: userCreated},
+					{Action: messageflow.ActionSend, Channel: userDeleted},
+				},
+			},
+		},
+	}, schema)
+}
+
+func TestExtractSchemaInvalidDefinition(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "event.json"), []byte(`{"type": "com.example.event"}`), 0644))
+
+	s, err := NewSource(dir)
+	require.NoError(t, err)
+
+	_, err = s.ExtractSchema(context.Background())
+	require.ErrorContains(t, err, "type and source are required")
+}
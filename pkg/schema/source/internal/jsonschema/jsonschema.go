@@ -0,0 +1,73 @@
+// Package jsonschema flattens JSON schemas into message payloads shared by schema sources.
+package jsonschema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Flatten returns a type string representation of the JSON schema, in the form used for message payloads:
+// objects become maps of their properties, arrays single element slices and other types strings
+// like "string[uuid]" or "string[enum:a,b]".
+func Flatten(schema map[string]any) any {
+	typ, _ := schema["type"].(string)
+
+	switch typ {
+	case "object":
+		props, ok := schema["properties"].(map[string]any)
+		if !ok || len(props) == 0 {
+			return "object"
+		}
+
+		result := make(map[string]any)
+		for name, p := range props {
+			prop, _ := p.(map[string]any)
+			result[name] = Flatten(prop)
+		}
+
+		return result
+	case "array":
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return []any{}
+		}
+
+		return []any{Flatten(items)}
+	case "":
+		return "string"
+	}
+
+	if format, ok := schema["format"].(string); ok {
+		return ScalarType(typ, format)
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return ScalarType(typ, EnumToken(enum))
+	}
+
+	return typ
+}
+
+// ScalarType returns the type string of a scalar field with the tokens, such as its format, constraints
+// or enum values, in brackets, e.g. "string[uuid]". Fields without a type are strings.
+func ScalarType(typ string, tokens ...string) string {
+	if typ == "" {
+		typ = "string"
+	}
+
+	if len(tokens) == 0 {
+		return typ
+	}
+
+	return typ + "[" + strings.Join(tokens, ",") + "]"
+}
+
+// EnumToken returns the token listing the enum values, e.g. "enum:a,b".
+func EnumToken(values []any) string {
+	tokens := make([]string, len(values))
+	for i, v := range values {
+		tokens[i] = fmt.Sprintf("%v", v)
+	}
+
+	return "enum:" + strings.Join(tokens, ",")
+}
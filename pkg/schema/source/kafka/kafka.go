@@ -0,0 +1,214 @@
+// Package kafka provides functionality for extracting message flow schemas from Kafka topics
+// and their schemas registered in a Confluent compatible Schema Registry.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// Ensure Source implements messageflow interfaces.
+var (
+	_ messageflow.Source = (*Source)(nil)
+)
+
+// ServiceTopics lists topics a service produces to and consumes from.
+type ServiceTopics struct {
+	Produces []string
+	Consumes []string
+}
+
+// TopicNameStrategy maps a Schema Registry subject to a topic name.
+// It returns false for subjects which don't describe topic messages.
+type TopicNameStrategy func(subject string) (string, bool)
+
+// DefaultTopicNameStrategy implements the Confluent TopicNameStrategy, where message values
+// of a topic are registered under the "<topic>-value" subject.
+func DefaultTopicNameStrategy(subject string) (string, bool) {
+	return strings.CutSuffix(subject, "-value")
+}
+
+// Source represents a Kafka Schema Registry source for schema extraction.
+type Source struct {
+	registryURL       string
+	client            *http.Client
+	topicNameStrategy TopicNameStrategy
+	services          map[string]ServiceTopics
+}
+
+// SourceOpt is a function type that allows customization of a Source instance.
+type SourceOpt func(*Source)
+
+// WithHTTPClient returns a SourceOpt that sets the client used to query the Schema Registry.
+func WithHTTPClient(client *http.Client) SourceOpt {
+	return func(s *Source) {
+		s.client = client
+	}
+}
+
+// WithTopicNameStrategy returns a SourceOpt that sets how subjects are mapped to topics.
+// DefaultTopicNameStrategy is used by default.
+func WithTopicNameStrategy(strategy TopicNameStrategy) SourceOpt {
+	return func(s *Source) {
+		s.topicNameStrategy = strategy
+	}
+}
+
+// WithServices returns a SourceOpt that sets topics produced and consumed by each service.
+// Producers and consumers can't be inferred from the registry, so without this mapping
+// the extracted schema contains no services.
+func WithServices(services map[string]ServiceTopics) SourceOpt {
+	return func(s *Source) {
+		s.services = services
+	}
+}
+
+// NewSource creates a new Kafka source reading schemas from the Schema Registry at registryURL.
+func NewSource(registryURL string, opts ...SourceOpt) (*Source, error) {
+	if _, err := url.ParseRequestURI(registryURL); err != nil {
+		return nil, fmt.Errorf("parsing registry url %s: %w", registryURL, err)
+	}
+
+	s := &Source{
+		registryURL:       strings.TrimSuffix(registryURL, "/"),
+		client:            http.DefaultClient,
+		topicNameStrategy: DefaultTopicNameStrategy,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s, nil
+}
+
+// ExtractSchema extracts messageflow schema from the latest schemas of registered subjects.
+// Each topic becomes a channel with the schema flattened into the message payload.
+func (s *Source) ExtractSchema(ctx context.Context) (messageflow.Schema, error) {
+	messages, err := s.topicMessages(ctx)
+	if err != nil {
+		return messageflow.Schema{}, err
+	}
+
+	names := make([]string, 0, len(s.services))
+	for name := range s.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	services := make([]messageflow.Service, 0, len(names))
+
+	for _, name := range names {
+		service := messageflow.Service{
+			Name:      name,
+			Operation: []messageflow.Operation{},
+		}
+
+		for _, topic := range s.services[name].Produces {
+			service.Operation = append(service.Operation, topicOperation(messageflow.ActionSend, topic, messages))
+		}
+
+		for _, topic := range s.services[name].Consumes {
+			service.Operation = append(service.Operation, topicOperation(messageflow.ActionReceive, topic, messages))
+		}
+
+		services = append(services, service)
+	}
+
+	return messageflow.Schema{
+		Services: services,
+	}, nil
+}
+
+// topicOperation creates an operation on the topic. Topics without registered schema have no messages.
+func topicOperation(action messageflow.Action, topic string, messages map[string]messageflow.Message) messageflow.Operation {
+	channel := messageflow.Channel{
+		Name:     topic,
+		Messages: []messageflow.Message{},
+	}
+
+	if msg, ok := messages[topic]; ok {
+		channel.Messages = append(channel.Messages, msg)
+	}
+
+	return messageflow.Operation{
+		Action:  action,
+		Channel: channel,
+	}
+}
+
+// registrySchema is the latest version of a subject returned by the Schema Registry.
+type registrySchema struct {
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+}
+
+// topicMessages fetches the latest schema of every topic subject and converts it to a message.
+func (s *Source) topicMessages(ctx context.Context) (map[string]messageflow.Message, error) {
+	var subjects []string
+	if err := s.get(ctx, "/subjects", &subjects); err != nil {
+		return nil, fmt.Errorf("listing subjects: %w", err)
+	}
+
+	messages := make(map[string]messageflow.Message)
+
+	for _, subject := range subjects {
+		topic, ok := s.topicNameStrategy(subject)
+		if !ok {
+			continue
+		}
+
+		var schema registrySchema
+		if err := s.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/latest", &schema); err != nil {
+			return nil, fmt.Errorf("fetching latest schema of subject %s: %w", subject, err)
+		}
+
+		msg, err := schemaMessage(schema)
+		if err != nil {
+			return nil, fmt.Errorf("converting schema of subject %s: %w", subject, err)
+		}
+
+		if msg.Name == "" {
+			msg.Name = topic
+		}
+
+		messages[topic] = msg
+	}
+
+	return messages, nil
+}
+
+// get performs a GET request to the Schema Registry decoding the JSON response into v.
+func (s *Source) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.registryURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting %s: unexpected status %s", path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding response of %s: %w", path, err)
+	}
+
+	return nil
+}
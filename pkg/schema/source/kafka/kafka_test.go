@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userCreatedAvro = `{
+  "type": "record",
+  "name": "UserCreated",
+  "fields": [
+    {"name": "user_id", "type": {"type": "string", "logicalType": "uuid"}},
+    {"name": "email", "type": ["null", "string"]},
+    {"name": "age", "type": "int"},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "BLOCKED"]}},
+    {"name": "previous_status", "type": ["null", "Status"]},
+    {"name": "tags", "type": {"type": "array", "items": "string"}}
+  ]
+}`
+
+const orderPlacedProto = `syntax = "proto3";
+
+message OrderPlaced {
+  string order_id = 1;
+  repeated Item items = 2;
+  oneof payment {
+    string card_id = 3;
+    string wallet_id = 4;
+  }
+  map<string, string> labels = 5;
+
+  message Ignored {
+    string ignored = 1;
+  }
+}
+
+message Item {
+  string sku = 1;
+  int32 quantity = 2;
+  double price = 3;
+}
+`
+
+func newRegistry(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	schemas := map[string]registrySchema{
+		"user.created-value": {Subject: "user.created-value", Version: 2, Schema: userCreatedAvro},
+		"order.placed-value": {Subject: "order.placed-value", Version: 1, SchemaType: schemaTypeProtobuf, Schema: orderPlacedProto},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subjects", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode([]string{"user.created-key", "user.created-value", "order.placed-value"})
+	})
+	mux.HandleFunc("/subjects/{subject}/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		schema, ok := schemas[r.PathValue("subject")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(schema)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestExtractSchema(t *testing.T) {
+	t.Parallel()
+
+	registry := newRegistry(t)
+
+	source, err := NewSource(registry.URL, WithServices(map[string]ServiceTopics{
+		"User Service":  {Produces: []string{"user.created"}},
+		"Order Service": {Produces: []string{"order.placed"}, Consumes: []string{"user.created", "payment.done"}},
+	}))
+	require.NoError(t, err)
+
+	actual, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	userCreated := messageflow.Message{
+		Name: "UserCreated",
+		Payload: `{
+  "age": "integer",
+  "email": "string",
+  "previous_status": "string[enum:ACTIVE,BLOCKED]",
+  "status": "string[enum:ACTIVE,BLOCKED]",
+  "tags": [
+    "string"
+  ],
+  "user_id": "string[uuid]"
+}`,
+	}
+
+	orderPlaced := messageflow.Message{
+		Name: "OrderPlaced",
+		Payload: `{
+  "card_id": "string",
+  "items": [
+    {
+      "price": "number",
+      "quantity": "integer",
+      "sku": "string"
+    }
+  ],
+  "labels": "object",
+  "order_id": "string",
+  "wallet_id": "string"
+}`,
+	}
+
+	expected := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "order.placed", Messages: []messageflow.Message{orderPlaced}},
+					},
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "user.created", Messages: []messageflow.Message{userCreated}},
+					},
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "payment.done", Messages: []messageflow.Message{}},
+					},
+				},
+			},
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created", Messages: []messageflow.Message{userCreated}},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, expected, actual)
+}
+
+func TestExtractSchemaRegistryError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	source, err := NewSource(server.URL)
+	require.NoError(t, err)
+
+	_, err = source.ExtractSchema(context.Background())
+	require.Error(t, err)
+}
@@ -0,0 +1,288 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/source/internal/jsonschema"
+)
+
+// Schema types supported by the Schema Registry, AVRO is assumed when the type is empty.
+const (
+	schemaTypeAvro     = "AVRO"
+	schemaTypeProtobuf = "PROTOBUF"
+	schemaTypeJSON     = "JSON"
+)
+
+// schemaMessage converts a registry schema into a message with a flattened JSON payload.
+func schemaMessage(schema registrySchema) (messageflow.Message, error) {
+	var (
+		name    string
+		payload any
+		err     error
+	)
+
+	switch schema.SchemaType {
+	case "", schemaTypeAvro:
+		name, payload, err = avroPayload(schema.Schema)
+	case schemaTypeProtobuf:
+		name, payload = protobufPayload(schema.Schema)
+	case schemaTypeJSON:
+		name, payload, err = jsonSchemaPayload(schema.Schema)
+	default:
+		return messageflow.Message{}, fmt.Errorf("unsupported schema type: %s", schema.SchemaType)
+	}
+
+	if err != nil {
+		return messageflow.Message{}, err
+	}
+
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return messageflow.Message{}, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	return messageflow.Message{
+		Name:    name,
+		Payload: string(data),
+	}, nil
+}
+
+// avroPayload returns the name of the Avro record and its fields flattened into type strings.
+func avroPayload(schema string) (string, any, error) {
+	var root any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return "", nil, fmt.Errorf("unmarshalling avro schema: %w", err)
+	}
+
+	name := ""
+	if record, ok := root.(map[string]any); ok {
+		name, _ = record["name"].(string)
+	}
+
+	return name, avroType(root, make(map[string]any)), nil
+}
+
+// avroType returns a type string representation of the Avro type.
+// Named types are collected into named so they can be referenced later in the schema.
+func avroType(t any, named map[string]any) any {
+	switch v := t.(type) {
+	case string:
+		if ref, ok := named[v]; ok {
+			return ref
+		}
+
+		return avroPrimitive(v)
+	case []any:
+		// Unions are usually used to make a field nullable, so the first non null branch is used.
+		for _, branch := range v {
+			if branch != "null" {
+				return avroType(branch, named)
+			}
+		}
+
+		return "null"
+	case map[string]any:
+		var result any
+
+		switch v["type"] {
+		case "record":
+			props := make(map[string]any)
+			if fields, ok := v["fields"].([]any); ok {
+				for _, f := range fields {
+					field, ok := f.(map[string]any)
+					if !ok {
+						continue
+					}
+
+					fieldName, _ := field["name"].(string)
+					props[fieldName] = avroType(field["type"], named)
+				}
+			}
+
+			result = props
+		case "enum":
+			symbols := []string{}
+			if values, ok := v["symbols"].([]any); ok {
+				for _, symbol := range values {
+					symbols = append(symbols, fmt.Sprintf("%v", symbol))
+				}
+			}
+
+			result = "string[enum:" + strings.Join(symbols, ",") + "]"
+		case "array":
+			result = []any{avroType(v["items"], named)}
+		case "map":
+			result = "object"
+		case "fixed":
+			result = "string"
+		default:
+			typ, _ := v["type"].(string)
+
+			result = avroPrimitive(typ)
+			if logicalType, ok := v["logicalType"].(string); ok {
+				result = fmt.Sprintf("%s[%s]", result, logicalType)
+			}
+		}
+
+		if name, ok := v["name"].(string); ok {
+			named[name] = result
+		}
+
+		return result
+	}
+
+	return "string"
+}
+
+// avroPrimitive maps Avro primitive types to JSON types.
+func avroPrimitive(t string) string {
+	switch t {
+	case "int", "long":
+		return "integer"
+	case "float", "double":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "bytes":
+		return "string[bytes]"
+	case "null":
+		return "null"
+	default:
+		return "string"
+	}
+}
+
+var (
+	protoMessageRe = regexp.MustCompile(`(?m)^\s*message\s+(\w+)\s*\{`)
+	protoFieldRe   = regexp.MustCompile(`^\s*(?:repeated\s+|optional\s+)?(map\s*<[^>]+>|[\w.]+)\s+(\w+)\s*=\s*\d+`)
+)
+
+// protobufPayload returns the name of the first message in the proto file and its fields
+// flattened into type strings. Messages defined in the file are expanded in place.
+func protobufPayload(schema string) (string, any) {
+	bodies := make(map[string]string)
+	order := []string{}
+
+	for _, match := range protoMessageRe.FindAllStringSubmatchIndex(schema, -1) {
+		name := schema[match[2]:match[3]]
+		bodies[name] = protoBlock(schema[match[1]:])
+		order = append(order, name)
+	}
+
+	if len(order) == 0 {
+		return "", map[string]any{}
+	}
+
+	return order[0], protoMessage(order[0], bodies, make(map[string]bool))
+}
+
+// protoBlock returns the body of a block starting right after its opening brace.
+func protoBlock(s string) string {
+	depth := 1
+
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[:i]
+			}
+		}
+	}
+
+	return s
+}
+
+// protoMessage converts message fields into type strings. visiting guards against recursive messages.
+func protoMessage(name string, bodies map[string]string, visiting map[string]bool) any {
+	if visiting[name] {
+		return "object"
+	}
+
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	props := make(map[string]any)
+
+	// blocks holds nested blocks of the current line, oneof blocks contain fields of the message itself.
+	var blocks []bool
+
+	for _, line := range strings.Split(bodies[name], "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if !slices.Contains(blocks, false) {
+			if match := protoFieldRe.FindStringSubmatch(line); match != nil {
+				typ := protoType(match[1], bodies, visiting)
+				if strings.HasPrefix(trimmed, "repeated") {
+					typ = []any{typ}
+				}
+
+				props[match[2]] = typ
+			}
+		}
+
+		for range strings.Count(line, "{") {
+			blocks = append(blocks, strings.HasPrefix(trimmed, "oneof"))
+		}
+
+		for range strings.Count(line, "}") {
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+	}
+
+	return props
+}
+
+// protoType maps protobuf scalar types to JSON types.
+func protoType(t string, bodies map[string]string, visiting map[string]bool) any {
+	switch t {
+	case "string":
+		return "string"
+	case "bytes":
+		return "string[bytes]"
+	case "bool":
+		return "boolean"
+	case "double", "float":
+		return "number"
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+		"fixed32", "fixed64", "sfixed32", "sfixed64":
+		return "integer"
+	}
+
+	if strings.HasPrefix(t, "map") {
+		return "object"
+	}
+
+	name := t[strings.LastIndex(t, ".")+1:]
+	if _, ok := bodies[name]; ok {
+		return protoMessage(name, bodies, visiting)
+	}
+
+	return "object"
+}
+
+// jsonSchemaPayload returns the title of the JSON schema and its properties flattened into type strings.
+func jsonSchemaPayload(schema string) (string, any, error) {
+	var root map[string]any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return "", nil, fmt.Errorf("unmarshalling json schema: %w", err)
+	}
+
+	title, _ := root["title"].(string)
+
+	payload := jsonschema.Flatten(root)
+	if _, ok := payload.(map[string]any); !ok {
+		payload = map[string]any{}
+	}
+
+	return title, payload, nil
+}
@@ -0,0 +1,99 @@
+// Package snapshot provides functionality for loading message flow schemas serialized as JSON,
+// such as messageflow.json written by documentation generation, without extracting them again.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// Ensure Source implements messageflow interfaces.
+var (
+	_ messageflow.Source = (*Source)(nil)
+)
+
+// document matches both a serialized schema and documentation metadata holding one.
+type document struct {
+	Services *[]messageflow.Service `json:"services"`
+	Schema   *struct {
+		Services *[]messageflow.Service `json:"services"`
+	} `json:"schema"`
+}
+
+// services returns services of the document, false if it holds no schema.
+func (d document) services() ([]messageflow.Service, bool) {
+	if d.Services != nil {
+		return *d.Services, true
+	}
+
+	if d.Schema != nil && d.Schema.Services != nil {
+		return *d.Schema.Services, true
+	}
+
+	return nil, false
+}
+
+// Source represents a serialized schema for schema extraction.
+type Source struct {
+	path string
+}
+
+// NewSource creates a new source reading the schema from a JSON file, either a serialized
+// messageflow.Schema or documentation metadata (messageflow.json) holding one.
+func NewSource(path string) (*Source, error) {
+	return &Source{
+		path: path,
+	}, nil
+}
+
+// ExtractSchema returns the schema stored in the file.
+func (s *Source) ExtractSchema(_ context.Context) (messageflow.Schema, error) {
+	doc, err := readDocument(s.path)
+	if err != nil {
+		return messageflow.Schema{}, err
+	}
+
+	services, ok := doc.services()
+	if !ok {
+		return messageflow.Schema{}, fmt.Errorf("no services found in %s", s.path)
+	}
+
+	return messageflow.Schema{Services: services}, nil
+}
+
+// IsSnapshot reports whether the file at path is a JSON file holding a serialized schema,
+// telling snapshots apart from other JSON files such as AsyncAPI specifications.
+func IsSnapshot(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		return false
+	}
+
+	doc, err := readDocument(path)
+	if err != nil {
+		return false
+	}
+
+	_, ok := doc.services()
+
+	return ok
+}
+
+func readDocument(path string) (document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return document{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return document{}, fmt.Errorf("unmarshalling %s: %w", path, err)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,62 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractSchema(t *testing.T) {
+	t.Parallel()
+
+	expected := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "user.created",
+							Messages: []messageflow.Message{
+								{Name: "UserCreated", Payload: "{\n  \"id\": \"string[uuid]\"\n}"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, path := range []string{"testdata/messageflow.json", "testdata/schema.json"} {
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+
+			source, err := NewSource(path)
+			require.NoError(t, err)
+
+			actual, err := source.ExtractSchema(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	source, err := NewSource("testdata/asyncapi.json")
+	require.NoError(t, err)
+
+	_, err = source.ExtractSchema(context.Background())
+	require.ErrorContains(t, err, "no services found")
+}
+
+func TestIsSnapshot(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, IsSnapshot("testdata/messageflow.json"))
+	assert.True(t, IsSnapshot("testdata/schema.json"))
+	assert.False(t, IsSnapshot("testdata/asyncapi.json"))
+	assert.False(t, IsSnapshot("testdata/missing.json"))
+	assert.False(t, IsSnapshot("../asyncapi/testdata/user.yaml"))
+}
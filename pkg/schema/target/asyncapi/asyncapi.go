@@ -0,0 +1,769 @@
+// Package asyncapi provides a target exporting message flow schemas back to AsyncAPI v3 documents,
+// e.g. to publish a schema merged from several sources as a single specification.
+package asyncapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/target"
+	"gopkg.in/yaml.v3"
+)
+
+// Ensure Target implements messageflow interfaces.
+var (
+	_ messageflow.Target = (*Target)(nil)
+)
+
+// targetType defines the schema format type for AsyncAPI documents.
+const targetType = messageflow.TargetType("asyncapi")
+
+const (
+	asyncAPIVersion = "3.0.0"
+	// documentVersion is the version of the exported API, the schema doesn't keep versions of specifications.
+	documentVersion = "1.0.0"
+	// serverHost is the host of generated servers, the schema keeps only their names and protocols.
+	serverHost = "localhost"
+	// defaultTitle is the title of documents holding all services.
+	defaultTitle = "Message Flow"
+)
+
+// TargetOpt configures the AsyncAPI target.
+type TargetOpt func(*Target)
+
+// Target exports schemas as AsyncAPI v3 YAML documents.
+type Target struct {
+	title string
+}
+
+// WithTitle returns a TargetOpt that sets the title of documents holding all services
+// (FormatModeContextServices), "Message Flow" by default.
+func WithTitle(title string) TargetOpt {
+	return func(t *Target) {
+		if title != "" {
+			t.title = title
+		}
+	}
+}
+
+// NewTarget creates a new AsyncAPI target instance.
+func NewTarget(opts ...TargetOpt) (*Target, error) {
+	t := &Target{
+		title: defaultTitle,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t, nil
+}
+
+func init() {
+	target.Register(string(targetType), func(cfg target.Config) (messageflow.Target, error) {
+		return NewTarget(WithTitle(cfg.Title))
+	})
+}
+
+// Capabilities returns target capabilities, documents are formatted only.
+func (t *Target) Capabilities() messageflow.TargetCapabilities {
+	return messageflow.TargetCapabilities{
+		Format: true,
+		Render: false,
+	}
+}
+
+// FormatSchema exports the schema as an AsyncAPI v3 document. FormatModeServiceChannels exports
+// the specification of a single service, FormatModeContextServices consolidates all services into
+// one document with operation IDs prefixed by service names.
+// Operations keep the order of the schema. Flattened payloads are converted back into JSON schemas
+// on a best-effort basis.
+func (t *Target) FormatSchema(
+	_ context.Context,
+	s messageflow.Schema,
+	opts messageflow.FormatOptions,
+) (messageflow.FormattedSchema, error) {
+	b := newBuilder()
+
+	if len(opts.ExcludeChannelPatterns) > 0 {
+		s = s.ExcludeChannels(opts.ExcludeChannelPatterns...)
+	}
+
+	switch opts.Mode {
+	case messageflow.FormatModeServiceChannels:
+		service, err := findService(s, opts.Service)
+		if err != nil {
+			return messageflow.FormattedSchema{}, err
+		}
+
+		b.doc.Info = info{
+			Title:       service.Name,
+			Version:     documentVersion,
+			Description: service.Description,
+			Domain:      service.Group,
+		}
+		b.addService(service, "", opts.ExcludeDeprecated)
+	case messageflow.FormatModeContextServices:
+		b.doc.Info = info{
+			Title:   t.title,
+			Version: documentVersion,
+		}
+		for _, service := range s.Services {
+			b.addService(service, key(service.Name)+"_", opts.ExcludeDeprecated)
+		}
+	default:
+		return messageflow.FormattedSchema{}, messageflow.NewUnsupportedFormatModeError(opts.Mode, []messageflow.FormatMode{
+			messageflow.FormatModeServiceChannels,
+			messageflow.FormatModeContextServices,
+		})
+	}
+
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(b.document()); err != nil {
+		return messageflow.FormattedSchema{}, fmt.Errorf("encoding asyncapi document: %w", err)
+	}
+
+	if err := enc.Close(); err != nil {
+		return messageflow.FormattedSchema{}, fmt.Errorf("encoding asyncapi document: %w", err)
+	}
+
+	return messageflow.FormattedSchema{
+		Type: targetType,
+		Data: buf.Bytes(),
+	}, nil
+}
+
+// RenderSchema isn't supported, AsyncAPI documents are only formatted.
+func (t *Target) RenderSchema(_ context.Context, _ messageflow.FormattedSchema) ([]byte, error) {
+	return nil, errors.New("asyncapi target doesn't support rendering")
+}
+
+// findService returns the named service, or the only service of the schema when name is empty.
+func findService(s messageflow.Schema, name string) (messageflow.Service, error) {
+	if name == "" && len(s.Services) == 1 {
+		return s.Services[0], nil
+	}
+
+	for _, service := range s.Services {
+		if service.Name == name {
+			return service, nil
+		}
+	}
+
+	return messageflow.Service{}, fmt.Errorf("service '%s' not found", name)
+}
+
+type document struct {
+	AsyncAPI   string     `yaml:"asyncapi"`
+	Info       info       `yaml:"info"`
+	Servers    orderedMap `yaml:"servers,omitempty"`
+	Channels   orderedMap `yaml:"channels"`
+	Operations orderedMap `yaml:"operations"`
+	Components components `yaml:"components"`
+}
+
+type info struct {
+	Title       string `yaml:"title"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description,omitempty"`
+	Domain      string `yaml:"x-domain,omitempty"`
+}
+
+type server struct {
+	Host     string `yaml:"host"`
+	Protocol string `yaml:"protocol"`
+}
+
+type channel struct {
+	Address    string              `yaml:"address"`
+	Servers    []ref               `yaml:"servers,omitempty"`
+	Tags       []tag               `yaml:"tags,omitempty"`
+	Parameters orderedMap          `yaml:"parameters,omitempty"`
+	Messages   orderedMap          `yaml:"messages"`
+	Bindings   map[string]struct{} `yaml:"bindings,omitempty"` // protocols none of the servers has
+}
+
+type operation struct {
+	Action      string `yaml:"action"`
+	Summary     string `yaml:"summary,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	Deprecated  bool   `yaml:"deprecated,omitempty"`
+	Tags        []tag  `yaml:"tags,omitempty"`
+	Channel     ref    `yaml:"channel"`
+	Messages    []ref  `yaml:"messages"`
+	Reply       *reply `yaml:"reply,omitempty"`
+	Security    []ref  `yaml:"security,omitempty"`
+	// Metadata holds specification extensions, e.g. x-throughput.
+	Metadata map[string]string `yaml:",inline"`
+}
+
+type reply struct {
+	Channel  ref   `yaml:"channel"`
+	Messages []ref `yaml:"messages"`
+}
+
+type message struct {
+	Name            string         `yaml:"name"`
+	ContentType     string         `yaml:"contentType,omitempty"`
+	CorrelationID   *correlationID `yaml:"correlationId,omitempty"`
+	DeprecationNote string         `yaml:"x-deprecation-note,omitempty"`
+	Headers         any            `yaml:"headers,omitempty"`
+	Payload         any            `yaml:"payload"`
+	Examples        []example      `yaml:"examples,omitempty"`
+}
+
+type correlationID struct {
+	Location string `yaml:"location"`
+}
+
+type example struct {
+	Payload any `yaml:"payload"`
+}
+
+type components struct {
+	Messages        orderedMap `yaml:"messages"`
+	Schemas         orderedMap `yaml:"schemas,omitempty"`
+	SecuritySchemes orderedMap `yaml:"securitySchemes,omitempty"`
+}
+
+type securityScheme struct {
+	Type   string   `yaml:"type,omitempty"`
+	Scopes []string `yaml:"scopes,omitempty"`
+}
+
+type ref struct {
+	Ref string `yaml:"$ref"`
+}
+
+type tag struct {
+	Name string `yaml:"name"`
+}
+
+// orderedMap is a YAML mapping keeping the order of its items.
+type orderedMap []mapItem
+
+type mapItem struct {
+	Key   string
+	Value any
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (m orderedMap) MarshalYAML() (any, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	for _, item := range m {
+		var value yaml.Node
+		if err := value.Encode(item.Value); err != nil {
+			return nil, err
+		}
+
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item.Key}, &value)
+	}
+
+	return node, nil
+}
+
+// builder assembles a document from services, sharing channels and messages between operations.
+type builder struct {
+	doc         document
+	servers     map[string]string          // protocols of servers by key
+	channelKeys map[string]string          // keys of channels by address
+	channels    map[string]*channel        // channels by key
+	keys        map[string]map[string]bool // keys in use by section (channels, operations, messages, schemas, securitySchemes)
+	messages    []componentMessage
+	schemas     []componentSchema
+	schemes     []componentScheme
+}
+
+type componentSchema struct {
+	key     string
+	message messageflow.Message // the first message with the payload, only SchemaRef, Payload and SchemaFormat matter
+}
+
+type componentScheme struct {
+	key         string
+	requirement messageflow.SecurityRequirement
+}
+
+type componentMessage struct {
+	key     string
+	message messageflow.Message
+}
+
+func newBuilder() *builder {
+	return &builder{
+		doc:         document{AsyncAPI: asyncAPIVersion},
+		servers:     make(map[string]string),
+		channelKeys: make(map[string]string),
+		channels:    make(map[string]*channel),
+		keys:        make(map[string]map[string]bool),
+	}
+}
+
+// addService adds operations of the service with IDs prefixed by idPrefix.
+func (b *builder) addService(service messageflow.Service, idPrefix string, excludeDeprecated bool) {
+	for _, op := range service.Operation {
+		if excludeDeprecated && op.IsDeprecated() {
+			continue
+		}
+
+		channelKey := b.channel(op.Channel, service.Servers)
+
+		id := op.ID
+		if id == "" {
+			id = string(op.Action) + "_" + channelKey
+		}
+
+		result := operation{
+			Action:      string(op.Action),
+			Summary:     op.Summary,
+			Description: op.Description,
+			Deprecated:  op.Deprecated,
+			Tags:        tags(op.Tags),
+			Channel:     ref{Ref: "#/channels/" + pointerToken(channelKey)},
+			Messages:    b.channelMessages(channelKey, op.Channel.Messages),
+			Metadata:    op.Metadata,
+		}
+
+		for _, requirement := range op.Security {
+			result.Security = append(result.Security, ref{
+				Ref: "#/components/securitySchemes/" + pointerToken(b.securityScheme(requirement)),
+			})
+		}
+
+		if op.Reply != nil {
+			replyKey := b.channel(*op.Reply, service.Servers)
+			result.Reply = &reply{
+				Channel:  ref{Ref: "#/channels/" + pointerToken(replyKey)},
+				Messages: b.channelMessages(replyKey, op.Reply.Messages),
+			}
+		}
+
+		b.doc.Operations = append(b.doc.Operations, mapItem{Key: b.uniqueKey("operations", idPrefix+id), Value: result})
+	}
+
+	// Servers no channel took protocols from are declared without protocol.
+	for _, name := range service.Servers {
+		b.server(name, "")
+	}
+}
+
+// channel returns the key of the channel, adding it on first use. Channels without servers of their own
+// are available on all servers of the service, serviceServers.
+func (b *builder) channel(ch messageflow.Channel, serviceServers []string) string {
+	if channelKey, ok := b.channelKeys[ch.Name]; ok {
+		existing := b.channels[channelKey]
+		for _, name := range ch.Tags {
+			if !slices.ContainsFunc(existing.Tags, func(t tag) bool { return t.Name == name }) {
+				existing.Tags = append(existing.Tags, tag{Name: name})
+			}
+		}
+
+		return channelKey
+	}
+
+	result := &channel{
+		Address: ch.Name,
+		Tags:    tags(ch.Tags),
+	}
+
+	for _, match := range parameterRe.FindAllStringSubmatch(ch.Name, -1) {
+		result.Parameters = append(result.Parameters, mapItem{Key: match[1], Value: struct{}{}})
+	}
+
+	var protocols []string
+	for _, protocol := range strings.Split(ch.Protocol, ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+
+	switch {
+	case len(ch.Servers) > 0:
+		result.Servers, result.Bindings = b.namedServers(ch.Servers, protocols)
+	case len(serviceServers) > 0:
+		// Channels without servers are available on all servers, so only the servers take their protocols.
+		_, result.Bindings = b.namedServers(serviceServers, protocols)
+	default:
+		for _, protocol := range protocols {
+			result.Servers = append(result.Servers, ref{Ref: "#/servers/" + pointerToken(b.server(protocol, protocol))})
+		}
+	}
+
+	channelKey := b.uniqueKey("channels", key(ch.Name))
+	b.channelKeys[ch.Name] = channelKey
+	b.channels[channelKey] = result
+	b.doc.Channels = append(b.doc.Channels, mapItem{Key: channelKey, Value: result})
+
+	return channelKey
+}
+
+// server returns the key of the named server, adding it with the protocol on first use.
+func (b *builder) server(name, protocol string) string {
+	serverKey := key(name)
+	if _, ok := b.servers[serverKey]; !ok {
+		b.servers[serverKey] = protocol
+		b.doc.Servers = append(b.doc.Servers, mapItem{Key: serverKey, Value: server{Host: serverHost, Protocol: protocol}})
+	}
+
+	return serverKey
+}
+
+// namedServers returns references to the named servers of a channel with the protocols. The schema doesn't keep
+// protocols by server, so servers added by the channel take its protocols no other of its servers has, in order.
+// Protocols left over, e.g. of channel bindings, are returned as bindings.
+func (b *builder) namedServers(names, protocols []string) ([]ref, map[string]struct{}) {
+	remaining := slices.DeleteFunc(slices.Clone(protocols), func(protocol string) bool {
+		return slices.ContainsFunc(names, func(name string) bool {
+			existing, ok := b.servers[key(name)]
+			return ok && existing == protocol
+		})
+	})
+
+	refs := make([]ref, 0, len(names))
+
+	for _, name := range names {
+		protocol := ""
+		if _, ok := b.servers[key(name)]; !ok && len(protocols) > 0 {
+			protocol = protocols[0]
+			if len(remaining) > 0 {
+				protocol, remaining = remaining[0], remaining[1:]
+			}
+		}
+
+		refs = append(refs, ref{Ref: "#/servers/" + pointerToken(b.server(name, protocol))})
+	}
+
+	var bindings map[string]struct{}
+	for _, protocol := range remaining {
+		if bindings == nil {
+			bindings = make(map[string]struct{})
+		}
+		bindings[protocol] = struct{}{}
+	}
+
+	return refs, bindings
+}
+
+// channelMessages adds the messages to the channel, returning references to them.
+func (b *builder) channelMessages(channelKey string, messages []messageflow.Message) []ref {
+	var (
+		ch   = b.channels[channelKey]
+		refs = make([]ref, 0, len(messages))
+	)
+
+	for _, msg := range messages {
+		messageKey := b.component(msg)
+
+		if !slices.ContainsFunc(ch.Messages, func(item mapItem) bool { return item.Key == messageKey }) {
+			ch.Messages = append(ch.Messages, mapItem{
+				Key:   messageKey,
+				Value: ref{Ref: "#/components/messages/" + pointerToken(messageKey)},
+			})
+		}
+
+		refs = append(refs, ref{Ref: "#/channels/" + pointerToken(channelKey) + "/messages/" + pointerToken(messageKey)})
+	}
+
+	return refs
+}
+
+// securityScheme returns the key of the security scheme of the requirement in components, adding it on first use.
+// Requirements of the same scheme with different types or scopes get distinct keys.
+func (b *builder) securityScheme(requirement messageflow.SecurityRequirement) string {
+	for _, existing := range b.schemes {
+		if reflect.DeepEqual(existing.requirement, requirement) {
+			return existing.key
+		}
+	}
+
+	schemeKey := b.uniqueKey("securitySchemes", key(requirement.Scheme))
+	b.schemes = append(b.schemes, componentScheme{key: schemeKey, requirement: requirement})
+
+	b.doc.Components.SecuritySchemes = append(b.doc.Components.SecuritySchemes, mapItem{
+		Key:   schemeKey,
+		Value: securityScheme{Type: requirement.Type, Scopes: requirement.Scopes},
+	})
+
+	return schemeKey
+}
+
+// component returns the key of the message in components, adding it on first use.
+// Messages with the same name but different definitions get distinct keys. Parsers derive message
+// names from keys suffixed with Message, so the suffix is left out of keys.
+func (b *builder) component(msg messageflow.Message) string {
+	for _, existing := range b.messages {
+		if reflect.DeepEqual(existing.message, msg) {
+			return existing.key
+		}
+	}
+
+	messageKey := b.uniqueKey("messages", key(strings.TrimSuffix(msg.Name, "Message")))
+	b.messages = append(b.messages, componentMessage{key: messageKey, message: msg})
+
+	result := message{
+		Name:            msg.Name,
+		ContentType:     msg.ContentType,
+		DeprecationNote: msg.DeprecationNote,
+		Payload:         payloadSchema(msg),
+	}
+
+	if msg.SchemaRef != "" {
+		result.Payload = ref{Ref: "#/components/schemas/" + pointerToken(b.schema(msg))}
+	}
+
+	if msg.CorrelationID != "" {
+		result.CorrelationID = &correlationID{Location: msg.CorrelationID}
+	}
+
+	var headers any
+	if err := json.Unmarshal([]byte(msg.Headers), &headers); err == nil {
+		result.Headers = flattenedSchema(headers)
+	}
+
+	for _, e := range msg.Examples {
+		result.Examples = append(result.Examples, example{Payload: jsonValue(e)})
+	}
+
+	b.doc.Components.Messages = append(b.doc.Components.Messages, mapItem{Key: messageKey, Value: result})
+
+	return messageKey
+}
+
+// schema returns the key of the payload of the message in component schemas, adding it on first use.
+// Messages sharing a payload type reference the same schema, differing payloads of the same type get distinct keys.
+func (b *builder) schema(msg messageflow.Message) string {
+	for _, existing := range b.schemas {
+		if existing.message.SchemaRef == msg.SchemaRef && existing.message.Payload == msg.Payload &&
+			existing.message.SchemaFormat == msg.SchemaFormat {
+			return existing.key
+		}
+	}
+
+	schemaKey := b.uniqueKey("schemas", key(msg.SchemaRef))
+	b.schemas = append(b.schemas, componentSchema{key: schemaKey, message: msg})
+
+	b.doc.Components.Schemas = append(b.doc.Components.Schemas, mapItem{Key: schemaKey, Value: payloadSchema(msg)})
+
+	return schemaKey
+}
+
+// uniqueKey returns the key suffixed with a number when it's already in use in the section.
+func (b *builder) uniqueKey(section, k string) string {
+	if b.keys[section] == nil {
+		b.keys[section] = make(map[string]bool)
+	}
+
+	unique := k
+	for i := 2; b.keys[section][unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", k, i)
+	}
+
+	b.keys[section][unique] = true
+
+	return unique
+}
+
+func (b *builder) document() document {
+	if b.doc.Channels == nil {
+		b.doc.Channels = orderedMap{}
+	}
+
+	if b.doc.Operations == nil {
+		b.doc.Operations = orderedMap{}
+	}
+
+	if b.doc.Components.Messages == nil {
+		b.doc.Components.Messages = orderedMap{}
+	}
+
+	return b.doc
+}
+
+var (
+	keyRe       = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+	parameterRe = regexp.MustCompile(`\{([^{}]+)\}`)
+)
+
+// key converts a name into a key of a components or channels map.
+func key(name string) string {
+	k := strings.Trim(keyRe.ReplaceAllString(name, "_"), "_")
+	if k == "" {
+		return "unnamed"
+	}
+
+	return k
+}
+
+// pointerToken escapes the key for use in a JSON pointer.
+func pointerToken(k string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(k)
+}
+
+func tags(names []string) []tag {
+	var result []tag
+	for _, name := range names {
+		result = append(result, tag{Name: name})
+	}
+
+	return result
+}
+
+// payloadSchema returns the payload of the message as an AsyncAPI payload. Raw JSON schemas are kept,
+// schemas in other formats (e.g. Avro) are wrapped into a multi format schema and flattened payloads
+// are converted back into JSON schemas.
+func payloadSchema(msg messageflow.Message) any {
+	switch {
+	case msg.SchemaFormat != "" && isJSONSchemaFormat(msg.SchemaFormat):
+		return jsonValue(msg.Payload)
+	case msg.SchemaFormat != "":
+		return orderedMap{
+			{Key: "schemaFormat", Value: msg.SchemaFormat},
+			{Key: "schema", Value: jsonValue(msg.Payload)},
+		}
+	}
+
+	var flattened any
+	if err := json.Unmarshal([]byte(msg.Payload), &flattened); err != nil {
+		return orderedMap{{Key: "type", Value: "object"}}
+	}
+
+	return flattenedSchema(flattened)
+}
+
+// isJSONSchemaFormat reports whether payloads of the schema format are JSON schemas.
+func isJSONSchemaFormat(format string) bool {
+	for _, prefix := range []string{"application/vnd.aai.asyncapi", "application/schema+json", "application/schema+yaml"} {
+		if strings.HasPrefix(format, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeRe matches flattened field types, e.g. string, string[uuid] or string[enum:a,b].
+var typeRe = regexp.MustCompile(`^(\w+)(?:\[(.*)\])?$`)
+
+// limitKeywords are numeric constraints of flattened field types, see messageflow.SplitFieldType.
+var limitKeywords = []string{"minLength", "maxLength", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"}
+
+// flattenedSchema converts a flattened payload, mapping fields to types, into a JSON schema.
+func flattenedSchema(value any) orderedMap {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			return orderedMap{{Key: "type", Value: "object"}}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		properties := make(orderedMap, 0, len(v))
+		var required []string
+		for _, name := range names {
+			properties = append(properties, mapItem{Key: name, Value: flattenedSchema(v[name])})
+
+			if typ, ok := v[name].(string); ok {
+				if _, _, isRequired := messageflow.SplitFieldType(typ); isRequired {
+					required = append(required, name)
+				}
+			}
+		}
+
+		schema := orderedMap{{Key: "type", Value: "object"}, {Key: "properties", Value: properties}}
+		if len(required) > 0 {
+			schema = append(schema, mapItem{Key: "required", Value: required})
+		}
+
+		return schema
+	case []any:
+		if len(v) == 0 {
+			return orderedMap{{Key: "type", Value: "array"}}
+		}
+
+		return orderedMap{{Key: "type", Value: "array"}, {Key: "items", Value: flattenedSchema(v[0])}}
+	case string:
+		if !typeRe.MatchString(v) {
+			return orderedMap{{Key: "type", Value: "string"}}
+		}
+
+		typ, tokens, _ := messageflow.SplitFieldType(v)
+		schema := orderedMap{{Key: "type", Value: typ}}
+
+		for _, token := range tokens {
+			if values, ok := strings.CutPrefix(token, "enum:"); ok {
+				var enum []any
+				for _, value := range strings.Split(values, ",") {
+					enum = append(enum, enumValue(typ, value))
+				}
+
+				schema = append(schema, mapItem{Key: "enum", Value: enum})
+				continue
+			}
+
+			key, value, ok := strings.Cut(token, ":")
+			switch {
+			case ok && key == "pattern":
+				schema = append(schema, mapItem{Key: key, Value: value})
+			case ok && slices.Contains(limitKeywords, key):
+				if limit, err := strconv.ParseFloat(value, 64); err == nil {
+					schema = append(schema, mapItem{Key: key, Value: limit})
+				}
+			default:
+				schema = append(schema, mapItem{Key: "format", Value: token})
+			}
+		}
+
+		return schema
+	default:
+		return orderedMap{{Key: "type", Value: "object"}}
+	}
+}
+
+// enumValue converts the enum value to the type of the field.
+func enumValue(typ, value string) any {
+	switch typ {
+	case "integer":
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// jsonValue decodes JSON, values which aren't valid JSON are kept as strings.
+func jsonValue(data string) any {
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return data
+	}
+
+	return value
+}
@@ -0,0 +1,275 @@
+package asyncapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	asyncapisource "github.com/holydocs/messageflow/pkg/schema/source/asyncapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reparse writes the formatted document to a file and extracts the schema from it again.
+func reparse(t *testing.T, fs messageflow.FormattedSchema, opts ...asyncapisource.SourceOpt) messageflow.Schema {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "asyncapi.yaml")
+	require.NoError(t, os.WriteFile(path, fs.Data, 0644))
+
+	source, err := asyncapisource.NewSource(path, opts...)
+	require.NoError(t, err)
+
+	s, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err, string(fs.Data))
+
+	return s
+}
+
+func TestFormatSchemaRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	for _, file := range []string{"user.yaml", "notification.yaml", "orders.yaml", "payments.yaml", "live.yaml", "campaign.yaml", "analytics.yaml", "shipping.yaml"} {
+		t.Run(file, func(t *testing.T) {
+			t.Parallel()
+
+			source, err := asyncapisource.NewSource(filepath.Join("../../source/asyncapi/testdata", file))
+			require.NoError(t, err)
+
+			expected, err := source.ExtractSchema(context.Background())
+			require.NoError(t, err)
+
+			fs, err := target.FormatSchema(context.Background(), expected, messageflow.FormatOptions{
+				Mode: messageflow.FormatModeServiceChannels,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, targetType, fs.Type)
+
+			assert.Equal(t, expected, reparse(t, fs))
+		})
+	}
+}
+
+func TestFormatSchemaContextServices(t *testing.T) {
+	t.Parallel()
+
+	var schemas []messageflow.Schema
+	for _, file := range []string{"user.yaml", "notification.yaml"} {
+		source, err := asyncapisource.NewSource(filepath.Join("../../source/asyncapi/testdata", file))
+		require.NoError(t, err)
+
+		s, err := source.ExtractSchema(context.Background())
+		require.NoError(t, err)
+
+		schemas = append(schemas, s)
+	}
+
+	merged := messageflow.MergeSchemas(schemas...)
+
+	target, err := NewTarget(WithTitle("Platform"))
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), merged, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	})
+	require.NoError(t, err)
+
+	actual := reparse(t, fs)
+	require.Len(t, actual.Services, 1)
+	assert.Equal(t, "Platform", actual.Services[0].Name)
+
+	var (
+		expected []messageflow.Operation
+		ids      []string
+	)
+	for _, service := range merged.Services {
+		for _, op := range service.Operation {
+			ids = append(ids, key(service.Name)+"_"+op.ID)
+			op.ID = ""
+			expected = append(expected, op)
+		}
+	}
+
+	var actualIDs []string
+	for i := range actual.Services[0].Operation {
+		actualIDs = append(actualIDs, actual.Services[0].Operation[i].ID)
+		actual.Services[0].Operation[i].ID = ""
+	}
+
+	assert.Equal(t, ids, actualIDs)
+	assert.Equal(t, expected, actual.Services[0].Operation)
+}
+
+func TestFormatSchemaRawPayloads(t *testing.T) {
+	t.Parallel()
+
+	source, err := asyncapisource.NewSource("../../source/asyncapi/testdata/payments.yaml", asyncapisource.WithRawPayloads(true))
+	require.NoError(t, err)
+
+	expected, err := source.ExtractSchema(context.Background())
+	require.NoError(t, err)
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), expected, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeServiceChannels,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, reparse(t, fs, asyncapisource.WithRawPayloads(true)))
+}
+
+func TestFormatSchemaMessages(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "user.{user_id}.created",
+							Messages: []messageflow.Message{{
+								Name:    "UserCreatedMessage",
+								Payload: `{"id": "string[uuid]", "roles": ["string[enum:admin,member]"], "score": "integer[enum:1,2]"}`,
+							}},
+						},
+					},
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "user.{user_id}.created",
+							Messages: []messageflow.Message{{Name: "UserCreatedMessage", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), schema, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeServiceChannels,
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "  user._user_id_.created:\n    address: user.{user_id}.created\n    parameters:\n      user_id: {}\n")
+	assert.Contains(t, data, "    UserCreated:\n      name: UserCreatedMessage\n")
+	assert.Contains(t, data, "    UserCreated_2:\n      name: UserCreatedMessage\n")
+	assert.Contains(t, data, "operations:\n  send_user._user_id_.created:\n")
+	assert.Contains(t, data, "  send_user._user_id_.created_2:\n")
+	assert.Contains(t, data, "          score:\n            type: integer\n            enum:\n              - 1\n              - 2\n")
+
+	actual := reparse(t, fs)
+	require.Len(t, actual.Services[0].Operation, 2)
+	assert.JSONEq(t, schema.Services[0].Operation[0].Channel.Messages[0].Payload, actual.Services[0].Operation[0].Channel.Messages[0].Payload)
+	assert.JSONEq(t, schema.Services[0].Operation[1].Channel.Messages[0].Payload, actual.Services[0].Operation[1].Channel.Messages[0].Payload)
+
+	_, err = target.FormatSchema(context.Background(), schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceChannels,
+		Service: "Order Service",
+	})
+	require.EqualError(t, err, "service 'Order Service' not found")
+
+	_, err = target.FormatSchema(context.Background(), schema, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeChannelServices,
+	})
+	require.Error(t, err)
+}
+
+func TestFormatSchemaPayloadConstraints(t *testing.T) {
+	t.Parallel()
+
+	payload := `{
+		"id": "string[uuid,required]",
+		"name": "string[required,minLength:1,maxLength:64]",
+		"code": "string[pattern:^[A-Z]{3}$]",
+		"score": "number[minimum:0.5,exclusiveMaximum:5]",
+		"role": "string[enum:admin,member]"
+	}`
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "user.created",
+							Messages: []messageflow.Message{{Name: "UserCreatedMessage", Payload: payload}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), schema, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeServiceChannels,
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "        required:\n          - id\n          - name\n")
+	assert.Contains(t, data, "            pattern: ^[A-Z]{3}$\n")
+
+	actual := reparse(t, fs, asyncapisource.WithPayloadConstraints(true))
+	assert.JSONEq(t, payload, actual.Services[0].Operation[0].Channel.Messages[0].Payload)
+}
+
+func TestFormatSchemaSharedSchemas(t *testing.T) {
+	t.Parallel()
+
+	profile := messageflow.Message{Name: "UserCreatedMessage", Payload: "{\n  \"id\": \"string\"\n}", SchemaRef: "UserProfile"}
+
+	expected := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						ID:      "sendUserCreated",
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created", Messages: []messageflow.Message{profile}},
+					},
+					{
+						ID:     "sendUserUpdated",
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.updated", Messages: []messageflow.Message{
+							{Name: "UserUpdatedMessage", Payload: profile.Payload, SchemaRef: "UserProfile"},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), expected, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeServiceChannels,
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "  schemas:\n    UserProfile:\n      type: object\n")
+	assert.Equal(t, 2, strings.Count(data, "$ref: '#/components/schemas/UserProfile'"))
+	assert.Equal(t, expected, reparse(t, fs))
+}
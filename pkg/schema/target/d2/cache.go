@@ -0,0 +1,79 @@
+package d2
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// renderCache is an LRU cache of rendered diagrams, safe for concurrent use.
+type renderCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type renderCacheEntry struct {
+	key  [sha256.Size]byte
+	data []byte
+}
+
+func newRenderCache(size int) *renderCache {
+	return &renderCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element, size),
+	}
+}
+
+// get returns a copy of the diagram cached under the key, marking it as recently used.
+func (c *renderCache) get(key [sha256.Size]byte) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return bytes.Clone(element.Value.(*renderCacheEntry).data), true
+}
+
+// add caches a copy of the diagram under the key, evicting the least recently used diagram when full.
+func (c *renderCache) add(key [sha256.Size]byte, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&renderCacheEntry{key: key, data: bytes.Clone(data)})
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*renderCacheEntry).key)
+	}
+}
+
+// renderCacheKey hashes the formatted diagram along with the options affecting its rendering.
+func (t *Target) renderCacheKey(data []byte) [sha256.Size]byte {
+	h := sha256.New()
+
+	renderOpts, _ := json.Marshal(t.renderOpts)
+	fmt.Fprintf(h, "%s\x00%s\x00%v\x00%v\x00", renderOpts, t.outputFormat, t.pngScale, t.minifySVG)
+	h.Write(data)
+
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+
+	return key
+}
@@ -4,13 +4,24 @@ package d2
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/target"
 	"oss.terrastruct.com/d2/d2graph"
 	"oss.terrastruct.com/d2/d2layouts/d2elklayout"
 	"oss.terrastruct.com/d2/d2lib"
@@ -35,6 +46,35 @@ var (
 
 	//go:embed templates/service_services.tmpl
 	serviceServicesTemplateFS embed.FS
+
+	//go:embed templates/service_overview.tmpl
+	serviceOverviewTemplateFS embed.FS
+
+	//go:embed templates/sequence.tmpl
+	sequenceTemplateFS embed.FS
+)
+
+// templateFuncs are helpers available in templates.
+var templateFuncs = template.FuncMap{
+	"tagsLabel":     tagsLabel,
+	"securityLabel": securityLabel,
+	"deprecated":    deprecated,
+	"payload":       truncatePayload,
+	"payloadTree":   payloadTree,
+	"labelText":     labelText,
+	"edgeLabel":     edgeLabel,
+	"realtime":      realtime,
+	"names":         messageNames,
+}
+
+// maxPayloadLines limits payloads shown in diagram tooltips and labels,
+// raw JSON schemas would otherwise make them unreadable.
+const maxPayloadLines = 40
+
+// Font sizes accepted by WithFontSize, as limited by D2.
+const (
+	minFontSize = 8
+	maxFontSize = 100
 )
 
 // Ensure Target implements messageflow interfaces.
@@ -48,7 +88,22 @@ type Target struct {
 	channelServicesTemplate *template.Template
 	contextServicesTemplate *template.Template
 	serviceServicesTemplate *template.Template
+	serviceOverviewTemplate *template.Template
+	sequenceTemplate        *template.Template
 	renderOpts              *d2svg.RenderOpts
+	outputFormat            OutputFormat
+	pngScale                float64
+	direction               string
+	colorByGroup            bool
+	renderTimeout           time.Duration
+	maxContextServices      int
+	templateDir             string
+	minifySVG               bool
+	fontSize                int
+	legend                  bool
+	payloadStyle            PayloadStyle
+	logger                  *slog.Logger
+	renderCache             *renderCache
 }
 
 // TargetOpt is a function type that allows customization of a Target instance.
@@ -62,48 +117,263 @@ func WithRenderOpts(renderOpts *d2svg.RenderOpts) TargetOpt {
 	}
 }
 
+// WithRenderCache returns a TargetOpt that keeps up to size rendered diagrams in memory, so formatted
+// schemas rendered again, e.g. by the serve command, are returned without rendering them. The output is
+// the same as without the cache. Zero or negative sizes disable caching, which is the default.
+func WithRenderCache(size int) TargetOpt {
+	return func(t *Target) {
+		t.renderCache = nil
+		if size > 0 {
+			t.renderCache = newRenderCache(size)
+		}
+	}
+}
+
+// WithOutputFormat returns a TargetOpt that sets the image format produced by RenderSchema.
+// SVG is used by default.
+func WithOutputFormat(format OutputFormat) TargetOpt {
+	return func(t *Target) {
+		t.outputFormat = format
+	}
+}
+
+// WithPNGScale returns a TargetOpt that sets the scale factor used when rasterizing to PNG.
+// Higher values produce sharper but larger images.
+func WithPNGScale(scale float64) TargetOpt {
+	return func(t *Target) {
+		t.pngScale = scale
+	}
+}
+
+// WithDirection returns a TargetOpt that sets the layout direction of the diagrams.
+// Supported directions are "down", "right", "up" and "left", unknown values fall back to "down".
+func WithDirection(direction string) TargetOpt {
+	return func(t *Target) {
+		switch direction {
+		case "down", "right", "up", "left":
+			t.direction = direction
+		default:
+			t.direction = "down"
+		}
+	}
+}
+
+// WithColorByGroup returns a TargetOpt that enables or disables color coding of services
+// in the context diagram. Colors are derived from the service group, or from the service name
+// when it has no group, so services of the same group share a color. Enabled by default.
+func WithColorByGroup(enabled bool) TargetOpt {
+	return func(t *Target) {
+		t.colorByGroup = enabled
+	}
+}
+
+// WithRenderTimeout returns a TargetOpt that limits the time RenderSchema may spend compiling
+// and rendering a diagram. The compilation is cancelled once the timeout expires. No limit by default.
+func WithRenderTimeout(timeout time.Duration) TargetOpt {
+	return func(t *Target) {
+		t.renderTimeout = timeout
+	}
+}
+
+// WithMaxContextServices returns a TargetOpt that makes FormatSchema refuse context diagrams
+// with more services than max, as their layout becomes too slow and memory hungry. No limit by default.
+func WithMaxContextServices(max int) TargetOpt {
+	return func(t *Target) {
+		t.maxContextServices = max
+	}
+}
+
+// WithMinifySVG returns a TargetOpt that optimizes rendered SVGs for size, removing comments and
+// redundant whitespace, zeros and styles without changing their appearance.
+func WithMinifySVG(enabled bool) TargetOpt {
+	return func(t *Target) {
+		t.minifySVG = enabled
+	}
+}
+
+// WithPadding returns a TargetOpt that sets the padding around rendered diagrams in pixels, 5 by default.
+// It overrides the padding of render options set by WithRenderOpts before it.
+func WithPadding(padding int) TargetOpt {
+	return func(t *Target) {
+		renderOpts := *t.renderOpts
+		renderOpts.Pad = go2.Pointer(int64(padding))
+		t.renderOpts = &renderOpts
+	}
+}
+
+// WithFontSize returns a TargetOpt that sets the font size of all shapes and connections labels,
+// between minFontSize and maxFontSize. Zero keeps the D2 default of 16 for shapes and 14 for connections.
+func WithFontSize(size int) TargetOpt {
+	return func(t *Target) {
+		t.fontSize = size
+	}
+}
+
+// WithLegend returns a TargetOpt that adds a legend explaining connection labels and line styles
+// to the bottom right corner of context diagrams. Disabled by default.
+func WithLegend(enabled bool) TargetOpt {
+	return func(t *Target) {
+		t.legend = enabled
+	}
+}
+
+// WithLogger returns a TargetOpt that sets the logger used for render timings and D2's own output.
+// Without it D2 logs at info level to stderr.
+func WithLogger(logger *slog.Logger) TargetOpt {
+	return func(t *Target) {
+		t.logger = logger
+	}
+}
+
+// WithTemplateDir returns a TargetOpt that loads templates from dir instead of the embedded ones.
+// Templates are looked up by their embedded file names (service_channels.tmpl, channel_services.tmpl,
+// context_services.tmpl, service_services.tmpl, service_overview.tmpl and sequence.tmpl), templates missing in dir
+// fall back to embedded.
+func WithTemplateDir(dir string) TargetOpt {
+	return func(t *Target) {
+		t.templateDir = dir
+	}
+}
+
 // NewTarget creates a new D2 diagram formatter instance.
-// It initializes the template from the embedded schema.tmpl file and sets up default
+// It initializes the templates from the embedded files or the template dir and sets up default
 // rendering and compilation options. The formatter uses the ELK layout engine for
 // diagram arrangement.
 func NewTarget(opts ...TargetOpt) (*Target, error) {
-	serviceChannelsTemplate, err := template.ParseFS(serviceChannelsTemplateFS, "templates/service_channels.tmpl")
+	t := &Target{
+		renderOpts: &d2svg.RenderOpts{
+			Pad: go2.Pointer(int64(5)),
+		},
+		outputFormat: OutputFormatSVG,
+		pngScale:     defaultPNGScale,
+		direction:    "down",
+		colorByGroup: true,
+		payloadStyle: PayloadStyleText,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if t.renderOpts.Pad != nil && *t.renderOpts.Pad < 0 {
+		return nil, fmt.Errorf("invalid padding %d, must not be negative", *t.renderOpts.Pad)
+	}
+
+	if t.payloadStyle != PayloadStyleText && t.payloadStyle != PayloadStyleTree {
+		return nil, fmt.Errorf("unsupported payload style: %s", t.payloadStyle)
+	}
+
+	if t.fontSize != 0 && (t.fontSize < minFontSize || t.fontSize > maxFontSize) {
+		return nil, fmt.Errorf("invalid font size %d, must be between %d and %d", t.fontSize, minFontSize, maxFontSize)
+	}
+
+	var err error
+
+	t.serviceChannelsTemplate, err = t.parseTemplate(serviceChannelsTemplateFS, "service_channels.tmpl")
 	if err != nil {
 		return nil, fmt.Errorf("parsing service channels template: %w", err)
 	}
 
-	channelServicesTemplate, err := template.ParseFS(channelServicesTemplateFS, "templates/channel_services.tmpl")
+	t.channelServicesTemplate, err = t.parseTemplate(channelServicesTemplateFS, "channel_services.tmpl")
 	if err != nil {
 		return nil, fmt.Errorf("parsing channel services template: %w", err)
 	}
 
-	contextServicesTemplate, err := template.ParseFS(contextServicesTemplateFS, "templates/context_services.tmpl")
+	t.contextServicesTemplate, err = t.parseTemplate(contextServicesTemplateFS, "context_services.tmpl")
 	if err != nil {
 		return nil, fmt.Errorf("parsing context services template: %w", err)
 	}
 
-	serviceServicesTemplate, err := template.ParseFS(serviceServicesTemplateFS, "templates/service_services.tmpl")
+	t.serviceServicesTemplate, err = t.parseTemplate(serviceServicesTemplateFS, "service_services.tmpl")
 	if err != nil {
 		return nil, fmt.Errorf("parsing service services template: %w", err)
 	}
 
-	t := &Target{
-		serviceChannelsTemplate: serviceChannelsTemplate,
-		channelServicesTemplate: channelServicesTemplate,
-		contextServicesTemplate: contextServicesTemplate,
-		serviceServicesTemplate: serviceServicesTemplate,
-		renderOpts: &d2svg.RenderOpts{
-			Pad: go2.Pointer(int64(5)),
-		},
+	t.serviceOverviewTemplate, err = t.parseTemplate(serviceOverviewTemplateFS, "service_overview.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parsing service overview template: %w", err)
 	}
 
-	for _, opt := range opts {
-		opt(t)
+	t.sequenceTemplate, err = t.parseTemplate(sequenceTemplateFS, "sequence.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("parsing sequence template: %w", err)
+	}
+
+	// The overview includes the service channels and service services templates.
+	for _, tmpl := range slices.Concat(t.serviceChannelsTemplate.Templates(), t.serviceServicesTemplate.Templates()) {
+		_, err = t.serviceOverviewTemplate.AddParseTree(tmpl.Name(), tmpl.Tree)
+		if err != nil {
+			return nil, fmt.Errorf("adding %s to service overview template: %w", tmpl.Name(), err)
+		}
 	}
 
 	return t, nil
 }
 
+func init() {
+	target.Register(string(targetType), newFromConfig)
+}
+
+// newFromConfig creates a target from registry settings.
+func newFromConfig(cfg target.Config) (messageflow.Target, error) {
+	opts := []TargetOpt{
+		WithDirection(cfg.Direction),
+		WithRenderTimeout(cfg.RenderTimeout),
+		WithMaxContextServices(cfg.MaxContextServices),
+		WithTemplateDir(cfg.TemplateDir),
+		WithFontSize(cfg.FontSize),
+		WithLegend(cfg.Legend),
+		WithMinifySVG(cfg.MinifySVG),
+	}
+
+	if cfg.Padding != nil {
+		opts = append(opts, WithPadding(*cfg.Padding))
+	}
+
+	if cfg.OutputFormat != "" {
+		opts = append(opts, WithOutputFormat(OutputFormat(cfg.OutputFormat)))
+	}
+
+	if cfg.PayloadStyle != "" {
+		opts = append(opts, WithPayloadStyle(PayloadStyle(cfg.PayloadStyle)))
+	}
+
+	if cfg.PNGScale != 0 {
+		opts = append(opts, WithPNGScale(cfg.PNGScale))
+	}
+
+	if cfg.Logger != nil {
+		opts = append(opts, WithLogger(cfg.Logger))
+	}
+
+	if cfg.RenderCache > 0 {
+		opts = append(opts, WithRenderCache(cfg.RenderCache))
+	}
+
+	return NewTarget(opts...)
+}
+
+// parseTemplate parses the named template from the template dir when it contains it,
+// otherwise from the embedded templates.
+func (t *Target) parseTemplate(embedded embed.FS, name string) (*template.Template, error) {
+	var (
+		fsys    fs.FS = embedded
+		pattern       = "templates/" + name
+	)
+
+	if t.templateDir != "" {
+		_, err := os.Stat(filepath.Join(t.templateDir, name))
+		switch {
+		case err == nil:
+			fsys, pattern = os.DirFS(t.templateDir), name
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("checking template %s in %s: %w", name, t.templateDir, err)
+		}
+	}
+
+	return template.New(name).Funcs(templateFuncs).ParseFS(fsys, pattern)
+}
+
 // Capabilities returns target capabilities.
 func (t *Target) Capabilities() messageflow.TargetCapabilities {
 	return messageflow.TargetCapabilities{
@@ -113,31 +383,136 @@ func (t *Target) Capabilities() messageflow.TargetCapabilities {
 }
 
 type channelServicesPayload struct {
-	Channel          string
-	Message          string
-	MessageName      string
-	ReplyMessage     *string
-	ReplyMessageName *string
-	Senders          []string
-	Receivers        []string
-	OmitPayloads     bool
+	Channel string
+	// Messages and ReplyMessages hold all message variants on the channel, e.g. of oneOf, by name.
+	Messages      []messageflow.Message
+	ReplyMessages []messageflow.Message
+	// SentMessages and ReceivedMessages hold messages of send and receive operations respectively.
+	SentMessages     []messageflow.Message
+	ReceivedMessages []messageflow.Message
+	// SplitMessages reports whether senders and receivers of the channel declare different messages,
+	// e.g. when the channel transforms messages, so they are shown separately.
+	SplitMessages bool
+	Senders       []string
+	Receivers     []string
+	OmitPayloads  bool
+	Tags          []string
+	// ContentTypes lists content types of messages on the channel separated by comma.
+	ContentTypes string
+	// Protocol is the transport of the channel.
+	Protocol string
+	// Security lists security requirements of operations on the channel.
+	Security []messageflow.SecurityRequirement
+	// Deprecated holds services whose operations on the channel are deprecated.
+	Deprecated map[string]bool
+	// Highlighted reports whether messages on the channel have the field of FormatOptions.HighlightField.
+	Highlighted bool
+	// PayloadTree shows flattened payloads as trees, see PayloadStyleTree.
+	PayloadTree bool
 }
 
 type contextServicesPayload struct {
 	Services    []messageflow.Service
 	Connections []connection
+	Colors      map[string]serviceColor
+	// Paths maps service names to D2 node keys, nesting grouped services into group containers.
+	Paths map[string]string
+	// Legend adds a legend of connection labels and line styles, positioned apart from the layout.
+	Legend          bool
+	HighlightCycles bool
+	HighlightField  string
+	EdgeMetadata    string
+	// Realtime reports whether any connection carries realtime transports, see connection.Realtime.
+	Realtime bool
+	// SelfLoops reports whether any connection is a self-loop, see FormatOptions.SelfLoops.
+	SelfLoops bool
+	// Links maps services to URLs their nodes link to, see FormatOptions.ServiceLinks.
+	Links map[string]string
+	// Changes maps services to their style when FormatOptions.Baseline is set, unchanged ones are missing.
+	Changes map[string]*changeStyle
+}
+
+// changeStyle colors services and connections changed since FormatOptions.Baseline.
+type changeStyle struct {
+	Fill   string
+	Stroke string
+	// Ghosted fades out removed elements.
+	Ghosted bool
+}
+
+// Styles of elements added, removed and changed since the baseline.
+var (
+	addedStyle   = &changeStyle{Fill: "#c8e6c9", Stroke: "#1b5e20"}
+	removedStyle = &changeStyle{Fill: "#ffcdd2", Stroke: "#b71c1c", Ghosted: true}
+	changedStyle = &changeStyle{Fill: "#fff59d", Stroke: "#f57f17"}
+)
+
+type serviceColor struct {
+	Fill   string
+	Stroke string
+}
+
+// servicePalette is a set of fill/stroke pairs used to color code services.
+var servicePalette = []serviceColor{
+	{Fill: "#e3f2fd", Stroke: "#1565c0"},
+	{Fill: "#e8f5e9", Stroke: "#2e7d32"},
+	{Fill: "#fff3e0", Stroke: "#ef6c00"},
+	{Fill: "#f3e5f5", Stroke: "#6a1b9a"},
+	{Fill: "#fce4ec", Stroke: "#ad1457"},
+	{Fill: "#e0f7fa", Stroke: "#00838f"},
+	{Fill: "#fffde7", Stroke: "#f9a825"},
+	{Fill: "#efebe9", Stroke: "#4e342e"},
 }
 
 type serviceServicesPayload struct {
 	MainService      messageflow.Service
 	NeighborServices []messageflow.Service
+	// DistantServices are services more than one hop away from the main service.
+	DistantServices []messageflow.Service
+	// DistantConnections connect distant services with each other and with neighbor services.
+	DistantConnections []connection
+}
+
+// serviceOverviewPayload combines the service channels and service services payloads of a service,
+// rendered as two sections of one diagram.
+type serviceOverviewPayload struct {
+	Channels messageflow.Service
+	Services serviceServicesPayload
+}
+
+// sequencePayload lists services in the order they join the traced flow and the steps between them.
+type sequencePayload struct {
+	Services []string
+	Steps    []sequenceStep
+}
+
+type sequenceStep struct {
+	messageflow.SequenceStep
+	// Label names the channel and messages of the step, escaped for a quoted d2 label.
+	Label string
 }
 
+// maxServiceServicesNodes caps the number of services in a service services diagram
+// expanded over several hops.
+const maxServiceServicesNodes = 50
+
 type connection struct {
 	From          string
 	To            string
 	Label         string
 	Bidirectional bool
+	// Channels lists channel groups the services communicate over separated by comma.
+	Channels string
+	// Cycle reports whether the connection is part of a cycle of services, see FormatOptions.HighlightCycles.
+	Cycle bool
+	// Highlighted reports whether the connection carries messages with the field of FormatOptions.HighlightField.
+	Highlighted bool
+	// Change styles the connection added, removed or changed since FormatOptions.Baseline, nil if unchanged.
+	Change *changeStyle
+	// Metadata lists values of FormatOptions.EdgeMetadata of the connection separated by comma.
+	Metadata string
+	// Realtime lists realtime transports (ws, sse) of the connection channels separated by comma.
+	Realtime string
 }
 
 func (t *Target) FormatSchema(
@@ -149,11 +524,65 @@ func (t *Target) FormatSchema(
 		Type: targetType,
 	}
 
+	if opts.ExcludeDeprecated {
+		s = withoutDeprecated(s)
+	}
+
+	if len(opts.ExcludeChannelPatterns) > 0 {
+		s = s.ExcludeChannels(opts.ExcludeChannelPatterns...)
+	}
+
+	if !opts.PreserveOrder {
+		s = sortedSchema(s)
+	}
+
 	var buf bytes.Buffer
 
+	if t.direction != "down" {
+		fmt.Fprintf(&buf, "direction: %s\n\n", t.direction)
+	}
+
+	if t.fontSize > 0 {
+		fmt.Fprintf(&buf, "**.style.font-size: %d\n(** -> **)[*].style.font-size: %d\n\n", t.fontSize, t.fontSize)
+	}
+
 	switch opts.Mode {
 	case messageflow.FormatModeContextServices:
-		payload := prepareContextServicesPayload(s)
+		if t.maxContextServices > 0 && len(s.Services) > t.maxContextServices {
+			return messageflow.FormattedSchema{}, fmt.Errorf(
+				"context diagram has %d services, more than the limit of %d, filter the schema to fewer services",
+				len(s.Services), t.maxContextServices,
+			)
+		}
+
+		payload := prepareContextServicesPayload(s, opts.ChannelPrefixDepth, opts.SelfLoops)
+		if t.colorByGroup && opts.Baseline == nil {
+			payload.Colors = serviceColors(s)
+		}
+		if opts.Baseline != nil {
+			baseline := *opts.Baseline
+			if opts.ExcludeDeprecated {
+				baseline = withoutDeprecated(baseline)
+			}
+			if len(opts.ExcludeChannelPatterns) > 0 {
+				baseline = baseline.ExcludeChannels(opts.ExcludeChannelPatterns...)
+			}
+			markChanges(&payload, sortedSchema(baseline), s, opts.ChannelPrefixDepth, opts.SelfLoops)
+		}
+		if opts.HighlightCycles {
+			markCycles(payload.Connections, messageflow.DetectCycles(s))
+		}
+		if opts.HighlightField != "" {
+			markHighlighted(payload.Connections, s, opts.HighlightField)
+		}
+		if opts.EdgeMetadata != "" {
+			markMetadata(payload.Connections, s, opts.EdgeMetadata)
+		}
+		payload.Legend = t.legend
+		payload.Links = opts.ServiceLinks
+		payload.HighlightCycles = opts.HighlightCycles
+		payload.HighlightField = opts.HighlightField
+		payload.EdgeMetadata = opts.EdgeMetadata
 
 		err := t.contextServicesTemplate.Execute(&buf, payload)
 		if err != nil {
@@ -168,24 +597,50 @@ func (t *Target) FormatSchema(
 		}
 	case messageflow.FormatModeChannelServices:
 		payload := prepareChannelServicesPayload(s, opts.Channel, opts.OmitPayloads)
+		payload.PayloadTree = t.payloadStyle == PayloadStyleTree
+		if opts.HighlightField != "" {
+			payload.Highlighted = highlightedChannels(s, opts.HighlightField)[opts.Channel]
+		}
 
 		err := t.channelServicesTemplate.Execute(&buf, payload)
 		if err != nil {
 			return messageflow.FormattedSchema{}, fmt.Errorf("executing channel services template: %w", err)
 		}
 	case messageflow.FormatModeServiceServices:
-		payload := prepareServiceServicesPayload(s, opts.Service)
+		payload := prepareServiceServicesPayload(s, opts.Service, opts.Depth)
 
 		err := t.serviceServicesTemplate.Execute(&buf, payload)
 		if err != nil {
 			return messageflow.FormattedSchema{}, fmt.Errorf("executing service services template: %w", err)
 		}
+	case messageflow.FormatModeServiceOverview:
+		payload := serviceOverviewPayload{
+			Channels: prepareServiceChannelsPayload(s, opts.Service),
+			Services: prepareServiceServicesPayload(s, opts.Service, opts.Depth),
+		}
+
+		err := t.serviceOverviewTemplate.Execute(&buf, payload)
+		if err != nil {
+			return messageflow.FormattedSchema{}, fmt.Errorf("executing service overview template: %w", err)
+		}
+	case messageflow.FormatModeSequence:
+		payload, err := prepareSequencePayload(s, opts.Service, opts.Channel)
+		if err != nil {
+			return messageflow.FormattedSchema{}, fmt.Errorf("tracing sequence: %w", err)
+		}
+
+		err = t.sequenceTemplate.Execute(&buf, payload)
+		if err != nil {
+			return messageflow.FormattedSchema{}, fmt.Errorf("executing sequence template: %w", err)
+		}
 	default:
 		return messageflow.FormattedSchema{}, messageflow.NewUnsupportedFormatModeError(opts.Mode, []messageflow.FormatMode{
 			messageflow.FormatModeServiceChannels,
 			messageflow.FormatModeChannelServices,
 			messageflow.FormatModeContextServices,
 			messageflow.FormatModeServiceServices,
+			messageflow.FormatModeServiceOverview,
+			messageflow.FormatModeSequence,
 		})
 	}
 
@@ -194,13 +649,48 @@ func (t *Target) FormatSchema(
 	return fs, nil
 }
 
-// RenderSchema renders a formatted D2 diagram to SVG format.
+// RenderSchema renders a formatted D2 diagram to SVG or PNG format depending on the output format.
 func (t *Target) RenderSchema(ctx context.Context, s messageflow.FormattedSchema) ([]byte, error) {
 	if s.Type != targetType {
 		return nil, messageflow.NewUnsupportedFormatError(s.Type, targetType)
 	}
 
-	ctx = log.WithDefault(ctx)
+	if t.logger != nil {
+		ctx = log.With(ctx, t.logger)
+	} else {
+		ctx = log.WithDefault(ctx)
+	}
+
+	var cacheKey [sha256.Size]byte
+	if t.renderCache != nil {
+		cacheKey = t.renderCacheKey(s.Data)
+		if out, ok := t.renderCache.get(cacheKey); ok {
+			log.Debug(ctx, "reused cached diagram", slog.Int("bytes", len(out)))
+			return out, nil
+		}
+	}
+
+	out, err := t.render(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.renderCache != nil {
+		t.renderCache.add(cacheKey, out)
+	}
+
+	return out, nil
+}
+
+// render compiles and renders the formatted schema in the output format.
+func (t *Target) render(ctx context.Context, s messageflow.FormattedSchema) ([]byte, error) {
+	// The render timeout is kept apart from the deadline of the caller, so errors tell them apart.
+	renderCtx := ctx
+	if t.renderTimeout > 0 {
+		var cancel context.CancelFunc
+		renderCtx, cancel = context.WithTimeout(ctx, t.renderTimeout)
+		defer cancel()
+	}
 
 	// Create a new Ruler for each call since it's not thread-safe
 	ruler, err := textmeasure.NewRuler()
@@ -217,7 +707,16 @@ func (t *Target) RenderSchema(ctx context.Context, s messageflow.FormattedSchema
 		Ruler:          ruler,
 	}
 
-	diagram, _, err := d2lib.Compile(ctx, string(s.Data), compileOpts, t.renderOpts)
+	start := time.Now()
+
+	diagram, _, err := d2lib.Compile(renderCtx, string(s.Data), compileOpts, t.renderOpts)
+	if ctxErr := renderCtx.Err(); ctxErr != nil {
+		if ctx.Err() == nil {
+			return nil, fmt.Errorf("compiling diagram: timed out after %s: %w", t.renderTimeout, ctxErr)
+		}
+
+		return nil, fmt.Errorf("compiling diagram: %w", ctx.Err())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("compiling diagram: %w", err)
 	}
@@ -227,7 +726,50 @@ func (t *Target) RenderSchema(ctx context.Context, s messageflow.FormattedSchema
 		return nil, fmt.Errorf("rendering diagram: %w", err)
 	}
 
-	return out, nil
+	log.Debug(ctx, "rendered diagram", slog.Duration("duration", time.Since(start)), slog.Int("bytes", len(out)))
+
+	switch t.outputFormat {
+	case OutputFormatSVG:
+		if t.minifySVG {
+			out = minifySVG(out)
+		}
+
+		return out, nil
+	case OutputFormatPNG:
+		out, err = rasterizePNG(out, t.pngScale)
+		if err != nil {
+			return nil, fmt.Errorf("rasterizing diagram: %w", err)
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", t.outputFormat)
+	}
+}
+
+// withoutDeprecated returns a copy of the schema without deprecated operations.
+func withoutDeprecated(s messageflow.Schema) messageflow.Schema {
+	services := make([]messageflow.Service, len(s.Services))
+	for i, service := range s.Services {
+		service.Operation = slices.DeleteFunc(slices.Clone(service.Operation), messageflow.Operation.IsDeprecated)
+		services[i] = service
+	}
+
+	return messageflow.Schema{Services: services}
+}
+
+// sortedSchema returns a copy of the schema with sorted operations leaving the given one untouched.
+func sortedSchema(s messageflow.Schema) messageflow.Schema {
+	services := make([]messageflow.Service, len(s.Services))
+	for i, service := range s.Services {
+		service.Operation = slices.Clone(service.Operation)
+		services[i] = service
+	}
+
+	sorted := messageflow.Schema{Services: services}
+	sorted.SortOperations()
+
+	return sorted
 }
 
 func prepareServiceChannelsPayload(s messageflow.Schema, serviceName string) messageflow.Service {
@@ -250,45 +792,115 @@ func prepareChannelServicesPayload(s messageflow.Schema, channel string, omitPay
 		OmitPayloads: omitPayloads,
 	}
 
+	var contentTypes []string
+
 	for _, service := range s.Services {
 		for _, op := range service.Operation {
 			if op.Channel.Name == channel {
+				for _, tag := range op.Channel.Tags {
+					if !messageflow.HasTag(payload.Tags, tag) {
+						payload.Tags = append(payload.Tags, tag)
+					}
+				}
+
+				if payload.Protocol == "" {
+					payload.Protocol = op.Channel.Protocol
+				}
+
+				for _, requirement := range op.Security {
+					if !slices.ContainsFunc(payload.Security, func(r messageflow.SecurityRequirement) bool {
+						return r.String() == requirement.String()
+					}) {
+						payload.Security = append(payload.Security, requirement)
+					}
+				}
+
+				messages := op.Channel.Messages
+				if op.Reply != nil {
+					messages = append(slices.Clone(messages), op.Reply.Messages...)
+				}
+
+				for _, msg := range messages {
+					if msg.ContentType != "" && !slices.Contains(contentTypes, msg.ContentType) {
+						contentTypes = append(contentTypes, msg.ContentType)
+					}
+				}
+
+				if op.IsDeprecated() {
+					if payload.Deprecated == nil {
+						payload.Deprecated = make(map[string]bool)
+					}
+					payload.Deprecated[service.Name] = true
+				}
+
 				switch op.Action {
 				case messageflow.ActionSend:
 					payload.Senders = append(payload.Senders, service.Name)
+					payload.SentMessages = mergeMessages(payload.SentMessages, op.Channel.Messages)
 				case messageflow.ActionReceive:
 					payload.Receivers = append(payload.Receivers, service.Name)
+					payload.ReceivedMessages = mergeMessages(payload.ReceivedMessages, op.Channel.Messages)
 				}
 
-				if len(op.Channel.Messages) > 0 {
-					firstMessage := op.Channel.Messages[0]
-					if len(payload.Message) < len(firstMessage.Payload) {
-						payload.Message = firstMessage.Payload
-						payload.MessageName = firstMessage.Name
-					}
-				}
+				payload.Messages = mergeMessages(payload.Messages, op.Channel.Messages)
 
-				if op.Reply != nil && len(op.Reply.Messages) > 0 {
-					firstReplyMessage := op.Reply.Messages[0]
-					if payload.ReplyMessage == nil ||
-						(len(*payload.ReplyMessage) < len(firstReplyMessage.Payload)) {
-						payload.ReplyMessage = &firstReplyMessage.Payload
-						payload.ReplyMessageName = &firstReplyMessage.Name
-					}
+				if op.Reply != nil {
+					payload.ReplyMessages = mergeMessages(payload.ReplyMessages, op.Reply.Messages)
 				}
 			}
 		}
 	}
 
+	sort.Strings(contentTypes)
+	payload.ContentTypes = strings.Join(contentTypes, ", ")
+
+	payload.SplitMessages = len(payload.ReplyMessages) == 0 &&
+		len(payload.SentMessages) > 0 && len(payload.ReceivedMessages) > 0 &&
+		!sameMessageNames(payload.SentMessages, payload.ReceivedMessages)
+
 	return payload
 }
 
-func prepareContextServicesPayload(s messageflow.Schema) contextServicesPayload {
+// mergeMessages appends messages not yet present by name. Operations may describe the same message
+// differently, the most detailed, i.e. longest, payload is kept.
+func mergeMessages(messages, others []messageflow.Message) []messageflow.Message {
+	for _, msg := range others {
+		i := slices.IndexFunc(messages, func(m messageflow.Message) bool { return m.Name == msg.Name })
+		if i < 0 {
+			messages = append(messages, msg)
+			continue
+		}
+
+		if len(messages[i].Payload) < len(msg.Payload) {
+			messages[i] = msg
+		}
+	}
+
+	return messages
+}
+
+// sameMessageNames reports whether both lists contain messages of the same names.
+func sameMessageNames(messages, others []messageflow.Message) bool {
+	names := func(messages []messageflow.Message) []string {
+		result := make([]string, 0, len(messages))
+		for _, msg := range messages {
+			result = append(result, msg.Name)
+		}
+		sort.Strings(result)
+
+		return result
+	}
+
+	return slices.Equal(names(messages), names(others))
+}
+
+func prepareContextServicesPayload(s messageflow.Schema, channelPrefixDepth int, selfLoops bool) contextServicesPayload {
 	formattedServices := make([]messageflow.Service, len(s.Services))
 	for i, service := range s.Services {
 		formattedServices[i] = messageflow.Service{
 			Name:        service.Name,
 			Description: formatDescription(service.Description),
+			Group:       service.Group,
 			Operation:   service.Operation,
 		}
 	}
@@ -296,76 +908,430 @@ func prepareContextServicesPayload(s messageflow.Schema) contextServicesPayload
 	payload := contextServicesPayload{
 		Services:    formattedServices,
 		Connections: []connection{},
+		Paths:       make(map[string]string, len(s.Services)),
 	}
 
-	servicePairs := make(map[string]map[string]bool) // service1->service2 -> hasSendOperation
-
-	// First pass: collect all send operations between service pairs
 	for _, service := range s.Services {
-		for _, op := range service.Operation {
-			if op.Action == messageflow.ActionSend {
-				for _, otherService := range s.Services {
-					if otherService.Name == service.Name {
+		path := fmt.Sprintf("'%s'", service.Name)
+		if service.Group != "" {
+			path = fmt.Sprintf("'%s'.%s", service.Group, path)
+		}
+		payload.Paths[service.Name] = path
+	}
+
+	protocols := channelProtocols(s)
+
+	for _, edge := range serviceEdges(s, selfLoops) {
+		conn := connection{
+			From:          edge.From,
+			To:            edge.To,
+			Label:         edge.Label,
+			Bidirectional: edge.Bidirectional,
+			Realtime:      channelsRealtime(protocols, edge.Channels),
+		}
+
+		if conn.Realtime != "" {
+			payload.Realtime = true
+		}
+
+		if edge.From == edge.To {
+			payload.SelfLoops = true
+		}
+
+		if channelPrefixDepth > 0 {
+			conn.Channels = strings.Join(channelGroups(edge.Channels, channelPrefixDepth), ", ")
+		}
+
+		payload.Connections = append(payload.Connections, conn)
+	}
+
+	return payload
+}
+
+// serviceEdges returns edges of the service graph, followed by self-loops of services when selfLoops is set.
+func serviceEdges(s messageflow.Schema, selfLoops bool) []messageflow.GraphEdge {
+	edges := messageflow.BuildServiceGraph(s).Edges
+	if selfLoops {
+		edges = append(edges, messageflow.SelfLoops(s)...)
+	}
+
+	return edges
+}
+
+// markChanges marks services and connections added, removed or changed since the baseline,
+// adding removed ones to the payload. Changed services are those messageflow.CompareSchemas reports changes of,
+// changed connections those whose label, direction or channels changed, or whose channels carry changed messages.
+func markChanges(payload *contextServicesPayload, baseline, s messageflow.Schema, channelPrefixDepth int, selfLoops bool) {
+	payload.Changes = make(map[string]*changeStyle)
+
+	for _, change := range messageflow.CompareSchemas(baseline, s).Changes {
+		if change.Category == messageflow.ChangeCategoryService {
+			if change.Type == messageflow.ChangeTypeRemoved {
+				payload.Changes[change.Name] = removedStyle
+			} else {
+				payload.Changes[change.Name] = addedStyle
+			}
+
+			continue
+		}
+
+		service, _, _ := strings.Cut(change.Name, ":")
+		payload.Changes[service] = changedStyle
+	}
+
+	removed := prepareContextServicesPayload(baseline, channelPrefixDepth, selfLoops)
+	for _, service := range removed.Services {
+		if payload.Changes[service.Name] == removedStyle {
+			payload.Services = append(payload.Services, service)
+			payload.Paths[service.Name] = removed.Paths[service.Name]
+		}
+	}
+
+	oldEdges := make(map[string]messageflow.GraphEdge)
+	for _, edge := range serviceEdges(baseline, selfLoops) {
+		oldEdges[edgePair(edge)] = edge
+	}
+
+	newEdges := make(map[string]messageflow.GraphEdge)
+	for _, edge := range serviceEdges(s, selfLoops) {
+		newEdges[edgePair(edge)] = edge
+	}
+
+	changedChannels := changedChannels(baseline, s)
+
+	for i, conn := range payload.Connections {
+		pair := edgePair(messageflow.GraphEdge{From: conn.From, To: conn.To})
+		edge, oldEdge := newEdges[pair], oldEdges[pair]
+
+		switch {
+		case oldEdge.From == "":
+			payload.Connections[i].Change = addedStyle
+		case edgeChanged(oldEdge, edge, changedChannels):
+			payload.Connections[i].Change = changedStyle
+		}
+	}
+
+	for _, conn := range removed.Connections {
+		if _, ok := newEdges[edgePair(messageflow.GraphEdge{From: conn.From, To: conn.To})]; !ok {
+			conn.Change = removedStyle
+			payload.Connections = append(payload.Connections, conn)
+		}
+	}
+}
+
+// edgeChanged reports whether the label, direction or channels of the edge changed,
+// or any of its channels carries changed messages.
+func edgeChanged(oldEdge, newEdge messageflow.GraphEdge, changedChannels map[string]bool) bool {
+	if oldEdge.From != newEdge.From || oldEdge.Label != newEdge.Label || oldEdge.Bidirectional != newEdge.Bidirectional {
+		return true
+	}
+
+	if !slices.Equal(oldEdge.Channels, newEdge.Channels) {
+		return true
+	}
+
+	return slices.ContainsFunc(newEdge.Channels, func(channel string) bool {
+		return changedChannels[channel]
+	})
+}
+
+// edgePair identifies the services an edge connects regardless of its direction.
+func edgePair(edge messageflow.GraphEdge) string {
+	from, to := edge.From, edge.To
+	if to < from {
+		from, to = to, from
+	}
+
+	return from + "<->" + to
+}
+
+// changedChannels returns channels, including reply channels, whose messages differ between the schemas.
+func changedChannels(oldSchema, newSchema messageflow.Schema) map[string]bool {
+	fingerprints := func(s messageflow.Schema) map[string]string {
+		messages := make(map[string][]string)
+		for _, service := range s.Services {
+			for _, op := range service.Operation {
+				for _, channel := range []*messageflow.Channel{&op.Channel, op.Reply} {
+					if channel == nil {
 						continue
 					}
 
-					for _, otherOp := range otherService.Operation {
-						if otherOp.Channel.Name == op.Channel.Name && otherOp.Action == messageflow.ActionReceive {
-							if servicePairs[service.Name] == nil {
-								servicePairs[service.Name] = make(map[string]bool)
-							}
-							servicePairs[service.Name][otherService.Name] = true
-							break
-						}
-					}
+					data, _ := json.Marshal(channel.Messages)
+					messages[channel.Name] = append(messages[channel.Name], string(data))
 				}
 			}
 		}
+
+		result := make(map[string]string, len(messages))
+		for channel, data := range messages {
+			sort.Strings(data)
+			result[channel] = strings.Join(slices.Compact(data), "\n")
+		}
+
+		return result
 	}
 
-	// Second pass: create connections and detect bidirectional communication
-	connectionMap := make(map[string]connection)
+	oldChannels := fingerprints(oldSchema)
+	changed := make(map[string]bool)
+
+	for channel, fingerprint := range fingerprints(newSchema) {
+		if old, ok := oldChannels[channel]; ok && old != fingerprint {
+			changed[channel] = true
+		}
+	}
 
-	for service1, receivers := range servicePairs {
-		for service2 := range receivers {
-			bidirectional := servicePairs[service2] != nil && servicePairs[service2][service1]
+	return changed
+}
+
+// markCycles marks connections the services of the cycles send messages over, in either direction
+// for bidirectional connections.
+func markCycles(connections []connection, cycles [][]string) {
+	edges := make(map[string]bool)
+	for _, cycle := range cycles {
+		for i, from := range cycle {
+			edges[from+"->"+cycle[(i+1)%len(cycle)]] = true
+		}
+	}
+
+	for i, conn := range connections {
+		connections[i].Cycle = edges[conn.From+"->"+conn.To] || (conn.Bidirectional && edges[conn.To+"->"+conn.From])
+	}
+}
 
-			var from, to string
-			switch {
-			case bidirectional && service1 < service2:
-				from, to = service1, service2
-			case bidirectional && service1 >= service2:
-				from, to = service2, service1
-			default:
-				from, to = service1, service2
+// markHighlighted marks connections over channels carrying messages with the field at path.
+func markHighlighted(connections []connection, s messageflow.Schema, path string) {
+	highlighted := highlightedChannels(s, path)
+
+	edges := make(map[string]bool)
+	for _, edge := range serviceEdges(s, true) {
+		for _, channel := range edge.Channels {
+			if highlighted[channel] {
+				edges[edge.From+"->"+edge.To] = true
+				break
 			}
+		}
+	}
 
-			key := fmt.Sprintf("%s->%s", from, to)
+	for i, conn := range connections {
+		connections[i].Highlighted = edges[conn.From+"->"+conn.To]
+	}
+}
+
+// markMetadata sets metadata of connections to unique values of the metadata key of operations
+// the connected services define over channels of the connections.
+func markMetadata(connections []connection, s messageflow.Schema, key string) {
+	type serviceChannel struct {
+		service string
+		channel string
+	}
 
-			label := determineConnectionLabel(s, from, to)
+	values := make(map[serviceChannel][]string)
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			value, ok := op.Metadata[key]
+			if !ok {
+				continue
+			}
 
-			conn := connection{
-				From:          from,
-				To:            to,
-				Label:         label,
-				Bidirectional: bidirectional,
+			channels := []string{op.Channel.Name}
+			if op.Reply != nil {
+				channels = append(channels, op.Reply.Name)
 			}
 
-			connectionMap[key] = conn
+			for _, channel := range channels {
+				k := serviceChannel{service: service.Name, channel: channel}
+				values[k] = append(values[k], value)
+			}
 		}
 	}
 
-	keys := make([]string, 0, len(connectionMap))
-	for key := range connectionMap {
-		keys = append(keys, key)
+	edges := make(map[string]string)
+	for _, edge := range serviceEdges(s, true) {
+		var edgeValues []string
+		for _, channel := range edge.Channels {
+			edgeValues = append(edgeValues, values[serviceChannel{service: edge.From, channel: channel}]...)
+			edgeValues = append(edgeValues, values[serviceChannel{service: edge.To, channel: channel}]...)
+		}
+
+		slices.Sort(edgeValues)
+		edges[edge.From+"->"+edge.To] = strings.Join(slices.Compact(edgeValues), ", ")
 	}
-	sort.Strings(keys)
 
-	for _, key := range keys {
-		payload.Connections = append(payload.Connections, connectionMap[key])
+	for i, conn := range connections {
+		connections[i].Metadata = edges[conn.From+"->"+conn.To]
 	}
+}
 
-	return payload
+// highlightedChannels returns channels, including reply channels, carrying messages with the field at path.
+func highlightedChannels(s messageflow.Schema, path string) map[string]bool {
+	segments := strings.Split(path, ".")
+	channels := make(map[string]bool)
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			for _, channel := range []*messageflow.Channel{&op.Channel, op.Reply} {
+				if channel == nil || channels[channel.Name] {
+					continue
+				}
+
+				for _, msg := range channel.Messages {
+					if payloadHasField(msg.Payload, segments) {
+						channels[channel.Name] = true
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return channels
+}
+
+// payloadHasField reports whether the JSON payload, either flattened into field types or a JSON schema,
+// has the field at the path. Array items are searched transparently.
+func payloadHasField(payload string, path []string) bool {
+	var value any
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return false
+	}
+
+	return hasField(value, path)
+}
+
+func hasField(value any, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if hasField(item, path) {
+				return true
+			}
+		}
+	case map[string]any:
+		if _, ok := v["type"].(string); ok && (v["properties"] != nil || v["items"] != nil) {
+			if props, ok := v["properties"].(map[string]any); ok {
+				if prop, ok := props[path[0]]; ok && hasField(prop, path[1:]) {
+					return true
+				}
+			}
+
+			return hasField(v["items"], path)
+		}
+
+		for _, key := range []string{"oneOf", "anyOf", "allOf"} {
+			if variants, ok := v[key].([]any); ok && hasField(variants, path) {
+				return true
+			}
+		}
+
+		if field, ok := v[path[0]]; ok {
+			return hasField(field, path[1:])
+		}
+	}
+
+	return false
+}
+
+// serviceColors assigns deterministic colors to services hashed from their group or name.
+func serviceColors(s messageflow.Schema) map[string]serviceColor {
+	colors := make(map[string]serviceColor, len(s.Services))
+
+	for _, service := range s.Services {
+		key := service.Group
+		if key == "" {
+			key = service.Name
+		}
+
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+
+		colors[service.Name] = servicePalette[h.Sum32()%uint32(len(servicePalette))]
+	}
+
+	return colors
+}
+
+// tagsLabel joins unique tags of the given sets into a badge-like label, e.g. "[pii] [internal]".
+func tagsLabel(tagSets ...[]string) string {
+	var badges []string
+
+	seen := make(map[string]bool)
+	for _, tags := range tagSets {
+		for _, tag := range tags {
+			if !seen[tag] {
+				seen[tag] = true
+				badges = append(badges, "["+tag+"]")
+			}
+		}
+	}
+
+	return strings.Join(badges, " ")
+}
+
+// securityLabel describes security requirements as a lock badge, e.g. "🔒 orderAuth (oauth2): orders:write",
+// empty when there are none.
+func securityLabel(requirements []messageflow.SecurityRequirement) string {
+	if len(requirements) == 0 {
+		return ""
+	}
+
+	descriptions := make([]string, 0, len(requirements))
+	for _, requirement := range requirements {
+		descriptions = append(descriptions, requirement.String())
+	}
+
+	return labelText("🔒 " + strings.Join(descriptions, "; "))
+}
+
+// labelText makes free text, such as operation summaries, safe to use inside a quoted d2 label
+// by collapsing whitespace and escaping quotes.
+func labelText(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text)
+}
+
+// edgeLabel returns the label of an operation edge, e.g. Send, followed by the operation summary when set.
+func edgeLabel(label, summary string) string {
+	if summary == "" {
+		return label
+	}
+
+	return `"` + label + `\n` + labelText(summary) + `"`
+}
+
+// messageNames joins names of message variants, e.g. "UserCreated | UserUpdated".
+func messageNames(messages []messageflow.Message) string {
+	names := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		names = append(names, msg.Name)
+	}
+
+	return strings.Join(names, " | ")
+}
+
+// deprecated reports whether any of the given tag sets marks an element as deprecated.
+func deprecated(tagSets ...[]string) bool {
+	for _, tags := range tagSets {
+		if messageflow.HasTag(tags, messageflow.TagDeprecated) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncatePayload cuts payloads longer than maxPayloadLines, marking the cut with an ellipsis line.
+func truncatePayload(payload string) string {
+	lines := strings.Split(payload, "\n")
+	if len(lines) <= maxPayloadLines {
+		return payload
+	}
+
+	return strings.Join(append(lines[:maxPayloadLines], "..."), "\n")
 }
 
 // formatDescription formats a description string by adding newlines every 7 words for better readability in D2 diagrams.
@@ -393,57 +1359,30 @@ func formatDescription(desc string) string {
 	return strings.Join(lines, "  \n")
 }
 
-func determineConnectionLabel(s messageflow.Schema, service1, service2 string) string {
-	var hasPub, hasReq bool
-
-	svc1 := findServiceByName(s, service1)
-	svc2 := findServiceByName(s, service2)
-
-	for _, op1 := range svc1.Operation {
-		for _, op2 := range svc2.Operation {
-			if op1.Channel.Name != op2.Channel.Name {
-				continue
-			}
-
-			switch {
-			case op1.Action == messageflow.ActionSend && op2.Action == messageflow.ActionReceive:
-				if op1.Reply != nil {
-					hasReq = true
-					continue
-				}
-
-				hasPub = true
-			case op1.Action == messageflow.ActionReceive && op2.Action == messageflow.ActionSend:
-				if op2.Reply != nil {
-					hasReq = true
-					continue
-				}
-
-				hasPub = true
-			}
-		}
+// channelGroups returns sorted unique groups of the channels, see channelGroup.
+func channelGroups(channels []string, depth int) []string {
+	groups := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		groups = append(groups, channelGroup(channel, depth))
 	}
 
-	switch {
-	case hasPub && hasReq:
-		return "Pub/Req"
-	case hasReq:
-		return "Req"
-	default:
-		return "Pub"
-	}
+	sort.Strings(groups)
+
+	return slices.Compact(groups)
 }
 
-func findServiceByName(s messageflow.Schema, name string) messageflow.Service {
-	for _, service := range s.Services {
-		if service.Name == name {
-			return service
-		}
+// channelGroup returns the first depth dot-delimited segments of the channel name followed by .*,
+// or the name itself when it has no more segments.
+func channelGroup(name string, depth int) string {
+	segments := strings.Split(name, ".")
+	if len(segments) <= depth {
+		return name
 	}
-	return messageflow.Service{}
+
+	return strings.Join(segments[:depth], ".") + ".*"
 }
 
-func prepareServiceServicesPayload(s messageflow.Schema, serviceName string) serviceServicesPayload {
+func prepareServiceServicesPayload(s messageflow.Schema, serviceName string, depth int) serviceServicesPayload {
 	var mainService messageflow.Service
 	if serviceName == "" && len(s.Services) == 1 {
 		mainService = s.Services[0]
@@ -503,8 +1442,152 @@ func prepareServiceServicesPayload(s messageflow.Schema, serviceName string) ser
 		}
 	}
 
-	return serviceServicesPayload{
+	payload := serviceServicesPayload{
 		MainService:      mainService,
 		NeighborServices: neighborServices,
 	}
+
+	if depth > 1 {
+		payload.DistantServices, payload.DistantConnections = expandServices(s, mainService, neighborServices, depth)
+	}
+
+	return payload
+}
+
+// expandServices expands the neighborhood of the main service breadth-first up to depth hops.
+// Returns services beyond the immediate neighbors and connections in which they participate.
+// Visited services are tracked to handle cycles and expansion stops at maxServiceServicesNodes services.
+func expandServices(
+	s messageflow.Schema,
+	mainService messageflow.Service,
+	neighborServices []messageflow.Service,
+	depth int,
+) ([]messageflow.Service, []connection) {
+	var (
+		distant  = []messageflow.Service{}
+		visited  = map[string]bool{mainService.Name: true}
+		frontier = neighborServices
+	)
+
+	for _, service := range neighborServices {
+		visited[service.Name] = true
+	}
+
+	for hop := 2; hop <= depth && len(frontier) > 0; hop++ {
+		var next []messageflow.Service
+
+		for _, service := range s.Services {
+			if visited[service.Name] || len(visited) >= maxServiceServicesNodes {
+				continue
+			}
+
+			for _, f := range frontier {
+				if len(serviceLinks(service, f)) > 0 || len(serviceLinks(f, service)) > 0 {
+					visited[service.Name] = true
+					next = append(next, service)
+					break
+				}
+			}
+		}
+
+		distant = append(distant, next...)
+		frontier = next
+	}
+
+	isDistant := make(map[string]bool, len(distant))
+	for _, service := range distant {
+		isDistant[service.Name] = true
+	}
+
+	var (
+		connections = []connection{}
+		seen        = make(map[string]bool)
+	)
+
+	for _, from := range s.Services {
+		for _, to := range s.Services {
+			if from.Name == to.Name || !visited[from.Name] || !visited[to.Name] {
+				continue
+			}
+
+			if !isDistant[from.Name] && !isDistant[to.Name] {
+				continue
+			}
+
+			for _, channel := range serviceLinks(from, to) {
+				key := fmt.Sprintf("%s->%s:%s", from.Name, to.Name, channel)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				connections = append(connections, connection{
+					From:  from.Name,
+					To:    to.Name,
+					Label: channel,
+				})
+			}
+		}
+	}
+
+	return distant, connections
+}
+
+// serviceLinks returns channels the sender sends to and the receiver receives from.
+func serviceLinks(sender, receiver messageflow.Service) []string {
+	var channels []string
+
+	for _, sendOp := range sender.Operation {
+		if sendOp.Action != messageflow.ActionSend {
+			continue
+		}
+
+		for _, receiveOp := range receiver.Operation {
+			if receiveOp.Action == messageflow.ActionReceive && receiveOp.Channel.Name == sendOp.Channel.Name {
+				channels = append(channels, sendOp.Channel.Name)
+				break
+			}
+		}
+	}
+
+	return channels
+}
+
+// prepareSequencePayload traces the flow of messages from send operations of the service on the channel,
+// see messageflow.TraceSequence.
+func prepareSequencePayload(s messageflow.Schema, service, channel string) (sequencePayload, error) {
+	steps, err := messageflow.TraceSequence(s, service, channel)
+	if err != nil {
+		return sequencePayload{}, err
+	}
+
+	var payload sequencePayload
+
+	for _, step := range steps {
+		for _, name := range []string{step.From, step.To} {
+			if !slices.Contains(payload.Services, name) {
+				payload.Services = append(payload.Services, name)
+			}
+		}
+
+		label := labelText(step.Channel)
+		switch {
+		case step.Request:
+			label = "Request: " + label
+		case step.Reply:
+			label = "Reply: " + label
+		}
+
+		if len(step.Messages) > 0 {
+			label += `\n` + labelText(strings.Join(step.Messages, " | "))
+		}
+
+		if step.Revisit {
+			label += `\n(continued above)`
+		}
+
+		payload.Steps = append(payload.Steps, sequenceStep{SequenceStep: step, Label: label})
+	}
+
+	return payload, nil
 }
@@ -1,13 +1,28 @@
 package d2
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/holydocs/messageflow/pkg/schema/target"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"oss.terrastruct.com/d2/d2renderers/d2svg"
+	"oss.terrastruct.com/util-go/go2"
 )
 
 func TestFormatSchema(t *testing.T) {
@@ -567,3 +582,1872 @@ func TestRenderSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderSchemaPNG(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Analytics Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionReceive,
+						Channel: messageflow.Channel{
+							Name: "user.created",
+							Messages: []messageflow.Message{
+								{
+									Name:    "UserCreated",
+									Payload: `{"user_id": "string[uuid]", "email": "string[email]"}`,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	opts := messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceChannels,
+		Service: "Analytics Service",
+	}
+
+	render := func(t *testing.T, scale float64) []byte {
+		t.Helper()
+
+		target, err := NewTarget(WithOutputFormat(OutputFormatPNG), WithPNGScale(scale))
+		require.NoError(t, err)
+
+		formattedSchema, err := target.FormatSchema(ctx, schema, opts)
+		require.NoError(t, err)
+
+		actual, err := target.RenderSchema(ctx, formattedSchema)
+		require.NoError(t, err)
+
+		return actual
+	}
+
+	cfg1, err := png.DecodeConfig(bytes.NewReader(render(t, 1)))
+	require.NoError(t, err)
+	assert.Positive(t, cfg1.Width)
+	assert.Positive(t, cfg1.Height)
+
+	cfg2, err := png.DecodeConfig(bytes.NewReader(render(t, 2)))
+	require.NoError(t, err)
+	assert.Equal(t, cfg1.Width*2, cfg2.Width)
+	assert.Equal(t, cfg1.Height*2, cfg2.Height)
+}
+
+func TestFormatSchemaDirection(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created"},
+					},
+				},
+			},
+		},
+	}
+
+	opts := messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	}
+
+	tests := []struct {
+		name      string
+		direction string
+		prefix    string
+	}{
+		{name: "right", direction: "right", prefix: "direction: right\n"},
+		{name: "left", direction: "left", prefix: "direction: left\n"},
+		{name: "unknown falls back to down", direction: "diagonal", prefix: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			target, err := NewTarget(WithDirection(tt.direction))
+			require.NoError(t, err)
+
+			actual, err := target.FormatSchema(ctx, schema, opts)
+			require.NoError(t, err)
+			if tt.prefix == "" {
+				assert.NotContains(t, string(actual.Data), "direction:")
+			} else {
+				assert.True(t, bytes.HasPrefix(actual.Data, []byte(tt.prefix)), string(actual.Data))
+			}
+
+			_, err = target.RenderSchema(ctx, actual)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestFormatSchemaColorByGroup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:  "Order Service",
+				Group: "sales",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "order.created"},
+					},
+				},
+			},
+			{
+				Name:  "Billing Service",
+				Group: "sales",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "order.created"},
+					},
+				},
+			},
+		},
+	}
+
+	opts := messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	}
+
+	colors := serviceColors(schema)
+	assert.Equal(t, colors["Order Service"], colors["Billing Service"])
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'Order Service'.style.fill: \""+colors["Order Service"].Fill+"\"")
+	assert.Contains(t, string(actual.Data), "style.stroke: \""+colors["Order Service"].Stroke+"\"")
+
+	target, err = NewTarget(WithColorByGroup(false))
+	require.NoError(t, err)
+
+	actual, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.NotContains(t, string(actual.Data), "style.")
+}
+
+func TestFormatSchemaGroups(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:  "Order Service",
+				Group: "Sales",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "order.created"},
+					},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "order.created"},
+					},
+				},
+			},
+		},
+	}
+
+	opts := messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	}
+
+	target, err := NewTarget(WithColorByGroup(false))
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "'Sales'.'Order Service': |md")
+	assert.Contains(t, data, "\n'Analytics Service': |md")
+	assert.Contains(t, data, "'Sales'.'Order Service' -> 'Analytics Service': {")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+}
+
+func TestRenderSchemaTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	target, err := NewTarget(WithRenderTimeout(time.Nanosecond))
+	require.NoError(t, err)
+
+	_, err = target.RenderSchema(ctx, messageflow.FormattedSchema{
+		Type: targetType,
+		Data: []byte("a -> b"),
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "timed out after 1ns")
+
+	// Deadlines of the caller aren't reported as render timeouts.
+	target, err = NewTarget(WithRenderTimeout(time.Hour))
+	require.NoError(t, err)
+
+	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now())
+	defer cancel()
+
+	_, err = target.RenderSchema(deadlineCtx, messageflow.FormattedSchema{
+		Type: targetType,
+		Data: []byte("a -> b"),
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotContains(t, err.Error(), "timed out")
+}
+
+func TestFormatSchemaMaxContextServices(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "User Service"},
+			{Name: "Notification Service"},
+		},
+	}
+
+	opts := messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	}
+
+	target, err := NewTarget(WithMaxContextServices(1))
+	require.NoError(t, err)
+
+	_, err = target.FormatSchema(ctx, schema, opts)
+	require.Error(t, err)
+
+	target, err = NewTarget(WithMaxContextServices(2))
+	require.NoError(t, err)
+
+	_, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+}
+
+func TestFormatSchemaTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Tags:   []string{messageflow.TagDeprecated},
+						Channel: messageflow.Channel{
+							Name: "user.created",
+							Tags: []string{"pii"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		opts   messageflow.FormatOptions
+		label  string
+		dashed bool
+	}{
+		{
+			name:   "service channels",
+			opts:   messageflow.FormatOptions{Mode: messageflow.FormatModeServiceChannels, Service: "User Service"},
+			label:  `label: "user.created\n[deprecated] [pii]"`,
+			dashed: true,
+		},
+		{
+			// The channel isn't deprecated, only the operation of its sender.
+			name:   "channel services",
+			opts:   messageflow.FormatOptions{Mode: messageflow.FormatModeChannelServices, Channel: "user.created"},
+			label:  `label: "user.created\n[pii]"`,
+			dashed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := target.FormatSchema(ctx, schema, tt.opts)
+			require.NoError(t, err)
+
+			assert.Contains(t, string(actual.Data), tt.label)
+			if tt.dashed {
+				assert.Contains(t, string(actual.Data), "style.stroke-dash: 3")
+			} else {
+				assert.NotContains(t, string(actual.Data), "style.stroke-dash")
+			}
+
+			_, err = target.RenderSchema(ctx, actual)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestFormatSchemaChannelServicesReply(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Notification Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "user.info.request",
+							Messages: []messageflow.Message{{Name: "UserInfoRequest", Payload: `{"user_id": "string"}`}},
+						},
+						Reply: &messageflow.Channel{
+							Name:     "user.info.reply",
+							Messages: []messageflow.Message{{Name: "UserInfoReply", Payload: `{"email": "string"}`}},
+						},
+					},
+				},
+			},
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionReceive,
+						Channel: messageflow.Channel{
+							Name:     "user.info.request",
+							Messages: []messageflow.Message{{Name: "UserInfoRequest", Payload: `{"user_id": "string"}`}},
+						},
+						Reply: &messageflow.Channel{
+							Name:     "user.info.reply",
+							Messages: []messageflow.Message{{Name: "UserInfoReply", Payload: `{"email": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "user.info.request",
+	})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, `requesters -> 'user.info.request': "Request(UserInfoRequest)"`)
+	assert.Contains(t, data, `'user.info.request' -> requesters: "Reply(UserInfoReply)" {`)
+	assert.Contains(t, data, `'user.info.request' -> repliers: "Request(UserInfoRequest)"`)
+	assert.Contains(t, data, `repliers -> 'user.info.request': "Reply(UserInfoReply)" {`)
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+}
+
+func TestFormatSchemaContentTypes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Payment Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "payment.captured",
+							Messages: []messageflow.Message{
+								{Name: "PaymentCaptured", Payload: "{}", ContentType: "avro/binary"},
+								{Name: "PaymentCapturedV2", Payload: "{}", ContentType: "application/json"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "payment.captured",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(actual.Data), `label: "payment.captured\napplication/json, avro/binary"`)
+}
+
+func TestNewTargetPaddingFontSize(t *testing.T) {
+	t.Parallel()
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *target.renderOpts.Pad)
+
+	renderOpts := &d2svg.RenderOpts{Pad: go2.Pointer(int64(20))}
+	target, err = NewTarget(WithRenderOpts(renderOpts), WithPadding(0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *target.renderOpts.Pad)
+	assert.Equal(t, int64(20), *renderOpts.Pad)
+
+	_, err = NewTarget(WithPadding(-1))
+	require.Error(t, err)
+
+	_, err = NewTarget(WithFontSize(4))
+	require.Error(t, err)
+
+	_, err = NewTarget(WithFontSize(101))
+	require.Error(t, err)
+
+	target, err = NewTarget(WithFontSize(24))
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), messageflow.Schema{
+		Services: []messageflow.Service{{Name: "User Service"}},
+	}, messageflow.FormatOptions{Mode: messageflow.FormatModeContextServices})
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(string(fs.Data),
+		"**.style.font-size: 24\n(** -> **)[*].style.font-size: 24\n"))
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Parallel()
+
+	created, err := target.New("d2", target.Config{})
+	require.NoError(t, err)
+
+	d2Target, ok := created.(*Target)
+	require.True(t, ok)
+	assert.Equal(t, int64(5), *d2Target.renderOpts.Pad)
+	assert.Equal(t, OutputFormatSVG, d2Target.outputFormat)
+	assert.InDelta(t, defaultPNGScale, d2Target.pngScale, 0)
+
+	padding := 0
+	created, err = target.New("d2", target.Config{
+		OutputFormat: "png",
+		PNGScale:     2,
+		Direction:    "right",
+		Padding:      &padding,
+		MinifySVG:    true,
+	})
+	require.NoError(t, err)
+
+	d2Target, ok = created.(*Target)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), *d2Target.renderOpts.Pad)
+	assert.Equal(t, OutputFormatPNG, d2Target.outputFormat)
+	assert.InDelta(t, 2.0, d2Target.pngScale, 0)
+	assert.Equal(t, "right", d2Target.direction)
+	assert.True(t, d2Target.minifySVG)
+
+	_, err = target.New("d2", target.Config{FontSize: 200})
+	require.Error(t, err)
+}
+
+func TestNewTargetTemplateDir(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "context_services.tmpl"), []byte(
+		"{{- range .Services }}\n'{{.Name}}': { shape: hexagon }\n{{- end }}\n",
+	), 0600)
+	require.NoError(t, err)
+
+	target, err := NewTarget(WithTemplateDir(dir))
+	require.NoError(t, err)
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created"},
+					},
+				},
+			},
+		},
+	}
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "\n'User Service': { shape: hexagon }\n", string(actual.Data))
+
+	// Templates missing in the dir fall back to the embedded ones.
+	actual, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceChannels,
+		Service: "User Service",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'Send To'")
+
+	invalidDir := t.TempDir()
+	err = os.WriteFile(filepath.Join(invalidDir, "service_services.tmpl"), []byte("{{ .Unclosed "), 0600)
+	require.NoError(t, err)
+
+	_, err = NewTarget(WithTemplateDir(invalidDir))
+	require.Error(t, err)
+}
+
+func TestFormatSchemaServiceServicesDepth(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	op := func(action messageflow.Action, channel string) messageflow.Operation {
+		return messageflow.Operation{Action: action, Channel: messageflow.Channel{Name: channel}}
+	}
+
+	// A chain ending with a cycle: A -> B -> C -> D -> C.
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "A", Operation: []messageflow.Operation{op(messageflow.ActionSend, "a.b")}},
+			{Name: "B", Operation: []messageflow.Operation{
+				op(messageflow.ActionReceive, "a.b"),
+				op(messageflow.ActionSend, "b.c"),
+			}},
+			{Name: "C", Operation: []messageflow.Operation{
+				op(messageflow.ActionReceive, "b.c"),
+				op(messageflow.ActionReceive, "d.c"),
+				op(messageflow.ActionSend, "c.d"),
+			}},
+			{Name: "D", Operation: []messageflow.Operation{
+				op(messageflow.ActionReceive, "c.d"),
+				op(messageflow.ActionSend, "d.c"),
+			}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		depth       int
+		distant     []string
+		connections int
+	}{
+		{name: "default", depth: 0, distant: nil, connections: 0},
+		{name: "two hops", depth: 2, distant: []string{"C"}, connections: 1},
+		{name: "three hops", depth: 3, distant: []string{"C", "D"}, connections: 3},
+		{name: "beyond graph", depth: 10, distant: []string{"C", "D"}, connections: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := prepareServiceServicesPayload(schema, "A", tt.depth)
+
+			distant := make([]string, 0, len(payload.DistantServices))
+			for _, service := range payload.DistantServices {
+				distant = append(distant, service.Name)
+			}
+
+			assert.ElementsMatch(t, tt.distant, distant)
+			assert.Len(t, payload.DistantConnections, tt.connections)
+		})
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceServices,
+		Service: "A",
+		Depth:   3,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'C' -> 'D': 'c.d' {")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+}
+
+func TestTruncatePayload(t *testing.T) {
+	short := "{\n  \"id\": \"string\"\n}"
+	assert.Equal(t, short, truncatePayload(short))
+
+	lines := make([]string, maxPayloadLines+10)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+
+	truncated := strings.Split(truncatePayload(strings.Join(lines, "\n")), "\n")
+	require.Len(t, truncated, maxPayloadLines+1)
+	assert.Equal(t, lines[:maxPayloadLines], truncated[:maxPayloadLines])
+	assert.Equal(t, "...", truncated[maxPayloadLines])
+}
+
+func TestFormatSchemaProtocols(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "order.created",
+							Protocol: "kafka",
+							Messages: []messageflow.Message{{Name: "OrderCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	for _, opts := range []messageflow.FormatOptions{
+		{Mode: messageflow.FormatModeServiceChannels, Service: "Order Service"},
+		{Mode: messageflow.FormatModeServiceServices, Service: "Order Service"},
+		{Mode: messageflow.FormatModeChannelServices, Channel: "order.created"},
+	} {
+		actual, err := target.FormatSchema(ctx, schema, opts)
+		require.NoError(t, err)
+
+		assert.Contains(t, string(actual.Data), `label: "order.created\nkafka"`, opts.Mode)
+	}
+}
+
+func TestFormatSchemaExcludeDeprecated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:     messageflow.ActionSend,
+						Deprecated: true,
+						Channel:    messageflow.Channel{Name: "user.created.v1"},
+					},
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.created.v2"},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	opts := messageflow.FormatOptions{Mode: messageflow.FormatModeServiceChannels, Service: "User Service"}
+
+	actual, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'user.created.v1'")
+	assert.Contains(t, string(actual.Data), "style.stroke-dash: 3")
+
+	opts.ExcludeDeprecated = true
+
+	actual, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.NotContains(t, string(actual.Data), "'user.created.v1'")
+	assert.Contains(t, string(actual.Data), "'user.created.v2'")
+	assert.Len(t, schema.Services[0].Operation, 2)
+}
+
+func TestFormatSchemaExcludeChannelPatterns(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "orders.placed"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "orders.placed.dlq"}},
+				},
+			},
+			{
+				Name: "Billing Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "orders.placed"}},
+				},
+			},
+			{
+				Name: "Audit Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "orders.placed.dlq"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	opts := messageflow.FormatOptions{Mode: messageflow.FormatModeContextServices}
+
+	actual, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'Order Service' -> 'Audit Service'")
+
+	opts.ExcludeChannelPatterns = []string{"*.dlq"}
+
+	actual, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'Order Service' -> 'Billing Service'")
+	assert.NotContains(t, string(actual.Data), "'Order Service' -> 'Audit Service'")
+	assert.Contains(t, string(actual.Data), "'Audit Service'")
+
+	actual, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:                   messageflow.FormatModeServiceChannels,
+		Service:                "Order Service",
+		ExcludeChannelPatterns: []string{"*.dlq"},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(actual.Data), "orders.placed.dlq")
+}
+
+func TestMinifySVG(t *testing.T) {
+	t.Parallel()
+
+	// elements lists element names and non-whitespace texts of the document in order, except for
+	// styles, which are compacted.
+	elements := func(t *testing.T, svg []byte) []string {
+		t.Helper()
+
+		var (
+			result  []string
+			inStyle bool
+		)
+
+		decoder := xml.NewDecoder(bytes.NewReader(svg))
+		for {
+			token, err := decoder.Token()
+			if errors.Is(err, io.EOF) {
+				return result
+			}
+			require.NoError(t, err)
+
+			switch token := token.(type) {
+			case xml.StartElement:
+				result = append(result, token.Name.Local)
+				inStyle = token.Name.Local == "style"
+			case xml.EndElement:
+				inStyle = false
+			case xml.CharData:
+				if text := strings.TrimSpace(string(token)); text != "" && !inStyle {
+					result = append(result, text)
+				}
+			}
+		}
+	}
+
+	// Texts are kept as they are, even when they look like styles or numbers.
+	text := `<svg><style>.a { fill: red; }</style><text x="1.500000">{ "id": "string" }  a { b: 1.000000; }</text>` +
+		"<text>\n  {\n</text></svg>"
+	assert.Equal(t, `<svg><style>.a{fill: red;}</style><text x="1.5">{ "id": "string" }  a { b: 1.000000; }</text>`+
+		"<text>\n  {\n</text></svg>", string(minifySVG([]byte(text))))
+
+	paths, err := filepath.Glob("testdata/*.svg")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+
+			original, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			minified := minifySVG(original)
+
+			assert.Less(t, len(minified), len(original))
+			assert.NotRegexp(t, `<[^>]*\d\.000000`, string(minified))
+			assert.Equal(t, elements(t, original), elements(t, minified))
+		})
+	}
+}
+
+func TestRenderSchemaMinifySVG(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	fs := messageflow.FormattedSchema{Type: targetType, Data: []byte("a -> b")}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	original, err := target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	target, err = NewTarget(WithMinifySVG(true))
+	require.NoError(t, err)
+
+	minified, err := target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	assert.Less(t, len(minified), len(original))
+	assert.Equal(t, minifySVG(original), minified)
+}
+
+func TestRenderSchemaLogger(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	target, err := NewTarget(WithLogger(logger))
+	require.NoError(t, err)
+
+	_, err = target.RenderSchema(context.Background(), messageflow.FormattedSchema{
+		Type: targetType,
+		Data: []byte("a -> b"),
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `msg="rendered diagram" duration=`)
+}
+
+func TestRenderSchemaCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fs := messageflow.FormattedSchema{Type: targetType, Data: []byte("a -> b")}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	target, err := NewTarget(WithRenderCache(1), WithLogger(logger))
+	require.NoError(t, err)
+
+	expected, err := target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+	assert.NotContains(t, buf.String(), `msg="reused cached diagram"`)
+
+	var wg sync.WaitGroup
+	results := make([][]byte, 4)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = target.RenderSchema(ctx, fs)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		assert.Equal(t, expected, result)
+	}
+
+	cached, err := target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+	assert.Equal(t, expected, cached)
+	assert.Contains(t, buf.String(), `msg="reused cached diagram"`)
+
+	cached[0] = 'x'
+	cached, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+	assert.Equal(t, expected, cached)
+}
+
+func TestRenderCache(t *testing.T) {
+	t.Parallel()
+
+	cache := newRenderCache(2)
+	key := func(b byte) [sha256.Size]byte { return [sha256.Size]byte{b} }
+
+	cache.add(key(1), []byte("one"))
+	cache.add(key(2), []byte("two"))
+
+	_, ok := cache.get(key(1))
+	require.True(t, ok)
+
+	cache.add(key(3), []byte("three"))
+
+	_, ok = cache.get(key(2))
+	assert.False(t, ok, "least recently used diagram is evicted")
+
+	data, ok := cache.get(key(1))
+	require.True(t, ok)
+	assert.Equal(t, []byte("one"), data)
+
+	data, ok = cache.get(key(3))
+	require.True(t, ok)
+	assert.Equal(t, []byte("three"), data)
+}
+
+func TestFormatSchemaChannelPrefixDepth(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Notification Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "notification.preferences.get"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "notification.preferences.update"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "notification.analytics"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "audit"}},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "notification.preferences.get"}},
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "notification.preferences.update"}},
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "notification.analytics"}},
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "audit"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	tests := []struct {
+		depth int
+		label string
+	}{
+		{depth: 0, label: `label: "Pub"`},
+		{depth: 1, label: `label: "Pub\naudit, notification.*"`},
+		{depth: 2, label: `label: "Pub\naudit, notification.analytics, notification.preferences.*"`},
+	}
+
+	for _, tt := range tests {
+		actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+			Mode:               messageflow.FormatModeContextServices,
+			ChannelPrefixDepth: tt.depth,
+		})
+		require.NoError(t, err)
+
+		assert.Contains(t, string(actual.Data), tt.label)
+	}
+}
+
+func TestFormatSchemaOperationSummary(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Summary: "Publish \"created\" orders\nonce paid",
+						Channel: messageflow.Channel{
+							Name:     "order.created",
+							Messages: []messageflow.Message{{Name: "OrderCreated", Payload: `{"id": "string"}`}},
+						},
+					},
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "payment.captured"},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceServices,
+		Service: "Order Service",
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, `'Order Service' -> 'order.created': "Send\nPublish \"created\" orders once paid"`)
+	assert.Contains(t, data, `'payment.captured' -> 'Order Service': Receive`)
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceChannels,
+		Service: "Order Service",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(fs.Data), `label: "order.created\nPublish \"created\" orders once paid"`)
+}
+
+func TestFormatSchemaMessageVariants(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "user.events",
+							Messages: []messageflow.Message{
+								{Name: "UserCreated", Payload: `{"id": "string"}`},
+								{Name: "UserDeleted", Payload: `{"id": "string"}`},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name: "Audit Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionReceive,
+						Channel: messageflow.Channel{
+							Name: "user.events",
+							Messages: []messageflow.Message{
+								{Name: "UserCreated", Payload: `{"id": "string", "name": "string"}`},
+								{Name: "UserDeleted", Payload: `{"id": "string"}`},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "user.events",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(fs.Data), `'message': |json
+Message(UserCreated):
+{"id": "string", "name": "string"}
+
+Message(UserDeleted):
+{"id": "string"}
+| {near: top-center}`)
+
+	schema.Services[0].Operation[0].Reply = &messageflow.Channel{
+		Messages: []messageflow.Message{
+			{Name: "Accepted", Payload: `{}`},
+			{Name: "Rejected", Payload: `{"reason": "string"}`},
+		},
+	}
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "user.events",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(fs.Data),
+		`requesters -> 'user.events': "Request(UserCreated | UserDeleted)"`)
+	assert.Contains(t, string(fs.Data), `'user.events' -> requesters: "Reply(Accepted | Rejected)"`)
+	assert.Contains(t, string(fs.Data), "Reply(Accepted):\n{}\n\nReply(Rejected):")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+}
+
+func TestFormatSchemaHighlightCycles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	service := func(name, sends, receives string) messageflow.Service {
+		return messageflow.Service{
+			Name: name,
+			Operation: []messageflow.Operation{
+				{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: sends}},
+				{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: receives}},
+			},
+		}
+	}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			service("A", "a.events", "c.events"),
+			service("B", "b.events", "a.events"),
+			service("C", "c.events", "b.events"),
+			service("D", "d.events", "c.events"),
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:            messageflow.FormatModeContextServices,
+		HighlightCycles: true,
+	})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	for _, edge := range []string{"'A' -> 'B'", "'B' -> 'C'", "'C' -> 'A'"} {
+		assert.Contains(t, data, edge+`: {
+  label: "Pub"
+  style.stroke: "#e53935"
+}`)
+	}
+	assert.NotContains(t, data, `'C' -> 'D': {
+  label: "Pub"
+  style.stroke: "#e53935"`)
+
+	actual, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(actual.Data), "#e53935")
+}
+
+func TestFormatSchemaSplitMessages(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name:     "order.events",
+							Messages: []messageflow.Message{{Name: "OrderPlaced", Payload: `{"id": "string"}`}},
+						},
+					},
+				},
+			},
+			{
+				Name: "Shipping Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionReceive,
+						Channel: messageflow.Channel{
+							Name:     "order.events",
+							Messages: []messageflow.Message{{Name: "ShipmentRequested", Payload: `{"order_id": "string"}`}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "order.events",
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "'sent': |json\nSent(OrderPlaced):\n{\"id\": \"string\"}\n| {near: top-left}")
+	assert.Contains(t, data, "'received': |json\nReceived(ShipmentRequested):\n{\"order_id\": \"string\"}\n| {near: top-right}")
+	assert.Contains(t, data, `senders -> 'order.events': "OrderPlaced"`)
+	assert.Contains(t, data, `'order.events' -> receivers: "ShipmentRequested"`)
+	assert.NotContains(t, data, "'message'")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	schema.Services[1].Operation[0].Channel.Messages = schema.Services[0].Operation[0].Channel.Messages
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeChannelServices,
+		Channel: "order.events",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(fs.Data), "'message': |json\nMessage(OrderPlaced):")
+	assert.NotContains(t, string(fs.Data), "'sent'")
+}
+
+func TestFormatSchemaLegend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name:      "User Service",
+				Operation: []messageflow.Operation{{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}}},
+			},
+			{
+				Name:      "Notification Service",
+				Operation: []messageflow.Operation{{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.created"}}},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{Mode: messageflow.FormatModeContextServices})
+	require.NoError(t, err)
+	assert.NotContains(t, string(fs.Data), "messageflow-legend")
+
+	target, err = NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:            messageflow.FormatModeContextServices,
+		HighlightCycles: true,
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "'messageflow-legend': |md\n**Legend**\n")
+	assert.Contains(t, data, "- **Pub/Req**: both published messages and requests\n")
+	assert.Contains(t, data, "- Lines take the color of the sending service\n")
+	assert.Contains(t, data, "- Red lines connect services forming a cycle\n| {near: bottom-right}\n")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{Mode: messageflow.FormatModeServiceChannels, Service: "User Service"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(fs.Data), "messageflow-legend")
+}
+
+func TestFormatSchemaHighlightField(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	send := func(channel, payload string) messageflow.Operation {
+		return messageflow.Operation{
+			Action:  messageflow.ActionSend,
+			Channel: messageflow.Channel{Name: channel, Messages: []messageflow.Message{{Name: "Event", Payload: payload}}},
+		}
+	}
+	receive := func(channel string) messageflow.Operation {
+		return messageflow.Operation{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: channel}}
+	}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "User Service", Operation: []messageflow.Operation{send("user.created", `{"user_id": "string"}`)}},
+			{Name: "Order Service", Operation: []messageflow.Operation{send("order.placed",
+				`{"type": "object", "properties": {"customer": {"type": "object", "properties": {"user_id": {"type": "string"}}}}}`)}},
+			{Name: "Billing Service", Operation: []messageflow.Operation{send("billing.paid", `{"amount": "number"}`)}},
+			{Name: "Notification Service", Operation: []messageflow.Operation{
+				receive("user.created"), receive("order.placed"), receive("billing.paid"),
+			}},
+		},
+	}
+
+	target, err := NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:           messageflow.FormatModeContextServices,
+		HighlightField: "user_id",
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "'User Service' -> 'Notification Service': {\n  label: \"Pub\"\n  style.stroke: \"#ef6c00\"\n  style.stroke-width: 4\n}")
+	assert.Equal(t, 1, strings.Count(data, "stroke-width"))
+	assert.Contains(t, data, "- Thick lines carry messages with the field `user_id`\n")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:           messageflow.FormatModeChannelServices,
+		Channel:        "order.placed",
+		HighlightField: "customer.user_id",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(fs.Data), "'order.placed': {\n  shape: queue\n  style.fill: \"#fff3e0\"\n  style.stroke-width: 4\n  style.stroke: \"#ef6c00\"\n}")
+
+	fs, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:           messageflow.FormatModeChannelServices,
+		Channel:        "billing.paid",
+		HighlightField: "customer.user_id",
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, string(fs.Data), "stroke-width")
+}
+
+func TestFormatSchemaBaseline(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	send := func(channel, payload string) messageflow.Operation {
+		return messageflow.Operation{
+			Action:  messageflow.ActionSend,
+			Channel: messageflow.Channel{Name: channel, Messages: []messageflow.Message{{Name: "Event", Payload: payload}}},
+		}
+	}
+	receive := func(channel string) messageflow.Operation {
+		return messageflow.Operation{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: channel}}
+	}
+
+	baseline := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "User Service", Operation: []messageflow.Operation{send("user.created", `{"id": "string"}`)}},
+			{Name: "Billing Service", Operation: []messageflow.Operation{send("billing.paid", `{"amount": "number"}`)}},
+			{Name: "Audit Service", Operation: []messageflow.Operation{send("audit.logged", `{"entry": "string"}`)}},
+			{Name: "Notification Service", Operation: []messageflow.Operation{
+				receive("user.created"), receive("billing.paid"), receive("audit.logged"),
+			}},
+		},
+	}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "User Service", Operation: []messageflow.Operation{send("user.created", `{"id": "string", "email": "string"}`)}},
+			{Name: "Billing Service", Operation: []messageflow.Operation{send("billing.paid", `{"amount": "number"}`)}},
+			{Name: "Order Service", Operation: []messageflow.Operation{send("order.placed", `{"id": "string"}`)}},
+			{Name: "Notification Service", Operation: []messageflow.Operation{
+				receive("user.created"), receive("billing.paid"), receive("order.placed"),
+			}},
+		},
+	}
+
+	target, err := NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:     messageflow.FormatModeContextServices,
+		Baseline: &baseline,
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "'Order Service'.shape: rectangle\n'Order Service'.style.fill: \"#c8e6c9\"\n'Order Service'.style.stroke: \"#1b5e20\"\n")
+	assert.Contains(t, data, "'User Service'.shape: rectangle\n'User Service'.style.fill: \"#fff59d\"\n")
+	assert.Contains(t, data, "'Notification Service'.shape: rectangle\n'Notification Service'.style.fill: \"#fff59d\"\n")
+	assert.NotContains(t, data, "'Billing Service'.style")
+	assert.Contains(t, data, "'Audit Service'.style.stroke: \"#b71c1c\"\n'Audit Service'.style.opacity: 0.4\n")
+
+	assert.Contains(t, data, "'Order Service' -> 'Notification Service': {\n  label: \"Pub\"\n  style.stroke: \"#1b5e20\"\n  style.stroke-width: 3\n}")
+	assert.Contains(t, data, "'User Service' -> 'Notification Service': {\n  label: \"Pub\"\n  style.stroke: \"#f57f17\"\n  style.stroke-width: 3\n}")
+	assert.Contains(t, data, "'Billing Service' -> 'Notification Service': {\n  label: \"Pub\"\n}")
+	assert.Contains(t, data, "'Audit Service' -> 'Notification Service': {\n  label: \"Pub\"\n  style.stroke: \"#b71c1c\"\n  style.opacity: 0.4\n  style.stroke-dash: 3\n  style.stroke-width: 3\n}")
+	assert.Contains(t, data, "- Red, faded: removed since the baseline\n")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+}
+
+func TestPayloadHasField(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		payload string
+		path    string
+		want    bool
+	}{
+		{payload: `{"user_id": "string"}`, path: "user_id", want: true},
+		{payload: `{"user": {"id": "string"}}`, path: "user.id", want: true},
+		{payload: `{"user": {"id": "string"}}`, path: "id", want: false},
+		{payload: `{"items": [{"sku": "string"}]}`, path: "items.sku", want: true},
+		{payload: `{"type": "object", "properties": {"id": {"type": "string"}}}`, path: "id", want: true},
+		{payload: `{"type": "object", "properties": {"id": {"type": "string"}}}`, path: "type", want: false},
+		{payload: `{"type": "array", "items": {"type": "object", "properties": {"sku": {"type": "string"}}}}`, path: "sku", want: true},
+		{payload: `{"oneOf": [{"type": "object", "properties": {"a": {"type": "string"}}}, {"type": "object", "properties": {"b": {"type": "string"}}}]}`, path: "b", want: true},
+		{payload: `record User { string id; }`, path: "id", want: false},
+		{payload: ``, path: "id", want: false},
+	} {
+		assert.Equal(t, tt.want, payloadHasField(tt.payload, strings.Split(tt.path, ".")), "%s in %s", tt.path, tt.payload)
+	}
+}
+
+func TestFormatSchemaEdgeMetadata(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "Order Service", Operation: []messageflow.Operation{
+				{
+					Action:   messageflow.ActionSend,
+					Channel:  messageflow.Channel{Name: "order.placed", Messages: []messageflow.Message{{Name: "OrderPlaced"}}},
+					Metadata: map[string]string{"x-throughput": "50/s", "x-sla": "200ms"},
+				},
+				{
+					Action:   messageflow.ActionSend,
+					Channel:  messageflow.Channel{Name: "order.cancelled", Messages: []messageflow.Message{{Name: "OrderCancelled"}}},
+					Metadata: map[string]string{"x-throughput": "\"5/s\""},
+				},
+			}},
+			{Name: "Billing Service", Operation: []messageflow.Operation{
+				{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "order.placed"}},
+				{
+					Action:   messageflow.ActionReceive,
+					Channel:  messageflow.Channel{Name: "order.cancelled"},
+					Metadata: map[string]string{"x-throughput": "50/s"},
+				},
+			}},
+			{Name: "Audit Service", Operation: []messageflow.Operation{
+				{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "order.placed"}},
+			}},
+		},
+	}
+
+	target, err := NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	fs, err := target.FormatSchema(context.Background(), schema, messageflow.FormatOptions{
+		Mode:         messageflow.FormatModeContextServices,
+		EdgeMetadata: "x-throughput",
+	})
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "'Order Service' -> 'Billing Service': {\n  label: \"Pub\\n\\\"5/s\\\", 50/s\"\n")
+	assert.Contains(t, data, "'Order Service' -> 'Audit Service': {\n  label: \"Pub\\n50/s\"\n")
+	assert.Contains(t, data, "- Labels end with `x-throughput` of the operations\n")
+	assert.NotContains(t, data, "200ms")
+}
+
+func TestFormatSchemaSecurity(t *testing.T) {
+	t.Parallel()
+
+	security := []messageflow.SecurityRequirement{{Scheme: "orderAuth", Type: "oauth2", Scopes: []string{"orders:write"}}}
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{Name: "Order Service", Operation: []messageflow.Operation{
+				{
+					Action:   messageflow.ActionSend,
+					Channel:  messageflow.Channel{Name: "order.placed", Messages: []messageflow.Message{{Name: "OrderPlaced"}}},
+					Security: security,
+				},
+				{
+					Action:  messageflow.ActionSend,
+					Channel: messageflow.Channel{Name: "order.cancelled", Messages: []messageflow.Message{{Name: "OrderCancelled"}}},
+				},
+			}},
+			{Name: "Billing Service", Operation: []messageflow.Operation{
+				{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "order.placed"}, Security: security},
+			}},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	const label = "label: \"order.placed\\n🔒 orderAuth (oauth2): orders:write\"\n"
+
+	for _, opts := range []messageflow.FormatOptions{
+		{Mode: messageflow.FormatModeChannelServices, Channel: "order.placed"},
+		{Mode: messageflow.FormatModeServiceChannels, Service: "Order Service"},
+		{Mode: messageflow.FormatModeServiceServices, Service: "Order Service"},
+	} {
+		fs, err := target.FormatSchema(context.Background(), schema, opts)
+		require.NoError(t, err)
+		assert.Contains(t, string(fs.Data), label, opts.Mode)
+		assert.Equal(t, 1, strings.Count(string(fs.Data), "🔒"), opts.Mode)
+	}
+}
+
+func TestFormatSchemaPayloadTree(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{
+						Action: messageflow.ActionSend,
+						Channel: messageflow.Channel{
+							Name: "order.events",
+							Messages: []messageflow.Message{{
+								Name:    "OrderPlaced",
+								Payload: `{"id": "string[uuid]", "address": {"city": "string"}, "items": [{"sku": "string"}], "tags": ["string"]}`,
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := NewTarget(WithPayloadStyle("table"))
+	require.Error(t, err)
+
+	target, err := NewTarget(WithPayloadStyle(PayloadStyleTree))
+	require.NoError(t, err)
+
+	opts := messageflow.FormatOptions{Mode: messageflow.FormatModeChannelServices, Channel: "order.events"}
+
+	fs, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+
+	data := string(fs.Data)
+	assert.Contains(t, data, "\"message\": {\n  near: top-center\n  label: \"Message\"\n  t0: {\n    shape: sql_table\n"+
+		"    label: \"Message(OrderPlaced)\"\n    \"address\": \"object\"\n    \"id\": \"string[uuid]\"\n"+
+		"    \"items\": \"[]object\"\n    \"tags\": \"[]string\"\n  }\n")
+	assert.Contains(t, data, "    label: \"Message(OrderPlaced).items[]\"\n    \"sku\": \"string\"\n")
+	assert.Contains(t, data, "  t0.\"address\" -> t1\n  t0.\"items\" -> t2\n}")
+	assert.NotContains(t, data, "|json")
+
+	_, err = target.RenderSchema(ctx, fs)
+	require.NoError(t, err)
+
+	// Raw JSON schemas are shown as text even when they look like flattened payloads.
+	schema.Services[0].Operation[0].Channel.Messages[0].Payload = `{"type": "object", "properties": {"id": {"type": "string"}}}`
+	schema.Services[0].Operation[0].Channel.Messages[0].SchemaFormat = "application/schema+json;version=draft-07"
+
+	fs, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(fs.Data), "'message': |json\nMessage(OrderPlaced):")
+
+	target, err = NewTarget()
+	require.NoError(t, err)
+
+	schema.Services[0].Operation[0].Channel.Messages[0] = messageflow.Message{Name: "OrderPlaced", Payload: `{"id": "string"}`}
+
+	fs, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(fs.Data), "'message': |json\nMessage(OrderPlaced):\n{\"id\": \"string\"}\n| {near: top-center}")
+}
+
+func TestFormatSchemaServiceOverview(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.deleted"}},
+				},
+			},
+			{
+				Name: "Notification Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	opts := messageflow.FormatOptions{Mode: messageflow.FormatModeServiceOverview, Service: "User Service"}
+
+	actual, err := target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "'Channels': {\n  label: \"Channels\"")
+	assert.Contains(t, data, "'Services': {\n  label: \"Connected Services\"")
+	assert.Contains(t, data, "'User Service' -> 'Send To'")
+	assert.Contains(t, data, "'user.created' -> 'Notification Service'")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+
+	// The overview includes templates overridden in the template dir.
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "service_channels.tmpl"), []byte("'{{.Name}}': { shape: hexagon }"), 0600)
+	require.NoError(t, err)
+
+	target, err = NewTarget(WithTemplateDir(dir))
+	require.NoError(t, err)
+
+	actual, err = target.FormatSchema(ctx, schema, opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'User Service': { shape: hexagon }")
+}
+
+func TestFormatSchemaSequence(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Gateway",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user.info", Messages: []messageflow.Message{{Name: "UserInfoRequest"}}},
+						Reply:   &messageflow.Channel{Name: "user.info.reply"},
+					},
+				},
+			},
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionReceive,
+						Channel: messageflow.Channel{Name: "user.info"},
+						Reply:   &messageflow.Channel{Name: "user.info.reply"},
+					},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.viewed"}},
+				},
+			},
+			{
+				Name: "Analytics Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.viewed"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeSequence,
+		Service: "Gateway",
+	})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "shape: sequence_diagram\n'Gateway'\n'User Service'\n'Analytics Service'\n")
+	assert.Contains(t, data, "'Gateway' -> 'User Service': \"Request: user.info\\nUserInfoRequest\"\n"+
+		"'User Service' -> 'Analytics Service': \"user.viewed\"\n"+
+		"'User Service' -> 'Gateway': \"Reply: user.info.reply\" {\n  style.stroke-dash: 3\n}")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+
+	_, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{Mode: messageflow.FormatModeSequence})
+	require.Error(t, err)
+}
+
+func TestFormatSchemaRealtime(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Live Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "live.orders", Protocol: "kafka, wss"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "order.created", Protocol: "kafka"}},
+				},
+			},
+			{
+				Name: "Browser",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "live.orders", Protocol: "kafka, wss"}},
+				},
+			},
+			{
+				Name: "Order Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "order.created", Protocol: "kafka"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{Mode: messageflow.FormatModeContextServices})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "'Live Service' -> 'Browser': {\n  label: \"Pub (ws)\"")
+	assert.Contains(t, data, "'Live Service' -> 'Order Service': {\n  label: \"Pub\"")
+	assert.Equal(t, 1, strings.Count(data, "style.animated: true"))
+	assert.Contains(t, data, "- Animated lines carry realtime transports")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+
+	for _, opts := range []messageflow.FormatOptions{
+		{Mode: messageflow.FormatModeServiceChannels, Service: "Live Service"},
+		{Mode: messageflow.FormatModeServiceServices, Service: "Live Service"},
+		{Mode: messageflow.FormatModeChannelServices, Channel: "live.orders"},
+	} {
+		actual, err := target.FormatSchema(ctx, schema, opts)
+		require.NoError(t, err)
+
+		data := string(actual.Data)
+		assert.Contains(t, data, "shape: hexagon", opts.Mode)
+		assert.Equal(t, 1, strings.Count(data, `style.fill: "#e8eaf6"`), opts.Mode)
+	}
+}
+
+func TestFormatSchemaSelfLoops(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "Worker Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "tasks"}},
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "tasks"}},
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "task.done"}},
+				},
+			},
+			{
+				Name: "Audit Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "task.done"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget(WithLegend(true))
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{Mode: messageflow.FormatModeContextServices})
+	require.NoError(t, err)
+	assert.NotContains(t, string(actual.Data), "'Worker Service' -> 'Worker Service'")
+	assert.NotContains(t, string(actual.Data), "- Loops:")
+
+	actual, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:               messageflow.FormatModeContextServices,
+		ChannelPrefixDepth: 1,
+		SelfLoops:          true,
+	})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "'Worker Service' -> 'Worker Service': {\n  label: \"Pub\\ntasks\"")
+	assert.Contains(t, data, "'Worker Service' -> 'Audit Service': {\n  label: \"Pub\\ntask.*\"")
+	assert.Contains(t, data, "- Loops: services receiving messages they send themselves")
+
+	_, err = target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+
+	actual, err = target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:      messageflow.FormatModeContextServices,
+		SelfLoops: true,
+		Baseline:  &schema,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(actual.Data), "'Worker Service' -> 'Worker Service': {\n  label: \"Pub\"\n}")
+}
+
+func TestFormatSchemaServiceLinks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionSend, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+			{
+				Name:  "Mail Service",
+				Group: "Notifications",
+				Operation: []messageflow.Operation{
+					{Action: messageflow.ActionReceive, Channel: messageflow.Channel{Name: "user.created"}},
+				},
+			},
+		},
+	}
+
+	target, err := NewTarget()
+	require.NoError(t, err)
+
+	actual, err := target.FormatSchema(ctx, schema, messageflow.FormatOptions{
+		Mode:         messageflow.FormatModeContextServices,
+		ServiceLinks: map[string]string{"Mail Service": "../README.md#mail-service"},
+	})
+	require.NoError(t, err)
+
+	data := string(actual.Data)
+	assert.Contains(t, data, "'Notifications'.'Mail Service'.link: \"../README.md#mail-service\"")
+	assert.NotContains(t, data, "'User Service'.link")
+
+	rendered, err := target.RenderSchema(ctx, actual)
+	require.NoError(t, err)
+	assert.Contains(t, string(rendered), `href="../README.md#mail-service"`)
+}
+
+func TestRealtime(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "ws", realtime("kafka, wss"))
+	assert.Equal(t, "sse, ws", realtime("ws, SSE, websockets"))
+	assert.Empty(t, realtime("amqp, kafka"))
+	assert.Empty(t, realtime(""))
+}
@@ -0,0 +1,40 @@
+package d2
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+
+	"github.com/holydocs/messageflow/pkg/internal/raster"
+)
+
+// OutputFormat defines the image format produced by RenderSchema.
+type OutputFormat string
+
+const (
+	OutputFormatSVG = OutputFormat("svg")
+	OutputFormatPNG = OutputFormat("png")
+)
+
+// defaultPNGScale is the scale factor applied to the SVG viewbox when rasterizing to PNG.
+const defaultPNGScale = 1.0
+
+// rasterizePNG converts an SVG document produced by d2svg into a PNG image, see raster.Rasterize
+// for the limitations of the conversion.
+func rasterizePNG(svg []byte, scale float64) ([]byte, error) {
+	if scale <= 0 {
+		return nil, fmt.Errorf("invalid png scale %v, must be greater than 0", scale)
+	}
+
+	img, err := raster.Rasterize(svg, scale)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encoding png: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package d2
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// realtimeTransports maps protocols of realtime transports, typically facing browsers,
+// to the badges diagrams mark their channels and connections with.
+var realtimeTransports = map[string]string{
+	"ws":         "ws",
+	"wss":        "ws",
+	"websocket":  "ws",
+	"websockets": "ws",
+	"sse":        "sse",
+}
+
+// realtime returns sorted badges of realtime transports among the protocols separated by comma,
+// e.g. "ws" for "kafka, wss", "" when there are none.
+func realtime(protocols string) string {
+	var badges []string
+
+	for _, protocol := range strings.Split(protocols, ",") {
+		badge, ok := realtimeTransports[strings.ToLower(strings.TrimSpace(protocol))]
+		if ok && !slices.Contains(badges, badge) {
+			badges = append(badges, badge)
+		}
+	}
+
+	slices.Sort(badges)
+
+	return strings.Join(badges, ", ")
+}
+
+// channelProtocols returns protocols of the channels, including reply channels, by name.
+func channelProtocols(s messageflow.Schema) map[string]string {
+	protocols := make(map[string]string)
+
+	for _, service := range s.Services {
+		for _, op := range service.Operation {
+			if op.Channel.Protocol != "" {
+				protocols[op.Channel.Name] = op.Channel.Protocol
+			}
+
+			if op.Reply != nil && op.Reply.Protocol != "" {
+				protocols[op.Reply.Name] = op.Reply.Protocol
+			}
+		}
+	}
+
+	return protocols
+}
+
+// channelsRealtime returns sorted badges of realtime transports of the channels.
+func channelsRealtime(protocols map[string]string, channels []string) string {
+	all := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		all = append(all, protocols[channel])
+	}
+
+	return realtime(strings.Join(all, ","))
+}
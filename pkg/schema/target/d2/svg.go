@@ -0,0 +1,64 @@
+package d2
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var (
+	commentRe     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	cssCommentRe  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	indentRe      = regexp.MustCompile(`>\s*\n\s*<`)
+	tagRe         = regexp.MustCompile(`<[^!?/][^>]*>`)
+	fixedNumberRe = regexp.MustCompile(`(-?\d+\.\d{6})([a-z%]*)\b`)
+	cssSpaceRe    = regexp.MustCompile(`\s+`)
+	cssPunctRe    = regexp.MustCompile(`\s*([{};,])\s*`)
+	styleRe       = regexp.MustCompile(`(?s)<style[^>]*>.*?</style>`)
+)
+
+// minifySVG reduces the size of an SVG document produced by d2svg without changing its appearance.
+// It removes comments and indentation between tags, trims trailing zeros d2svg formats coordinates
+// with (e.g. 12.000000), compacts styles and drops style elements repeating an earlier one.
+func minifySVG(svg []byte) []byte {
+	svg = commentRe.ReplaceAll(svg, nil)
+	svg = indentRe.ReplaceAll(svg, []byte("><"))
+
+	svg = tagRe.ReplaceAllFunc(svg, func(tag []byte) []byte {
+		return fixedNumberRe.ReplaceAllFunc(tag, trimFixedNumber)
+	})
+
+	seen := make(map[string]bool)
+
+	return styleRe.ReplaceAllFunc(svg, func(style []byte) []byte {
+		style = minifyCSS(style)
+		if seen[string(style)] {
+			return nil
+		}
+		seen[string(style)] = true
+
+		return style
+	})
+}
+
+// minifyCSS compacts the content of a style element, whitespace is only kept where it separates tokens.
+func minifyCSS(style []byte) []byte {
+	style = cssCommentRe.ReplaceAll(style, nil)
+	style = cssSpaceRe.ReplaceAll(style, []byte(" "))
+	style = cssPunctRe.ReplaceAll(style, []byte("$1"))
+
+	return bytes.ReplaceAll(style, []byte("> "), []byte(">"))
+}
+
+// trimFixedNumber trims trailing zeros of a number formatted with fixed precision keeping its unit,
+// e.g. 12.500000 to 12.5 or 1.000000em to 1em.
+func trimFixedNumber(match []byte) []byte {
+	parts := fixedNumberRe.FindSubmatch(match)
+
+	number := strings.TrimRight(strings.TrimRight(string(parts[1]), "0"), ".")
+	if number == "-0" {
+		number = "0"
+	}
+
+	return append([]byte(number), parts[2]...)
+}
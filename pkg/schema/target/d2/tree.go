@@ -0,0 +1,142 @@
+package d2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// PayloadStyle defines how channel diagrams show message payloads.
+type PayloadStyle string
+
+const (
+	// PayloadStyleText shows payloads as JSON text.
+	PayloadStyleText = PayloadStyle("text")
+	// PayloadStyleTree shows flattened payloads as a tree of tables, one per nested object.
+	PayloadStyleTree = PayloadStyle("tree")
+)
+
+// WithPayloadStyle returns a TargetOpt that sets how channel diagrams show message payloads,
+// PayloadStyleText by default. Payloads with a schema format, e.g. raw JSON schemas or Avro, are always shown as text.
+func WithPayloadStyle(style PayloadStyle) TargetOpt {
+	return func(t *Target) {
+		t.payloadStyle = style
+	}
+}
+
+// payloadTree renders flattened payloads of the messages as a container positioned near the given constant,
+// holding a sql_table per object with edges from object and array fields to tables of their items.
+// Tables of the messages are labeled kind(name). Payloads are flattened unless the message has a schema format,
+// as sources mark raw payloads with one, see messageflow.Message. It returns "" when any payload has a schema format
+// or isn't a JSON object, so payloads are shown as text instead.
+func payloadTree(key, near, kind string, messages []messageflow.Message) string {
+	objects := make([]map[string]any, 0, len(messages))
+
+	for _, msg := range messages {
+		var object map[string]any
+		if msg.SchemaFormat != "" || json.Unmarshal([]byte(msg.Payload), &object) != nil || object == nil {
+			return ""
+		}
+		objects = append(objects, object)
+	}
+
+	tree := &payloadTreeBuilder{}
+
+	fmt.Fprintf(&tree.buf, "%s: {\n  near: %s\n  label: %s\n", quoteKey(key), near, quoteLabel(kind))
+
+	for i, object := range objects {
+		tree.table(fmt.Sprintf("%s(%s)", kind, messages[i].Name), object)
+	}
+
+	for _, edge := range tree.edges {
+		tree.buf.WriteString("  " + edge + "\n")
+	}
+
+	tree.buf.WriteString("}")
+
+	return tree.buf.String()
+}
+
+// payloadTreeBuilder accumulates tables of a payload tree, named t0, t1... in the order they are added.
+type payloadTreeBuilder struct {
+	buf    strings.Builder
+	tables int
+	edges  []string
+}
+
+// table adds a table of the object fields sorted by name, along with tables of nested objects, returning its key.
+func (b *payloadTreeBuilder) table(label string, object map[string]any) string {
+	tableKey := fmt.Sprintf("t%d", b.tables)
+	b.tables++
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type nested struct {
+		field  string
+		label  string
+		object map[string]any
+	}
+
+	var (
+		rows     []string
+		children []nested
+	)
+
+	for _, name := range names {
+		typ, items, child := fieldType(object[name])
+		rows = append(rows, fmt.Sprintf("    %s: %s", quoteKey(name), quoteLabel(typ)))
+
+		if child != nil {
+			children = append(children, nested{field: name, label: label + "." + name + items, object: child})
+		}
+	}
+
+	fmt.Fprintf(&b.buf, "  %s: {\n    shape: sql_table\n    label: %s\n", tableKey, quoteLabel(label))
+	for _, row := range rows {
+		b.buf.WriteString(row + "\n")
+	}
+	b.buf.WriteString("  }\n")
+
+	for _, child := range children {
+		childKey := b.table(child.label, child.object)
+		b.edges = append(b.edges, fmt.Sprintf("%s.%s -> %s", tableKey, quoteKey(child.field), childKey))
+	}
+
+	return tableKey
+}
+
+// fieldType describes the type of a flattened field, e.g. "string[uuid]" or "[]object". For objects and arrays
+// of objects it also returns the object holding nested fields and the [] suffixes of its path.
+func fieldType(value any) (string, string, map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		return "object", "", v
+	case []any:
+		if len(v) == 0 {
+			return "[]", "", nil
+		}
+
+		typ, items, child := fieldType(v[0])
+
+		return "[]" + typ, "[]" + items, child
+	default:
+		return fmt.Sprint(v), "", nil
+	}
+}
+
+// quoteKey quotes a d2 key, so field names with dots or other special characters don't nest shapes.
+func quoteKey(key string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+}
+
+// quoteLabel quotes a d2 label.
+func quoteLabel(label string) string {
+	return `"` + labelText(label) + `"`
+}
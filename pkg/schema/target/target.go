@@ -0,0 +1,99 @@
+// Package target keeps a registry of targets, so commands can create them by name.
+// Targets register themselves on import, e.g. import _ "github.com/holydocs/messageflow/pkg/schema/target/d2".
+package target
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+// Config holds target settings, targets ignore settings they don't support.
+// Zero values keep the defaults of the target.
+type Config struct {
+	// OutputFormat is the image format produced by rendering, e.g. "png".
+	OutputFormat string
+	// PNGScale is the scale factor used when rendering to PNG.
+	PNGScale float64
+	// Direction is the layout direction of diagrams.
+	Direction string
+	// RenderTimeout limits the time spent rendering a diagram.
+	RenderTimeout time.Duration
+	// MaxContextServices makes formatting refuse context diagrams with more services.
+	MaxContextServices int
+	// TemplateDir is a directory with templates overriding the embedded ones.
+	TemplateDir string
+	// Padding is the padding around rendered diagrams in pixels, nil keeps the default.
+	Padding *int
+	// FontSize is the font size of diagram labels.
+	FontSize int
+	// Legend adds a legend to context diagrams.
+	Legend bool
+	// PayloadStyle is how channel diagrams show message payloads, e.g. "tree".
+	PayloadStyle string
+	// MinifySVG optimizes rendered SVGs for size.
+	MinifySVG bool
+	// Title is the title of generated documents.
+	Title string
+	// Logger reports target activity.
+	Logger *slog.Logger
+	// RenderCache is the number of rendered diagrams kept in memory, zero disables caching.
+	RenderCache int
+}
+
+// Constructor creates a target from the config.
+type Constructor func(cfg Config) (messageflow.Target, error)
+
+var (
+	mu           sync.RWMutex
+	constructors = make(map[string]Constructor)
+)
+
+// Register makes a target available by name. It panics if a target with the name is already registered.
+func Register(name string, constructor Constructor) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := constructors[name]; ok {
+		panic(fmt.Sprintf("target %s is already registered", name))
+	}
+
+	constructors[name] = constructor
+}
+
+// New creates the target registered by name.
+func New(name string, cfg Config) (messageflow.Target, error) {
+	mu.RLock()
+	constructor, ok := constructors[name]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s, registered targets: %s", name, strings.Join(Names(), ", "))
+	}
+
+	t, err := constructor(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s target: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// Names returns names of registered targets, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(constructors))
+	for name := range constructors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,41 @@
+package target
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/internal/testutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	var created Config
+	Register("fake", func(cfg Config) (messageflow.Target, error) {
+		created = cfg
+		return testutil.Target{}, nil
+	})
+	Register("broken", func(Config) (messageflow.Target, error) {
+		return nil, errors.New("missing templates")
+	})
+
+	assert.Subset(t, Names(), []string{"broken", "fake"})
+	assert.IsIncreasing(t, Names())
+
+	target, err := New("fake", Config{Title: "Docs"})
+	require.NoError(t, err)
+	assert.Equal(t, testutil.Target{}, target)
+	assert.Equal(t, "Docs", created.Title)
+
+	_, err = New("broken", Config{})
+	require.EqualError(t, err, "error creating broken target: missing templates")
+
+	_, err = New("unknown", Config{})
+	require.ErrorContains(t, err, "unknown target: unknown, registered targets: ")
+	require.ErrorContains(t, err, "broken, fake")
+
+	assert.PanicsWithValue(t, "target fake is already registered", func() {
+		Register("fake", func(Config) (messageflow.Target, error) { return testutil.Target{}, nil })
+	})
+}
@@ -0,0 +1,116 @@
+// Package server serves diagrams of a message flow schema over HTTP, rendering them on request.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/holydocs/messageflow/pkg/messageflow"
+)
+
+const svgExt = ".svg"
+
+// Handler serves diagrams of a loaded schema:
+//   - /context.svg - context diagram of all services
+//   - /service/{name}.svg - services communicating with the service
+//   - /channel/{name}.svg - services operating on the channel
+//   - /schema.json - the schema itself
+type Handler struct {
+	schema messageflow.Schema
+	target messageflow.Target
+	mux    *http.ServeMux
+}
+
+// NewHandler creates a new Handler rendering diagrams of the schema with the target.
+// Target must be safe for concurrent use, as requests are rendered in parallel.
+func NewHandler(schema messageflow.Schema, target messageflow.Target) *Handler {
+	h := &Handler{
+		schema: schema,
+		target: target,
+		mux:    http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("GET /context.svg", h.serveContext)
+	h.mux.HandleFunc("GET /service/{file...}", h.serveService)
+	h.mux.HandleFunc("GET /channel/{file...}", h.serveChannel)
+	h.mux.HandleFunc("GET /schema.json", h.serveSchema)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) serveContext(w http.ResponseWriter, r *http.Request) {
+	h.serveDiagram(w, r, messageflow.FormatOptions{
+		Mode: messageflow.FormatModeContextServices,
+	})
+}
+
+func (h *Handler) serveService(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), svgExt)
+	if !ok || !h.hasService(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.serveDiagram(w, r, messageflow.FormatOptions{
+		Mode:    messageflow.FormatModeServiceServices,
+		Service: name,
+	})
+}
+
+func (h *Handler) serveChannel(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), svgExt)
+	if !ok || !h.hasChannel(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.serveDiagram(w, r, messageflow.FormatOptions{
+		Mode:         messageflow.FormatModeChannelServices,
+		Channel:      name,
+		OmitPayloads: true,
+	})
+}
+
+func (h *Handler) serveSchema(w http.ResponseWriter, _ *http.Request) {
+	data, err := json.Marshal(h.schema)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error marshaling schema: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (h *Handler) serveDiagram(w http.ResponseWriter, r *http.Request, formatOpts messageflow.FormatOptions) {
+	formattedSchema, err := h.target.FormatSchema(r.Context(), h.schema, formatOpts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error formatting %s schema: %v", formatOpts.Mode, err), http.StatusInternalServerError)
+		return
+	}
+
+	diagram, err := h.target.RenderSchema(r.Context(), formattedSchema)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error rendering %s diagram: %v", formatOpts.Mode, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	_, _ = w.Write(diagram)
+}
+
+func (h *Handler) hasService(name string) bool {
+	return slices.Contains(h.schema.ServiceNames(), name)
+}
+
+func (h *Handler) hasChannel(name string) bool {
+	return slices.Contains(h.schema.ChannelNames(), name)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/holydocs/messageflow/pkg/internal/testutil"
+	"github.com/holydocs/messageflow/pkg/messageflow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	schema := messageflow.Schema{
+		Services: []messageflow.Service{
+			{
+				Name: "User Service",
+				Operation: []messageflow.Operation{
+					{
+						Action:  messageflow.ActionSend,
+						Channel: messageflow.Channel{Name: "user/created"},
+					},
+				},
+			},
+		},
+	}
+
+	server := httptest.NewServer(NewHandler(schema, testutil.Target{}))
+	t.Cleanup(server.Close)
+
+	get := func(path string) (int, string, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{path: "/context.svg", status: http.StatusOK, contentType: "image/svg+xml", body: "context_services:"},
+		{path: "/service/User%20Service.svg", status: http.StatusOK, contentType: "image/svg+xml", body: "service_services:User Service"},
+		{path: "/channel/user/created.svg", status: http.StatusOK, contentType: "image/svg+xml", body: "channel_services:user/created"},
+		{path: "/service/Unknown.svg", status: http.StatusNotFound},
+		{path: "/channel/user/created.png", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		status, contentType, body := get(tt.path)
+		assert.Equal(t, tt.status, status, tt.path)
+
+		if tt.status == http.StatusOK {
+			assert.Equal(t, tt.contentType, contentType, tt.path)
+			assert.Equal(t, tt.body, body, tt.path)
+		}
+	}
+
+	status, contentType, body := get("/schema.json")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "application/json", contentType)
+
+	var got messageflow.Schema
+	require.NoError(t, json.Unmarshal([]byte(body), &got))
+	assert.Equal(t, schema, got)
+}